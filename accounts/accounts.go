@@ -0,0 +1,132 @@
+// Package accounts keeps data claimed from anonymous guest sessions once a
+// user signs up, so nothing is lost when a guest becomes a member.
+package accounts
+
+import (
+	"coopcinema/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidClaim = errors.New("claim token is invalid")
+
+// Account is what a signed-in user has accumulated across guest sessions.
+type Account struct {
+	ID        string                `json:"id"`
+	GuestIDs  []string              `json:"guestIDs"`
+	Rooms     []string              `json:"rooms"`
+	Bookmarks []models.RoomBookmark `json:"bookmarks"`
+}
+
+// Store persists accounts as a JSON file.
+type Store struct {
+	path string
+
+	mu       sync.Mutex
+	accounts map[string]*Account
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, accounts: make(map[string]*Account)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.accounts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Merge folds a guest's rooms and bookmarks into an account. Claiming the
+// same guest twice is a no-op.
+func (s *Store) Merge(accountID, guestID string, rooms []string, bookmarks []models.RoomBookmark) (Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[accountID]
+	if !ok {
+		a = &Account{ID: accountID}
+		s.accounts[accountID] = a
+	}
+	for _, id := range a.GuestIDs {
+		if id == guestID {
+			return *a, nil
+		}
+	}
+
+	a.GuestIDs = append(a.GuestIDs, guestID)
+	for _, room := range rooms {
+		if !contains(a.Rooms, room) {
+			a.Rooms = append(a.Rooms, room)
+		}
+	}
+	a.Bookmarks = append(a.Bookmarks, bookmarks...)
+
+	data, err := json.MarshalIndent(s.accounts, "", "  ")
+	if err != nil {
+		return Account{}, err
+	}
+	if err := os.WriteFile(s.path, data, 0o600); err != nil {
+		return Account{}, err
+	}
+	return *a, nil
+}
+
+// Get returns an account by ID.
+func (s *Store) Get(accountID string) (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.accounts[accountID]
+	if !ok {
+		return Account{}, false
+	}
+	return *a, true
+}
+
+// ClaimToken proves possession of a guest ID when it is later claimed.
+func ClaimToken(secret []byte, guestID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(guestID)) + "." + sign(secret, "claim:", guestID)
+}
+
+// VerifyClaim returns the guest ID a claim token was issued for.
+func VerifyClaim(secret []byte, token string) (string, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidClaim
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return "", ErrInvalidClaim
+	}
+	guestID := string(raw)
+	if !hmac.Equal([]byte(sig), []byte(sign(secret, "claim:", guestID))) {
+		return "", ErrInvalidClaim
+	}
+	return guestID, nil
+}
+
+// sign MACs id for one purpose, so a token for one can't pass as another.
+func sign(secret []byte, purpose, id string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
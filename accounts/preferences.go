@@ -0,0 +1,86 @@
+package accounts
+
+import (
+	"coopcinema/models"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidDevice = errors.New("device token is invalid")
+
+// PreferenceStore persists preferences as a JSON file, keyed by
+// AccountKey or DeviceKey.
+type PreferenceStore struct {
+	path string
+
+	mu    sync.Mutex
+	prefs map[string]models.Preferences
+}
+
+func OpenPreferences(path string) (*PreferenceStore, error) {
+	s := &PreferenceStore{path: path, prefs: make(map[string]models.Preferences)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.prefs); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AccountKey and DeviceKey name whose preferences are meant.
+func AccountKey(accountID string) string { return "account:" + accountID }
+func DeviceKey(deviceID string) string   { return "device:" + deviceID }
+
+// Get returns the preferences stored under key.
+func (s *PreferenceStore) Get(key string) (models.Preferences, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.prefs[key]
+	return p, ok
+}
+
+// Put replaces the preferences stored under key.
+func (s *PreferenceStore) Put(key string, p models.Preferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prefs[key] = p
+	data, err := json.MarshalIndent(s.prefs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
+
+// DeviceToken identifies a browser across sessions, so guests keep their
+// preferences without an account.
+func DeviceToken(secret []byte, deviceID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(deviceID)) + "." + sign(secret, "device:", deviceID)
+}
+
+// VerifyDevice returns the device ID a device token was issued for.
+func VerifyDevice(secret []byte, token string) (string, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidDevice
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || len(raw) == 0 {
+		return "", ErrInvalidDevice
+	}
+	deviceID := string(raw)
+	if !hmac.Equal([]byte(sig), []byte(sign(secret, "device:", deviceID))) {
+		return "", ErrInvalidDevice
+	}
+	return deviceID, nil
+}
@@ -0,0 +1,43 @@
+// Package adapt classifies connection quality and decides how clients
+// should adapt, so the policy lives in one place on the server.
+package adapt
+
+import (
+	"coopcinema/models"
+	"time"
+)
+
+const (
+	Good     = "good"
+	Degraded = "degraded"
+	Poor     = "poor"
+)
+
+// Classify grades a connection from its round-trip time and how full its
+// send queue is.
+func Classify(rtt time.Duration, queued, capacity int) string {
+	fill := 0.0
+	if capacity > 0 {
+		fill = float64(queued) / float64(capacity)
+	}
+	switch {
+	case rtt > 800*time.Millisecond || fill > 0.5:
+		return Poor
+	case rtt > 250*time.Millisecond || fill > 0.1:
+		return Degraded
+	default:
+		return Good
+	}
+}
+
+// Hint returns what a client on a connection of the given quality should do.
+func Hint(quality string) *models.AdaptHint {
+	switch quality {
+	case Poor:
+		return &models.AdaptHint{DriftReports: false, MaxReactionsPerSec: 0.2, BufferTarget: 8}
+	case Degraded:
+		return &models.AdaptHint{DriftReports: true, MaxReactionsPerSec: 1, BufferTarget: 4}
+	default:
+		return &models.AdaptHint{DriftReports: true, MaxReactionsPerSec: 5, BufferTarget: 2}
+	}
+}
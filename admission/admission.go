@@ -0,0 +1,139 @@
+// Package admission shapes bursts of joins into a room. Joins within the
+// room's rate go straight through; the rest wait in a first-come queue and
+// are admitted as the rate allows, so a rush on a big public room doesn't
+// become an unbounded burst of registrations.
+package admission
+
+import (
+	"coopcinema/ratelimit"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrAbandoned is returned when a queued client stops accepting updates.
+var ErrAbandoned = errors.New("left the queue")
+
+// How often a waiting client is reminded of its place. The reminders also
+// show up dead connections, since the waiting client isn't being read.
+const updateEvery = 5 * time.Second
+
+type ticket struct {
+	ready    chan struct{}
+	position chan int // latest place in line, 1-based
+}
+
+type line struct {
+	waiting []*ticket
+}
+
+// Gate admits joins per room code.
+type Gate struct {
+	limiter *ratelimit.Limiter
+
+	mu    sync.Mutex
+	lines map[string]*line
+}
+
+// New admits up to burst joins at once per room, refilled at rate per
+// second.
+func New(rate, burst float64) *Gate {
+	return &Gate{limiter: ratelimit.New(rate, burst), lines: make(map[string]*line)}
+}
+
+// SetRate changes the rate and burst for every room, including joins
+// already queued.
+func (g *Gate) SetRate(rate, burst float64) {
+	g.limiter.SetRate(rate, burst)
+}
+
+// Wait returns once the client may join roomCode. While queued, update is
+// called with the client's place in line; if it fails the client is dropped
+// from the queue and its error returned.
+func (g *Gate) Wait(roomCode string, update func(position int) error) error {
+	g.mu.Lock()
+	l, queued := g.lines[roomCode]
+	if !queued && g.limiter.Allow(roomCode) {
+		g.mu.Unlock()
+		return nil
+	}
+
+	t := &ticket{ready: make(chan struct{}), position: make(chan int, 1)}
+	if !queued {
+		l = &line{}
+		g.lines[roomCode] = l
+		go g.dispatch(roomCode, l)
+	}
+	l.waiting = append(l.waiting, t)
+	position := len(l.waiting)
+	g.mu.Unlock()
+
+	remind := time.NewTicker(updateEvery)
+	defer remind.Stop()
+	for {
+		if err := update(position); err != nil {
+			g.leave(roomCode, t)
+			return err
+		}
+		select {
+		case <-t.ready:
+			return nil
+		case position = <-t.position:
+		case <-remind.C:
+		}
+	}
+}
+
+// dispatch admits the head of a room's line whenever the rate allows and
+// tells everyone behind their new place. It exits when the line empties.
+func (g *Gate) dispatch(roomCode string, l *line) {
+	for {
+		g.mu.Lock()
+		if len(l.waiting) == 0 {
+			delete(g.lines, roomCode)
+			g.mu.Unlock()
+			return
+		}
+		ok, wait := g.limiter.Reserve(roomCode)
+		if ok {
+			close(l.waiting[0].ready)
+			l.waiting = l.waiting[1:]
+			for i, t := range l.waiting {
+				setPosition(t, i+1)
+			}
+		}
+		g.mu.Unlock()
+
+		if !ok {
+			time.Sleep(wait)
+		}
+	}
+}
+
+func (g *Gate) leave(roomCode string, t *ticket) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	l, ok := g.lines[roomCode]
+	if !ok {
+		return
+	}
+	for i, w := range l.waiting {
+		if w == t {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			break
+		}
+	}
+	for i, w := range l.waiting {
+		setPosition(w, i+1)
+	}
+}
+
+// setPosition replaces any place update the waiter hasn't read yet.
+func setPosition(t *ticket, position int) {
+	select {
+	case <-t.position:
+	default:
+	}
+	t.position <- position
+}
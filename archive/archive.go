@@ -0,0 +1,201 @@
+// Package archive compresses closed rooms into the blob store so their
+// history survives without keeping them in memory.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"coopcinema/blobstore"
+	"coopcinema/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry describes one archived room.
+type Entry struct {
+	RoomCode string    `json:"roomCode"`
+	ClosedAt time.Time `json:"closedAt"`
+	Key      string    `json:"key"`
+	Size     int       `json:"size"`
+}
+
+// Recap summarises a session.
+type Recap struct {
+	StartedAt  time.Time `json:"startedAt,omitempty"`
+	ClosedAt   time.Time `json:"closedAt"`
+	Viewers    int       `json:"viewers"`
+	MediaLoads int       `json:"mediaLoads"`
+	Reactions  int       `json:"reactions"`
+	Bookmarks  int       `json:"bookmarks"`
+}
+
+// Document is the archived content, stored as gzipped JSON.
+type Document struct {
+	RoomCode  string                 `json:"roomCode"`
+	Recap     Recap                  `json:"recap"`
+	Timeline  []models.TimelineEntry `json:"timeline"`
+	Bookmarks []models.Bookmark      `json:"bookmarks"`
+	Reactions map[int]int            `json:"reactions"`
+	ByEmoji   map[string]int         `json:"reactionsByEmoji,omitempty"`
+	Poll      *models.Poll           `json:"poll,omitempty"`
+}
+
+// Archiver writes room archives and enforces retention.
+type Archiver struct {
+	store     *blobstore.Store
+	indexPath string
+	retention time.Duration
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func New(store *blobstore.Store, indexPath string, retention time.Duration) (*Archiver, error) {
+	a := &Archiver{store: store, indexPath: indexPath, retention: retention}
+	data, err := os.ReadFile(indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &a.entries); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Archive stores a closed room. Rooms that never saw any activity are
+// skipped.
+func (a *Archiver) Archive(room *models.Room) error {
+	if len(room.Timeline) == 0 {
+		return nil
+	}
+
+	doc := Document{
+		RoomCode:  room.Code,
+		Timeline:  room.Timeline,
+		Bookmarks: room.Bookmarks,
+		Reactions: room.Reactions,
+		ByEmoji:   room.ReactionCounts,
+		Poll:      room.Poll,
+		Recap:     recap(room),
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(doc); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	key, err := a.store.Put(buf.Bytes(), ".json.gz")
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, Entry{
+		RoomCode: room.Code,
+		ClosedAt: doc.Recap.ClosedAt,
+		Key:      key,
+		Size:     buf.Len(),
+	})
+	return a.saveLocked()
+}
+
+func recap(room *models.Room) Recap {
+	r := Recap{
+		ClosedAt:  time.Now().UTC(),
+		Bookmarks: len(room.Bookmarks),
+	}
+	if len(room.Timeline) > 0 {
+		r.StartedAt = room.Timeline[0].At
+	}
+	viewers := make(map[string]bool)
+	for _, e := range room.Timeline {
+		switch e.Kind {
+		case "join":
+			viewers[e.UserID] = true
+		case "media":
+			r.MediaLoads++
+		}
+	}
+	r.Viewers = len(viewers)
+	for _, n := range room.Reactions {
+		r.Reactions += n
+	}
+	return r
+}
+
+// List returns archives newest first, optionally for one room code.
+func (a *Archiver) List(roomCode string) []Entry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := []Entry{}
+	for _, e := range a.entries {
+		if roomCode == "" || e.RoomCode == roomCode {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ClosedAt.After(out[j].ClosedAt) })
+	return out
+}
+
+// Has reports whether a blob key belongs to an archive.
+func (a *Archiver) Has(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range a.entries {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// RunRetention deletes archives older than the retention period every
+// interval.
+func (a *Archiver) RunRetention(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		a.mu.Lock()
+		kept := a.entries[:0]
+		removed := 0
+		for _, e := range a.entries {
+			if now.Sub(e.ClosedAt) > a.retention {
+				a.store.Delete(e.Key)
+				removed++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		a.entries = kept
+		if removed > 0 {
+			if err := a.saveLocked(); err != nil {
+				log.Printf("archive index: %v", err)
+			}
+			log.Printf("🗄️  Removed %d expired archives", removed)
+		}
+		a.mu.Unlock()
+	}
+}
+
+func (a *Archiver) saveLocked() error {
+	data, err := json.MarshalIndent(a.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(a.indexPath, data, 0o644)
+}
@@ -0,0 +1,182 @@
+// Package bans keeps the server-wide ban list. Lookups go through a bloom
+// filter and an LRU cache so the check on every /ws upgrade rarely reaches
+// the backing store.
+package bans
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Key prefixes for the kinds of thing that can be banned.
+const (
+	KindIP   = "ip"
+	KindUser = "id"
+)
+
+// Key builds a ban-list entry such as "ip:203.0.113.7".
+func Key(kind, value string) string {
+	return kind + ":" + value
+}
+
+// Store is where bans are kept. Contains may be slow.
+type Store interface {
+	Contains(key string) (bool, error)
+	Add(key string) error
+	Keys() ([]string, error)
+}
+
+// FileStore keeps one ban key per line in a text file, and the whole set in
+// memory: the file is read once, when the store is made, and only appended
+// to after that.
+type FileStore struct {
+	path string
+
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// NewFileStore reads the ban list at path, if there is one.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, keys: make(map[string]bool)}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			s.keys[line] = true
+		}
+	}
+	return s, scanner.Err()
+}
+
+func (s *FileStore) Contains(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[key], nil
+}
+
+func (s *FileStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[key] {
+		return nil
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(key + "\n"); err != nil {
+		return err
+	}
+	s.keys[key] = true
+	return nil
+}
+
+func (s *FileStore) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// List answers ban lookups in front of a Store.
+type List struct {
+	store Store
+
+	mu     sync.Mutex
+	filter *bloom
+	keys   int // added to filter
+	cache  *lru
+}
+
+// Load builds the bloom filter from every key in the store.
+func Load(store Store, cacheSize int) (*List, error) {
+	keys, err := store.Keys()
+	if err != nil {
+		return nil, err
+	}
+	l := &List{store: store, cache: newLRU(cacheSize)}
+	l.rebuild(keys)
+	return l, nil
+}
+
+// rebuild makes a new filter with room for as many keys again. Callers hold
+// l.mu, or have yet to share l.
+func (l *List) rebuild(keys []string) {
+	l.filter = newBloom(len(keys)*2, 0.01)
+	for _, k := range keys {
+		l.filter.add(k)
+	}
+	l.keys = len(keys)
+}
+
+// Banned reports whether any of the keys is banned. A store error is
+// treated as not banned so an outage doesn't lock everyone out.
+func (l *List) Banned(keys ...string) bool {
+	for _, key := range keys {
+		if l.banned(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *List) banned(key string) bool {
+	l.mu.Lock()
+	if !l.filter.mayContain(key) {
+		l.mu.Unlock()
+		return false
+	}
+	if banned, ok := l.cache.get(key); ok {
+		l.mu.Unlock()
+		return banned
+	}
+	l.mu.Unlock()
+
+	banned, err := l.store.Contains(key)
+	if err != nil {
+		return false
+	}
+	l.mu.Lock()
+	l.cache.put(key, banned)
+	l.mu.Unlock()
+	return banned
+}
+
+// Add bans a key. A filter holding as many keys as it was sized for is
+// rebuilt twice as big, so its false-positive rate stays put as bans pile
+// up.
+func (l *List) Add(key string) error {
+	if err := l.store.Add(key); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache.put(key, true)
+	l.filter.add(key)
+	if l.keys++; l.keys > l.filter.n {
+		if keys, err := l.store.Keys(); err == nil {
+			l.rebuild(keys)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package bans
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloom is a fixed-size bloom filter. A miss means the key is definitely not
+// in the set; a hit still has to be confirmed.
+type bloom struct {
+	bits []uint64
+	m    uint64 // number of bits
+	k    uint64 // hashes per key
+	n    int    // keys it was sized for
+}
+
+// newBloom sizes a filter for n keys at false-positive rate p.
+func newBloom(n int, p float64) *bloom {
+	n = max(n, 1024)
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloom{bits: make([]uint64, (m+63)/64), m: m, k: k, n: n}
+}
+
+func (b *bloom) add(key string) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *bloom) mayContain(key string) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes derives the two base hashes for double hashing.
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	h2 := h.Sum64() | 1
+	return h1, h2
+}
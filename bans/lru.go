@@ -0,0 +1,42 @@
+package bans
+
+import "container/list"
+
+// lru caches recent lookup results that got past the bloom filter.
+type lru struct {
+	size  int
+	order *list.List // front is most recent
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key    string
+	banned bool
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lru) get(key string) (banned, ok bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return false, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).banned, true
+}
+
+func (c *lru) put(key string, banned bool) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry).banned = banned
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, banned: banned})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,62 @@
+package bans
+
+import (
+	"coopcinema/memstore"
+	"slices"
+	"sync"
+)
+
+// MemoryStore keeps bans in memory, in the "bans" section of a memstore,
+// for small deployments that would rather not append to a text file on
+// every ban. Bans added since the last snapshot are lost if the process
+// dies.
+type MemoryStore struct {
+	store *memstore.Store
+
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// NewMemoryStore restores the bans store holds, if any.
+func NewMemoryStore(store *memstore.Store) (*MemoryStore, error) {
+	var keys []string
+	if _, err := store.Get("bans", &keys); err != nil {
+		return nil, err
+	}
+	s := &MemoryStore{store: store, keys: make(map[string]bool, len(keys))}
+	for _, k := range keys {
+		s.keys[k] = true
+	}
+	return s, nil
+}
+
+func (s *MemoryStore) Contains(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[key], nil
+}
+
+func (s *MemoryStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[key] {
+		return nil
+	}
+	s.keys[key] = true
+	return s.store.Put("bans", s.sorted())
+}
+
+func (s *MemoryStore) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted(), nil
+}
+
+func (s *MemoryStore) sorted() []string {
+	keys := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
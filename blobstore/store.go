@@ -0,0 +1,92 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps content-addressed blobs in a directory on disk. Identical
+// uploads share one file, so the store counts who holds each blob and only
+// removes the file when the last of them lets go.
+type Store struct {
+	dir string
+
+	mu   sync.Mutex
+	refs map[string]int // key -> references held since startup
+}
+
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, refs: make(map[string]int)}, nil
+}
+
+// Put writes data and returns its key, the SHA-256 of the content plus ext.
+// The caller holds a reference to the blob until it calls Release.
+func (s *Store) Put(data []byte, ext string) (string, error) {
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:]) + ext
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(s.dir, key)
+	if _, err := os.Stat(path); err != nil {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return "", err
+		}
+	}
+	s.refs[key]++
+	return key, nil
+}
+
+// Release drops a reference taken by Put, removing the blob once nothing
+// holds it. Releasing a missing blob is not an error.
+func (s *Store) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refs[key] > 1 {
+		s.refs[key]--
+		return nil
+	}
+	delete(s.refs, key)
+	return s.remove(key)
+}
+
+// Path returns the file path for a key, rejecting anything that is not a
+// plain file name inside the store.
+func (s *Store) Path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, ".") {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(s.dir, key)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// Delete removes a blob whoever holds it. Deleting a missing blob is not an
+// error.
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.refs, key)
+	return s.remove(key)
+}
+
+// remove deletes a blob's file. Callers hold s.mu.
+func (s *Store) remove(key string) error {
+	path, err := s.Path(key)
+	if err != nil {
+		return nil
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,34 @@
+package blobstore
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestShared checks a blob two rooms stored stays until both let it go.
+func TestShared(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.Put([]byte("party parrot"), ".gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Put([]byte("party parrot"), ".gif")
+	if err != nil || b != a {
+		t.Fatalf("same image stored as %q and %q, %v", a, b, err)
+	}
+
+	s.Release(a)
+	if _, err := s.Path(a); err != nil {
+		t.Fatalf("gone while still held: %v", err)
+	}
+	s.Release(b)
+	if _, err := s.Path(a); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("still there once released: %v", err)
+	}
+	if err := s.Release(a); err != nil {
+		t.Errorf("releasing again: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Package canary probes the real user path end to end: it joins a hidden
+// room with two WebSocket clients, plays a short scripted exchange and
+// records how long each step took to reach the other side.
+package canary
+
+import (
+	"bytes"
+	"coopcinema/hub"
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of one probe.
+type Result struct {
+	At      time.Time          `json:"at"`
+	OK      bool               `json:"ok"`
+	Error   string             `json:"error,omitempty"`
+	Steps   map[string]float64 `json:"steps,omitempty"` // step -> milliseconds
+	TotalMs float64            `json:"totalMs"`
+}
+
+// Status is the latest probe plus running counts.
+type Status struct {
+	Last                *Result `json:"last,omitempty"`
+	Runs                int64   `json:"runs"`
+	Failures            int64   `json:"failures"`
+	ConsecutiveFailures int     `json:"consecutiveFailures"`
+}
+
+// Canary runs probes against a server's own /ws endpoint.
+type Canary struct {
+	WSURL    string        // e.g. ws://127.0.0.1:8080/ws
+	Timeout  time.Duration // per step
+	AlertURL string        // optional webhook POSTed when probes start failing or slow down
+	SlowStep time.Duration // a step slower than this counts as degraded
+	// Token signs the probe clients' sign-in tokens when /ws requires them
+	Token func(userID, name string) (string, error)
+
+	mu     sync.Mutex
+	status Status
+	alerts bool // an alert is outstanding
+}
+
+var alertClient = &http.Client{Timeout: 5 * time.Second}
+
+// step is one scripted message from the first client and the type the
+// second client must see.
+type step struct {
+	name string
+	msg  models.Message
+}
+
+var script = []step{
+	{"play", models.Message{Type: "play", Timestamp: 1}},
+	{"seek", models.Message{Type: "seek", Timestamp: 42}},
+	{"chat", models.Message{Type: "chat", Content: "canary", UserName: "canary-a"}},
+}
+
+// Run probes every interval, forever.
+func (c *Canary) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.record(c.Probe())
+	}
+}
+
+// Status returns the latest result and counts.
+func (c *Canary) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Probe runs the scripted exchange once.
+func (c *Canary) Probe() Result {
+	start := time.Now()
+	res := Result{At: start, Steps: make(map[string]float64)}
+
+	room := hub.HiddenRoomPrefix + randomID()
+	a, err := c.dial(room, "canary-a")
+	if err != nil {
+		res.Error = "join: " + err.Error()
+		return res
+	}
+	defer a.Close()
+	b, err := c.dial(room, "canary-b")
+	if err != nil {
+		res.Error = "join: " + err.Error()
+		return res
+	}
+	defer b.Close()
+	// The roster update means the second client is registered in the room
+	if err := await(b, "userList", time.Now().Add(c.Timeout)); err != nil {
+		res.Error = "join: " + err.Error()
+		return res
+	}
+	res.Steps["join"] = ms(time.Since(start))
+
+	for _, s := range script {
+		sent := time.Now()
+		s.msg.SentAt = float64(sent.UnixMilli())
+		a.SetWriteDeadline(sent.Add(c.Timeout))
+		if err := a.WriteJSON(s.msg); err != nil {
+			res.Error = s.name + ": " + err.Error()
+			return res
+		}
+		if err := await(b, s.msg.Type, sent.Add(c.Timeout)); err != nil {
+			res.Error = s.name + ": " + err.Error()
+			return res
+		}
+		res.Steps[s.name] = ms(time.Since(sent))
+	}
+
+	res.OK = true
+	res.TotalMs = ms(time.Since(start))
+	return res
+}
+
+func (c *Canary) dial(room, name string) (*websocket.Conn, error) {
+	// Without sign-in tokens the server picks the IDs
+	q := url.Values{"room": {room}, "name": {name}}
+	if c.Token != nil {
+		token, err := c.Token(name+"-"+randomID(), name)
+		if err != nil {
+			return nil, err
+		}
+		q.Set("token", token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(c.WSURL+"?"+q.Encode(), nil)
+	return conn, err
+}
+
+// await reads until a message of the wanted type arrives, skipping roster
+// updates and other server chatter.
+func await(conn *websocket.Conn, msgType string, deadline time.Time) error {
+	conn.SetReadDeadline(deadline)
+	for {
+		var msg models.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		if msg.Type == msgType {
+			return nil
+		}
+	}
+}
+
+func (c *Canary) record(res Result) {
+	metrics.RecordCanary(res.OK, time.Duration(res.TotalMs*float64(time.Millisecond)))
+
+	degraded := !res.OK
+	for name, stepMs := range res.Steps {
+		if c.SlowStep > 0 && stepMs > ms(c.SlowStep) {
+			degraded = true
+			if res.OK {
+				res.Error = fmt.Sprintf("%s took %.0fms", name, stepMs)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.status.Last = &res
+	c.status.Runs++
+	if res.OK {
+		c.status.ConsecutiveFailures = 0
+	} else {
+		c.status.Failures++
+		c.status.ConsecutiveFailures++
+	}
+	// Alert on the transition into and out of a degraded state
+	changed := degraded != c.alerts
+	c.alerts = degraded
+	c.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if degraded {
+		log.Printf("🐤 Canary degraded: %s", res.Error)
+	} else {
+		log.Printf("🐤 Canary recovered (%.0fms end to end)", res.TotalMs)
+	}
+	if c.AlertURL != "" {
+		go c.alert(degraded, res)
+	}
+}
+
+func (c *Canary) alert(degraded bool, res Result) {
+	event := "recovered"
+	if degraded {
+		event = "degraded"
+	}
+	body, _ := json.Marshal(map[string]interface{}{"event": event, "result": res})
+	resp, err := alertClient.Post(c.AlertURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("canary alert webhook failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func randomID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
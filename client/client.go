@@ -0,0 +1,449 @@
+// Package client speaks the server's WebSocket protocol for Go programs:
+// headless bots, bridges to local players and test harnesses. It joins a
+// room, keeps the connection up across drops, decodes messages into
+// models.Message and reports playback and media changes through callbacks.
+//
+//	c := client.New(client.Options{URL: "ws://localhost:8080/ws", Room: "f00dcafe", Name: "bot"})
+//	c.OnPlayback(func(p client.Playback) { log.Printf("%s at %.1fs", p.Type, p.Position) })
+//	c.On("chat", func(msg models.Message) { ... })
+//	err := c.Run(ctx)
+package client
+
+import (
+	"context"
+	"coopcinema/codec"
+	"coopcinema/models"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Options say where to connect and as whom.
+type Options struct {
+	URL  string // the server's WebSocket endpoint, e.g. wss://example.com/ws
+	Room string
+	Name string
+	// Claim is the claim token of an earlier session, to join as the same
+	// guest; the server picks a new ID if empty. Either way the ID is kept
+	// across reconnects.
+	Claim    string
+	Token    string // sign-in token, for servers that require one
+	Password string // for password rooms
+	// MessagePack asks for binary frames instead of JSON
+	MessagePack bool
+	// Backoff is the wait before the first reconnect, doubling up to
+	// MaxBackoff; 1s and 30s if zero
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// WriteTimeout bounds each write; 10s if zero
+	WriteTimeout time.Duration
+}
+
+// Errors that end Run instead of being retried.
+var (
+	ErrRoomClosed = errors.New("client: the room was closed")
+	ErrRefused    = errors.New("client: the server refused the connection")
+)
+
+var (
+	// ErrNotJoined is returned by Send between connections.
+	ErrNotJoined = errors.New("client: not connected")
+
+	errServerClose = errors.New("client: connection closed by server")
+)
+
+// Playback is a play, pause, seek or state report, or the room's state on
+// joining (Type "syncState").
+type Playback struct {
+	Type     string
+	Position float64   // seconds
+	Playing  bool      // whether the room is playing after this
+	UserID   string    // who sent it; empty from the server
+	Slot     string    // secondary media slot, "" for the main player
+	ServerAt time.Time // when the server relayed it, zero if unknown
+}
+
+// Media is what the room loaded: a youtube, vimeo, twitch, dailymotion,
+// directurl or file message, or the media in the room's state on joining.
+type Media struct {
+	Type   string // the message type, or the source type for syncState
+	URL    string
+	UserID string
+	Slot   string
+}
+
+// Client is one connection to a room, re-established as needed while Run
+// is running. Handlers run on the reading goroutine, one at a time.
+type Client struct {
+	opts Options
+	enc  codec.Codec
+
+	mu         sync.Mutex
+	conn       *websocket.Conn
+	room       string // follows code rotations and breakout moves
+	id         string // who the server says we are
+	claim      string // keeps id on the next connection
+	version    int    // protocol version the server agreed to
+	playing    bool
+	handlers   map[string][]func(models.Message)
+	playback   []func(Playback)
+	media      []func(Media)
+	connect    []func()
+	disconnect []func(error)
+
+	writeMu sync.Mutex
+}
+
+// New returns a client for opts. Nothing happens until Run.
+func New(opts Options) *Client {
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	opts.MaxBackoff = max(opts.MaxBackoff, opts.Backoff)
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	enc := codec.JSON
+	if opts.MessagePack {
+		enc = codec.MessagePack
+	}
+	return &Client{
+		opts:     opts,
+		enc:      enc,
+		room:     opts.Room,
+		claim:    opts.Claim,
+		handlers: make(map[string][]func(models.Message)),
+	}
+}
+
+// On calls fn with every message of msgType; "*" matches every message.
+func (c *Client) On(msgType string, fn func(models.Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[msgType] = append(c.handlers[msgType], fn)
+}
+
+// OnPlayback calls fn for every playback change and the state on joining.
+func (c *Client) OnPlayback(fn func(Playback)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.playback = append(c.playback, fn)
+}
+
+// OnMedia calls fn when media is loaded and with the room's media on
+// joining.
+func (c *Client) OnMedia(fn func(Media)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.media = append(c.media, fn)
+}
+
+// OnConnect calls fn after every successful join, reconnects included.
+func (c *Client) OnConnect(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connect = append(c.connect, fn)
+}
+
+// OnDisconnect calls fn with the error that ended each connection.
+func (c *Client) OnDisconnect(fn func(error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disconnect = append(c.disconnect, fn)
+}
+
+// ID is the user ID the server gave the client, "" before the first join.
+func (c *Client) ID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id
+}
+
+// Claim is the client's claim token: passed as Options.Claim, it lets a
+// later client join as the same guest. "" for signed-in clients.
+func (c *Client) Claim() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.claim
+}
+
+// Room is the room's current code.
+func (c *Client) Room() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.room
+}
+
+// Version is the protocol version the server agreed to, 0 before the first
+// join.
+func (c *Client) Version() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// Run connects and keeps reconnecting, with backoff, until ctx is done or
+// the server turns the client away for good: a refused handshake, a closed
+// room, a kick or ban, or a missing password. It returns why it stopped.
+func (c *Client) Run(ctx context.Context) error {
+	backoff := c.opts.Backoff
+	for {
+		conn, err := c.dial(ctx)
+		if err == nil {
+			backoff = c.opts.Backoff
+			err = c.serve(ctx, conn)
+			c.emitDisconnect(err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if permanent(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.opts.MaxBackoff)
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	u, err := url.Parse(c.opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("room", c.Room())
+	q.Set("name", c.opts.Name)
+	if claim := c.Claim(); claim != "" {
+		q.Set("claim", claim)
+	}
+	q.Set("v", strconv.Itoa(models.ProtocolVersion))
+	if c.opts.Token != "" {
+		q.Set("token", c.opts.Token)
+	}
+	if c.opts.Password != "" {
+		q.Set("password", c.opts.Password)
+	}
+	u.RawQuery = q.Encode()
+
+	dialer := websocket.Dialer{HandshakeTimeout: c.opts.WriteTimeout, Subprotocols: []string{c.enc.Name()}}
+	conn, resp, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s", ErrRefused, resp.Status)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// serve reads one connection until it drops.
+func (c *Client) serve(ctx context.Context, conn *websocket.Conn) error {
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return closeError(err)
+		}
+		var msg models.Message
+		if kind == websocket.BinaryMessage {
+			err = codec.MessagePack.Unmarshal(data, &msg)
+		} else {
+			err = codec.JSON.Unmarshal(data, &msg)
+		}
+		// A payload this package doesn't know yet still leaves the flat
+		// fields readable
+		var badPayload *models.PayloadError
+		if err != nil && !errors.As(err, &badPayload) {
+			continue
+		}
+		if err := c.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle tracks what the client needs to know itself and runs the
+// callbacks.
+func (c *Client) handle(msg models.Message) error {
+	c.mu.Lock()
+	switch msg.Type {
+	case "hello":
+		if p, ok := msg.Payload.(*models.HelloPayload); ok {
+			c.version = p.Version
+		} else {
+			c.version = 1
+		}
+		c.id = msg.UserID
+	case "claimToken":
+		c.claim = msg.Content
+	case "codeRotated", "roomTransfer":
+		if msg.RoomCode != "" {
+			c.room = msg.RoomCode
+		}
+	case "play", "syncState":
+		if msg.Slot == "" {
+			c.playing = msg.Type == "play" || msg.Playing
+		}
+	case "pause":
+		if msg.Slot == "" {
+			c.playing = false
+		}
+	case "state":
+		if msg.Slot == "" {
+			c.playing = msg.Playing
+		}
+	}
+	playing := c.playing
+	handlers := append(append([]func(models.Message){}, c.handlers[msg.Type]...), c.handlers["*"]...)
+	playback, media, connect := c.playback, c.media, c.connect
+	c.mu.Unlock()
+
+	if msg.Type == "hello" {
+		for _, fn := range connect {
+			fn()
+		}
+	}
+	for _, fn := range handlers {
+		fn(msg)
+	}
+
+	switch msg.Type {
+	case "play", "pause", "seek", "state", "syncState":
+		if msg.Type == "syncState" && msg.SourceType == "none" {
+			break
+		}
+		p := Playback{Type: msg.Type, Position: msg.Timestamp, Playing: playing, UserID: msg.UserID, Slot: msg.Slot}
+		if msg.Slot != "" {
+			p.Playing = msg.Type == "play" || (msg.Type != "pause" && msg.Playing)
+		}
+		if msg.ServerAt > 0 {
+			p.ServerAt = time.UnixMilli(msg.ServerAt)
+		}
+		for _, fn := range playback {
+			fn(p)
+		}
+	}
+	switch msg.Type {
+	case "youtube", "vimeo", "twitch", "dailymotion", "directurl", "file", "syncState":
+		if msg.URL == "" {
+			break
+		}
+		m := Media{Type: msg.Type, URL: msg.URL, UserID: msg.UserID, Slot: msg.Slot}
+		if msg.Type == "syncState" {
+			m.Type = msg.SourceType
+		}
+		for _, fn := range media {
+			fn(m)
+		}
+	}
+
+	if msg.Type == "roomClosed" {
+		return ErrRoomClosed
+	}
+	return nil
+}
+
+func (c *Client) emitDisconnect(err error) {
+	c.mu.Lock()
+	disconnect := c.disconnect
+	c.mu.Unlock()
+	for _, fn := range disconnect {
+		fn(err)
+	}
+}
+
+// Send writes msg to the room now. It fails with ErrNotJoined between
+// connections; messages aren't queued for the next one.
+func (c *Client) Send(msg models.Message) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotJoined
+	}
+
+	data, err := c.enc.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	kind := websocket.TextMessage
+	if c.enc.Binary() {
+		kind = websocket.BinaryMessage
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout))
+	return conn.WriteMessage(kind, data)
+}
+
+// Play starts the room's playback at position seconds.
+func (c *Client) Play(position float64) error { return c.sendPlayback("play", position) }
+
+// Pause pauses the room at position seconds.
+func (c *Client) Pause(position float64) error { return c.sendPlayback("pause", position) }
+
+// Seek moves the room to position seconds.
+func (c *Client) Seek(position float64) error { return c.sendPlayback("seek", position) }
+
+func (c *Client) sendPlayback(msgType string, position float64) error {
+	return c.Send(models.Message{Type: msgType, Timestamp: position, SentAt: float64(time.Now().UnixMilli())})
+}
+
+// Chat posts text to the room's chat.
+func (c *Client) Chat(text string) error {
+	return c.Send(models.Message{Type: "chat", Content: text})
+}
+
+// Load asks the server to load media: sourceType is youtube, url or file,
+// as with setMedia.
+func (c *Client) Load(sourceType, mediaURL string) error {
+	return c.Send(models.Message{Type: "setMedia", SourceType: sourceType, URL: mediaURL})
+}
+
+// closeError turns how the server closed the connection into Run's view
+// of it.
+func closeError(err error) error {
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) {
+		return err
+	}
+	switch ce.Code {
+	case websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseServiceRestart,
+		websocket.CloseTryAgainLater, websocket.CloseAbnormalClosure:
+		return fmt.Errorf("%w: %d %s", errServerClose, ce.Code, ce.Text)
+	}
+	return fmt.Errorf("%w: %d %s", ErrRefused, ce.Code, ce.Text)
+}
+
+// permanent reports whether retrying err is pointless.
+func permanent(err error) bool {
+	return errors.Is(err, ErrRefused) || errors.Is(err, ErrRoomClosed)
+}
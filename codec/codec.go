@@ -0,0 +1,81 @@
+// Package codec holds the wire encodings a WebSocket connection can
+// negotiate through its subprotocol: JSON, the default, and MessagePack.
+// Text frames are always JSON and binary frames always MessagePack, so a
+// client can tell them apart by frame type alone.
+package codec
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"sync"
+)
+
+// Codec encodes messages for one wire format.
+type Codec interface {
+	Name() string // also the WebSocket subprotocol that selects it
+	Binary() bool // sent as binary rather than text frames
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSON        Codec = jsonCodec{}
+	MessagePack Codec = messagePack{}
+)
+
+// Subprotocols lists the codecs by subprotocol name, for the WebSocket
+// upgrader. Clients that ask for none of them get JSON.
+var Subprotocols = []string{MessagePack.Name(), JSON.Name()}
+
+// ForSubprotocol returns the codec a negotiated subprotocol selects.
+func ForSubprotocol(name string) Codec {
+	if name == MessagePack.Name() {
+		return MessagePack
+	}
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Binary() bool { return false }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// Shared holds one broadcast's frames: the first connection to write it in
+// a given form encodes and frames it, and every other recipient writes the
+// same prepared frame.
+type Shared struct {
+	mu     sync.Mutex
+	frames map[string]sharedFrame
+}
+
+type sharedFrame struct {
+	frame *websocket.PreparedMessage
+	data  []byte
+	err   error
+}
+
+func NewShared() *Shared {
+	return &Shared{frames: make(map[string]sharedFrame)}
+}
+
+// Prepare returns the frame stored under key and the encoded message it
+// carries, encoding it and framing it as a message of kind the first time.
+func (s *Shared) Prepare(key string, kind int, encode func() ([]byte, error)) (*websocket.PreparedMessage, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.frames[key]; ok {
+		return f.frame, f.data, f.err
+	}
+	var f sharedFrame
+	f.data, f.err = encode()
+	if f.err == nil {
+		f.frame, f.err = websocket.NewPreparedMessage(kind, f.data)
+	}
+	s.frames[key] = f
+	return f.frame, f.data, f.err
+}
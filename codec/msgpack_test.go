@@ -0,0 +1,267 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Label string `json:"label"`
+}
+
+type Embedded struct {
+	Flat int `json:"flat"`
+}
+
+// sample looks like a protocol message: tagged, omitempty and skipped
+// fields, an embedded struct, pointers, raw JSON and a time.
+type sample struct {
+	Embedded
+	Type    string            `json:"type"`
+	Count   int               `json:"count,omitempty"`
+	Small   int8              `json:"small"`
+	Big     uint64            `json:"big"`
+	Ratio   float32           `json:"ratio"`
+	Exact   float64           `json:"exact"`
+	On      bool              `json:"on"`
+	Data    []byte            `json:"data,omitempty"`
+	List    []string          `json:"list"`
+	Nested  *inner            `json:"nested,omitempty"`
+	Missing *inner            `json:"missing"`
+	Tags    map[string]int    `json:"tags,omitempty"`
+	Any     any               `json:"any"`
+	Raw     json.RawMessage   `json:"raw,omitempty"`
+	At      time.Time         `json:"at"`
+	Extra   map[string]string `json:"-"`
+	private int
+}
+
+// full is a sample with every field set.
+func full() sample {
+	return sample{
+		Embedded: Embedded{Flat: 9},
+		Type:     "chat",
+		Count:    3,
+		Small:    -5,
+		Big:      1 << 50,
+		Ratio:    0.5,
+		Exact:    1.0 / 3,
+		On:       true,
+		Data:     []byte("bytes"),
+		List:     []string{"a", "b"},
+		Nested:   &inner{Label: "in"},
+		Tags:     map[string]int{"x": 1},
+		Any:      []any{"y", 2.0},
+		Raw:      json.RawMessage(`{"kind":"offer","n":[1,2]}`),
+		At:       time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		Extra:    map[string]string{"not": "sent"},
+		private:  1,
+	}
+}
+
+// samples covers each MessagePack form the encoder picks, at the edges of
+// their ranges.
+func samples() []any {
+	vs := []any{
+		nil, true, false, "", "x",
+		0, 127, 128, 255, 256, 65535, 65536, math.MaxUint32, math.MaxUint32 + 1,
+		-1, -32, -33, -128, -129, -32768, -32769, math.MinInt32, math.MinInt32 - 1,
+		uint8(200), uint16(60000), uint64(1 << 40),
+		float32(1.5), 3.25, -0.0,
+		strings.Repeat("a", 31), strings.Repeat("b", 32), strings.Repeat("c", 255),
+		strings.Repeat("d", 256), strings.Repeat("e", 65535), strings.Repeat("f", 65536),
+		"héllo ✓",
+		[]byte{}, []byte{1, 2, 3}, bytes.Repeat([]byte{7}, 300), bytes.Repeat([]byte{8}, 70000),
+		[]int{}, make([]int, 15), make([]int, 16), make([]int, 70000),
+		[3]string{"a", "b", "c"},
+		map[string]int{}, map[string]bool{"a": true},
+		map[int]string{1: "one", -2: "minus two"},
+		map[string]any{"nested": map[string]any{"deeper": []any{1.5, "x", nil}}},
+		full(),
+		sample{Type: "empty"},
+		&sample{Type: "pointer"},
+	}
+	many := make(map[string]int, 20)
+	for i := range 20 {
+		many[strings.Repeat("k", i+1)] = i
+	}
+	return append(vs, many)
+}
+
+// asJSON decodes JSON into generic values, for comparing documents
+// regardless of key order and spacing.
+func asJSON(t testing.TB, data []byte) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("%v: %.100s", err, data)
+	}
+	return v
+}
+
+// TestMessagePackMatchesJSON checks a value sent as MessagePack reads back
+// as the same document it would be as JSON.
+func TestMessagePackMatchesJSON(t *testing.T) {
+	for _, v := range samples() {
+		want, err := JSON.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packed, err := MessagePack.Marshal(v)
+		if err != nil {
+			t.Fatalf("%T: %v", v, err)
+		}
+		got, err := MessagePackToJSON(packed)
+		if err != nil {
+			t.Fatalf("%T %.60s: %v", v, want, err)
+		}
+		if !reflect.DeepEqual(asJSON(t, got), asJSON(t, want)) {
+			t.Errorf("%T: MessagePack reads back as %.200s, JSON is %.200s", v, got, want)
+		}
+	}
+}
+
+func TestMessagePackRoundTrip(t *testing.T) {
+	in := full()
+	packed, err := MessagePack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out sample
+	if err := MessagePack.Unmarshal(packed, &out); err != nil {
+		t.Fatal(err)
+	}
+	// What JSON drops, MessagePack drops too
+	in.Extra, in.private = nil, 0
+	out.Raw = json.RawMessage(asCompact(t, out.Raw))
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got  %+v\nwant %+v", out, in)
+	}
+}
+
+func asCompact(t *testing.T, raw []byte) []byte {
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// TestMessagePackFormats pins the encoding of a few values to the bytes
+// the MessagePack spec gives for them.
+func TestMessagePackFormats(t *testing.T) {
+	for _, tc := range []struct {
+		v    any
+		want []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{5, []byte{0x05}},
+		{-1, []byte{0xff}},
+		{200, []byte{0xcc, 0xc8}},
+		{-100, []byte{0xd0, 0x9c}},
+		{1000, []byte{0xcd, 0x03, 0xe8}},
+		{"hi", []byte{0xa2, 'h', 'i'}},
+		{[]byte{1}, []byte{0xc4, 0x01, 0x01}},
+		{[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{map[string]int{"a": 1}, []byte{0x81, 0xa1, 'a', 0x01}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{struct {
+			A int `json:"a,omitempty"`
+			B int `json:"b"`
+		}{B: 2}, []byte{0x81, 0xa1, 'b', 0x02}},
+	} {
+		got, err := MessagePack.Marshal(tc.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%#v: % x, want % x", tc.v, got, tc.want)
+		}
+	}
+}
+
+// TestMessagePackTruncated checks that every cut-short frame is refused,
+// not read past its end.
+func TestMessagePackTruncated(t *testing.T) {
+	for _, v := range samples() {
+		packed, err := MessagePack.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Long values only need their edges tried
+		for i := 0; i < len(packed); i++ {
+			if i > 64 && i < len(packed)-64 {
+				i = len(packed) - 64
+			}
+			if _, err := MessagePackToJSON(packed[:i]); err == nil {
+				t.Errorf("%T cut to %d of %d bytes decoded", v, i, len(packed))
+			}
+		}
+		if _, err := MessagePackToJSON(append(packed, 0xc0)); err == nil {
+			t.Errorf("%T with trailing data decoded", v)
+		}
+	}
+}
+
+func TestMessagePackRefused(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":                {},
+		"huge array":           {0xdd, 0xff, 0xff, 0xff, 0xff},
+		"huge map":             {0xdf, 0xff, 0xff, 0xff, 0xff, 0xa0},
+		"huge string":          {0xdb, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"huge binary":          {0xc6, 0x7f, 0xff, 0xff, 0xff},
+		"map with integer key": {0x81, 0x01, 0x02},
+		"extension":            {0xd4, 0x01, 0x02},
+		"never used":           {0xc1},
+		"nested too deeply":    append(bytes.Repeat([]byte{0x91}, maxDepth+2), 0xc0),
+		"NaN":                  {0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 1},
+	} {
+		if got, err := MessagePackToJSON(data); err == nil {
+			t.Errorf("%s decoded as %s", name, got)
+		}
+	}
+	var v map[string]any
+	if err := MessagePack.Unmarshal([]byte{0x93, 0x01, 0x02, 0x03}, &v); err == nil {
+		t.Error("an array decoded into a map")
+	}
+}
+
+// FuzzMessagePackToJSON feeds the decoder arbitrary bytes: it must not
+// panic, and whatever it accepts must be JSON that encodes back to the
+// same document.
+func FuzzMessagePackToJSON(f *testing.F) {
+	for _, v := range samples() {
+		if packed, err := MessagePack.Marshal(v); err == nil && len(packed) < 4096 {
+			f.Add(packed)
+		}
+	}
+	f.Add([]byte{0xdd, 0xff, 0xff, 0xff, 0xff})
+	f.Add(bytes.Repeat([]byte{0x91}, 40))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		js, err := MessagePackToJSON(data)
+		if err != nil {
+			return
+		}
+		doc := asJSON(t, js)
+		packed, err := MessagePack.Marshal(doc)
+		if err != nil {
+			t.Fatalf("re-encoding %s: %v", js, err)
+		}
+		again, err := MessagePackToJSON(packed)
+		if err != nil {
+			t.Fatalf("decoding re-encoded %s: %v", js, err)
+		}
+		// Compared as documents: JSON replaces invalid UTF-8 in keys, which
+		// can change the order it sorts them in
+		if !reflect.DeepEqual(asJSON(t, again), doc) {
+			t.Fatalf("%s re-encoded reads back as %s", js, again)
+		}
+	})
+}
@@ -0,0 +1,360 @@
+package commands
+
+import (
+	"coopcinema/hub"
+	"coopcinema/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&Command{
+		Name:  "help",
+		Usage: "/help",
+		Help:  "List available commands",
+		Run: func(ctx *Context) (string, error) {
+			return HelpText(ctx.Hub.IsHost(ctx.Sender)), nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "skip",
+		Usage:    "/skip [seconds]",
+		Help:     "Jump forward (or back, if negative) for everyone; default 10s",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			delta := 10.0
+			if len(ctx.Args) > 0 {
+				d, err := strconv.ParseFloat(ctx.Args[0], 64)
+				if err != nil {
+					return "", ErrUsage
+				}
+				delta = d
+			}
+
+			pos, _, ok := ctx.Hub.Playback(ctx.Sender.RoomCode)
+			if !ok {
+				return "", errors.New("room not found")
+			}
+			target := pos + delta
+			if target < 0 {
+				target = 0
+			}
+			ctx.Hub.BroadcastRoom(ctx.Sender.RoomCode, models.Message{
+				Type:      "seek",
+				Timestamp: target,
+				SentAt:    float64(time.Now().UnixMilli()),
+			})
+			return fmt.Sprintf("Skipped to %s", clock(target)), nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "poll",
+		Usage:    "/poll question | option 1 | option 2 [| ...]",
+		Help:     "Start a poll; vote with /vote <number>",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			parts := strings.Split(ctx.Raw, "|")
+			if len(parts) < 3 {
+				return "", ErrUsage
+			}
+			for i := range parts {
+				parts[i] = strings.TrimSpace(parts[i])
+			}
+			if err := ctx.Hub.StartPoll(ctx.Sender.RoomCode, parts[0], parts[1:]); err != nil {
+				return "", err
+			}
+			return "Poll started", nil
+		},
+	})
+
+	Register(&Command{
+		Name:  "vote",
+		Usage: "/vote <number>",
+		Help:  "Vote in the current poll",
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) != 1 {
+				return "", ErrUsage
+			}
+			n, err := strconv.Atoi(ctx.Args[0])
+			if err != nil {
+				return "", ErrUsage
+			}
+			if err := ctx.Hub.Vote(ctx.Sender.RoomCode, ctx.Sender.ID, n-1); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Voted for option %d", n), nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "kick",
+		Usage:    "/kick <name>",
+		Help:     "Remove a viewer from the room",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if ctx.Raw == "" {
+				return "", ErrUsage
+			}
+			if strings.EqualFold(ctx.Raw, ctx.Sender.Name) {
+				return "", errors.New("you can't kick yourself")
+			}
+			target, err := ctx.Hub.Kick(ctx.Sender.RoomCode, ctx.Raw)
+			if err != nil {
+				return "", err
+			}
+			return "Kicked " + target.Name, nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "captions",
+		Usage:    "/captions on [language] | off",
+		Help:     "Force captions on for everyone",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) == 0 {
+				return "", ErrUsage
+			}
+			a, _ := ctx.Hub.Accessibility(ctx.Sender.RoomCode)
+			switch strings.ToLower(ctx.Args[0]) {
+			case "on":
+				a.ForceCaptions = true
+				a.CaptionLanguage = ""
+				if len(ctx.Args) > 1 {
+					a.CaptionLanguage = ctx.Args[1]
+				}
+			case "off":
+				a.ForceCaptions = false
+				a.CaptionLanguage = ""
+			default:
+				return "", ErrUsage
+			}
+			if !ctx.Hub.SetAccessibility(ctx.Sender.RoomCode, a) {
+				return "", errors.New("room not found")
+			}
+			if a.ForceCaptions {
+				return "Captions forced on", nil
+			}
+			return "Captions are up to each viewer again", nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "describe",
+		Usage:    "/describe <language> | off",
+		Help:     "Switch everyone to the audio-description track",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) != 1 {
+				return "", ErrUsage
+			}
+			a, _ := ctx.Hub.Accessibility(ctx.Sender.RoomCode)
+			a.AudioDescription = ctx.Args[0]
+			if strings.EqualFold(a.AudioDescription, "off") {
+				a.AudioDescription = ""
+			}
+			if !ctx.Hub.SetAccessibility(ctx.Sender.RoomCode, a) {
+				return "", errors.New("room not found")
+			}
+			if a.AudioDescription == "" {
+				return "Audio description off", nil
+			}
+			return "Audio description: " + a.AudioDescription, nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "token",
+		Usage:    "/token <name> <scope,scope...> [expires-in]",
+		Help:     "Create an API token for this room with post-chat, control-playback and/or read-state, e.g. /token bot post-chat 24h",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) != 2 && len(ctx.Args) != 3 {
+				return "", ErrUsage
+			}
+			var ttl time.Duration
+			if len(ctx.Args) == 3 {
+				var err error
+				if ttl, err = time.ParseDuration(ctx.Args[2]); err != nil || ttl <= 0 {
+					return "", ErrUsage
+				}
+			}
+			token, grant, err := ctx.Hub.MintToken(ctx.Sender.RoomCode, ctx.Args[0], strings.Split(ctx.Args[1], ","), ttl)
+			if err != nil {
+				return "", err
+			}
+			reply := "Token for " + grant.Name + " (id " + grant.ID + "): " + token
+			if !grant.ExpiresAt.IsZero() {
+				reply += ", expires " + grant.ExpiresAt.Format(time.RFC3339)
+			}
+			return reply, nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "dj",
+		Usage:    "/dj on|off",
+		Help:     "Take turns picking tracks: each load passes the turn to the next person",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) != 1 || (ctx.Args[0] != "on" && ctx.Args[0] != "off") {
+				return "", ErrUsage
+			}
+			ctx.Hub.SetDJMode(ctx.Sender, ctx.Args[0])
+			return "DJ mode " + ctx.Args[0], nil
+		},
+	})
+
+	Register(&Command{
+		Name:  "voteskip",
+		Usage: "/voteskip",
+		Help:  "Vote to pass the DJ turn to the next person",
+		Run: func(ctx *Context) (string, error) {
+			votes, needed, passed, err := ctx.Hub.VoteSkip(ctx.Sender)
+			if err != nil {
+				return "", err
+			}
+			if passed {
+				return "Vote passed; next DJ is up", nil
+			}
+			return fmt.Sprintf("%d of %d votes to skip", votes, needed), nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "attention",
+		Usage:    "/attention on|off",
+		Help:     "See how many people are actually watching; everyone is told when this is on",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) != 1 || (ctx.Args[0] != "on" && ctx.Args[0] != "off") {
+				return "", ErrUsage
+			}
+			if ctx.Hub.Settings().AttentionDetail == hub.AttentionOff {
+				return "", errors.New("attention summaries are disabled on this server")
+			}
+			ctx.Hub.SetAttention(ctx.Sender, ctx.Args[0])
+			return "Attention summaries " + ctx.Args[0], nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "wait",
+		Usage:    "/wait on|off",
+		Help:     "Pause for everyone while anyone buffers, and play on once they all catch up",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) != 1 || (ctx.Args[0] != "on" && ctx.Args[0] != "off") {
+				return "", ErrUsage
+			}
+			ctx.Hub.SetWaitMode(ctx.Sender, ctx.Args[0])
+			return "Wait for everyone " + ctx.Args[0], nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "quality",
+		Usage:    "/quality <height>|off",
+		Help:     "Cap the video quality everyone's player picks, e.g. /quality 480",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) != 1 {
+				return "", ErrUsage
+			}
+			n := 0
+			if ctx.Args[0] != "off" {
+				var err error
+				n, err = strconv.Atoi(strings.TrimSuffix(ctx.Args[0], "p"))
+				if err != nil || n <= 0 {
+					return "", ErrUsage
+				}
+			}
+			ctx.Hub.SetQualityCap(ctx.Sender, strconv.Itoa(n))
+			if n == 0 {
+				return "Quality cap lifted", nil
+			}
+			return fmt.Sprintf("Quality capped at %dp", n), nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "webhook",
+		Usage:    "/webhook <url>|off",
+		Help:     "Send this room's play, pause, seek and media changes to a URL",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if len(ctx.Args) != 1 {
+				return "", ErrUsage
+			}
+			if ctx.Args[0] == "off" {
+				_, err := ctx.Hub.SetWebhook(ctx.Sender.RoomCode, "")
+				return "Webhook removed", err
+			}
+			secret, err := ctx.Hub.SetWebhook(ctx.Sender.RoomCode, ctx.Args[0])
+			if err != nil {
+				return "", err
+			}
+			return "Webhook set. Signing secret: " + secret, nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "rotate",
+		Usage:    "/rotate",
+		Help:     "Give the room a new code so old links stop working; everyone here stays",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			if _, err := ctx.Hub.RotateCode(ctx.Sender.RoomCode); err != nil {
+				return "", err
+			}
+			return "Room code changed. Old links and guest passes no longer let anyone in", nil
+		},
+	})
+
+	Register(&Command{
+		Name:     "close",
+		Usage:    "/close <reason> [| new room code]",
+		Help:     "End the room for everyone, optionally pointing them to another room",
+		HostOnly: true,
+		Run: func(ctx *Context) (string, error) {
+			reason, moveTo, _ := strings.Cut(ctx.Raw, "|")
+			reason, moveTo = strings.TrimSpace(reason), strings.TrimSpace(moveTo)
+			if reason == "" {
+				return "", ErrUsage
+			}
+			if err := ctx.Hub.CloseRoom(ctx.Sender.RoomCode, reason, moveTo); err != nil {
+				return "", err
+			}
+			return "Room closed", nil
+		},
+	})
+
+	Register(&Command{
+		Name:  "marker",
+		Usage: "/marker <title>",
+		Help:  "Bookmark the current moment",
+		Run: func(ctx *Context) (string, error) {
+			if ctx.Raw == "" {
+				return "", ErrUsage
+			}
+			b, err := ctx.Hub.AddBookmark(ctx.Sender, ctx.Raw)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Marked %q at %s", b.Label, clock(b.Time)), nil
+		},
+	})
+}
+
+func clock(seconds float64) string {
+	s := int(seconds)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
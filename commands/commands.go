@@ -0,0 +1,110 @@
+// Package commands dispatches chat messages starting with "/" to registered
+// server-side commands instead of relaying them to the room.
+package commands
+
+import (
+	"coopcinema/hub"
+	"coopcinema/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Context is what a command runs against.
+type Context struct {
+	Hub    *hub.Hub
+	Sender *models.Client
+	Args   []string
+	Raw    string // everything after the command name
+}
+
+// Command is one slash command.
+type Command struct {
+	Name     string
+	Usage    string // e.g. "/skip [seconds]"
+	Help     string
+	HostOnly bool
+	// Run returns the reply shown to the sender.
+	Run func(ctx *Context) (string, error)
+}
+
+// ErrUsage makes the dispatcher reply with the command's usage line.
+var ErrUsage = errors.New("usage")
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]*Command)
+)
+
+// Register adds a command, replacing any with the same name. Call it from
+// an init function.
+func Register(cmd *Command) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[cmd.Name] = cmd
+}
+
+// Install adds the dispatcher to the hub's filter stage.
+func Install(h *hub.Hub) {
+	h.Use(hub.StageFilter, func(next hub.Handler) hub.Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if msg.Type != "chat" || !strings.HasPrefix(msg.Content, "/") {
+				next(msg, sender)
+				return
+			}
+			dispatch(h, sender, msg.Content)
+		}
+	})
+}
+
+func dispatch(h *hub.Hub, sender *models.Client, line string) {
+	name, raw, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	name = strings.ToLower(name)
+	raw = strings.TrimSpace(raw)
+
+	mu.RLock()
+	cmd, ok := registry[name]
+	mu.RUnlock()
+
+	reply := models.Message{Type: "commandResult", Command: name}
+	switch {
+	case !ok:
+		reply.Error = fmt.Sprintf("Unknown command /%s. Try /help", name)
+	case cmd.HostOnly && !h.IsHost(sender):
+		reply.Error = fmt.Sprintf("/%s is only available to the host", name)
+	default:
+		out, err := cmd.Run(&Context{Hub: h, Sender: sender, Args: strings.Fields(raw), Raw: raw})
+		switch {
+		case errors.Is(err, ErrUsage):
+			reply.Error = "Usage: " + cmd.Usage
+		case err != nil:
+			reply.Error = err.Error()
+		default:
+			reply.Content = out
+		}
+	}
+
+	sender.Deliver(reply)
+}
+
+// HelpText lists every command the sender may use.
+func HelpText(isHost bool) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var lines []string
+	for _, cmd := range registry {
+		if cmd.HostOnly && !isHost {
+			continue
+		}
+		line := cmd.Usage + " — " + cmd.Help
+		if cmd.HostOnly {
+			line += " (host)"
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -1,42 +1,398 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Config struct {
 	ServerAddr       string
-	PingInterval     time.Duration
-	ReadTimeout      time.Duration
+	ListenNetwork    string
+	IPv6Prefix       int
+	TrustedProxies   []netip.Prefix // peers whose forwarding headers are believed
 	WriteTimeout     time.Duration
+	DrainTimeout     time.Duration // how long shutdown waits for connections to close
+	RoomIdleTimeout  time.Duration // close rooms with no playback or chat this long; 0 never
+	RoomTTL          time.Duration // close rooms open this long; 0 never
+	ReconnectHint    time.Duration // clients are told to reconnect after this, plus jitter
+	ServerTimeEvery  time.Duration
+	ProbeInterval    time.Duration
 	ClientSendBuffer int
+	SlowClientGrace  time.Duration // how long a client's writer may stay behind before it's dropped
+	SlowClientChat   int           // chat messages held for a client whose writer is behind
+	ResumeGrace      time.Duration // how long a dropped member's place is kept for a reconnect
+	MaxMessageSize   int64         // largest WebSocket message read from a client, in bytes
+	AllowedOrigins   []string      // other sites' hosts whose pages may open WebSockets; *.example.com for subdomains
+	AllowAnyOrigin   bool          // let any site's pages open WebSockets, for development
+	ChatHistory      int
+	PublicDir        string // web UI directory overriding the built-in one
+	BrandTitle       string
+	BrandLogoURL     string
+	BrandColors      map[string]string // BrandColorNames to CSS hex colors
+	BrandMOTD        string
 	GamesEnabled     bool
+	ScheduleTick     time.Duration
+	ViewingSample    time.Duration
+	AttentionEvery   time.Duration
+	AttentionDetail  string
+	GeoIPDB          string
+	YouTubeAPIKey    string
+	MediaAllowlist   []string
+	RelayRate        int // bytes a second per member; 0 off
+	RelayMax         int
+	ReminderLead     time.Duration
+	GuestPassSecret  []byte
+	BlobDir          string
+	MediaDir         string
+	MaxUploadSize    int64
+	FFmpegPath       string
+	TranscodeWorkers int
+	EventLogPath     string
+	WiretapDir       string
+	ScriptsDir       string
+	ScriptTimeout    time.Duration
+	ScriptMemory     int64 // bytes a script callback may allocate
+	TenantsFile      string
+	FeedsState       string
+	AutocertDir      string
+	AutocertEmail    string
+	AutocertDomains  []string // hostnames autocert may issue for, besides tenants'
+	TLSCert          string
+	TLSKey           string
+	TLSAddr          string
+	ClaimSecret      []byte
+	AccountsFile     string
+	AccountHeader    string
+	PreferencesFile  string
+	FeedbackFile     string
+	LeaderboardFile  string
+	AdminToken       string
+	GRPCAddr         string // gRPC API listen address; "" off
+	MetricsToken     string
+	ScalingCapacity  int
+	PushgatewayURL   string
+	PushgatewayEvery time.Duration
+	BansFile         string
+	BansStore        string
+	RoomStore        string
+	RoomStoreDSN     string
+	RoomSnapshot     time.Duration
+	MemoryStoreFile  string
+	MemorySnapshot   time.Duration
+	JoinRate         float64
+	JoinBurst        float64
+	CanaryInterval   time.Duration
+	MediaCheckEvery  time.Duration
+	CanarySlow       time.Duration
+	CanaryAlertURL   string
+	ArchiveIndex     string
+	ArchiveRetention time.Duration
+	RetentionRules   string
+	PruneInterval    time.Duration
+	OAuthFile        string
+	OAuthRedirect    string // public base URL the provider sends users back to
+	SessionSecret    []byte
+	SessionTTL       time.Duration
+	WSAuth           string // "jwt" to require a signed token on /ws
+	JWTSecret        []byte
+	JWTPublicKey     string
+	JWTPrivateKey    string
+	JWTTTL           time.Duration
+	MessageRates     map[string]Rate // message type, or "*" for the rest -> limit per client
+	MessageStrikes   int
+
+	settings values // what it was built from, for Write
+}
+
+// Rate is a token-bucket limit: PerSecond sustained, Burst at once.
+type Rate struct {
+	PerSecond float64
+	Burst     float64
 }
 
-func Load() *Config {
-	addr := os.Getenv("SERVER_ADDR")
+// defaultMessageRates keep playback spam in check while leaving room for
+// scrubbing; MESSAGE_RATES entries replace them type by type.
+var defaultMessageRates = map[string]Rate{
+	"play":  {PerSecond: 2, Burst: 10},
+	"pause": {PerSecond: 2, Burst: 10},
+	"seek":  {PerSecond: 4, Burst: 20},
+	// Reactions come in flurries, but a held-down key shouldn't flood
+	"reaction": {PerSecond: 3, Burst: 10},
+	// ICE candidates come in bursts while a peer connection is set up
+	"signal":      {PerSecond: 20, Burst: 100},
+	"voiceSignal": {PerSecond: 20, Burst: 100},
+	// Relayed data is capped in bytes by RELAY_KBPS; this only bounds the
+	// message count
+	"relayData": {PerSecond: 100, Burst: 200},
+	"*":         {PerSecond: 20, Burst: 60},
+}
+
+// build makes the configuration from validated settings.
+func build(v values) *Config {
+	addr := v.str("SERVER_ADDR")
 	if addr == "" {
 		// Render and similar platforms set PORT
-		if port := os.Getenv("PORT"); port != "" {
+		if port := v.str("PORT"); port != "" {
 			addr = ":" + port
 		} else {
 			addr = ":8080"
 		}
+		v.raw["SERVER_ADDR"] = addr
 	}
 
-	gamesEnabled := true
-	if ge := os.Getenv("GAMES_ENABLED"); ge != "" {
-		gamesEnabled = strings.ToLower(ge) != "false"
+	// Rooms survive restarts in a "sqlite", "file", "postgres" or "memory"
+	// store; empty keeps them in memory only, with nothing written out
+	roomStore := v.str("ROOM_STORE")
+	if v.str("ROOM_STORE_DSN") == "" {
+		switch roomStore {
+		case "sqlite":
+			v.raw["ROOM_STORE_DSN"] = "./data/rooms.db"
+		case "file":
+			v.raw["ROOM_STORE_DSN"] = "./data/rooms.json"
+		}
+	}
+
+	// Without configured secrets, passes, tokens and sessions only survive
+	// until restart
+	guestPassSecret := secretOrRandom(v.str("GUEST_PASS_SECRET"))
+	claimSecret := secretOrRandom(v.str("CLAIM_SECRET"))
+	sessionSecret := secretOrRandom(v.str("SESSION_SECRET"))
+
+	// Per-client message limits, e.g. "seek=4/20,*=20/60" (per second/burst)
+	messageRates := make(map[string]Rate, len(defaultMessageRates))
+	for msgType, r := range defaultMessageRates {
+		messageRates[msgType] = r
+	}
+	for _, entry := range strings.Split(v.str("MESSAGE_RATES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		msgType, _, _ := strings.Cut(entry, "=")
+		r, _ := parseRate(entry)
+		messageRates[msgType] = r
 	}
 
+	brandColors, _ := parseBrandColors(v.str("BRAND_COLORS"))
+	trustedProxies, _ := parsePrefixes(v.list("TRUSTED_PROXIES"))
+
 	return &Config{
 		ServerAddr:       addr,
-		PingInterval:     54 * time.Second,
-		ReadTimeout:      60 * time.Second,
-		WriteTimeout:     10 * time.Second,
-		ClientSendBuffer: 256,
-		GamesEnabled:     gamesEnabled,
+		ListenNetwork:    v.str("LISTEN_NETWORK"),
+		IPv6Prefix:       v.integer("IPV6_PREFIX"),
+		TrustedProxies:   trustedProxies,
+		WriteTimeout:     v.duration("WRITE_TIMEOUT"),
+		DrainTimeout:     v.duration("DRAIN_TIMEOUT"),
+		RoomIdleTimeout:  v.duration("ROOM_IDLE_TIMEOUT"),
+		RoomTTL:          v.duration("ROOM_TTL"),
+		ReconnectHint:    v.duration("RECONNECT_HINT"),
+		ServerTimeEvery:  v.duration("SERVER_TIME_EVERY"),
+		ProbeInterval:    v.duration("PROBE_INTERVAL"),
+		ClientSendBuffer: v.integer("CLIENT_SEND_BUFFER"),
+		SlowClientGrace:  v.duration("SLOW_CLIENT_GRACE"),
+		SlowClientChat:   v.integer("SLOW_CLIENT_CHAT"),
+		ResumeGrace:      v.duration("RESUME_GRACE"),
+		MaxMessageSize:   int64(v.integer("MAX_MESSAGE_KB")) << 10,
+		AllowedOrigins:   v.list("ALLOWED_ORIGINS"),
+		AllowAnyOrigin:   v.boolean("ALLOW_ANY_ORIGIN"),
+		ChatHistory:      v.integer("CHAT_HISTORY"),
+		PublicDir:        v.str("PUBLIC_DIR"),
+		BrandTitle:       v.str("BRAND_TITLE"),
+		BrandLogoURL:     v.str("BRAND_LOGO_URL"),
+		BrandColors:      brandColors,
+		BrandMOTD:        v.str("BRAND_MOTD"),
+		GamesEnabled:     v.boolean("GAMES_ENABLED"),
+		ScheduleTick:     v.duration("SCHEDULE_TICK"),
+		ViewingSample:    v.duration("VIEWING_SAMPLE"),
+		AttentionEvery:   v.duration("ATTENTION_EVERY"),
+		AttentionDetail:  v.str("ATTENTION_DETAIL"),
+		GeoIPDB:          v.str("GEOIP_DB"),
+		YouTubeAPIKey:    v.str("YOUTUBE_API_KEY"),
+		MediaAllowlist:   v.list("MEDIA_URL_ALLOWLIST"),
+		RelayRate:        v.integer("RELAY_KBPS") << 10,
+		RelayMax:         v.integer("RELAY_MAX"),
+		ReminderLead:     v.duration("SCHEDULE_REMINDER_LEAD"),
+		GuestPassSecret:  guestPassSecret,
+		BlobDir:          v.str("BLOB_DIR"),
+		MediaDir:         v.str("MEDIA_DIR"),
+		MaxUploadSize:    int64(v.integer("MAX_UPLOAD_MB")) << 20,
+		FFmpegPath:       v.str("FFMPEG_PATH"),
+		TranscodeWorkers: v.integer("TRANSCODE_WORKERS"),
+		EventLogPath:     v.str("EVENT_LOG"),
+		WiretapDir:       v.str("WIRETAP_DIR"),
+		ScriptsDir:       v.str("SCRIPTS_DIR"),
+		ScriptTimeout:    v.duration("SCRIPT_TIMEOUT"),
+		ScriptMemory:     int64(v.integer("SCRIPT_MEMORY_MB")) << 20,
+		TenantsFile:      v.str("TENANTS_FILE"),
+		FeedsState:       v.str("FEEDS_STATE"),
+		AutocertDir:      v.str("AUTOCERT_DIR"),
+		AutocertEmail:    v.str("AUTOCERT_EMAIL"),
+		AutocertDomains:  v.list("AUTOCERT_DOMAINS"),
+		TLSCert:          v.str("TLS_CERT"),
+		TLSKey:           v.str("TLS_KEY"),
+		TLSAddr:          v.str("TLS_ADDR"),
+		ClaimSecret:      claimSecret,
+		AccountsFile:     v.str("ACCOUNTS_FILE"),
+		AccountHeader:    v.str("ACCOUNT_HEADER"),
+		PreferencesFile:  v.str("PREFERENCES_FILE"),
+		FeedbackFile:     v.str("FEEDBACK_FILE"),
+		LeaderboardFile:  v.str("LEADERBOARD_FILE"),
+		AdminToken:       v.str("ADMIN_TOKEN"),
+		GRPCAddr:         v.str("GRPC_ADDR"),
+		MetricsToken:     v.str("METRICS_TOKEN"),
+		ScalingCapacity:  v.integer("SCALING_CAPACITY"),
+		PushgatewayURL:   strings.TrimSuffix(v.str("PUSHGATEWAY_URL"), "/"),
+		PushgatewayEvery: v.duration("PUSHGATEWAY_EVERY"),
+		BansFile:         v.str("BANS_FILE"),
+		BansStore:        v.str("BANS_STORE"),
+		RoomStore:        roomStore,
+		RoomStoreDSN:     v.str("ROOM_STORE_DSN"),
+		RoomSnapshot:     v.duration("ROOM_SNAPSHOT_EVERY"),
+		MemoryStoreFile:  v.str("MEMORY_STORE_FILE"),
+		MemorySnapshot:   v.duration("MEMORY_SNAPSHOT_EVERY"),
+		JoinRate:         v.number("JOIN_RATE"),
+		JoinBurst:        v.number("JOIN_BURST"),
+		CanaryInterval:   v.duration("CANARY_INTERVAL"),
+		MediaCheckEvery:  v.duration("MEDIA_CHECK_EVERY"),
+		CanarySlow:       v.duration("CANARY_SLOW"),
+		CanaryAlertURL:   v.str("CANARY_ALERT_URL"),
+		ArchiveIndex:     v.str("ARCHIVE_INDEX"),
+		ArchiveRetention: v.duration("ARCHIVE_RETENTION"),
+		RetentionRules:   v.str("RETENTION"),
+		PruneInterval:    v.duration("PRUNE_INTERVAL"),
+		OAuthFile:        v.str("OAUTH_PROVIDERS_FILE"),
+		OAuthRedirect:    strings.TrimSuffix(v.str("OAUTH_REDIRECT_BASE"), "/"),
+		SessionSecret:    sessionSecret,
+		SessionTTL:       v.duration("SESSION_TTL"),
+		WSAuth:           v.str("WS_AUTH"),
+		JWTSecret:        []byte(v.str("JWT_SECRET")),
+		JWTPublicKey:     v.str("JWT_PUBLIC_KEY"),
+		JWTPrivateKey:    v.str("JWT_PRIVATE_KEY"),
+		JWTTTL:           v.duration("JWT_TTL"),
+		MessageRates:     messageRates,
+		MessageStrikes:   v.integer("MESSAGE_STRIKES"),
+		settings:         v,
+	}
+}
+
+// KeepClaimSecret makes a random claim secret outlive restarts when rooms
+// do, since restored rooms know their hosts by claim token: with
+// CLAIM_SECRET unset, the secret is made once and kept in claim.secret
+// beside the room store's file. A Postgres store has no such file, so it
+// needs CLAIM_SECRET.
+func (c *Config) KeepClaimSecret() error {
+	if c.settings.str("CLAIM_SECRET") != "" {
+		return nil
+	}
+	var beside string
+	switch c.RoomStore {
+	case "sqlite", "file":
+		beside, _, _ = strings.Cut(strings.TrimPrefix(c.RoomStoreDSN, "file:"), "?")
+	case "memory":
+		beside = c.MemoryStoreFile
+	default:
+		return nil
+	}
+	path := filepath.Join(filepath.Dir(beside), "claim.secret")
+
+	if saved, err := os.ReadFile(path); err == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(saved)))
+		if err != nil || len(secret) == 0 {
+			return fmt.Errorf("%s: not a hex secret", path)
+		}
+		c.ClaimSecret = secret
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(hex.EncodeToString(c.ClaimSecret)+"\n"), 0o600)
+}
+
+func secretOrRandom(s string) []byte {
+	if s != "" {
+		return []byte(s)
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+// BrandColorNames are the palette entries BRAND_COLORS can set.
+var BrandColorNames = []string{"background", "surface", "accent", "accent-light", "highlight", "text", "muted"}
+
+// parseBrandColors reads BRAND_COLORS, name=#hex pairs, into lower-cased
+// colors by name.
+func parseBrandColors(raw string) (map[string]string, error) {
+	colors := make(map[string]string)
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, color, _ := strings.Cut(entry, "=")
+		name, color = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(color))
+		if !slices.Contains(BrandColorNames, name) {
+			return nil, fmt.Errorf("%q is not a palette entry", name)
+		}
+		if !hexColor(color) {
+			return nil, fmt.Errorf("%s: %q is not a color like #4da3ff", name, color)
+		}
+		colors[name] = color
+	}
+	return colors, nil
+}
+
+// hexColor reports whether s is #rgb, #rrggbb or #rrggbbaa.
+func hexColor(s string) bool {
+	digits, ok := strings.CutPrefix(s, "#")
+	if !ok || (len(digits) != 3 && len(digits) != 6 && len(digits) != 8) {
+		return false
+	}
+	_, err := strconv.ParseUint(digits, 16, 32)
+	return err == nil
+}
+
+// parsePrefixes reads addresses and CIDR ranges; an address is a range of
+// one.
+func parsePrefixes(items []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range items {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR range", item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseRate reads one MESSAGE_RATES entry, type=perSecond/burst.
+func parseRate(entry string) (Rate, bool) {
+	_, limit, ok := strings.Cut(entry, "=")
+	if !ok {
+		return Rate{}, false
+	}
+	perSecond, burst, _ := strings.Cut(limit, "/")
+	r, err1 := strconv.ParseFloat(perSecond, 64)
+	b, err2 := strconv.ParseFloat(burst, 64)
+	if err1 != nil || err2 != nil || r <= 0 || b < 1 {
+		return Rate{}, false
 	}
+	return Rate{PerSecond: r, Burst: b}, true
 }
@@ -0,0 +1,347 @@
+package config
+
+import (
+	"coopcinema/retention"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layers are where settings come from, each overriding the one before:
+// defaults, a YAML file, the environment, then command-line flags.
+type Layers struct {
+	file  *string // -config, else CONFIG_FILE
+	print *bool
+	flags *flag.FlagSet
+}
+
+// Flags registers -config, -print-config and a flag for every setting on
+// fs, to be parsed before Load.
+func Flags(fs *flag.FlagSet) *Layers {
+	l := &Layers{
+		file:  fs.String("config", "", "YAML file of settings, keyed like the environment variables in lower case (default $CONFIG_FILE)"),
+		print: fs.Bool("print-config", false, "print the resolved settings as a config file, then exit"),
+		flags: fs,
+	}
+	for _, s := range settings {
+		fs.String(flagName(s.name), s.def, s.help)
+	}
+	return l
+}
+
+// PrintOnly reports whether -print-config was given.
+func (l *Layers) PrintOnly() bool {
+	return l.print != nil && *l.print
+}
+
+// Load resolves every setting through the layers, checks them and builds
+// the configuration. The error lists every setting that is wrong.
+func (l *Layers) Load() (*Config, error) {
+	v, err := l.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+	return build(v), nil
+}
+
+// values are the resolved settings by name, with where each came from.
+type values struct {
+	raw  map[string]string
+	from map[string]string // "" for defaults
+}
+
+func (l *Layers) resolve() (values, error) {
+	v := values{raw: make(map[string]string, len(settings)), from: make(map[string]string)}
+	for _, s := range settings {
+		v.raw[s.name] = s.def
+	}
+
+	path := os.Getenv("CONFIG_FILE")
+	if l.file != nil && *l.file != "" {
+		path = *l.file
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return v, err
+		}
+		file, err := parseYAML(data)
+		if err != nil {
+			return v, fmt.Errorf("%s: %w", path, err)
+		}
+		for key, value := range file {
+			name := strings.ToUpper(key)
+			if _, ok := lookup(name); !ok || key != strings.ToLower(name) {
+				return v, fmt.Errorf("%s: unknown setting %q", path, key)
+			}
+			v.raw[name], v.from[name] = value, path
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.name); ok {
+			v.raw[s.name], v.from[s.name] = value, "environment"
+		}
+	}
+
+	if l.flags != nil {
+		l.flags.Visit(func(f *flag.Flag) {
+			if name := settingName(f.Name); name != "" {
+				v.raw[name], v.from[name] = f.Value.String(), "-"+f.Name
+			}
+		})
+	}
+	return v, nil
+}
+
+// validate checks each value against its kind, then settings that only
+// make sense together.
+func (v values) validate() error {
+	var errs []error
+	bad := func(name, format string, args ...any) {
+		where := ""
+		if from := v.from[name]; from != "" {
+			where = " (from " + from + ")"
+		}
+		errs = append(errs, fmt.Errorf("%s%s: %s", name, where, fmt.Sprintf(format, args...)))
+	}
+
+	for _, s := range settings {
+		raw := v.raw[s.name]
+		if raw == "" && s.kind != choice {
+			continue
+		}
+		switch s.kind {
+		case duration:
+			d, err := time.ParseDuration(raw)
+			switch {
+			case err != nil:
+				bad(s.name, "%q is not a duration like 30s or 5m", raw)
+			case d < 0 || (s.positive && d == 0):
+				bad(s.name, "%s", tooSmall(s))
+			}
+		case integer:
+			n, err := strconv.Atoi(raw)
+			switch {
+			case err != nil:
+				bad(s.name, "%q is not a whole number", raw)
+			case n < 0 || (s.positive && n == 0):
+				bad(s.name, "%s", tooSmall(s))
+			}
+		case number:
+			n, err := strconv.ParseFloat(raw, 64)
+			switch {
+			case err != nil:
+				bad(s.name, "%q is not a number", raw)
+			case n < 0 || (s.positive && n == 0):
+				bad(s.name, "%s", tooSmall(s))
+			}
+		case boolean:
+			if _, err := strconv.ParseBool(raw); err != nil {
+				bad(s.name, "%q is not true or false", raw)
+			}
+		case choice:
+			if !slices.Contains(s.choices, raw) {
+				bad(s.name, "%q is not one of %s", raw, strings.Join(quoted(s.choices), ", "))
+			}
+		}
+		if s.check != nil && raw != "" {
+			if err := s.check(raw); err != nil {
+				bad(s.name, "%v", err)
+			}
+		}
+	}
+
+	if (v.raw["TLS_CERT"] == "") != (v.raw["TLS_KEY"] == "") {
+		bad("TLS_CERT", "TLS_CERT and TLS_KEY go together")
+	}
+	if v.raw["WS_AUTH"] == "jwt" && v.raw["JWT_SECRET"] == "" && v.raw["JWT_PUBLIC_KEY"] == "" {
+		bad("WS_AUTH", "jwt needs JWT_SECRET or JWT_PUBLIC_KEY")
+	}
+	if v.raw["ACCOUNT_HEADER"] != "" && v.raw["TRUSTED_PROXIES"] == "" {
+		bad("ACCOUNT_HEADER", "ACCOUNT_HEADER needs TRUSTED_PROXIES, or anyone could send it")
+	}
+	if v.raw["GRPC_ADDR"] != "" && v.raw["ADMIN_TOKEN"] == "" {
+		bad("GRPC_ADDR", "the gRPC API needs ADMIN_TOKEN")
+	}
+	if v.raw["ROOM_STORE"] == "postgres" && v.raw["ROOM_STORE_DSN"] == "" {
+		bad("ROOM_STORE", "postgres needs ROOM_STORE_DSN")
+	}
+	if v.raw["ROOM_STORE"] == "postgres" && v.raw["CLAIM_SECRET"] == "" {
+		bad("ROOM_STORE", "postgres needs CLAIM_SECRET, or restored rooms' hosts lose their claim at restart")
+	}
+	return errors.Join(errs...)
+}
+
+func tooSmall(s setting) string {
+	if s.positive {
+		return "must be more than 0"
+	}
+	return "can't be negative"
+}
+
+func quoted(choices []string) []string {
+	q := make([]string, len(choices))
+	for i, c := range choices {
+		q[i] = strconv.Quote(c)
+	}
+	return q
+}
+
+func checkIPv6Prefix(raw string) error {
+	if n, err := strconv.Atoi(raw); err == nil && (n < 1 || n > 128) {
+		return errors.New("must be 1 to 128")
+	}
+	return nil
+}
+
+func checkTrustedProxies(raw string) error {
+	_, err := parsePrefixes(splitList(raw))
+	return err
+}
+
+func checkAtLeastOne(raw string) error {
+	if n, err := strconv.ParseFloat(raw, 64); err == nil && n < 1 {
+		return errors.New("must be at least 1")
+	}
+	return nil
+}
+
+func checkMessageRates(raw string) error {
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if _, ok := parseRate(entry); !ok {
+			return fmt.Errorf("%q is not type=perSecond/burst, with burst at least 1", entry)
+		}
+	}
+	return nil
+}
+
+func checkLogoURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && !strings.HasPrefix(raw, "/")) {
+		return errors.New("must be an http(s) URL or a path starting with /")
+	}
+	return nil
+}
+
+func checkBrandColors(raw string) error {
+	_, err := parseBrandColors(raw)
+	return err
+}
+
+func checkRetention(raw string) error {
+	_, err := retention.ParseRules(raw)
+	return err
+}
+
+// Write prints the settings c was built from as a YAML config file, each
+// under its description. Secrets that are set are left out, so the file
+// can be shared; they have to come from elsewhere.
+func (c *Config) Write(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Co-op Cinema settings; load with -config or CONFIG_FILE\n")
+	for _, s := range settings {
+		raw := c.settings.raw[s.name]
+		fmt.Fprintf(&b, "\n# %s\n", s.help)
+		key := strings.ToLower(s.name)
+		switch {
+		case s.kind == secret && raw != "":
+			fmt.Fprintf(&b, "# %s: (set, not shown)\n", key)
+		case s.kind == list:
+			items := quoted(splitList(raw))
+			fmt.Fprintf(&b, "%s: [%s]\n", key, strings.Join(items, ", "))
+		default:
+			fmt.Fprintf(&b, "%s: %s\n", key, strconv.Quote(raw))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Changed compares next, a reloaded configuration, with c: applied are
+// the settings that changed and take effect at once, restart those that
+// changed but only do when the server starts.
+func (c *Config) Changed(next *Config) (applied, restart []string) {
+	for _, s := range settings {
+		if c.settings.raw[s.name] == next.settings.raw[s.name] {
+			continue
+		}
+		if s.reload {
+			applied = append(applied, s.name)
+		} else {
+			restart = append(restart, s.name)
+		}
+	}
+	return applied, restart
+}
+
+func lookup(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// flagName is the flag for a setting: -resume-grace for RESUME_GRACE.
+func flagName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+}
+
+// settingName is the setting a flag is for, "" for other flags.
+func settingName(flagName string) string {
+	name := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if _, ok := lookup(name); !ok {
+		return ""
+	}
+	return name
+}
+
+func (v values) str(name string) string { return v.raw[name] }
+
+func (v values) duration(name string) time.Duration {
+	d, _ := time.ParseDuration(v.raw[name])
+	return d
+}
+
+func (v values) integer(name string) int {
+	n, _ := strconv.Atoi(v.raw[name])
+	return n
+}
+
+func (v values) number(name string) float64 {
+	n, _ := strconv.ParseFloat(v.raw[name], 64)
+	return n
+}
+
+func (v values) boolean(name string) bool {
+	b, _ := strconv.ParseBool(v.raw[name])
+	return b
+}
+
+func (v values) list(name string) []string { return splitList(v.raw[name]) }
+
+// splitList reads a comma-separated list, lower-cased, leaving out blanks.
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
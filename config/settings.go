@@ -0,0 +1,129 @@
+package config
+
+import "strings"
+
+// kind is how a setting's value is written and checked.
+type kind int
+
+const (
+	text     kind = iota
+	duration      // time.ParseDuration, never negative
+	integer       // never negative
+	number        // float, never negative
+	boolean       // strconv.ParseBool
+	list          // comma-separated, lower-cased
+	choice        // one of setting.choices
+	secret        // text that -print-config leaves out
+)
+
+// setting is one tunable. name is its environment variable; the YAML key
+// is the same in lower case and the flag in lower case with dashes.
+type setting struct {
+	name     string
+	kind     kind
+	def      string // "" when unset means off or is worked out in Load
+	positive bool   // zero isn't allowed either
+	choices  []string
+	check    func(string) error // further checks on a non-empty value
+	reload   bool               // applied on SIGHUP without a restart
+	help     string
+}
+
+// settings are every tunable, in the order -print-config writes them.
+var settings = []setting{
+	{name: "SERVER_ADDR", help: "Listen address (host:port); :PORT, or :8080, if unset"},
+	{name: "PORT", help: "Port only, for platforms that set it"},
+	{name: "LISTEN_NETWORK", kind: choice, def: "tcp", choices: []string{"tcp", "tcp4", "tcp6"}, help: "tcp listens dual-stack; tcp4 or tcp6 picks one address family"},
+	{name: "IPV6_PREFIX", kind: integer, def: "64", check: checkIPv6Prefix, help: "IPv6 clients share rate limits and IP bans across this prefix"},
+	{name: "TRUSTED_PROXIES", kind: list, check: checkTrustedProxies, help: "Addresses or CIDR ranges of your reverse proxies, whose X-Forwarded-For is believed; only they may set ACCOUNT_HEADER"},
+	{name: "WRITE_TIMEOUT", kind: duration, def: "10s", positive: true, help: "How long a write to a client may take before its connection is dropped"},
+	{name: "DRAIN_TIMEOUT", kind: duration, def: "10s", positive: true, help: "How long a stopping server waits for connections to close and state to be saved"},
+	{name: "RECONNECT_HINT", kind: duration, def: "5s", help: "Clients of a stopping server are told to reconnect after this, plus up to as much again"},
+	{name: "ROOM_IDLE_TIMEOUT", kind: duration, def: "2h", help: "Close rooms with nothing playing and no playback change or chat for this long (0 never)"},
+	{name: "ROOM_TTL", kind: duration, def: "0s", help: "Close rooms this long after they open, however busy (0 never)"},
+	{name: "SERVER_TIME_EVERY", kind: duration, def: "15s", positive: true, help: "How often outgoing frames carry the server clock"},
+	{name: "PROBE_INTERVAL", kind: duration, def: "10s", positive: true, help: "How often each connection is graded for adaptHint"},
+	{name: "CLIENT_SEND_BUFFER", kind: integer, def: "256", positive: true, help: "Messages queued for a client before it counts as behind"},
+	{name: "SLOW_CLIENT_GRACE", kind: duration, def: "15s", help: "How long a client that can't keep up may stay behind before it is disconnected"},
+	{name: "SLOW_CLIENT_CHAT", kind: integer, def: "50", help: "Chat messages kept for a client that is behind, oldest dropped first"},
+	{name: "RESUME_GRACE", kind: duration, def: "30s", reload: true, help: "How long a member whose connection dropped keeps their place for a reconnect (0 off)"},
+	{name: "MAX_MESSAGE_KB", kind: integer, def: "128", positive: true, help: "Largest WebSocket message a client may send"},
+	{name: "ALLOWED_ORIGINS", kind: list, reload: true, help: "Hosts of other sites whose pages may open WebSockets, *.example.com for any subdomain"},
+	{name: "ALLOW_ANY_ORIGIN", kind: boolean, def: "false", reload: true, help: "Let pages on any site open WebSockets; for development only"},
+	{name: "CHAT_HISTORY", kind: integer, def: "50", reload: true, help: "Chat messages each room keeps for joiners (0 keeps none)"},
+	{name: "PUBLIC_DIR", help: "Serve the web UI from this directory instead of the copy built in, to customize it"},
+	{name: "BRAND_TITLE", def: "Co-op Cinema", reload: true, help: "Name the web UI and /api/v1/branding give the instance"},
+	{name: "BRAND_LOGO_URL", check: checkLogoURL, reload: true, help: "Logo image (http(s) URL or path) shown instead of the 🎬"},
+	{name: "BRAND_COLORS", check: checkBrandColors, reload: true, help: "Palette overrides, e.g. accent=#4da3ff,background=#070d1a (names: " + strings.Join(BrandColorNames, ", ") + ")"},
+	{name: "BRAND_MOTD", reload: true, help: "Message of the day shown in the lobby"},
+	{name: "GAMES_ENABLED", kind: boolean, def: "true", help: "Mini-games module"},
+	{name: "SCHEDULE_TICK", kind: duration, def: "30s", positive: true, help: "How often scheduled sessions are checked"},
+	{name: "SCHEDULE_REMINDER_LEAD", kind: duration, def: "15m", help: "How early the reminder webhook fires before a scheduled session"},
+	{name: "VIEWING_SAMPLE", kind: duration, def: "30s", positive: true, help: "How often viewing time is sampled for metrics and leaderboards"},
+	{name: "ATTENTION_EVERY", kind: duration, def: "15s", positive: true, help: "How often hosts get attention summaries"},
+	{name: "ATTENTION_DETAIL", kind: choice, def: "counts", choices: []string{"counts", "names", "off"}, reload: true, help: "What attention summaries tell hosts"},
+	{name: "GEOIP_DB", help: "IP-to-country CSV (first,last,country ranges) for region warnings"},
+	{name: "YOUTUBE_API_KEY", kind: secret, help: "YouTube Data API key for looking up where videos can play"},
+	{name: "MEDIA_URL_ALLOWLIST", kind: list, reload: true, help: "Hosts media URLs may be loaded from, subdomains included (any host if unset)"},
+	{name: "RELAY_KBPS", kind: integer, def: "256", reload: true, help: "What each member may send through the server when a file share or voice connection can't be made directly, in kilobytes per second (0 turns relaying off)"},
+	{name: "RELAY_MAX", kind: integer, def: "32", reload: true, help: "Relayed connections open at once"},
+	{name: "MEDIA_CHECK_EVERY", kind: duration, def: "5m", help: "How often rooms' direct media URLs are checked (0 turns checks off)"},
+	{name: "GUEST_PASS_SECRET", kind: secret, help: "Key for signing guest passes; random if unset, so passes end at restart"},
+	{name: "BLOB_DIR", def: "./data/blobs", help: "Where uploaded files (custom emotes) are stored"},
+	{name: "MEDIA_DIR", def: "./data/media", help: "Where videos uploaded to rooms are stored until the room closes"},
+	{name: "MAX_UPLOAD_MB", kind: integer, def: "4096", help: "Largest video a member can upload, in megabytes (0 disables uploads)"},
+	{name: "FFMPEG_PATH", help: "ffmpeg binary used to transcode uploaded .mkv/.mov videos to HLS (off if unset)"},
+	{name: "TRANSCODE_WORKERS", kind: integer, def: "1", positive: true, help: "Videos transcoded at once"},
+	{name: "EVENT_LOG", help: "Append every inbound room message to this JSON Lines file"},
+	{name: "WIRETAP_DIR", help: "Directory for debug recordings of single connections (off if unset)"},
+	{name: "SCRIPTS_DIR", help: "Load Lua room automations from this directory"},
+	{name: "SCRIPT_TIMEOUT", kind: duration, def: "100ms", positive: true, help: "CPU time limit for each script callback"},
+	{name: "SCRIPT_MEMORY_MB", kind: integer, def: "64", positive: true, help: "How much a script callback may grow the heap, in megabytes, before the script is unloaded"},
+	{name: "TENANTS_FILE", help: "JSON list of tenants and their custom hostnames, put into ROOM_STORE at startup"},
+	{name: "FEEDS_STATE", def: "./data/feeds.json", help: "Which tenant feed entries have been announced"},
+	{name: "AUTOCERT_DIR", help: "Enable Let's Encrypt, caching certificates here"},
+	{name: "AUTOCERT_DOMAINS", kind: list, help: "Hostnames Let's Encrypt may issue certificates for, besides tenants'"},
+	{name: "AUTOCERT_EMAIL", help: "Contact address for Let's Encrypt"},
+	{name: "TLS_CERT", help: "PEM certificate (chain) file; serve HTTPS with it instead of autocert"},
+	{name: "TLS_KEY", help: "PEM key file for TLS_CERT"},
+	{name: "TLS_ADDR", def: ":443", help: "HTTPS listen address when TLS is on"},
+	{name: "CLAIM_SECRET", kind: secret, help: "Key for signing guest claim and device tokens; if unset, random and kept in claim.secret beside ROOM_STORE's file"},
+	{name: "ACCOUNTS_FILE", def: "./data/accounts.json", help: "Where claimed account data is stored"},
+	{name: "ACCOUNT_HEADER", help: "Header carrying the signed-in account ID from your auth proxy, e.g. X-Account-ID; needs TRUSTED_PROXIES"},
+	{name: "PREFERENCES_FILE", def: "./data/preferences.json", help: "Where users' saved preferences are stored"},
+	{name: "FEEDBACK_FILE", help: "JSON Lines file for end-of-session ratings (not asked for if unset)"},
+	{name: "LEADERBOARD_FILE", def: "./data/leaderboard.json", help: "Where scheduled rooms' watch-time leaderboards are stored"},
+	{name: "ADMIN_TOKEN", kind: secret, help: "Bearer token for /api/admin/*; the admin API is off without it"},
+	{name: "GRPC_ADDR", help: "Serve the gRPC API (proto/coopcinema/v1/rooms.proto) here, unencrypted HTTP/2; needs ADMIN_TOKEN (off if unset)"},
+	{name: "METRICS_TOKEN", kind: secret, help: "Bearer token Prometheus must send to /metrics and /api/scaling"},
+	{name: "SCALING_CAPACITY", kind: integer, def: "0", help: "Clients one instance should carry; enables utilization and desired-replica hints"},
+	{name: "PUSHGATEWAY_URL", help: "Prometheus Pushgateway to push metrics to (off if unset)"},
+	{name: "PUSHGATEWAY_EVERY", kind: duration, def: "15s", positive: true, help: "How often metrics are pushed"},
+	{name: "BANS_FILE", help: "Server-wide ban list checked on every join"},
+	{name: "BANS_STORE", kind: choice, def: "file", choices: []string{"file", "memory"}, help: "file appends each ban to BANS_FILE; memory keeps bans in MEMORY_STORE_FILE (and turns bans on without BANS_FILE)"},
+	{name: "ROOM_STORE", kind: choice, def: "sqlite", choices: []string{"", "file", "sqlite", "postgres", "memory"}, help: "Keep rooms across restarts: sqlite, file, postgres or memory (in MEMORY_STORE_FILE); empty keeps none"},
+	{name: "ROOM_STORE_DSN", kind: secret, help: "File path, or the database to connect to; ./data/rooms.db for sqlite, ./data/rooms.json for file"},
+	{name: "ROOM_SNAPSHOT_EVERY", kind: duration, def: "15s", positive: true, help: "How often rooms are saved (only when something changed)"},
+	{name: "MEMORY_STORE_FILE", def: "./data/memory.json", help: "Snapshot file of the memory store, used by BANS_STORE=memory and ROOM_STORE=memory"},
+	{name: "MEMORY_SNAPSHOT_EVERY", kind: duration, def: "1m", positive: true, help: "How often the memory store writes its snapshot (only when something changed)"},
+	{name: "JOIN_RATE", kind: number, def: "10", positive: true, reload: true, help: "Joins per second admitted into one room once its burst is used up"},
+	{name: "JOIN_BURST", kind: number, def: "50", check: checkAtLeastOne, reload: true, help: "Joins a room admits at once before queueing"},
+	{name: "MESSAGE_RATES", check: checkMessageRates, reload: true, help: "Per-client message limits by type, e.g. seek=4/20,*=20/60 (per second/burst)"},
+	{name: "MESSAGE_STRIKES", kind: integer, def: "5", reload: true, help: "Rate limit violations within a minute before a client is disconnected (0 never)"},
+	{name: "CANARY_INTERVAL", kind: duration, def: "0s", help: "Run the end-to-end canary this often (0 off)"},
+	{name: "CANARY_SLOW", kind: duration, def: "1s", help: "Canary step latency that counts as degraded"},
+	{name: "CANARY_ALERT_URL", help: "Webhook POSTed when the canary degrades or recovers"},
+	{name: "ARCHIVE_INDEX", def: "./data/archives.json", help: "Index of archived rooms"},
+	{name: "ARCHIVE_RETENTION", kind: duration, def: "720h", help: "How long closed-room archives are kept"},
+	{name: "RETENTION", check: checkRetention, help: "Retention per data class, e.g. chat=24h,events=168h,telemetry=720h"},
+	{name: "PRUNE_INTERVAL", kind: duration, def: "10m", positive: true, help: "How often data past its retention is pruned"},
+	{name: "OAUTH_PROVIDERS_FILE", help: "JSON list of OAuth sign-in providers (sign-in off if unset)"},
+	{name: "OAUTH_REDIRECT_BASE", help: "Public base URL for /auth/callback; the request host if unset"},
+	{name: "SESSION_SECRET", kind: secret, help: "Signs session cookies; random if unset, so sign-ins end at restart"},
+	{name: "SESSION_TTL", kind: duration, def: "720h", positive: true, help: "How long a sign-in lasts"},
+	{name: "WS_AUTH", kind: choice, choices: []string{"", "jwt"}, help: "jwt to take user IDs and names on /ws from signed tokens only"},
+	{name: "JWT_SECRET", kind: secret, help: "HMAC secret for HS256 tokens"},
+	{name: "JWT_PUBLIC_KEY", help: "RSA PEM public key file for RS256 tokens (when JWT_SECRET is unset)"},
+	{name: "JWT_PRIVATE_KEY", help: "RSA PEM private key file for issuing RS256 tokens"},
+	{name: "JWT_TTL", kind: duration, def: "15m", positive: true, help: "Lifetime of tokens from /api/v1/token"},
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the flat YAML a config file needs: "key: value" lines,
+// with values plain, "double-quoted" or 'single-quoted', lists either
+// inline ([a, b]) or as "- item" lines under an empty key, and # comments.
+// Lists come back comma-joined, as the environment would give them.
+func parseYAML(data []byte) (map[string]string, error) {
+	out := make(map[string]string)
+	var listKey string // key whose "- item" lines are being read
+	var items []string
+	endList := func() {
+		if listKey != "" {
+			out[listKey] = strings.Join(items, ",")
+			listKey, items = "", nil
+		}
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		n := i + 1
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok || trimmed == "-" {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item outside a list", n)
+			}
+			value, err := scalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			items = append(items, value)
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested settings aren't supported", n)
+		}
+		endList()
+
+		key, rest, ok := strings.Cut(line, ":")
+		if !ok || strings.ContainsAny(key, " \t\"'") {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		if _, dup := out[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", n, key)
+		}
+		rest = strings.TrimSpace(rest)
+		switch {
+		case rest == "" || strings.HasPrefix(rest, "#"):
+			listKey, items = key, []string{}
+			out[key] = ""
+		case strings.HasPrefix(rest, "["):
+			value, err := flowList(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			out[key] = value
+		default:
+			value, err := scalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			out[key] = value
+		}
+	}
+	endList()
+	return out, nil
+}
+
+// scalar reads one value, dropping a trailing comment from a plain one.
+func scalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := closingQuote(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		if err := onlyComment(s[end+1:]); err != nil {
+			return "", err
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		// '' is a quote inside single quotes
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			if err := onlyComment(s[i+1:]); err != nil {
+				return "", err
+			}
+			return strings.ReplaceAll(s[1:i], "''", "'"), nil
+		}
+		return "", fmt.Errorf("unterminated string %s", s)
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "~" || s == "null" {
+		return "", nil
+	}
+	return s, nil
+}
+
+// closingQuote finds the quote ending a double-quoted string at s[0].
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func onlyComment(rest string) error {
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after string", rest)
+	}
+	return nil
+}
+
+// flowList reads an inline [a, "b", 'c'] list.
+func flowList(s string) (string, error) {
+	end := strings.LastIndex(s, "]")
+	if end < 0 {
+		return "", fmt.Errorf("unterminated list %s", s)
+	}
+	if err := onlyComment(s[end+1:]); err != nil {
+		return "", err
+	}
+	var items []string
+	for _, item := range splitFlow(s[1:end]) {
+		value, err := scalar(item)
+		if err != nil {
+			return "", err
+		}
+		if value != "" {
+			items = append(items, value)
+		}
+	}
+	return strings.Join(items, ","), nil
+}
+
+// splitFlow splits a flow list's inside on commas outside quotes.
+func splitFlow(s string) []string {
+	var parts []string
+	start := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
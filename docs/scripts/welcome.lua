@@ -0,0 +1,24 @@
+-- Greets newcomers, lets anyone call !intermission and takes an intermission
+-- one hour into the movie.
+
+on("join", function(room, name)
+  say(room, "Welcome to the theater, " .. name .. "! 🍿")
+end)
+
+on("chat", function(room, name, text)
+  if text == "!intermission" then
+    pause(room)
+    say(room, name .. " called an intermission.")
+    return true
+  end
+end)
+
+local paused = {}
+
+on("tick", function(room, position, playing)
+  if playing and position >= 3600 and not paused[room] then
+    paused[room] = true
+    pause(room)
+    say(room, "Intermission! Back in 10 minutes.")
+  end
+end)
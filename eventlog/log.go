@@ -0,0 +1,65 @@
+package eventlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is one inbound room message as seen by the server.
+type Event struct {
+	At        time.Time `json:"at"`
+	RoomCode  string    `json:"room"`
+	UserID    string    `json:"userID"`
+	Type      string    `json:"type"`
+	Timestamp float64   `json:"timestamp,omitempty"`
+	SentAt    float64   `json:"sentAt,omitempty"`
+	Playing   bool      `json:"playing,omitempty"`
+	Content   string    `json:"content,omitempty"`
+}
+
+// Writer appends events to a JSON Lines file.
+type Writer struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+	enc  *json.Encoder
+}
+
+func Open(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{path: path, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (w *Writer) Write(e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.Encode(e)
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// Read decodes every event in a JSON Lines stream, skipping bad lines.
+func Read(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,95 @@
+package eventlog
+
+import (
+	"coopcinema/retention"
+	"coopcinema/tenant"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+func (w *Writer) Name() string           { return "event log " + w.path }
+func (w *Writer) Class() retention.Class { return retention.Telemetry }
+
+// Prune rewrites the log without events older than their tenant's cutoff.
+func (w *Writer) Prune(cutoff func(string) time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	events, err := w.readLocked()
+	if err != nil {
+		log.Printf("event log prune: %v", err)
+		return 0
+	}
+
+	kept := events[:0]
+	for _, e := range events {
+		tenantID, _ := tenant.Split(e.RoomCode)
+		if e.At.After(cutoff(tenantID)) {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(events) - len(kept)
+	if removed == 0 {
+		return 0
+	}
+
+	tmp := w.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		log.Printf("event log prune: %v", err)
+		return 0
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range kept {
+		enc.Encode(e)
+	}
+	f.Close()
+	if err := os.Rename(tmp, w.path); err != nil {
+		log.Printf("event log prune: %v", err)
+		return 0
+	}
+
+	w.f.Close()
+	w.f, err = os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("event log reopen: %v", err)
+	}
+	w.enc = json.NewEncoder(w.f)
+	return removed
+}
+
+// Scan counts expired events and finds when the oldest kept one expires.
+func (w *Writer) Scan(cutoff func(string) time.Time, ttl func(string) time.Duration) (int, time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	events, err := w.readLocked()
+	if err != nil {
+		return 0, time.Time{}
+	}
+
+	due := 0
+	var next time.Time
+	for _, e := range events {
+		tenantID, _ := tenant.Split(e.RoomCode)
+		if !e.At.After(cutoff(tenantID)) {
+			due++
+			continue
+		}
+		if expires := e.At.Add(ttl(tenantID)); next.IsZero() || expires.Before(next) {
+			next = expires
+		}
+	}
+	return due, next
+}
+
+func (w *Writer) readLocked() ([]Event, error) {
+	f, err := os.Open(w.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
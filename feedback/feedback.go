@@ -0,0 +1,111 @@
+// Package feedback collects members' ratings of a session after its room
+// closes, and sums them up per tenant for operators.
+package feedback
+
+import (
+	"bufio"
+	"coopcinema/models"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+)
+
+// maxComments is how many recent free-text responses a summary carries.
+const maxComments = 20
+
+var ErrDuplicate = errors.New("feedback for this session was already sent")
+
+// Store appends responses to a JSON Lines file and keeps them in memory for
+// summaries.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	entries []models.Feedback
+	seen    map[string]bool // tenant, room and user ID of every response
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, seen: make(map[string]bool)}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var fb models.Feedback
+		if err := json.Unmarshal(scanner.Bytes(), &fb); err != nil {
+			return nil, err
+		}
+		s.entries = append(s.entries, fb)
+		s.seen[key(fb)] = true
+	}
+	return s, scanner.Err()
+}
+
+// Add records a response. Each member rates a session once.
+func (s *Store) Add(fb models.Feedback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen[key(fb)] {
+		return ErrDuplicate
+	}
+	line, err := json.Marshal(fb)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	s.entries = append(s.entries, fb)
+	s.seen[key(fb)] = true
+	return nil
+}
+
+// Summaries aggregates responses by tenant ("" for the default instance).
+func (s *Store) Summaries() map[string]models.FeedbackSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summaries := make(map[string]models.FeedbackSummary)
+	for _, fb := range s.entries {
+		sum := summaries[fb.Tenant]
+		sum.Responses++
+		sum.Ratings[fb.Rating-1]++
+		sum.Average += float64(fb.Rating)
+		if fb.Text != "" {
+			sum.Comments = append(sum.Comments, fb)
+		}
+		summaries[fb.Tenant] = sum
+	}
+	for tenant, sum := range summaries {
+		sum.Average /= float64(sum.Responses)
+		sort.Slice(sum.Comments, func(i, j int) bool {
+			return sum.Comments[i].At.After(sum.Comments[j].At)
+		})
+		if len(sum.Comments) > maxComments {
+			sum.Comments = sum.Comments[:maxComments]
+		}
+		summaries[tenant] = sum
+	}
+	return summaries
+}
+
+func key(fb models.Feedback) string {
+	return fb.Tenant + "\x00" + fb.Room + "\x00" + fb.UserID + "\x00" + fb.Session
+}
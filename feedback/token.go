@@ -0,0 +1,66 @@
+package feedback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// tokenLifetime is how long after a room closes its members may rate it.
+const tokenLifetime = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidToken = errors.New("feedback token is invalid")
+	ErrExpiredToken = errors.New("feedback token has expired")
+)
+
+// Ticket is what a feedback token vouches for: that UserID was in the
+// scoped room Room when the session that ended at Session closed.
+type Ticket struct {
+	Room      string    `json:"room"`
+	UserID    string    `json:"id"`
+	Session   string    `json:"session"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// Issue signs a ticket for a member of a room that is closing now.
+func Issue(secret []byte, room, userID string, now time.Time) string {
+	payload, _ := json.Marshal(Ticket{
+		Room:      room,
+		UserID:    userID,
+		Session:   now.UTC().Format(time.RFC3339),
+		ExpiresAt: now.Add(tokenLifetime),
+	})
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + sign(secret, body)
+}
+
+// Verify checks a token's signature and lifetime.
+func Verify(secret []byte, token string, now time.Time) (Ticket, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(secret, body))) {
+		return Ticket{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return Ticket{}, ErrInvalidToken
+	}
+	var t Ticket
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return Ticket{}, ErrInvalidToken
+	}
+	if !now.Before(t.ExpiresAt) {
+		return t, ErrExpiredToken
+	}
+	return t, nil
+}
+
+func sign(secret []byte, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("feedback:" + body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,168 @@
+// Package feeds polls RSS, Atom and iCalendar feeds and announces new
+// entries in a room.
+package feeds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultEvery = 30 * time.Minute
+	MinEvery     = 5 * time.Minute
+
+	// maxPerPoll caps announcements per feed per poll; the rest wait for
+	// the next one.
+	maxPerPoll  = 3
+	maxFeedSize = 2 << 20
+)
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+// Source is a feed and the room its entries are announced in.
+type Source struct {
+	URL      string
+	RoomCode string
+	Every    time.Duration
+}
+
+// Announcer posts an entry into a room. It returns false if the room isn't
+// open, in which case the entry is retried on the next poll.
+type Announcer func(roomCode string, item Item) bool
+
+// Poller checks sources and remembers which entries it has announced, in a
+// JSON file so restarts don't repeat them.
+type Poller struct {
+	announce  Announcer
+	statePath string
+
+	mu   sync.Mutex
+	seen map[string]map[string]bool // room + feed URL -> entry ID -> announced
+}
+
+func NewPoller(statePath string, announce Announcer) (*Poller, error) {
+	p := &Poller{announce: announce, statePath: statePath, seen: make(map[string]map[string]bool)}
+	data, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &p.seen); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Watch polls a source on its own schedule, forever.
+func (p *Poller) Watch(src Source) {
+	if src.Every == 0 {
+		src.Every = DefaultEvery
+	}
+	src.Every = max(src.Every, MinEvery)
+
+	p.poll(src)
+	ticker := time.NewTicker(src.Every)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.poll(src)
+	}
+}
+
+func (p *Poller) poll(src Source) {
+	items, err := fetch(src.URL)
+	if err != nil {
+		log.Printf("feed %s: %v", src.URL, err)
+		return
+	}
+
+	key := src.RoomCode + " " + src.URL
+	p.mu.Lock()
+	seen, known := p.seen[key]
+	if !known {
+		// First look at a feed: remember its backlog instead of flooding
+		// the room with it.
+		seen = make(map[string]bool)
+		for _, it := range items {
+			seen[it.ID] = true
+		}
+		p.seen[key] = seen
+		p.mu.Unlock()
+		p.save()
+		return
+	}
+	var fresh []Item
+	for _, it := range items {
+		if !seen[it.ID] {
+			fresh = append(fresh, it)
+		}
+	}
+	p.mu.Unlock()
+
+	// Feeds list newest first; announce oldest first
+	posted := 0
+	for i := len(fresh) - 1; i >= 0 && posted < maxPerPoll; i-- {
+		if !p.announce(src.RoomCode, fresh[i]) {
+			break
+		}
+		p.mu.Lock()
+		seen[fresh[i].ID] = true
+		p.mu.Unlock()
+		posted++
+	}
+	if posted > 0 {
+		log.Printf("📰 Announced %d new entries from %s", posted, src.URL)
+	}
+
+	// Forget entries that have dropped off the feed. An empty fetch is
+	// more likely a glitch than a feed with nothing in it.
+	if len(items) == 0 {
+		return
+	}
+	p.mu.Lock()
+	current := make(map[string]bool, len(items))
+	for _, it := range items {
+		if seen[it.ID] {
+			current[it.ID] = true
+		}
+	}
+	p.seen[key] = current
+	p.mu.Unlock()
+	p.save()
+}
+
+func (p *Poller) save() {
+	p.mu.Lock()
+	data, err := json.Marshal(p.seen)
+	p.mu.Unlock()
+	if err == nil {
+		err = os.WriteFile(p.statePath, data, 0o600)
+	}
+	if err != nil {
+		log.Printf("feeds: saving state: %v", err)
+	}
+}
+
+func fetch(url string) ([]Item, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
@@ -0,0 +1,126 @@
+package feeds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+// Item is one feed entry.
+type Item struct {
+	ID    string
+	Title string
+	Link  string
+}
+
+var ErrUnknownFormat = errors.New("not an RSS, Atom or iCalendar feed")
+
+// Parse reads RSS 2.0, Atom or iCalendar (VEVENT) entries, newest first as
+// the feed lists them.
+func Parse(data []byte) ([]Item, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("BEGIN:VCALENDAR")) {
+		return parseICS(trimmed), nil
+	}
+
+	var doc struct {
+		XMLName xml.Name
+		Items   []struct {
+			Title string `xml:"title"`
+			Link  string `xml:"link"`
+			GUID  string `xml:"guid"`
+		} `xml:"channel>item"`
+		Entries []struct {
+			Title string `xml:"title"`
+			ID    string `xml:"id"`
+			Links []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(trimmed, &doc); err != nil {
+		return nil, ErrUnknownFormat
+	}
+
+	var items []Item
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, it := range doc.Items {
+			id := it.GUID
+			if id == "" {
+				id = it.Link
+			}
+			items = append(items, Item{ID: id, Title: strings.TrimSpace(it.Title), Link: strings.TrimSpace(it.Link)})
+		}
+	case "feed":
+		for _, e := range doc.Entries {
+			item := Item{ID: e.ID, Title: strings.TrimSpace(e.Title)}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.Link = l.Href
+					break
+				}
+			}
+			items = append(items, item)
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+	return items, nil
+}
+
+// parseICS reads VEVENTs, using UID as the ID and SUMMARY as the title.
+func parseICS(data []byte) []Item {
+	// Unfold continuation lines first (RFC 5545 3.1)
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var items []Item
+	var cur *Item
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// Drop parameters such as DTSTART;TZID=...
+		name, _, _ = strings.Cut(name, ";")
+		switch name {
+		case "BEGIN":
+			if value == "VEVENT" {
+				cur = &Item{}
+			}
+		case "END":
+			if value == "VEVENT" && cur != nil {
+				if cur.ID == "" {
+					cur.ID = cur.Title
+				}
+				items = append(items, *cur)
+				cur = nil
+			}
+		case "UID":
+			if cur != nil {
+				cur.ID = value
+			}
+		case "SUMMARY":
+			if cur != nil {
+				cur.Title = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ").Replace(value)
+			}
+		case "URL":
+			if cur != nil {
+				cur.Link = value
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,98 @@
+// Package geoip resolves client addresses to countries from a CSV range
+// database, one "first,last,country" line per range, as in DB-IP's free
+// IP-to-country lite download. IPv4 and IPv6 ranges may be mixed in one
+// file.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+type ipRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// DB is a loaded range database. It is read-only and safe for concurrent
+// use.
+type DB struct {
+	ranges []ipRange // sorted by first address
+}
+
+// Open loads the database at path.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	db := &DB{}
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("%s:%d: want first,last,country", path, line)
+		}
+		first, err1 := netip.ParseAddr(strings.TrimSpace(record[0]))
+		last, err2 := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err1 != nil || err2 != nil {
+			// A header line, if the file has one
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: bad address range", path, line)
+		}
+		db.ranges = append(db.ranges, ipRange{
+			first:   first.Unmap(),
+			last:    last.Unmap(),
+			country: strings.ToUpper(strings.TrimSpace(record[2])),
+		})
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].first.Less(db.ranges[j].first)
+	})
+	return db, nil
+}
+
+// Country returns the ISO 3166 country code for ip, or "" if the address
+// is unparseable or in no range. A nil DB knows no countries.
+func (db *DB) Country(ip string) string {
+	if db == nil {
+		return ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap().WithZone("")
+
+	// The last range starting at or before addr is the only candidate
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].first)
+	}) - 1
+	if i < 0 || db.ranges[i].last.Less(addr) || db.ranges[i].first.Is4() != addr.Is4() {
+		return ""
+	}
+	// ZZ marks ranges with no known country
+	if db.ranges[i].country == "ZZ" {
+		return ""
+	}
+	return db.ranges[i].country
+}
@@ -0,0 +1,136 @@
+// Package grpcwire serves gRPC over HTTP/2 without generated code. Methods
+// read their request with Parse and build replies with Message; Server
+// routes calls to them and frames what they return.
+package grpcwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Message is an encoded protobuf message, built a field at a time. Zero
+// values are left out, as proto3 does.
+type Message []byte
+
+func (m *Message) tag(n, wire int) {
+	*m = binary.AppendUvarint(*m, uint64(n)<<3|uint64(wire))
+}
+
+func (m *Message) String(n int, s string) {
+	if s != "" {
+		m.tag(n, wireBytes)
+		*m = binary.AppendUvarint(*m, uint64(len(s)))
+		*m = append(*m, s...)
+	}
+}
+
+// Int writes an int32 or int64 field.
+func (m *Message) Int(n int, v int64) {
+	if v != 0 {
+		m.tag(n, wireVarint)
+		*m = binary.AppendUvarint(*m, uint64(v))
+	}
+}
+
+func (m *Message) Bool(n int, v bool) {
+	if v {
+		m.tag(n, wireVarint)
+		*m = append(*m, 1)
+	}
+}
+
+func (m *Message) Double(n int, v float64) {
+	if v != 0 {
+		m.tag(n, wireFixed64)
+		*m = binary.LittleEndian.AppendUint64(*m, math.Float64bits(v))
+	}
+}
+
+// Message writes an embedded message, which is written even when empty so
+// the reader can tell it is there; repeated ones are written once each.
+func (m *Message) Message(n int, sub Message) {
+	m.tag(n, wireBytes)
+	*m = binary.AppendUvarint(*m, uint64(len(sub)))
+	*m = append(*m, sub...)
+}
+
+type field struct {
+	wire  int
+	value uint64 // varint and fixed fields
+	bytes []byte
+}
+
+// Fields are a decoded message's fields by number. A field that appears
+// more than once keeps its last value, as proto3 does for scalars.
+type Fields map[int]field
+
+var errMalformed = errors.New("malformed protobuf message")
+
+// Parse decodes a message's fields without knowing its schema.
+func Parse(data []byte) (Fields, error) {
+	fields := make(Fields)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 {
+			return nil, errMalformed
+		}
+		data = data[n:]
+		f := field{wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errMalformed
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, errMalformed
+			}
+			f.value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, errMalformed
+			}
+			f.value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, errMalformed
+			}
+			f.bytes, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return nil, errMalformed
+		}
+		fields[int(key>>3)] = f
+	}
+	return fields, nil
+}
+
+func (f Fields) String(n int) string {
+	if v, ok := f[n]; ok && v.wire == wireBytes {
+		return string(v.bytes)
+	}
+	return ""
+}
+
+// Int reads an int32 or int64 field.
+func (f Fields) Int(n int) int64 {
+	if v, ok := f[n]; ok && v.wire == wireVarint {
+		return int64(v.value)
+	}
+	return 0
+}
+
+func (f Fields) Bool(n int) bool {
+	return f.Int(n) != 0
+}
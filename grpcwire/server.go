@@ -0,0 +1,172 @@
+package grpcwire
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Requests larger than this are refused with ResourceExhausted.
+const maxRequestSize = 1 << 20
+
+// Unary answers a call with one reply. ctx ends when the client goes away
+// or its deadline passes, and a method should give up then.
+type Unary func(ctx context.Context, req Fields) (Message, error)
+
+// Stream answers a call with any number of replies, passed to send, until
+// it returns. ctx ends when the client goes away.
+type Stream func(ctx context.Context, req Fields, send func(Message) error) error
+
+// Server routes gRPC calls, by their "/package.Service/Method" path, to the
+// methods registered on it. It takes HTTP/2 requests only, so wrap it with
+// h2c to serve it without TLS.
+type Server struct {
+	// Authorize, if set, vets every call before it is routed; an error it
+	// returns ends the call.
+	Authorize func(r *http.Request) error
+
+	unary   map[string]Unary
+	streams map[string]Stream
+}
+
+func NewServer() *Server {
+	return &Server{unary: make(map[string]Unary), streams: make(map[string]Stream)}
+}
+
+func (s *Server) Handle(method string, fn Unary) {
+	s.unary[method] = fn
+}
+
+func (s *Server) HandleStream(method string, fn Stream) {
+	s.streams[method] = fn
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	err := s.call(w, r)
+	code, message := OK, ""
+	var status *Error
+	switch {
+	case err == nil:
+	case errors.As(err, &status):
+		code, message = status.Code, status.Message
+	case errors.Is(err, context.DeadlineExceeded):
+		code, message = DeadlineExceeded, "deadline exceeded"
+	case errors.Is(err, context.Canceled):
+		code, message = Canceled, "canceled"
+	default:
+		log.Printf("⚠️  gRPC %s: %v", r.URL.Path, err)
+		code, message = Internal, "internal error"
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		w.Header().Set("Grpc-Message", escapeMessage(message))
+	}
+}
+
+func (s *Server) call(w http.ResponseWriter, r *http.Request) error {
+	unary, isUnary := s.unary[r.URL.Path]
+	stream, isStream := s.streams[r.URL.Path]
+	if !isUnary && !isStream {
+		return Errorf(Unimplemented, "unknown method %s", r.URL.Path)
+	}
+	if s.Authorize != nil {
+		if err := s.Authorize(r); err != nil {
+			return err
+		}
+	}
+
+	ctx := r.Context()
+	if timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	body, err := readFrame(r.Body)
+	if err != nil {
+		return err
+	}
+	req, err := Parse(body)
+	if err != nil {
+		return Errorf(InvalidArgument, "%v", err)
+	}
+
+	if isUnary {
+		reply, err := unary(ctx, req)
+		if err != nil {
+			return err
+		}
+		// A reply after the deadline would be taken for a success the client
+		// already gave up on
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return writeFrame(w, reply)
+	}
+	return stream(ctx, req, func(m Message) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return writeFrame(w, m)
+	})
+}
+
+// readFrame reads the one length-prefixed message a call carries.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, Errorf(InvalidArgument, "missing request message")
+	}
+	if header[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages aren't supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxRequestSize {
+		return nil, Errorf(ResourceExhausted, "request is larger than %d bytes", maxRequestSize)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, Errorf(InvalidArgument, "truncated request message")
+	}
+	return body, nil
+}
+
+func writeFrame(w http.ResponseWriter, m Message) error {
+	frame := make([]byte, 5, 5+len(m))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(m)))
+	if _, err := w.Write(append(frame, m...)); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// parseTimeout reads a grpc-timeout header: up to 8 digits and a unit.
+func parseTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	unit, ok := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}[s[len(s)-1]]
+	return time.Duration(n) * unit, ok
+}
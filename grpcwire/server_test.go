@@ -0,0 +1,353 @@
+package grpcwire
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// rawCodec has grpc-go send and receive messages as already encoded bytes,
+// standing in for generated stubs.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) { return *v.(*[]byte), nil }
+func (rawCodec) Name() string                  { return "proto" }
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+// serve runs s as the server main.go would and returns a grpc-go client
+// for it.
+func serve(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+	ts := httptest.NewServer(h2c.NewHandler(s, &http2.Server{}))
+	t.Cleanup(ts.Close)
+	conn, err := grpc.Dial(strings.TrimPrefix(ts.URL, "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// consume reads a reply with protobuf's own decoder, keeping each field's
+// last value.
+func consume(t *testing.T, data []byte) map[protowire.Number]any {
+	t.Helper()
+	fields := make(map[protowire.Number]any)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatalf("reply: %v", protowire.ParseError(n))
+		}
+		data = data[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			fields[num], data = v, data[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			fields[num], data = v, data[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				t.Fatalf("reply: %v", protowire.ParseError(n))
+			}
+			fields[num], data = string(v), data[n:]
+		default:
+			t.Fatalf("reply field %d has wire type %d", num, typ)
+		}
+	}
+	return fields
+}
+
+func TestUnary(t *testing.T) {
+	s := NewServer()
+	s.Handle("/test.v1.Echo/Echo", func(ctx context.Context, req Fields) (Message, error) {
+		var sub Message
+		sub.String(1, "inner")
+		var m Message
+		m.String(1, req.String(1))
+		m.Int(2, req.Int(2))
+		m.Bool(3, req.Bool(3))
+		m.Double(4, math.Pi)
+		m.Message(5, sub)
+		m.Message(6, nil)
+		m.String(7, "") // zero values aren't sent
+		return m, nil
+	})
+	conn := serve(t, s)
+
+	// The request is written by protobuf's encoder, including a field the
+	// method doesn't know and a repeated scalar whose last value counts
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendString(req, "héllo")
+	req = protowire.AppendTag(req, 2, protowire.VarintType)
+	req = protowire.AppendVarint(req, 7)
+	negative := int64(-42)
+	req = protowire.AppendTag(req, 2, protowire.VarintType)
+	req = protowire.AppendVarint(req, uint64(negative))
+	req = protowire.AppendTag(req, 3, protowire.VarintType)
+	req = protowire.AppendVarint(req, 1)
+	req = protowire.AppendTag(req, 99, protowire.Fixed32Type)
+	req = protowire.AppendFixed32(req, 5)
+
+	var reply []byte
+	if err := conn.Invoke(context.Background(), "/test.v1.Echo/Echo", &req, &reply); err != nil {
+		t.Fatal(err)
+	}
+	got := consume(t, reply)
+	if got[1] != "héllo" || int64(got[2].(uint64)) != -42 || got[3] != uint64(1) {
+		t.Errorf("echoed %v", got)
+	}
+	if math.Float64frombits(got[4].(uint64)) != math.Pi {
+		t.Errorf("double read back as %v", math.Float64frombits(got[4].(uint64)))
+	}
+	if sub := consume(t, []byte(got[5].(string))); sub[1] != "inner" {
+		t.Errorf("embedded message %v", sub)
+	}
+	if got[6] != "" {
+		t.Errorf("empty embedded message %q, want present and empty", got[6])
+	}
+	if _, ok := got[7]; ok {
+		t.Error("empty string sent")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := NewServer()
+	s.Handle("/test.v1.Echo/Fail", func(ctx context.Context, req Fields) (Message, error) {
+		return nil, Errorf(NotFound, "room %q not found: 100%% ✓\n", req.String(1))
+	})
+	s.Handle("/test.v1.Echo/Crash", func(ctx context.Context, req Fields) (Message, error) {
+		return nil, errors.New("database on fire")
+	})
+	conn := serve(t, s)
+
+	var req, reply []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendString(req, "abc")
+	err := conn.Invoke(context.Background(), "/test.v1.Echo/Fail", &req, &reply)
+	if st := status.Convert(err); st.Code() != codes.NotFound || st.Message() != "room \"abc\" not found: 100% ✓\n" {
+		t.Errorf("got %v %q", st.Code(), st.Message())
+	}
+
+	// Only the code gets out, not what went wrong inside
+	err = conn.Invoke(context.Background(), "/test.v1.Echo/Crash", &req, &reply)
+	if st := status.Convert(err); st.Code() != codes.Internal || strings.Contains(st.Message(), "fire") {
+		t.Errorf("got %v %q, want Internal without the error", st.Code(), st.Message())
+	}
+
+	err = conn.Invoke(context.Background(), "/test.v1.Echo/Missing", &req, &reply)
+	if code := status.Code(err); code != codes.Unimplemented {
+		t.Errorf("unknown method: %v, want Unimplemented", code)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	s := NewServer()
+	s.Authorize = func(r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			return Errorf(Unauthenticated, "who are you")
+		}
+		return nil
+	}
+	var called atomic.Bool
+	s.Handle("/test.v1.Echo/Echo", func(ctx context.Context, req Fields) (Message, error) {
+		called.Store(true)
+		return nil, nil
+	})
+	conn := serve(t, s)
+
+	var req, reply []byte
+	if code := status.Code(conn.Invoke(context.Background(), "/test.v1.Echo/Echo", &req, &reply)); code != codes.Unauthenticated || called.Load() {
+		t.Fatalf("without a token: %v, called %v", code, called.Load())
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if err := conn.Invoke(ctx, "/test.v1.Echo/Echo", &req, &reply); err != nil || !called.Load() {
+		t.Fatalf("with the token: %v, called %v", err, called.Load())
+	}
+	if len(reply) != 0 {
+		t.Errorf("empty reply came back as % x", reply)
+	}
+}
+
+// TestDeadline checks a unary method sees the client's deadline, and that
+// a reply made after it isn't passed off as a success.
+func TestDeadline(t *testing.T) {
+	s := NewServer()
+	saw := make(chan error, 1)
+	s.Handle("/test.v1.Echo/Wait", func(ctx context.Context, req Fields) (Message, error) {
+		<-ctx.Done()
+		saw <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	s.Handle("/test.v1.Echo/Late", func(ctx context.Context, req Fields) (Message, error) {
+		time.Sleep(100 * time.Millisecond)
+		return Message{}, nil
+	})
+	conn := serve(t, s)
+
+	var req, reply []byte
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if code := status.Code(conn.Invoke(ctx, "/test.v1.Echo/Wait", &req, &reply)); code != codes.DeadlineExceeded {
+		t.Errorf("got %v, want DeadlineExceeded", code)
+	}
+	select {
+	case err := <-saw:
+		if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+			t.Errorf("method's context ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("method's context never ended")
+	}
+
+	// Asked directly, so the client's own timer doesn't decide it
+	body := make([]byte, 5)
+	r := httptest.NewRequest(http.MethodPost, "/test.v1.Echo/Late", strings.NewReader(string(body)))
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("Grpc-Timeout", "20m")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if got := w.Header().Get("Grpc-Status"); got != "4" {
+		t.Errorf("late reply: grpc-status %q, want 4", got)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("late reply was sent: % x", w.Body.Bytes())
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := NewServer()
+	ended := make(chan error, 1)
+	s.HandleStream("/test.v1.Echo/Count", func(ctx context.Context, req Fields, send func(Message) error) error {
+		for i := int64(1); i <= req.Int(1); i++ {
+			var m Message
+			m.Int(1, i)
+			if err := send(m); err != nil {
+				return err
+			}
+		}
+		if req.Bool(2) {
+			<-ctx.Done()
+			ended <- ctx.Err()
+			return ctx.Err()
+		}
+		return Errorf(ResourceExhausted, "that's all")
+	})
+	conn := serve(t, s)
+	desc := &grpc.StreamDesc{ServerStreams: true}
+
+	open := func(ctx context.Context, count int, hold bool) grpc.ClientStream {
+		t.Helper()
+		stream, err := conn.NewStream(ctx, desc, "/test.v1.Echo/Count")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req []byte
+		req = protowire.AppendTag(req, 1, protowire.VarintType)
+		req = protowire.AppendVarint(req, uint64(count))
+		if hold {
+			req = protowire.AppendTag(req, 2, protowire.VarintType)
+			req = protowire.AppendVarint(req, 1)
+		}
+		if err := stream.SendMsg(&req); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		return stream
+	}
+
+	stream := open(context.Background(), 50, false)
+	for i := uint64(1); ; i++ {
+		var reply []byte
+		err := stream.RecvMsg(&reply)
+		if i > 50 {
+			if code := status.Code(err); code != codes.ResourceExhausted {
+				t.Fatalf("after the last reply: %v, want ResourceExhausted", err)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("reply %d: %v", i, err)
+		}
+		if got := consume(t, reply)[1]; got != i {
+			t.Fatalf("reply %d carried %v", i, got)
+		}
+	}
+
+	// A client hanging up ends the method's context
+	ctx, cancel := context.WithCancel(context.Background())
+	stream = open(ctx, 1, true)
+	var reply []byte
+	if err := stream.RecvMsg(&reply); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case err := <-ended:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("method's context ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("method still running after the client went away")
+	}
+	if err := stream.RecvMsg(&reply); status.Code(err) != codes.Canceled {
+		t.Errorf("after cancelling: %v", err)
+	}
+}
+
+func TestRefused(t *testing.T) {
+	s := NewServer()
+	s.Handle("/test.v1.Echo/Echo", func(ctx context.Context, req Fields) (Message, error) {
+		return Message{}, nil
+	})
+	conn := serve(t, s)
+
+	big := make([]byte, maxRequestSize+1)
+	var reply []byte
+	if code := status.Code(conn.Invoke(context.Background(), "/test.v1.Echo/Echo", &big, &reply)); code != codes.ResourceExhausted {
+		t.Errorf("oversized request: %v, want ResourceExhausted", code)
+	}
+
+	req := []byte{0x0a, 0x05, 'a'} // a string field cut short
+	if code := status.Code(conn.Invoke(context.Background(), "/test.v1.Echo/Echo", &req, &reply)); code != codes.InvalidArgument {
+		t.Errorf("malformed request: %v, want InvalidArgument", code)
+	}
+
+	req = []byte("a request long enough to be worth compressing, a request long enough")
+	err := conn.Invoke(context.Background(), "/test.v1.Echo/Echo", &req, &reply, grpc.UseCompressor("gzip"))
+	if code := status.Code(err); code != codes.Unimplemented {
+		t.Errorf("compressed request: %v, want Unimplemented", code)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/test.v1.Echo/Echo", strings.NewReader("{}")))
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("plain HTTP: %d, want 415", w.Code)
+	}
+}
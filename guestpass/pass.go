@@ -0,0 +1,79 @@
+package guestpass
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalid   = errors.New("guest pass is invalid")
+	ErrNotYet    = errors.New("guest pass is not valid yet")
+	ErrExpired   = errors.New("guest pass has expired")
+	ErrWrongRoom = errors.New("guest pass is for another room")
+)
+
+// Pass grants access to one room between NotBefore and ExpiresAt. An
+// invite is a pass with an ID; a single-use one admits only the first user
+// to redeem it, which the room keeps track of.
+type Pass struct {
+	RoomCode  string    `json:"room"`
+	NotBefore time.Time `json:"nbf"`
+	ExpiresAt time.Time `json:"exp"`
+	ID        string    `json:"id,omitempty"`
+	SingleUse bool      `json:"once,omitempty"`
+}
+
+// Issue signs a pass into an opaque token.
+func Issue(secret []byte, p Pass) string {
+	payload, _ := json.Marshal(p)
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + sign(secret, body)
+}
+
+// Verify checks a token's signature, room and time window.
+func Verify(secret []byte, token, roomCode string, now time.Time) (Pass, error) {
+	p, err := Decode(secret, token)
+	if err != nil {
+		return Pass{}, err
+	}
+
+	switch {
+	case p.RoomCode != roomCode:
+		return p, ErrWrongRoom
+	case now.Before(p.NotBefore):
+		return p, ErrNotYet
+	case !now.Before(p.ExpiresAt):
+		return p, ErrExpired
+	}
+	return p, nil
+}
+
+// Decode checks a token's signature and returns the pass it carries,
+// without checking its room or time window.
+func Decode(secret []byte, token string) (Pass, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(secret, body))) {
+		return Pass{}, ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return Pass{}, ErrInvalid
+	}
+	var p Pass
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return Pass{}, ErrInvalid
+	}
+	return p, nil
+}
+
+func sign(secret []byte, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
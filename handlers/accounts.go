@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"coopcinema/accounts"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"encoding/json"
+	"net/http"
+)
+
+// ServeClaim merges the history of the guest a claim token was issued to
+// into the signed-in account: the one named by the authenticating proxy's
+// header (ACCOUNT_HEADER), or the OAuth session.
+func ServeClaim(h *hub.Hub, store *accounts.Store, w http.ResponseWriter, r *http.Request) {
+	accountID := accountOf(r)
+	if accountID == "" {
+		http.Error(w, "Not signed in", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	guestID, err := accounts.VerifyClaim(cfg.ClaimSecret, req.Token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	rooms, bookmarks := h.GuestHistory(guestID)
+	account, err := store.Merge(accountID, guestID, rooms, bookmarks)
+	if err != nil {
+		http.Error(w, "Could not save account", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// ServeAccount returns the signed-in account's claimed data.
+func ServeAccount(store *accounts.Store, w http.ResponseWriter, r *http.Request) {
+	accountID := accountOf(r)
+	if accountID == "" {
+		http.Error(w, "Not signed in", http.StatusUnauthorized)
+		return
+	}
+	account, ok := store.Get(accountID)
+	if !ok {
+		account = accounts.Account{ID: accountID}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"coopcinema/archive"
+	"coopcinema/bans"
+	"coopcinema/blobstore"
+	"coopcinema/canary"
+	"coopcinema/hub"
+	"coopcinema/ipaddr"
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"coopcinema/retention"
+	"coopcinema/tenant"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Room configs carry their reaction images inline.
+const maxRoomConfigSize = 32 << 20
+
+// requireAdmin checks the bearer token against ADMIN_TOKEN. The admin API
+// is disabled when no token is configured.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if cfg.AdminToken == "" {
+		http.Error(w, "Admin API disabled", http.StatusForbidden)
+		return false
+	}
+	if !adminBearer(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// adminBearer reports whether r carries ADMIN_TOKEN as its bearer token.
+func adminBearer(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1
+}
+
+// ServeArchives lists room archives, optionally filtered by ?room=.
+func ServeArchives(a *archive.Archiver, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.List(r.URL.Query().Get("room")))
+}
+
+// ServeArchive downloads one archive as gzipped JSON.
+func ServeArchive(a *archive.Archiver, store *blobstore.Store, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	key := r.PathValue("key")
+	if !a.Has(key) {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := store.Path(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+key+`"`)
+	http.ServeFile(w, r, path)
+}
+
+// ServeRetentionReport shows, per data source, how much is due for pruning
+// and when the next item expires.
+func ServeRetentionReport(job *retention.Job, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Report(time.Now()))
+}
+
+// ServeMaintenance shows (GET) or changes (PUT) maintenance mode. PUT takes
+// {"active": true, "message": "...", "at": "<RFC 3339>"}; with a future "at"
+// maintenance is announced now and starts then.
+func ServeMaintenance(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	m := h.Maintenance()
+	if r.Method == http.MethodPut {
+		m = models.Maintenance{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&m); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		m = h.SetMaintenance(m)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// ServeExportRoom downloads an open room's setup as JSON, with custom
+// reaction images inlined.
+func ServeExportRoom(h *hub.Hub, store *blobstore.Store, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	room := r.PathValue("code")
+	c, ok := h.ExportConfig(tenant.Scope(r, room))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	for i, e := range c.Emotes {
+		path, err := store.Path(e.Key)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			http.Error(w, "Could not read emote "+e.Name, http.StatusInternalServerError)
+			return
+		}
+		c.Emotes[i].Ext = filepath.Ext(e.Key)
+		c.Emotes[i].Data = data
+	}
+	if c.Schedule != nil {
+		c.Schedule.RoomCode = room
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="room-`+room+`.json"`)
+	json.NewEncoder(w).Encode(c)
+}
+
+// ServeImportRoom applies an exported setup to an open room, storing its
+// reaction images in this instance's blob store.
+func ServeImportRoom(h *hub.Hub, store *blobstore.Store, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var c models.RoomConfig
+	r.Body = http.MaxBytesReader(w, r.Body, maxRoomConfigSize)
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	for _, e := range c.Emotes {
+		if !emoteName.MatchString(e.Name) || !isEmoteExt(e.Ext) {
+			http.Error(w, "Invalid emote "+e.Name, http.StatusBadRequest)
+			return
+		}
+	}
+	// Each stored image is held for the room until it's replaced or the
+	// room closes; they're let go again if the room won't take them
+	stored := 0
+	release := func() {
+		for _, e := range c.Emotes[:stored] {
+			store.Release(e.Key)
+		}
+	}
+	for i, e := range c.Emotes {
+		key, err := store.Put(e.Data, e.Ext)
+		if err != nil {
+			release()
+			http.Error(w, "Could not store emote "+e.Name, http.StatusInternalServerError)
+			return
+		}
+		c.Emotes[i].Key = key
+		stored++
+	}
+
+	replaced, err := h.ImportConfig(tenant.Scope(r, r.PathValue("code")), c)
+	if err != nil {
+		release()
+	}
+	for _, key := range replaced {
+		store.Release(key)
+	}
+	if errors.Is(err, hub.ErrRoomNotFound) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeBan adds server-wide bans: {"ip": "203.0.113.7", "userID": "..."}.
+// Either field may be left out; ip may also be an IPv6 prefix such as
+// "2001:db8:1:2::/64".
+func ServeBan(banList *bans.List, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if banList == nil {
+		http.Error(w, "Ban list disabled (set BANS_FILE)", http.StatusNotFound)
+		return
+	}
+	var req models.BanRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil || (req.IP == "" && req.UserID == "") {
+		http.Error(w, "Expected an ip or userID", http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	if req.IP != "" {
+		ip := ipaddr.Normalize(req.IP)
+		if prefix, err := netip.ParsePrefix(req.IP); err == nil {
+			ip = prefix.Masked().String()
+		}
+		keys = append(keys, bans.Key(bans.KindIP, ip))
+	}
+	if req.UserID != "" {
+		keys = append(keys, bans.Key(bans.KindUser, req.UserID))
+	}
+	for _, key := range keys {
+		if err := banList.Add(key); err != nil {
+			http.Error(w, "Could not save ban", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeTenants lists the tenants.
+func ServeTenants(tenants *tenant.Store, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenants.All())
+}
+
+// ServePutTenant adds or replaces the tenant named in the path, leaving the
+// others as they are. Feed and retention changes apply at the next restart.
+func ServePutTenant(tenants *tenant.Store, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var t tenant.Tenant
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&t); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	t.ID = r.PathValue("id")
+	switch err := tenants.Put(t); {
+	case errors.Is(err, tenant.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, tenant.ErrHostTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, "Could not save tenant", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ServeDeleteTenant removes a tenant. Its rooms stay open until they close.
+func ServeDeleteTenant(tenants *tenant.Store, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	ok, err := tenants.Delete(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Could not delete tenant", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeCanary shows the latest synthetic probe and failure counts.
+func ServeCanary(probe *canary.Canary, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(probe.Status())
+}
+
+// ServeDrops counts dropped connections and lost messages by reason.
+func ServeDrops(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics.Drops())
+}
+
+// ServeWiretap arms recording of a user's next connection, within the hour:
+// {"userID": "..."}.
+func ServeWiretap(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if cfg.WiretapDir == "" {
+		http.Error(w, "Recording disabled (set WIRETAP_DIR)", http.StatusNotFound)
+		return
+	}
+	var req models.WiretapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		http.Error(w, "Expected a userID", http.StatusBadRequest)
+		return
+	}
+	wiretapArms.Arm(req.UserID, time.Hour)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeCloseRoom closes an open room, telling its members why:
+// {"reason": "...", "moveTo": "<room code>"}, both optional.
+func ServeCloseRoom(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req models.CloseRoomRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "This room was closed by the server operator."
+	}
+	if err := h.CloseRoom(tenant.Scope(r, r.PathValue("code")), req.Reason, req.MoveTo); err != nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// announcer is the chat name admin announcements are posted under.
+const announcer = "Server"
+
+// ServeAdminRooms lists the open rooms with member counts and playback.
+func ServeAdminRooms(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.AdminRooms())
+}
+
+// ServeResyncRoom sends everyone in a room its current playback state.
+func ServeResyncRoom(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if !h.Resync(tenant.Scope(r, r.PathValue("code"))) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeAnnounce posts a message into one room's chat or, without a room,
+// every room's: {"message": "...", "room": "<room code>"}.
+func ServeAnnounce(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req models.AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" || utf8.RuneCountInString(req.Message) > maxChatLength {
+		http.Error(w, "Message must be 1-2000 characters", http.StatusBadRequest)
+		return
+	}
+
+	var resp models.AnnouncementResponse
+	if req.Room == "" {
+		resp.Rooms = h.AnnounceAll(announcer, req.Message)
+	} else if h.Announce(tenant.Scope(r, req.Room), announcer, req.Message) {
+		resp.Rooms = 1
+	} else {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"coopcinema/oauth"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookie = "coopcinema_session"
+	nonceCookie   = "coopcinema_oauth"
+	loginTimeout  = 10 * time.Minute // from /auth/login to the callback
+)
+
+// ServeAuthProviders lists the providers users can sign in with, for the
+// sign-in buttons.
+func ServeAuthProviders(providers []*oauth.Provider, w http.ResponseWriter, r *http.Request) {
+	type button struct {
+		Name  string `json:"name"`
+		Label string `json:"label"`
+	}
+	buttons := []button{}
+	for _, p := range providers {
+		buttons = append(buttons, button{p.Name, p.Label})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buttons)
+}
+
+// ServeLogin sends the user to ?provider= to sign in, and back to ?return=
+// (a path on this site) afterwards.
+func ServeLogin(providers []*oauth.Provider, w http.ResponseWriter, r *http.Request) {
+	p := findProvider(providers, r.URL.Query().Get("provider"))
+	if p == nil {
+		http.Error(w, "Unknown sign-in provider", http.StatusNotFound)
+		return
+	}
+	// Only local paths, so the login can't bounce users to another site
+	returnTo := r.URL.Query().Get("return")
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		returnTo = "/"
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	state := oauth.Seal(cfg.SessionSecret, "state", oauth.State{
+		Provider:  p.Name,
+		Return:    returnTo,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(loginTimeout),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     nonceCookie,
+		Value:    nonce,
+		Path:     "/auth/",
+		MaxAge:   int(loginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, p.AuthCodeURL(redirectURI(r), state), http.StatusFound)
+}
+
+// ServeCallback finishes a sign-in: it checks the state came from this
+// browser's login, trades the code for the user's identity and starts a
+// session.
+func ServeCallback(providers []*oauth.Provider, w http.ResponseWriter, r *http.Request) {
+	state, err := oauth.OpenState(cfg.SessionSecret, r.URL.Query().Get("state"), time.Now())
+	nonce, cookieErr := r.Cookie(nonceCookie)
+	if err != nil || cookieErr != nil || nonce.Value != state.Nonce {
+		http.Error(w, "Sign-in expired or was started elsewhere; try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: nonceCookie, Path: "/auth/", MaxAge: -1})
+
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		http.Error(w, "Sign-in was cancelled: "+reason, http.StatusForbidden)
+		return
+	}
+	p := findProvider(providers, state.Provider)
+	if p == nil {
+		http.Error(w, "Unknown sign-in provider", http.StatusNotFound)
+		return
+	}
+	identity, err := p.Exchange(r.Context(), r.URL.Query().Get("code"), redirectURI(r))
+	if err != nil {
+		log.Printf("🔑 Sign-in with %s failed: %v", p.Name, err)
+		http.Error(w, "Sign-in failed", http.StatusBadGateway)
+		return
+	}
+
+	session := oauth.Session{Identity: identity, ExpiresAt: time.Now().Add(cfg.SessionTTL)}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    oauth.Seal(cfg.SessionSecret, "session", session),
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, state.Return, http.StatusFound)
+}
+
+// ServeLogout ends the session.
+func ServeLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeMe says who the caller is signed in as, and so which user ID /ws
+// will give them.
+func ServeMe(w http.ResponseWriter, r *http.Request) {
+	identity := oauth.Identity{ID: accountHeader(r)}
+	if session, ok := sessionFrom(r); ok && identity.ID == "" {
+		identity = session.Identity
+	}
+	if identity.ID == "" {
+		http.Error(w, "Not signed in", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(identity)
+}
+
+// sessionFrom reads the session cookie, if the request carries a valid one.
+func sessionFrom(r *http.Request) (oauth.Session, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return oauth.Session{}, false
+	}
+	session, err := oauth.OpenSession(cfg.SessionSecret, c.Value, time.Now())
+	return session, err == nil
+}
+
+// accountOf is who the caller is signed in as: the account header set by
+// a trusted authenticating proxy, or else an OAuth session. "" for guests.
+func accountOf(r *http.Request) string {
+	if id := accountHeader(r); id != "" {
+		return id
+	}
+	if session, ok := sessionFrom(r); ok {
+		return session.ID
+	}
+	return ""
+}
+
+func findProvider(providers []*oauth.Provider, name string) *oauth.Provider {
+	for _, p := range providers {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// redirectURI is the callback URL registered with providers:
+// OAUTH_REDIRECT_BASE, or else the host the request came in on.
+func redirectURI(r *http.Request) string {
+	if cfg.OAuthRedirect != "" {
+		return cfg.OAuthRedirect + "/auth/callback"
+	}
+	scheme := "http"
+	if secureRequest(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/auth/callback"
+}
+
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"coopcinema/config"
+	"coopcinema/models"
+	"encoding/json"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// paletteVars are the stylesheet's variables each BRAND_COLORS entry sets.
+var paletteVars = map[string]string{
+	"background":   "--theater-darker",
+	"surface":      "--theater-dark",
+	"accent":       "--theater-gold",
+	"accent-light": "--theater-amber",
+	"highlight":    "--theater-yellow",
+	"text":         "--text-primary",
+	"muted":        "--text-secondary",
+}
+
+func branding() models.Branding {
+	c := reloaded.Load()
+	return models.Branding{Title: c.BrandTitle, LogoURL: c.BrandLogoURL, Colors: c.BrandColors, MOTD: c.BrandMOTD}
+}
+
+// ServeBranding describes the instance's branding for clients drawing
+// their own UI.
+func ServeBranding(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branding())
+}
+
+// Frontend serves the web UI from files, with index.html rendered as a
+// template of the branding. It is read on every request, so edits to an
+// on-disk UI show without a restart.
+func Frontend(files http.FileSystem) http.Handler {
+	static := http.FileServer(files)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			static.ServeHTTP(w, r)
+			return
+		}
+		page, err := renderIndex(files)
+		if err != nil {
+			log.Printf("⚠️  index.html: %v", err)
+			http.Error(w, "Page unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(page)
+	})
+}
+
+func renderIndex(files http.FileSystem) ([]byte, error) {
+	f, err := files.Open("/index.html")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	page, err := template.New("index").Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	b := branding()
+	var palette strings.Builder
+	for _, name := range config.BrandColorNames {
+		if color, ok := b.Colors[name]; ok {
+			palette.WriteString(paletteVars[name] + ": " + color + "; ")
+		}
+	}
+	var out bytes.Buffer
+	err = page.Execute(&out, struct {
+		models.Branding
+		Palette template.CSS // validated hex colors only
+	}{b, template.CSS(strings.TrimSpace(palette.String()))})
+	return out.Bytes(), err
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"coopcinema/blobstore"
+	"coopcinema/hub"
+	"coopcinema/tenant"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const maxEmoteSize = 512 << 10
+
+var emoteName = regexp.MustCompile(`^[a-z0-9_]{2,32}$`)
+
+var emoteTypes = map[string]string{
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/jpeg": ".jpg",
+}
+
+func isEmoteExt(ext string) bool {
+	for _, e := range emoteTypes {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeEmotes lists a room's custom reactions, to those who could share
+// the room.
+func ServeEmotes(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	emotes, ok := h.Emotes(code, func(key string) string {
+		return "/blobs/" + key
+	})
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(emotes)
+}
+
+// ServeReactionSummary returns a room's reactions totalled by emoji, with
+// the seconds that drew the most, for a recap after watching. Like the
+// emotes, it's only for those who could share the room.
+func ServeReactionSummary(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	summary, ok := h.ReactionSummary(code)
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// ServeUploadEmote stores an image in the blob store and registers it under
+// ?name= as a room reaction, replacing any image the name had. The image is
+// the raw body or multipart "file". Only the room's host or an admin may.
+func ServeUploadEmote(h *hub.Hub, store *blobstore.Store, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !requireRoomHost(h, w, r, code) {
+		return
+	}
+	if _, _, ok := h.RoomInfo(code); !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	name := strings.ToLower(r.URL.Query().Get("name"))
+	if !emoteName.MatchString(name) {
+		http.Error(w, "Emote name must be 2-32 characters of a-z, 0-9 or _", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEmoteSize)
+	var src io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		src = file
+	}
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	ext, ok := emoteTypes[http.DetectContentType(data)]
+	if !ok {
+		http.Error(w, "Emotes must be PNG, GIF, WebP or JPEG", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	key, err := store.Put(data, ext)
+	if err != nil {
+		http.Error(w, "Could not store image", http.StatusInternalServerError)
+		return
+	}
+
+	// Identical images share a blob across rooms, so the room's reference is
+	// released rather than the file deleted
+	old, ok := h.SetEmote(code, name, key)
+	if !ok {
+		// The room closed while the image was stored
+		store.Release(key)
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if old != "" {
+		store.Release(old)
+	}
+	ServeEmotes(h, w, r)
+}
+
+// ServeDeleteEmote removes a custom reaction from a room, and its image with
+// it unless another reaction still uses it. Only the room's host or an admin
+// may.
+func ServeDeleteEmote(h *hub.Hub, store *blobstore.Store, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !requireRoomHost(h, w, r, code) {
+		return
+	}
+	old, ok := h.DeleteEmote(code, r.PathValue("name"))
+	if !ok {
+		http.Error(w, "Emote not found", http.StatusNotFound)
+		return
+	}
+	if old != "" {
+		store.Release(old)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeBlob serves a stored blob by key.
+func ServeBlob(store *blobstore.Store, w http.ResponseWriter, r *http.Request) {
+	path, err := store.Path(r.PathValue("key"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeFile(w, r, path)
+}
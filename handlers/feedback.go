@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"coopcinema/feedback"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxFeedbackText caps the free-text part of a rating, in characters.
+const maxFeedbackText = 2000
+
+// FeedbackToken signs the token a member of a closing room rates the
+// session with.
+func FeedbackToken(roomCode, userID string) string {
+	return feedback.Issue(cfg.ClaimSecret, roomCode, userID, time.Now())
+}
+
+// ServeFeedback records a member's rating of a session, vouched for by the
+// token in the feedbackRequest they got as the room closed:
+// {"token": "...", "rating": 1-5, "text": "..."}.
+func ServeFeedback(store *feedback.Store, w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		http.Error(w, "Feedback is not collected here", http.StatusNotFound)
+		return
+	}
+
+	var req models.FeedbackRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	switch {
+	case req.Rating < 1 || req.Rating > 5:
+		http.Error(w, "rating must be 1 to 5 stars", http.StatusBadRequest)
+		return
+	case utf8.RuneCountInString(req.Text) > maxFeedbackText:
+		http.Error(w, "text is too long", http.StatusBadRequest)
+		return
+	}
+
+	ticket, err := feedback.Verify(cfg.ClaimSecret, req.Token, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	tenantID, code := tenant.Split(ticket.Room)
+	err = store.Add(models.Feedback{
+		Tenant:  tenantID,
+		Room:    code,
+		UserID:  ticket.UserID,
+		Session: ticket.Session,
+		Rating:  req.Rating,
+		Text:    req.Text,
+		At:      time.Now(),
+	})
+	switch {
+	case errors.Is(err, feedback.ErrDuplicate):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, "Could not save feedback", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ServeFeedbackSummary sums up session feedback per tenant ("" for the
+// default instance), or for one with ?tenant=.
+func ServeFeedbackSummary(store *feedback.Store, w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	summaries := map[string]models.FeedbackSummary{}
+	if store != nil {
+		summaries = store.Summaries()
+	}
+	if r.URL.Query().Has("tenant") {
+		one := r.URL.Query().Get("tenant")
+		summaries = map[string]models.FeedbackSummary{one: summaries[one]}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"coopcinema/models"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Longest values accepted from a WebSocket client, in characters, both on
+// the connection URL and in the messages it sends.
+const (
+	maxNameLength     = 64
+	maxIDLength       = 128
+	maxRoomCodeLength = 64
+	maxChatLength     = 2000
+	maxContentLength  = 4096
+	maxURLLength      = 2048
+)
+
+// tooLong returns why one of msg's fields is over its limit, "" if none
+// is.
+func tooLong(msg models.Message) string {
+	field, limit := "content", maxContentLength
+	if msg.Type == "chat" {
+		field, limit = "chat text", maxChatLength
+	}
+	switch {
+	case utf8.RuneCountInString(msg.Content) > limit:
+		return fmt.Sprintf("%s is longer than %d characters", field, limit)
+	case utf8.RuneCountInString(msg.UserName) > maxNameLength:
+		return fmt.Sprintf("userName is longer than %d characters", maxNameLength)
+	case utf8.RuneCountInString(msg.RoomCode) > maxRoomCodeLength:
+		return fmt.Sprintf("roomCode is longer than %d characters", maxRoomCodeLength)
+	case utf8.RuneCountInString(msg.URL) > maxURLLength:
+		return fmt.Sprintf("url is longer than %d characters", maxURLLength)
+	}
+	return ""
+}
+
+// badJoinParams returns what is wrong with a joiner's name, ID and room
+// code, "" if nothing is.
+func badJoinParams(name, id, roomCode string) string {
+	switch {
+	case utf8.RuneCountInString(name) > maxNameLength:
+		return fmt.Sprintf("Name is longer than %d characters", maxNameLength)
+	case utf8.RuneCountInString(id) > maxIDLength:
+		return fmt.Sprintf("ID is longer than %d characters", maxIDLength)
+	case utf8.RuneCountInString(roomCode) > maxRoomCodeLength:
+		return fmt.Sprintf("Room code is longer than %d characters", maxRoomCodeLength)
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"coopcinema/config"
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"coopcinema/ratelimit"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// strikeMemory is how long a rate limit violation counts against a client.
+const strikeMemory = time.Minute
+
+// messageLimiters holds a token bucket per message type in
+// cfg.MessageRates, keyed by floodGuard.key. The "*" bucket is shared by
+// every type without its own. Set up by Configure and replaced by Reload.
+var messageLimiters atomic.Pointer[map[string]*ratelimit.Limiter]
+
+// newMessageLimiters makes the limiters for c's rates, taking over the
+// buckets of those in old for the types it still limits.
+func newMessageLimiters(c *config.Config, old map[string]*ratelimit.Limiter) *map[string]*ratelimit.Limiter {
+	limiters := make(map[string]*ratelimit.Limiter, len(c.MessageRates))
+	for msgType, r := range c.MessageRates {
+		if l, ok := old[msgType]; ok {
+			l.SetRate(r.PerSecond, r.Burst)
+			limiters[msgType] = l
+		} else {
+			limiters[msgType] = ratelimit.New(r.PerSecond, r.Burst)
+		}
+	}
+	return &limiters
+}
+
+// floodGuard applies the message rate limits to one connection. Each run
+// of refused messages is a strike; the client is warned at every strike
+// and disconnected at MESSAGE_STRIKES within strikeMemory of each other.
+type floodGuard struct {
+	client *models.Client
+	// key names the client's buckets: its user ID, which the server
+	// assigned or verified, and its address (clientKey). Reconnecting as
+	// the same user from the same place doesn't refill them, and nobody
+	// can drain another's by sending under their ID.
+	key        string
+	strikes    int
+	refusing   bool // the last message was refused
+	lastStrike time.Time
+}
+
+// allow reports whether the message may go on to the hub, and whether the
+// client should be disconnected.
+func (g *floodGuard) allow(msgType string) (ok, disconnect bool) {
+	limiters := *messageLimiters.Load()
+	bucket := msgType
+	limiter := limiters[bucket]
+	if limiter == nil {
+		bucket = "*"
+		limiter = limiters[bucket]
+	}
+	if limiter == nil {
+		return true, false
+	}
+
+	allowed, wait := limiter.Reserve(bucket + "|" + g.key)
+	if allowed {
+		g.refusing = false
+		return true, false
+	}
+	if g.refusing {
+		return false, false
+	}
+	g.refusing = true
+
+	now := time.Now()
+	if now.Sub(g.lastStrike) > strikeMemory {
+		g.strikes = 0
+	}
+	g.strikes++
+	g.lastStrike = now
+	if strikes := reloaded.Load().MessageStrikes; strikes > 0 && g.strikes >= strikes {
+		return false, true
+	}
+	g.client.Deliver(models.Message{Type: "rateLimited", Content: msgType, Cooldown: wait.Seconds()})
+	return false, false
+}
+
+// disconnect hangs up on a client that kept flooding, with the reason in
+// the close frame.
+func (g *floodGuard) disconnect(conn *websocket.Conn) {
+	log.Printf("🌊 Disconnected %s (%s) from room %s for flooding", g.client.ID, g.client.Name, g.client.RoomCode)
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Too many messages."),
+		time.Now().Add(cfg.WriteTimeout))
+	if g.client.Close() {
+		metrics.Dropped(metrics.DropFlooded)
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"coopcinema/accounts"
+	"coopcinema/grpcwire"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// The gRPC service, described in proto/coopcinema/v1/rooms.proto
+const grpcService = "/coopcinema.v1.Rooms/"
+
+// GRPC serves the Rooms gRPC service for backend integrations. Callers
+// are trusted with every room, so each call needs ADMIN_TOKEN as bearer
+// authorization metadata.
+func GRPC(h *hub.Hub) http.Handler {
+	s := grpcwire.NewServer()
+	s.Authorize = func(r *http.Request) error {
+		if !adminBearer(r) {
+			return grpcwire.Errorf(grpcwire.Unauthenticated, "authorization must be Bearer ADMIN_TOKEN")
+		}
+		return nil
+	}
+	s.Handle(grpcService+"CreateRoom", func(ctx context.Context, req grpcwire.Fields) (grpcwire.Message, error) {
+		return grpcCreateRoom(ctx, h, req)
+	})
+	s.Handle(grpcService+"GetRoom", func(ctx context.Context, req grpcwire.Fields) (grpcwire.Message, error) {
+		return grpcGetRoom(ctx, h, req)
+	})
+	s.Handle(grpcService+"ListRooms", func(ctx context.Context, req grpcwire.Fields) (grpcwire.Message, error) {
+		return grpcListRooms(ctx, h, req)
+	})
+	s.Handle(grpcService+"DeleteRoom", func(ctx context.Context, req grpcwire.Fields) (grpcwire.Message, error) {
+		return grpcDeleteRoom(ctx, h, req)
+	})
+	s.HandleStream(grpcService+"WatchRoom", func(ctx context.Context, req grpcwire.Fields, send func(grpcwire.Message) error) error {
+		return grpcWatchRoom(ctx, h, req, send)
+	})
+	return s
+}
+
+// CreateRoomRequest{name = 1, password = 2, max_members = 3,
+// owner_account = 4, tenant = 5} -> Room
+func grpcCreateRoom(ctx context.Context, h *hub.Hub, req grpcwire.Fields) (grpcwire.Message, error) {
+	// A caller that gave up isn't left a room it never heard about
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m := h.Maintenance(); m.Active {
+		return nil, grpcwire.Errorf(grpcwire.Unavailable, "%s", m.Message)
+	}
+	create := models.CreateRoomRequest{
+		Name:       req.String(1),
+		Password:   req.String(2),
+		MaxMembers: int(req.Int(3)),
+	}
+	if err := checkCreateRoom(create); err != nil {
+		return nil, grpcwire.Errorf(grpcwire.InvalidArgument, "%v", err)
+	}
+	var owner string
+	if account := req.String(4); account != "" {
+		owner = accounts.AccountKey(account)
+	}
+	tenantID := req.String(5)
+	code, err := reserveRoom(h, tenantID, create, owner)
+	if err != nil {
+		return nil, grpcwire.Errorf(grpcwire.InvalidArgument, "%v", err)
+	}
+	return grpcRoom(h, tenantID, code)
+}
+
+// GetRoomRequest{code = 1, tenant = 2} -> Room
+func grpcGetRoom(ctx context.Context, h *hub.Hub, req grpcwire.Fields) (grpcwire.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return grpcRoom(h, req.String(2), req.String(1))
+}
+
+// ListRoomsRequest{owner_account = 1, tenant = 2} -> ListRoomsResponse{
+// repeated Room rooms = 1}. Without an owner every open room is listed,
+// in every tenant unless one is given.
+func grpcListRooms(ctx context.Context, h *hub.Hub, req grpcwire.Fields) (grpcwire.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var list grpcwire.Message
+	if account := req.String(1); account != "" {
+		tenantID := req.String(2)
+		for _, info := range h.OwnedRooms(accounts.AccountKey(account), tenantID) {
+			list.Message(1, roomMessage(info, tenantID))
+		}
+		return list, nil
+	}
+	for _, room := range h.AdminRooms() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if t := req.String(2); t != "" && room.Tenant != t {
+			continue
+		}
+		// Rooms that closed since being listed are left out
+		if info, _, ok := h.RoomInfo(scoped(room.Tenant, room.Code)); ok {
+			list.Message(1, roomMessage(info, room.Tenant))
+		}
+	}
+	return list, nil
+}
+
+// DeleteRoomRequest{code = 1, tenant = 2, reason = 3} -> DeleteRoomResponse{}
+func grpcDeleteRoom(ctx context.Context, h *hub.Hub, req grpcwire.Fields) (grpcwire.Message, error) {
+	reason := req.String(3)
+	if reason == "" {
+		reason = "This room was closed by the server."
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	code := scoped(req.String(2), req.String(1))
+	if _, _, ok := h.RoomInfo(code); !ok {
+		return nil, grpcwire.Errorf(grpcwire.NotFound, "room not found")
+	}
+	if err := h.CloseRoom(code, reason, ""); err != nil {
+		return nil, grpcwire.Errorf(grpcwire.NotFound, "room not found")
+	}
+	return grpcwire.Message{}, nil
+}
+
+// WatchRoomRequest{code = 1, tenant = 2} -> stream RoomEvent: "state"
+// first, then every message relayed in the room, then "closed" when the
+// room closes.
+func grpcWatchRoom(ctx context.Context, h *hub.Hub, req grpcwire.Fields, send func(grpcwire.Message) error) error {
+	msgs, state, cancel, err := h.Watch(scoped(req.String(2), req.String(1)))
+	if errors.Is(err, hub.ErrRoomNotFound) {
+		return grpcwire.Errorf(grpcwire.NotFound, "room not found")
+	}
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	playback := models.RoomPlayback{SourceType: "none", Position: state.Position, Playing: state.Playing}
+	if state.Media != nil {
+		playback.SourceType, playback.URL = state.Media.SourceType, state.Media.URL
+	}
+	first := roomEvent("state", nil)
+	first.Message(3, playbackMessage(playback))
+	first.Int(4, int64(state.Viewers))
+	if err := send(first); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return send(roomEvent("closed", nil))
+			}
+			if err := send(roomEvent(msg.Type, &msg)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// grpcRoom describes a room as a Room message.
+func grpcRoom(h *hub.Hub, tenantID, code string) (grpcwire.Message, error) {
+	info, _, ok := h.RoomInfo(scoped(tenantID, code))
+	if !ok {
+		return nil, grpcwire.Errorf(grpcwire.NotFound, "room not found")
+	}
+	return roomMessage(info, tenantID), nil
+}
+
+// Room{code = 1, name = 2, members = 3, max_members = 4, protected = 5,
+// Playback playback = 6, tenant = 7}
+func roomMessage(info models.RoomInfo, tenantID string) grpcwire.Message {
+	var m grpcwire.Message
+	m.String(1, info.Code)
+	m.String(2, info.Name)
+	m.Int(3, int64(info.Members))
+	m.Int(4, int64(info.MaxMembers))
+	m.Bool(5, info.Protected)
+	m.Message(6, playbackMessage(info.Playback))
+	m.String(7, tenantID)
+	return m
+}
+
+// Playback{source_type = 1, url = 2, position = 3, playing = 4}
+func playbackMessage(p models.RoomPlayback) grpcwire.Message {
+	var m grpcwire.Message
+	m.String(1, p.SourceType)
+	m.String(2, p.URL)
+	m.Double(3, p.Position)
+	m.Bool(4, p.Playing)
+	return m
+}
+
+// RoomEvent{type = 1, at = 2 (Unix ms), Playback playback = 3,
+// viewers = 4, message_json = 5}
+func roomEvent(eventType string, msg *models.Message) grpcwire.Message {
+	var m grpcwire.Message
+	m.String(1, eventType)
+	m.Int(2, time.Now().UnixMilli())
+	if msg != nil {
+		data, _ := json.Marshal(msg)
+		m.String(5, string(data))
+	}
+	return m
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"coopcinema/config"
+	"coopcinema/grpcwire"
+	"coopcinema/hub"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// rawCodec has grpc-go send and receive messages as already encoded bytes,
+// standing in for stubs generated from rooms.proto.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) { return *v.(*[]byte), nil }
+func (rawCodec) Name() string                  { return "proto" }
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+// grpcClient serves the Rooms service for h and returns a grpc-go client
+// for it with a context carrying ADMIN_TOKEN.
+func grpcClient(t *testing.T, h *hub.Hub) (*grpc.ClientConn, context.Context) {
+	t.Helper()
+	Configure(&config.Config{AdminToken: "secret"})
+	ts := httptest.NewServer(h2c.NewHandler(GRPC(h), &http2.Server{}))
+	t.Cleanup(ts.Close)
+	conn, err := grpc.Dial(strings.TrimPrefix(ts.URL, "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+}
+
+// stringFields builds a request of string fields, numbered from 1, as
+// protobuf encodes it.
+func stringFields(values ...string) []byte {
+	var b []byte
+	for i, v := range values {
+		if v != "" {
+			b = protowire.AppendTag(b, protowire.Number(i+1), protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		}
+	}
+	return b
+}
+
+// fieldsOf decodes a reply with protobuf's own decoder: varints as uint64,
+// length-delimited fields as strings, repeated ones in order.
+func fieldsOf(t *testing.T, data []byte) map[protowire.Number][]any {
+	t.Helper()
+	fields := make(map[protowire.Number][]any)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatalf("reply: %v", protowire.ParseError(n))
+		}
+		data = data[n:]
+		var v any
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(data)
+		case protowire.BytesType:
+			var b []byte
+			b, n = protowire.ConsumeBytes(data)
+			v = string(b)
+		default:
+			n = -1
+		}
+		if n < 0 {
+			t.Fatalf("reply field %d: wire type %d", num, typ)
+		}
+		fields[num] = append(fields[num], v)
+		data = data[n:]
+	}
+	return fields
+}
+
+func TestGRPCRooms(t *testing.T) {
+	h := hub.NewHub()
+	conn, ctx := grpcClient(t, h)
+	call := func(method string, req []byte) (map[protowire.Number][]any, error) {
+		var reply []byte
+		if err := conn.Invoke(ctx, grpcService+method, &req, &reply); err != nil {
+			return nil, err
+		}
+		return fieldsOf(t, reply), nil
+	}
+
+	// CreateRoomRequest{name = 1, password = 2, max_members = 3}
+	req := stringFields("Movie night", "hunter2")
+	req = protowire.AppendTag(req, 3, protowire.VarintType)
+	req = protowire.AppendVarint(req, 5)
+	room, err := call("CreateRoom", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := room[1][0].(string)
+	if code == "" || room[2][0] != "Movie night" || room[4][0] != uint64(5) || room[5][0] != uint64(1) {
+		t.Fatalf("created %v", room)
+	}
+	if playback := fieldsOf(t, []byte(room[6][0].(string))); playback[1][0] != "none" {
+		t.Errorf("new room's playback %v", playback)
+	}
+
+	got, err := call("GetRoom", stringFields(code))
+	if err != nil || got[1][0] != code {
+		t.Fatalf("GetRoom: %v, %v", got, err)
+	}
+	if _, err := call("GetRoom", stringFields("nosuchroom")); status.Code(err) != codes.NotFound {
+		t.Errorf("GetRoom of no room: %v, want NotFound", err)
+	}
+
+	list, err := call("ListRooms", nil)
+	if err != nil || len(list[1]) != 1 || fieldsOf(t, []byte(list[1][0].(string)))[1][0] != code {
+		t.Fatalf("ListRooms: %v, %v", list, err)
+	}
+
+	// Watching, then deleting: the stream starts with the room's state and
+	// ends with it closing
+	watch, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, grpcService+"WatchRoom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchReq := stringFields(code)
+	if err := watch.SendMsg(&watchReq); err != nil {
+		t.Fatal(err)
+	}
+	watch.CloseSend()
+	var event []byte
+	if err := watch.RecvMsg(&event); err != nil || fieldsOf(t, event)[1][0] != "state" {
+		t.Fatalf("first event: %v, %v", fieldsOf(t, event), err)
+	}
+
+	if _, err := call("DeleteRoom", stringFields(code, "", "done")); err != nil {
+		t.Fatal(err)
+	}
+	// Members are told first, and the watcher sees that too
+	for _, want := range []string{"roomClosed", "closed"} {
+		if err := watch.RecvMsg(&event); err != nil || fieldsOf(t, event)[1][0] != want {
+			t.Fatalf("after deleting: %v, %v; want %s", fieldsOf(t, event), err, want)
+		}
+	}
+	if err := watch.RecvMsg(&event); err != io.EOF {
+		t.Errorf("after closed: %v, want the stream to end", err)
+	}
+	if _, err := call("DeleteRoom", stringFields(code)); status.Code(err) != codes.NotFound {
+		t.Errorf("deleting again: %v, want NotFound", err)
+	}
+
+	var reply []byte
+	if err := conn.Invoke(context.Background(), grpcService+"ListRooms", &[]byte{}, &reply); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("without ADMIN_TOKEN: %v, want Unauthenticated", err)
+	}
+}
+
+// TestGRPCGaveUp checks a call whose caller has gone changes nothing.
+func TestGRPCGaveUp(t *testing.T) {
+	h := hub.NewHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := grpcwire.Parse(stringFields("Movie night"))
+	if _, err := grpcCreateRoom(ctx, h, req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("CreateRoom after the caller left: %v", err)
+	}
+	if rooms := h.AdminRooms(); len(rooms) != 0 {
+		t.Fatalf("CreateRoom after the caller left made %d rooms", len(rooms))
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"coopcinema/guestpass"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultPassLead = 30 * time.Minute
+	defaultPassTail = 4 * time.Hour
+	maxPassWindow   = 24 * time.Hour // for each of before and after
+)
+
+// ServeGuestPass issues a guest pass valid from `before` ahead of the room's
+// next scheduled start until `after` past it. Both are Go durations of up
+// to a day. Only the room's host or an admin may issue passes.
+func ServeGuestPass(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	room := r.URL.Query().Get("room")
+	roomCode := tenant.Scope(r, room)
+	if roomCode == "" {
+		http.Error(w, "Missing room", http.StatusBadRequest)
+		return
+	}
+
+	if !requireRoomHost(h, w, r, roomCode) {
+		return
+	}
+
+	s, ok := h.Schedule(roomCode)
+	if !ok || s.Next.IsZero() {
+		http.Error(w, "Room has no upcoming scheduled start", http.StatusNotFound)
+		return
+	}
+
+	lead, err := durationParam(r, "before", defaultPassLead)
+	if err != nil || lead < 0 || lead > maxPassWindow {
+		http.Error(w, "before must be a duration up to 24h", http.StatusBadRequest)
+		return
+	}
+	tail, err := durationParam(r, "after", defaultPassTail)
+	if err != nil || tail <= 0 || tail > maxPassWindow {
+		http.Error(w, "after must be a duration up to 24h", http.StatusBadRequest)
+		return
+	}
+
+	pass := guestpass.Pass{
+		RoomCode:  roomCode,
+		NotBefore: s.Next.Add(-lead),
+		ExpiresAt: s.Next.Add(tail),
+	}
+	token := guestpass.Issue(cfg.GuestPassSecret, pass)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GuestPassResponse{
+		Token:     token,
+		URL:       "/?room=" + url.QueryEscape(room) + "&pass=" + url.QueryEscape(token),
+		NotBefore: pass.NotBefore,
+		ExpiresAt: pass.ExpiresAt,
+	})
+}
+
+func durationParam(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"coopcinema/config"
+	"coopcinema/guestpass"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestPassRequired checks a schedule that requires guest passes turns away
+// a join without one and lets one with a pass in.
+func TestPassRequired(t *testing.T) {
+	c, err := config.Flags(flag.NewFlagSet("test", flag.ContinueOnError)).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Configure(c)
+	h := hub.NewHub()
+	start := time.Now().Add(time.Hour)
+	if err := h.SetSchedule(&models.Schedule{RoomCode: "movienight", Start: start, PassRequired: true}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(h, nil, nil, nil, w, r)
+	}))
+	t.Cleanup(ts.Close)
+	join := func(pass string) (*websocket.Conn, *http.Response, error) {
+		q := url.Values{"room": {"movienight"}, "name": {"Ann"}}
+		if pass != "" {
+			q.Set("pass", pass)
+		}
+		return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws?"+q.Encode(), nil)
+	}
+
+	if _, resp, err := join(""); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("without a pass: %v, %v; want 403", resp, err)
+	}
+
+	pass := guestpass.Issue(c.GuestPassSecret, guestpass.Pass{
+		RoomCode:  "movienight",
+		NotBefore: time.Now().Add(-time.Minute),
+		ExpiresAt: start.Add(time.Hour),
+	})
+	conn, _, err := join(pass)
+	if err != nil {
+		t.Fatalf("with a pass: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"coopcinema/highlights"
+	"coopcinema/hub"
+	"coopcinema/tenant"
+	"fmt"
+	"net/http"
+)
+
+// ServeHighlights exports a room's most-reacted moments and bookmarks as a
+// CSV (default) or CMX3600 EDL for cutting a highlight clip offline. A room
+// with a password needs it, as for subtitles.
+func ServeHighlights(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	room := r.URL.Query().Get("room")
+	roomCode := tenant.Scope(r, room)
+	if roomCode == "" {
+		http.Error(w, "Missing room", http.StatusBadRequest)
+		return
+	}
+	if !mayShareWith(h, r, roomCode) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	reactions, bookmarks, ok := h.Activity(roomCode)
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	marks := make([]highlights.Bookmark, len(bookmarks))
+	for i, b := range bookmarks {
+		marks[i] = highlights.Bookmark{Time: b.Time, Label: b.Label}
+	}
+	clips := highlights.Build(reactions, marks)
+
+	switch r.URL.Query().Get("format") {
+	case "edl":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-highlights.edl"`, room))
+		highlights.WriteEDL(w, "Co-op Cinema "+room+" highlights", clips)
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-highlights.csv"`, room))
+		highlights.WriteCSV(w, clips)
+	default:
+		http.Error(w, "Unknown format", http.StatusBadRequest)
+	}
+}
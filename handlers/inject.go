@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const maxInjectSize = 16 << 10
+
+// ServeInjectMessage lets an external system post into a room with a room
+// API token: {"type": "chat", "content": "..."} or {"type": "pause"}.
+func ServeInjectMessage(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Missing API token", http.StatusUnauthorized)
+		return
+	}
+
+	var msg models.Message
+	r.Body = http.MaxBytesReader(w, r.Body, maxInjectSize)
+	err := json.NewDecoder(r.Body).Decode(&msg)
+	var badPayload *models.PayloadError
+	if errors.As(err, &badPayload) {
+		http.Error(w, badPayload.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	msg.ApplyPayload()
+
+	err = h.Inject(tenant.Scope(r, r.PathValue("code")), token, msg)
+	switch {
+	case errors.Is(err, hub.ErrRoomNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, hub.ErrBadToken):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, hub.ErrTypeNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"coopcinema/guestpass"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultInviteTTL = 24 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+)
+
+// ServeCreateInvite issues an invite to a room: a signed token that lets its
+// holder join without the password until it expires, or only once with
+// singleUse. Anyone who may share into the room may invite to it: its
+// owner, anyone for a room without a password, or whoever sends the
+// password in X-Room-Password.
+func ServeCreateInvite(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	room := r.PathValue("code")
+	code := tenant.Scope(r, room)
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	var req models.InviteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	ttl := defaultInviteTTL
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > maxInviteTTL {
+			http.Error(w, "ttl must be a duration up to 720h", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	pass := guestpass.Pass{
+		RoomCode:  code,
+		NotBefore: now,
+		ExpiresAt: now.Add(ttl),
+		ID:        generateRoomCode(),
+		SingleUse: req.SingleUse,
+	}
+	token := guestpass.Issue(cfg.GuestPassSecret, pass)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.InviteResponse{
+		Token:     token,
+		URL:       "/?room=" + url.QueryEscape(room) + "&invite=" + url.QueryEscape(token),
+		ExpiresAt: pass.ExpiresAt,
+		SingleUse: pass.SingleUse,
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"coopcinema/bans"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/ratelimit"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Failed joins with a bad credential back off exponentially, per client
+// and per room. A client that keeps going long after its lockouts reach the
+// cap is banned outright when a ban list is configured.
+var (
+	clientJoinFailures = ratelimit.NewBackoff(5, time.Second, time.Hour)
+	roomJoinFailures   = ratelimit.NewBackoff(20, time.Second, 5*time.Minute)
+)
+
+const banAfterFailures = 100
+
+// joinLocked refuses the request if the client or the room is locked out,
+// and reports whether it did.
+func joinLocked(w http.ResponseWriter, r *http.Request, roomCode string) bool {
+	wait := max(clientJoinFailures.Locked(clientKey(r)), roomJoinFailures.Locked(roomCode))
+	if wait == 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// joinFailed counts a rejected credential against the client and the room.
+// The host hears about it when the room gets locked.
+func joinFailed(h *hub.Hub, banList *bans.List, r *http.Request, roomCode string) {
+	failures, _ := clientJoinFailures.Fail(clientKey(r))
+	if failures == banAfterFailures && banList != nil {
+		if err := banList.Add(bans.Key(bans.KindIP, clientKey(r))); err == nil {
+			log.Printf("🚫 Banned %s after %d failed joins", clientKey(r), failures)
+		}
+	}
+
+	roomFailures, lockout := roomJoinFailures.Fail(roomCode)
+	if lockout > 0 {
+		log.Printf("🔒 Room %s locked for %s after %d failed joins", roomCode, lockout, roomFailures)
+		h.NotifyHost(roomCode, models.Message{
+			Type:     "joinAttack",
+			Content:  strconv.Itoa(roomFailures),
+			Cooldown: lockout.Seconds(),
+		})
+	}
+}
+
+// joinSucceeded clears the client's failures once it gets in.
+func joinSucceeded(r *http.Request) {
+	clientJoinFailures.Reset(clientKey(r))
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/tenant"
+	"encoding/json"
+	"net/http"
+)
+
+// ServeLeaderboard ranks a scheduled room's members by accumulated watch
+// time, with their attendance streaks. While the room is open, one with a
+// password shows them only to those who could share the room.
+func ServeLeaderboard(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if _, _, open := h.RoomInfo(code); open && !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := h.Schedule(code); !ok {
+		http.Error(w, "Leaderboards are kept for scheduled rooms only", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Leaderboard.Standings(code))
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/lyrics"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const maxLyricsSize = 256 << 10
+
+// ServeLyrics returns a room's parsed LRC cues on GET and replaces them on
+// POST. The upload may be a raw LRC body or a multipart form field "file",
+// and only the room's host (or an admin) may make it. A room with a
+// password only shows its cues to those who could share the room.
+func ServeLyrics(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	roomCode := tenant.Scope(r, r.URL.Query().Get("room"))
+	if roomCode == "" {
+		http.Error(w, "Missing room", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !mayShareWith(h, r, roomCode) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		cues, ok := h.Lyrics(roomCode)
+		if !ok {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if cues == nil {
+			cues = []models.LyricCue{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.LyricsResponse{Cues: cues})
+
+	case http.MethodPost:
+		if !requireRoomHost(h, w, r, roomCode) {
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxLyricsSize)
+
+		var src io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "Missing file", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			src = file
+		}
+
+		cues, err := lyrics.Parse(src)
+		if err != nil {
+			http.Error(w, "Invalid LRC file", http.StatusBadRequest)
+			return
+		}
+		if len(cues) == 0 {
+			http.Error(w, "No timed lines found", http.StatusBadRequest)
+			return
+		}
+		if !h.SetLyrics(roomCode, cues) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+
+		h.BroadcastRoom(roomCode, models.Message{Type: "lyrics"})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.LyricsResponse{Cues: cues})
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
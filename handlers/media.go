@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/mediastore"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"coopcinema/transcode"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// videoExts are the uploads accepted, by file extension.
+var videoExts = map[string]bool{
+	".mp4":  true,
+	".m4v":  true,
+	".webm": true,
+	".mkv":  true,
+	".mov":  true,
+	".ogv":  true,
+}
+
+// transcodeExts are containers browsers mostly can't play, transcoded to
+// HLS when transcoding is on. ?transcode=1 asks for it for any upload.
+var transcodeExts = map[string]bool{
+	".mkv": true,
+	".mov": true,
+}
+
+func init() {
+	// Not in every system's MIME table; players want the right type
+	mime.AddExtensionType(".mkv", "video/x-matroska")
+	mime.AddExtensionType(".mov", "video/quicktime")
+	mime.AddExtensionType(".m4v", "video/mp4")
+	mime.AddExtensionType(".m3u8", "application/vnd.apple.mpegurl")
+	mime.AddExtensionType(".ts", "video/mp2t")
+}
+
+// ServeUploadMedia stores a video for a room and returns the URL it streams
+// from, for the uploader to load as a direct URL. The file is multipart
+// "file", read as it arrives rather than buffered, so large videos are fine.
+// With a transcoder, containers browsers can't play are also queued for
+// HLS; stream is then the playlist URL the room gets in mediaReady.
+func ServeUploadMedia(h *hub.Hub, store *mediastore.Store, transcoder *transcode.Pool, w http.ResponseWriter, r *http.Request) {
+	if cfg.MaxUploadSize == 0 {
+		http.Error(w, "Uploads are disabled", http.StatusForbidden)
+		return
+	}
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxUploadSize+1<<20)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart upload", http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		name := filepath.Base(part.FileName())
+		ext := strings.ToLower(filepath.Ext(name))
+		if !videoExts[ext] {
+			http.Error(w, "Not a supported video file (mp4, m4v, webm, mkv, mov, ogv)", http.StatusUnsupportedMediaType)
+			return
+		}
+		id, size, err := store.Create(code, ext, part, cfg.MaxUploadSize)
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, mediastore.ErrTooLarge) || errors.As(err, &tooLarge):
+			http.Error(w, "Video is too large", http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			http.Error(w, "Could not store video", http.StatusInternalServerError)
+			return
+		}
+
+		resp := models.MediaUploadResponse{
+			URL:  "/media/" + url.PathEscape(r.PathValue("code")) + "/" + id,
+			Name: name,
+			Size: size,
+		}
+		if transcoder != nil && (transcodeExts[ext] || r.URL.Query().Get("transcode") == "1") {
+			input, _ := store.Path(code, id)
+			job := transcode.Job{ID: id, Room: code, Name: name, Source: resp.URL, Playlist: resp.URL + "/hls/index.m3u8"}
+			// A busy server still keeps the upload; it just isn't transcoded
+			if err := transcoder.Submit(job, input, store.StreamDir(code, id)); err == nil {
+				resp.Stream = job.Playlist
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+}
+
+// ServeMedia streams a room's uploaded video, with Range support so players
+// can seek without fetching the whole file. Videos are open to anyone with
+// the URL while the room lasts: players can't send X-Room-Password, so the
+// unguessable ID is what keeps them private.
+func ServeMedia(h *hub.Hub, store *mediastore.Store, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if _, _, ok := h.RoomInfo(code); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := store.Path(code, r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeFile(w, r, path)
+}
+
+// ServeMediaStream serves the HLS playlist and segments transcoded from a
+// room's uploaded video, on the same terms as the video itself.
+func ServeMediaStream(h *hub.Hub, store *mediastore.Store, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if _, _, ok := h.RoomInfo(code); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := store.StreamPath(code, r.PathValue("id"), r.PathValue("file"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeFile(w, r, path)
+}
+
+// ServeTranscodeJob reports how transcoding a room's uploaded video is
+// going.
+func ServeTranscodeJob(h *hub.Hub, transcoder *transcode.Pool, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if transcoder == nil {
+		http.Error(w, "Transcoding is disabled", http.StatusNotFound)
+		return
+	}
+	job, ok := transcoder.Job(code, r.PathValue("id"))
+	if !ok {
+		http.Error(w, "No such transcode", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
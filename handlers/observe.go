@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/tenant"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServeObserve streams a room's messages as Server-Sent Events for
+// dashboards and overlays. The token comes from ?token= (EventSource can't
+// set headers) or a bearer header. The first event is "state" with what the
+// room is watching; every relayed message follows as "message".
+func ServeObserve(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	msgs, state, cancel, err := h.Observe(tenant.Scope(r, r.PathValue("code")), token)
+	switch {
+	case errors.Is(err, hub.ErrRoomNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, hub.ErrTypeNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	writeEvent(w, "state", state)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(cfg.ServerTimeEvery)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				writeEvent(w, "closed", struct{}{})
+				flusher.Flush()
+				return
+			}
+			writeEvent(w, "message", msg)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
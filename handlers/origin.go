@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// originAllowed reports whether a WebSocket upgrade may go ahead from the
+// page that asked for it. Browsers always send Origin, so a request without
+// one isn't from a page at all. Pages served from the host the request
+// came in on may connect, as may those on ALLOWED_ORIGINS hosts; anyone may
+// with ALLOW_ANY_ORIGIN.
+func originAllowed(r *http.Request) bool {
+	c := reloaded.Load()
+	origin := r.Header.Get("Origin")
+	if origin == "" || c.AllowAnyOrigin {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if originMatches(strings.ToLower(u.Host), allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// originMatches reports whether host, an origin's host and port, is
+// allowed: a port in allowed must match, and *.example.com allows any
+// subdomain of example.com but not example.com itself.
+func originMatches(host, allowed string) bool {
+	if _, _, err := net.SplitHostPort(allowed); err != nil {
+		// No port given, so any will do
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+			if strings.Contains(h, ":") {
+				host = "[" + h + "]"
+			}
+		}
+	}
+	if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == allowed
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"coopcinema/overlay"
+	"net/http"
+)
+
+// ServeOverlay serves the OBS browser-source page for a room. It needs an
+// observe token, which the page passes on to the observer stream.
+func ServeOverlay(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	overlay.Render(w, r.PathValue("code"), token)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"coopcinema/accounts"
+	"coopcinema/models"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// callerKey says who a request is from, for preferences and room
+// ownership: the signed-in account if there is one, or else the device its
+// token names.
+func callerKey(r *http.Request, deviceToken string) (string, bool) {
+	if accountID := accountOf(r); accountID != "" {
+		return accounts.AccountKey(accountID), true
+	}
+	if deviceToken == "" {
+		return "", false
+	}
+	deviceID, err := accounts.VerifyDevice(cfg.ClaimSecret, deviceToken)
+	if err != nil {
+		return "", false
+	}
+	return accounts.DeviceKey(deviceID), true
+}
+
+// newDeviceToken mints a token for a browser seen for the first time.
+func newDeviceToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return accounts.DeviceToken(cfg.ClaimSecret, hex.EncodeToString(b))
+}
+
+// ServeGetPreferences returns the caller's preferences, empty if none were
+// saved yet. Guests identify with the X-Device-Token header.
+func ServeGetPreferences(store *accounts.PreferenceStore, w http.ResponseWriter, r *http.Request) {
+	key, ok := callerKey(r, r.Header.Get("X-Device-Token"))
+	if !ok {
+		http.Error(w, "Not signed in and no device token", http.StatusUnauthorized)
+		return
+	}
+	prefs, _ := store.Get(key)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// ServePutPreferences replaces the caller's preferences.
+func ServePutPreferences(store *accounts.PreferenceStore, w http.ResponseWriter, r *http.Request) {
+	key, ok := callerKey(r, r.Header.Get("X-Device-Token"))
+	if !ok {
+		http.Error(w, "Not signed in and no device token", http.StatusUnauthorized)
+		return
+	}
+
+	var prefs models.Preferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	prefs.Name = strings.TrimSpace(prefs.Name)
+	if err := checkPreferences(prefs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := store.Put(key, prefs); err != nil {
+		http.Error(w, "Could not save preferences", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// Themes the frontend knows how to draw; "" is the default.
+var themes = map[string]bool{"": true, "theater": true, "midnight": true}
+
+// Notification settings the frontend understands.
+var notificationSettings = map[string]bool{"chatSound": true, "chatToast": true}
+
+func checkPreferences(p models.Preferences) error {
+	switch {
+	case utf8.RuneCountInString(p.Name) > 64:
+		return errors.New("name is longer than 64 characters")
+	case len(p.SubtitleLanguage) > 16:
+		return errors.New("subtitleLanguage is not a language tag")
+	case math.IsNaN(p.AVOffset) || math.Abs(p.AVOffset) > 5:
+		return errors.New("avOffset must be within 5 seconds either way")
+	case !themes[p.Theme]:
+		return errors.New("unknown theme")
+	}
+	for name := range p.Notifications {
+		if !notificationSettings[name] {
+			return errors.New("unknown notification setting " + name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"encoding/json"
+	"net/http"
+)
+
+// ServeProtocol describes the WebSocket message types this server speaks,
+// for third-party client authors.
+func ServeProtocol(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Protocol())
+}
+
+// ServeCapabilities lists the protocol versions and message types this
+// server supports, for clients to check before connecting.
+func ServeCapabilities(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Capabilities())
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// fromTrustedProxy reports whether r came straight from one of
+// TRUSTED_PROXIES, so that headers it adds about the client can be believed.
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return trustedProxy(host)
+}
+
+// trustedProxy reports whether ip is in TRUSTED_PROXIES.
+func trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+	for _, p := range cfg.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor is the client X-Forwarded-For names: the last address in it
+// that isn't one of TRUSTED_PROXIES, since each proxy appends the peer it
+// got the request from and anything before the first trusted one is
+// whatever the client sent. "" if there is none.
+func forwardedFor(r *http.Request) string {
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			return ""
+		}
+		if !trustedProxy(hop) {
+			return hop
+		}
+	}
+	return ""
+}
+
+// accountHeader is the account the authenticating proxy says the caller is
+// signed in as, or "" without ACCOUNT_HEADER or from anywhere but a trusted
+// proxy.
+func accountHeader(r *http.Request) string {
+	if cfg.AccountHeader == "" || !fromTrustedProxy(r) {
+		return ""
+	}
+	return r.Header.Get(cfg.AccountHeader)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"coopcinema/guestpass"
+	"coopcinema/hub"
+	"coopcinema/qrcode"
+	"coopcinema/tenant"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultQRScale = 8
+	maxQRScale     = 32
+)
+
+// ServeRoomQR renders a room's join link as a QR code, for a host to put on
+// the big screen: SVG by default, or PNG with format=png, scale pixels to
+// the module. An invite token from /invites is carried in the link, so
+// phones scanning it skip the password, and vouches for the caller as well;
+// without one the caller needs what /invites needs.
+func ServeRoomQR(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	room := r.PathValue("code")
+	code := tenant.Scope(r, room)
+	invite := r.URL.Query().Get("invite")
+	if invite != "" {
+		if _, err := guestpass.Verify(cfg.GuestPassSecret, invite, code, time.Now()); err != nil {
+			http.Error(w, "Invite: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		if _, _, ok := h.RoomInfo(code); !ok {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+	} else if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	scheme := "http"
+	if secureRequest(r) {
+		scheme = "https"
+	}
+	link := scheme + "://" + r.Host + "/?room=" + url.QueryEscape(room)
+	if invite != "" {
+		link += "&invite=" + url.QueryEscape(invite)
+	}
+	qr, err := qrcode.Encode(link, qrcode.Medium)
+	if err != nil {
+		http.Error(w, "Join link too long for a QR code", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	switch r.URL.Query().Get("format") {
+	case "", "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(qr.SVG())
+	case "png":
+		scale := defaultQRScale
+		if s := r.URL.Query().Get("scale"); s != "" {
+			scale, err = strconv.Atoi(s)
+			if err != nil || scale < 1 || scale > maxQRScale {
+				http.Error(w, "scale must be 1 to 32", http.StatusBadRequest)
+				return
+			}
+		}
+		img, err := qr.PNG(scale)
+		if err != nil {
+			http.Error(w, "Could not render QR code", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(img)
+	default:
+		http.Error(w, "format must be svg or png", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"unicode/utf8"
+)
+
+// reserveRoom creates a room in a tenant ("" for the default instance)
+// under a fresh code with req's options and returns the code.
+func reserveRoom(h *hub.Hub, tenantID string, req models.CreateRoomRequest, owner string) (string, error) {
+	opts := models.RoomOptions{Name: req.Name, MaxMembers: req.MaxMembers, Owner: owner}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", errors.New("password must be at most 72 bytes")
+		}
+		opts.PasswordHash = hash
+	}
+
+	// Codes are random; a clash just means drawing another
+	for {
+		code := generateRoomCode()
+		err := h.Reserve(scoped(tenantID, code), opts)
+		if !errors.Is(err, hub.ErrRoomTaken) {
+			return code, err
+		}
+	}
+}
+
+// ServeCreateRoom creates a room with options for the caller, who owns it:
+// they can list it, see it even when it has a password, and close it.
+func ServeCreateRoom(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	owner, ok := callerKey(r, r.Header.Get("X-Device-Token"))
+	if !ok {
+		http.Error(w, "Not signed in and no device token", http.StatusUnauthorized)
+		return
+	}
+	if m := h.Maintenance(); m.Active {
+		http.Error(w, m.Message, http.StatusServiceUnavailable)
+		return
+	}
+
+	var req models.CreateRoomRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := checkCreateRoom(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code, err := reserveRoom(h, tenantOf(r), req, owner)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info, _, _ := h.RoomInfo(tenant.Scope(r, code))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/rooms/"+code)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+func checkCreateRoom(req models.CreateRoomRequest) error {
+	if utf8.RuneCountInString(req.Name) > 64 {
+		return errors.New("name is longer than 64 characters")
+	}
+	if req.MaxMembers < 0 {
+		return errors.New("maxMembers can't be negative")
+	}
+	return nil
+}
+
+// ServeOwnedRooms lists the rooms the caller created.
+func ServeOwnedRooms(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	owner, ok := callerKey(r, r.Header.Get("X-Device-Token"))
+	if !ok {
+		http.Error(w, "Not signed in and no device token", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.OwnedRooms(owner, tenantOf(r)))
+}
+
+// ServeRoomInfo describes a room: members and what is playing. Rooms with a
+// password are only shown to their owner.
+func ServeRoomInfo(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	info, owner, ok := h.RoomInfo(tenant.Scope(r, r.PathValue("code")))
+	if !ok || (info.Protected && !ownedBy(r, owner)) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// ServeDeleteRoom closes one of the caller's rooms and disconnects
+// everyone in it.
+func ServeDeleteRoom(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	_, owner, ok := h.RoomInfo(code)
+	if !ok || !ownedBy(r, owner) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err := h.CloseRoom(code, "This room was closed by its owner.", ""); err != nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownedBy reports whether the request comes from owner.
+func ownedBy(r *http.Request, owner string) bool {
+	caller, ok := callerKey(r, r.Header.Get("X-Device-Token"))
+	return ok && owner != "" && caller == owner
+}
+
+// tenantOf is the ID of the tenant a request came in for, "" for the
+// default instance.
+func tenantOf(r *http.Request) string {
+	if t, ok := tenant.FromContext(r.Context()); ok {
+		return t.ID
+	}
+	return ""
+}
+
+// scoped is a room's code in a tenant's namespace.
+func scoped(tenantID, code string) string {
+	if tenantID == "" {
+		return code
+	}
+	return tenant.Code(tenantID, code)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"net/http"
+)
+
+// ServeSchedule returns a room's schedule on GET and creates or replaces it
+// on POST with a JSON body of {"start", "timeZone", "rrule", "reminderURL",
+// "passRequired"}. Only the room's host or an admin may set one; a room that
+// isn't open yet takes the admin token.
+func ServeSchedule(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	roomCode := tenant.Scope(r, r.URL.Query().Get("room"))
+	if roomCode == "" {
+		http.Error(w, "Missing room", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s, ok := h.Schedule(roomCode)
+		if !ok {
+			http.Error(w, "No schedule for room", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+
+	case http.MethodPost:
+		if !requireRoomHost(h, w, r, roomCode) {
+			return
+		}
+		var s models.Schedule
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.Start.IsZero() {
+			http.Error(w, "Invalid schedule", http.StatusBadRequest)
+			return
+		}
+		s.RoomCode = roomCode
+		if err := h.SetSchedule(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/ipaddr"
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"coopcinema/ratelimit"
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const statsCacheTTL = time.Minute
+
+var (
+	statsLimiter = ratelimit.New(0.5, 10)
+
+	statsMu     sync.Mutex
+	statsCached models.PublicStats
+	statsAt     time.Time
+)
+
+var statsPage = template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} — Stats</title>
+<link rel="stylesheet" href="/css/styles.css">
+</head>
+<body>
+<main style="max-width:640px;margin:48px auto;padding:0 16px;text-align:center">
+<h1>🎬 {{.Title}}</h1>
+<p><strong>{{.ActiveRooms}}</strong> rooms open now</p>
+<p><strong>{{.PartiesHosted}}</strong> watch parties hosted</p>
+<p><strong>{{printf "%.1f" .HoursWatched}}</strong> hours watched together</p>
+<p style="opacity:.6">Updated {{.UpdatedAt.Format "15:04 MST"}}</p>
+</main>
+</body>
+</html>
+`))
+
+// ServeStats shows anonymized instance totals as HTML or JSON (when the
+// client does not ask for HTML). Results are cached and requests are rate
+// limited per IP.
+func ServeStats(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if !statsLimiter.Allow(clientKey(r)) {
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	stats := publicStats(h)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		statsPage.Execute(w, struct {
+			models.PublicStats
+			Title string
+		}{stats, reloaded.Load().BrandTitle})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// ServeMetrics exposes counters and gauges for Prometheus. With
+// METRICS_TOKEN set, scrapers must send it as a bearer token.
+func ServeMetrics(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if !requireMetricsToken(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WritePrometheus(w, h.Gauges(), cfg.ScalingCapacity)
+}
+
+// ServeScaling reports load and its recent trend as JSON for autoscalers,
+// with a desired replica count when SCALING_CAPACITY is set. It shares
+// METRICS_TOKEN with /metrics.
+func ServeScaling(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if !requireMetricsToken(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(metrics.ScalingSignals(h.Gauges(), cfg.ScalingCapacity))
+}
+
+func requireMetricsToken(w http.ResponseWriter, r *http.Request) bool {
+	if cfg.MetricsToken == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.MetricsToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func publicStats(h *hub.Hub) models.PublicStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	if time.Since(statsAt) < statsCacheTTL {
+		return statsCached
+	}
+
+	rooms, _, _ := h.Occupancy()
+	totals := metrics.Snapshot()
+	statsCached = models.PublicStats{
+		ActiveRooms:   rooms,
+		PartiesHosted: totals.PartiesHosted,
+		HoursWatched:  math.Round(totals.HoursWatched*10) / 10,
+		UpdatedAt:     time.Now().UTC(),
+	}
+	statsAt = time.Now()
+	return statsCached
+}
+
+// clientIP is the address the request came from: the peer's, or behind
+// TRUSTED_PROXIES the one they forwarded for.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if trustedProxy(host) {
+		if forwarded := forwardedFor(r); forwarded != "" {
+			host = forwarded
+		}
+	}
+	return ipaddr.Normalize(host)
+}
+
+// clientKey is the per-client key for rate limits: the address for IPv4,
+// the configured prefix for IPv6.
+func clientKey(r *http.Request) string {
+	return ipaddr.Key(clientIP(r), cfg.IPv6Prefix)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"coopcinema/blobstore"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/subtitles"
+	"coopcinema/tenant"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const maxSubtitleSize = 1 << 20
+
+func init() {
+	// Browsers only load tracks served as text/vtt
+	mime.AddExtensionType(".vtt", "text/vtt; charset=utf-8")
+}
+
+// ServeSubtitles describes the subtitles shared for what a room is playing.
+func ServeSubtitles(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	track, ok := h.Subtitles(code)
+	if !ok {
+		http.Error(w, "No subtitles", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(track)
+}
+
+// ServeUploadSubtitles converts an SRT or WebVTT file to WebVTT, stores it
+// and has every member's player load it. The file is the raw body or
+// multipart "file"; ?label= names the track, otherwise the file name does.
+func ServeUploadSubtitles(h *hub.Hub, store *blobstore.Store, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubtitleSize)
+	var src io.Reader = r.Body
+	label := r.URL.Query().Get("label")
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		src = file
+		if label == "" {
+			label = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		}
+	}
+	if utf8.RuneCountInString(label) > 64 {
+		http.Error(w, "label is longer than 64 characters", http.StatusBadRequest)
+		return
+	}
+
+	cues, err := subtitles.Parse(src)
+	if err != nil {
+		http.Error(w, "Not an SRT or WebVTT file with timed cues", http.StatusBadRequest)
+		return
+	}
+	var vtt bytes.Buffer
+	subtitles.WriteVTT(&vtt, cues)
+	key, err := store.Put(vtt.Bytes(), ".vtt")
+	if err != nil {
+		http.Error(w, "Could not store subtitles", http.StatusInternalServerError)
+		return
+	}
+
+	track := models.SubtitleTrack{Key: key, URL: "/blobs/" + key, Label: label}
+	old, ok := h.SetSubtitles(code, track)
+	if !ok {
+		store.Release(key)
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if old != nil {
+		store.Release(old.Key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.SubtitlesResponse{URL: track.URL, Label: label, Cues: len(cues)})
+}
+
+// ServeDeleteSubtitles stops sharing a room's subtitles.
+func ServeDeleteSubtitles(h *hub.Hub, store *blobstore.Store, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	old, ok := h.ClearSubtitles(code)
+	if !ok {
+		http.Error(w, "No subtitles", http.StatusNotFound)
+		return
+	}
+	store.Release(old.Key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mayShareWith reports whether the caller may see or change what a room
+// shares: anyone for an open room; for one with a password, its owner or
+// whoever sends the password in X-Room-Password.
+func mayShareWith(h *hub.Hub, r *http.Request, code string) bool {
+	info, owner, ok := h.RoomInfo(code)
+	if !ok {
+		return false
+	}
+	if !info.Protected || ownedBy(r, owner) {
+		return true
+	}
+	password := r.Header.Get("X-Room-Password")
+	return password != "" && bcrypt.CompareHashAndPassword(h.PasswordHash(code), []byte(password)) == nil
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultTimelinePage = 50
+	maxTimelinePage     = 200
+)
+
+// ServeTimeline returns a room's activity feed newest first. Page with
+// ?before=<nextBefore from the previous page>&limit=<n>. A room with a
+// password shows it only to those who could share the room.
+func ServeTimeline(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	code := tenant.Scope(r, r.PathValue("code"))
+	if !mayShareWith(h, r, code) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	limit := defaultTimelinePage
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxTimelinePage)
+	}
+
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+		before = n
+	}
+
+	entries, next, ok := h.Timeline(code, before, limit)
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TimelineResponse{Entries: entries, NextBefore: next})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"coopcinema/accounts"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxTokenRequestSize = 4 << 10
+
+// requireRoomHost lets the request through if it carries the room host's
+// claim token (every guest is sent one on connect) or the admin token, or
+// comes from the signed-in account that hosts the room.
+func requireRoomHost(h *hub.Hub, w http.ResponseWriter, r *http.Request, roomCode string) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1 {
+		return true
+	}
+	if userID, err := accounts.VerifyClaim(cfg.ClaimSecret, token); err == nil && h.IsHostID(roomCode, userID) {
+		return true
+	}
+	if account := accountOf(r); account != "" && h.IsHostID(roomCode, account) {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "Only the room's host can do this", http.StatusUnauthorized)
+	return false
+}
+
+// ServeTokens lists a room's API tokens, without their secrets.
+func ServeTokens(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	roomCode := tenant.Scope(r, r.PathValue("code"))
+	if !requireRoomHost(h, w, r, roomCode) {
+		return
+	}
+	tokens, err := h.Tokens(roomCode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// ServeMintToken creates a room API token from
+// {"name": "...", "scopes": ["post-chat"], "ttl": "24h"}.
+func ServeMintToken(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	roomCode := tenant.Scope(r, r.PathValue("code"))
+	if !requireRoomHost(h, w, r, roomCode) {
+		return
+	}
+
+	var req models.MintTokenRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxTokenRequestSize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "Expected {\"name\", \"scopes\", \"ttl\"}", http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	token, grant, err := h.MintToken(roomCode, req.Name, req.Scopes, ttl)
+	switch {
+	case errors.Is(err, hub.ErrRoomNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.MintTokenResponse{Token: token, APIToken: grant})
+	}
+}
+
+// ServeRevokeToken deletes a room API token by ID.
+func ServeRevokeToken(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	roomCode := tenant.Scope(r, r.PathValue("code"))
+	if !requireRoomHost(h, w, r, roomCode) {
+		return
+	}
+	if err := h.RevokeToken(roomCode, r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,119 +1,658 @@
 package handlers
 
 import (
+	"coopcinema/accounts"
+	"coopcinema/adapt"
+	"coopcinema/admission"
+	"coopcinema/bans"
+	"coopcinema/codec"
 	"coopcinema/config"
+	"coopcinema/guestpass"
 	"coopcinema/hub"
+	"coopcinema/jwt"
+	"coopcinema/keepalive"
+	"coopcinema/metrics"
 	"coopcinema/models"
+	"coopcinema/tenant"
+	"coopcinema/wiretap"
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin:  originAllowed,
+	Subprotocols: codec.Subprotocols,
 }
 
-var cfg = config.Load()
+var (
+	cfg      *config.Config
+	joinGate *admission.Gate
 
-func ServeWs(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
-	roomCode := r.URL.Query().Get("room")
+	// reloaded is the latest configuration, for the settings that take
+	// effect without a restart: origins and rate limits
+	reloaded atomic.Pointer[config.Config]
+)
+
+// Configure hands the handlers the server's configuration; it is called
+// once, before any are served.
+func Configure(c *config.Config) {
+	cfg = c
+	reloaded.Store(c)
+	joinGate = admission.New(cfg.JoinRate, cfg.JoinBurst)
+	messageLimiters.Store(newMessageLimiters(c, nil))
+}
+
+// Reload applies a reloaded configuration's origin allowlist and rate
+// limits. Buckets already filling keep their tokens.
+func Reload(c *config.Config) {
+	reloaded.Store(c)
+	joinGate.SetRate(c.JoinRate, c.JoinBurst)
+	messageLimiters.Store(newMessageLimiters(c, *messageLimiters.Load()))
+}
+
+// closePasswordRequired is the close code for a join to a password room
+// without the right password, so the client knows to ask for it.
+const closePasswordRequired = 4001
+
+// wiretapArms are users an admin asked to record on their next connection.
+var wiretapArms = wiretap.NewArms()
+
+func ServeWs(h *hub.Hub, banList *bans.List, prefs *accounts.PreferenceStore, keys *jwt.Keys, w http.ResponseWriter, r *http.Request) {
+	roomCode := tenant.Scope(r, r.URL.Query().Get("room"))
 	userName := r.URL.Query().Get("name")
-	userID := r.URL.Query().Get("id")
+	var userID string
+
+	// An invite is a guest pass that also names the room, so it can stand
+	// in for the code
+	passToken := r.URL.Query().Get("pass")
+	if invite := r.URL.Query().Get("invite"); invite != "" {
+		passToken = invite
+		if roomCode == "" {
+			if pass, err := guestpass.Decode(cfg.GuestPassSecret, invite); err == nil {
+				_, code := tenant.Split(pass.RoomCode)
+				if tenant.Scope(r, code) == pass.RoomCode {
+					roomCode = pass.RoomCode
+				}
+			}
+		}
+	}
+
+	// With token sign-in, who the client is comes from a signed token.
+	// Otherwise signed-in users are known by their account, and guests by
+	// an ID the server picks, which they keep across reconnects by
+	// presenting the claim token they were sent with it. An ID is never
+	// taken from the query string, so nobody can pass as another member.
+	var account string
+	var guest bool
+	if keys != nil {
+		claims, err := keys.Verify(r.URL.Query().Get("token"), time.Now())
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Sign-in token: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		userID, userName = claims.Subject, claims.Name
+	} else if account = accountOf(r); account != "" {
+		userID = account
+		if session, ok := sessionFrom(r); ok && userName == "" {
+			userName = session.Name
+		}
+	} else {
+		guest = true
+		if id, err := accounts.VerifyClaim(cfg.ClaimSecret, r.URL.Query().Get("claim")); err == nil {
+			userID = id
+		} else {
+			userID = newGuestID()
+		}
+	}
 
 	if roomCode == "" || userName == "" || userID == "" {
-		http.Error(w, "Missing room, name or id", http.StatusBadRequest)
+		http.Error(w, "Missing room or name", http.StatusBadRequest)
 		return
 	}
+	if problem := badJoinParams(userName, userID, r.URL.Query().Get("room")); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	// Bans match the exact address or, for IPv6, the whole prefix
+	if banList != nil && banList.Banned(
+		bans.Key(bans.KindIP, clientIP(r)),
+		bans.Key(bans.KindIP, clientKey(r)),
+		bans.Key(bans.KindUser, userID),
+	) {
+		log.Printf("🚫 Refused banned client %s (%s)", clientIP(r), userID)
+		http.Error(w, "You are banned from this server", http.StatusForbidden)
+		return
+	}
+
+	// Members reconnecting after the host rotated the room's code follow it
+	// there; anyone else is turned away from the old code once upgraded
+	joinCode, admitted := h.ResolveCode(roomCode, userID)
+	rotated := admitted && joinCode != roomCode
+
+	if h.IsKicked(joinCode, userID) {
+		http.Error(w, "You were removed from this room", http.StatusForbidden)
+		return
+	}
+
+	var expiresAt time.Time
+	var invited bool
+	if passToken != "" {
+		if joinLocked(w, r, roomCode) {
+			return
+		}
+		pass, err := guestpass.Verify(cfg.GuestPassSecret, passToken, roomCode, time.Now())
+		if err != nil {
+			if errors.Is(err, guestpass.ErrInvalid) {
+				joinFailed(h, banList, r, roomCode)
+			}
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if pass.SingleUse {
+			if err := h.RedeemInvite(roomCode, pass.ID, userID); errors.Is(err, hub.ErrInviteUsed) {
+				http.Error(w, "This invite has already been used.", http.StatusForbidden)
+				return
+			} else if err != nil {
+				http.Error(w, "This invite is no longer valid.", http.StatusForbidden)
+				return
+			}
+		}
+		joinSucceeded(r)
+		expiresAt = pass.ExpiresAt
+		invited = pass.ID != ""
+	} else if h.PassRequired(joinCode) && !h.IsHostID(joinCode, userID) {
+		// So a leaked link alone doesn't get in, nor does a guest whose
+		// pass ran out
+		http.Error(w, "This room needs a guest pass.", http.StatusForbidden)
+		return
+	}
+
+	// A password room takes its password or an invite, which only those
+	// who may share the room can make; a guest pass limits when someone
+	// may join, not who. Members following a rotated code were already in.
+	var refused string
+	if hash := h.PasswordHash(joinCode); hash != nil && !invited && !rotated {
+		password := r.URL.Query().Get("password")
+		if password == "" {
+			refused = "This room needs a password."
+		} else {
+			if joinLocked(w, r, joinCode) {
+				return
+			}
+			if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+				joinFailed(h, banList, r, joinCode)
+				refused = "Wrong password."
+			} else {
+				joinSucceeded(r)
+			}
+		}
+	}
+
+	version, versionOK := models.NegotiateVersion(r.URL.Query().Get("v"))
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		metrics.UpgradeFailed()
 		log.Println(err)
 		return
 	}
 
+	// The subprotocol picks the frames the server writes; clients may send
+	// either kind
+	enc := codec.ForSubprotocol(conn.Subprotocol())
+
+	if !versionOK {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseProtocolError,
+			fmt.Sprintf("Unsupported protocol version; this server speaks %d to %d.", models.MinProtocolVersion, models.ProtocolVersion)))
+		conn.Close()
+		return
+	}
+
+	if !admitted {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+			websocket.ClosePolicyViolation, "This room link is no longer valid. Ask the host for the new one."))
+		conn.Close()
+		return
+	}
+	roomCode = joinCode
+
+	if refused != "" {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closePasswordRequired, refused))
+		conn.Close()
+		return
+	}
+	if h.Full(roomCode, userID) {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+			websocket.CloseTryAgainLater, "This room is full."))
+		conn.Close()
+		return
+	}
+
+	if h.ShuttingDown() {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+			websocket.CloseServiceRestart, "The server is restarting."))
+		conn.Close()
+		return
+	}
+
+	// Browsers can't read a refused handshake, so the maintenance notice
+	// goes out as the close reason instead
+	if ok, reason := h.AcceptsRoom(roomCode); !ok {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+			websocket.CloseTryAgainLater, closeReason(reason)))
+		conn.Close()
+		return
+	}
+
+	// Over the room's join rate, wait in line on the upgraded connection
+	err = joinGate.Wait(roomCode, func(position int) error {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		return writeFrame(conn, nil, enc, models.Message{Type: "queued", Content: strconv.Itoa(position)}, version)
+	})
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetWriteDeadline(time.Time{})
+
 	client := &models.Client{
-		ID:       userID,
-		Name:     userName,
-		Conn:     conn,
-		Send:     make(chan models.Message, cfg.ClientSendBuffer),
-		RoomCode: roomCode,
+		ID:        userID,
+		Name:      userName,
+		Conn:      conn,
+		Send:      make(chan models.Message, cfg.ClientSendBuffer),
+		RoomCode:  roomCode,
+		ExpiresAt: expiresAt,
+		Caps:      models.CapAll,
+		Country:   h.GeoIP.Country(clientIP(r)),
+		Account:   account,
+		Protocol:  version,
+
+		StallGrace:  cfg.SlowClientGrace,
+		ChatBacklog: cfg.SlowClientChat,
+
+		ResumeFrom: r.URL.Query().Get("resume"),
+	}
+	grace := h.Settings().ResumeGrace
+	if grace > 0 {
+		client.ResumeToken = newResumeToken()
+	}
+	if r.URL.Query().Has("caps") {
+		client.Caps = models.ParseCapabilities(r.URL.Query().Get("caps"))
+	}
+
+	// hello goes first, ahead of anything the room sends on joining, and
+	// tells the client who it is; a guest's claim token comes before the
+	// join too, so it's kept even if the client drops straight away
+	hello := models.Hello(version)
+	hello.UserID = userID
+	client.Deliver(hello)
+	if guest {
+		client.Deliver(models.Message{Type: "claimToken", Content: accounts.ClaimToken(cfg.ClaimSecret, userID), UserID: userID})
+	}
+	h.Join(client)
+	if client.ResumeToken != "" {
+		client.Deliver(models.Message{Type: "resumeToken", Content: client.ResumeToken, Cooldown: grace.Seconds()})
 	}
 
-	h.Register <- client
+	// Saved preferences follow the account or device into every room; a
+	// browser without a device token is given one
+	if key, ok := callerKey(r, r.URL.Query().Get("device")); ok {
+		if p, saved := prefs.Get(key); saved {
+			client.Deliver(models.Message{Type: "preferences", Preferences: &p})
+		}
+	} else {
+		client.Deliver(models.Message{Type: "deviceToken", Content: newDeviceToken()})
+	}
+	if rotated {
+		_, code := tenant.Split(roomCode)
+		client.Deliver(models.Message{Type: "codeRotated", RoomCode: code, URL: "/?room=" + url.QueryEscape(code)})
+	}
 
-	go writePump(client, conn)
-	go readPump(client, conn, h)
+	// A client's frames are recorded when it asked to be (record=1, for
+	// a bug report) or an admin armed it
+	var tap *wiretap.Recorder
+	if cfg.WiretapDir != "" && (r.URL.Query().Get("record") == "1" || wiretapArms.Take(userID)) {
+		tap, err = wiretap.Start(cfg.WiretapDir, roomCode, userID)
+		if err != nil {
+			log.Printf("wiretap: %v", err)
+		} else {
+			log.Printf("🎙️ Recording %s (%s) in room %s to %s", userID, userName, roomCode, tap.Path())
+		}
+	}
+
+	link := keepalive.New()
+	client.Liveness.Store(100)
+	go writePump(client, conn, h, link, tap, enc)
+	go readPump(client, conn, h, link, tap, &floodGuard{client: client, key: client.ID + "|" + clientKey(r)})
 }
 
-func readPump(client *models.Client, conn *websocket.Conn, h *hub.Hub) {
+func readPump(client *models.Client, conn *websocket.Conn, h *hub.Hub, link *keepalive.Tracker, tap *wiretap.Recorder, guard *floodGuard) {
 	defer func() {
-		h.Unregister <- client
+		h.Leave(client)
 		conn.Close()
+		tap.Close()
 	}()
 
-	conn.SetReadDeadline(time.Now().Add(cfg.ReadTimeout))
-	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(cfg.ReadTimeout))
+	// Anything bigger ends the connection with 1009 before it's buffered
+	conn.SetReadLimit(cfg.MaxMessageSize)
+	conn.SetReadDeadline(link.Deadline())
+	conn.SetPongHandler(func(appData string) error {
+		if len(appData) != 8 {
+			return nil
+		}
+		sent := int64(binary.BigEndian.Uint64([]byte(appData)))
+		conn.SetReadDeadline(link.Pong(sent, time.Now()))
+		client.RTT.Store(link.RTT().Milliseconds())
 		return nil
 	})
 
 	for {
-		var msg models.Message
-		err := conn.ReadJSON(&msg)
+		kind, data, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
+			// A client leaving on purpose closes normally; anything else
+			// may be back
+			client.Dropped.Store(!websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived))
+			break
+		}
+		metrics.FrameIn(len(data))
+
+		// Binary frames are MessagePack, handled from here on as the JSON
+		// they stand for
+		if kind == websocket.BinaryMessage {
+			if data, err = codec.MessagePackToJSON(data); err != nil {
+				break
+			}
+		}
+		tap.Frame(wiretap.In, data)
+
+		// A bad payload is answered; anything that isn't a JSON message
+		// ends the connection
+		var msg models.Message
+		err = json.Unmarshal(data, &msg)
+		var badPayload *models.PayloadError
+		if err != nil && !errors.As(err, &badPayload) {
 			break
 		}
 		msg.UserID = client.ID
-		h.Broadcast(msg, client)
+
+		ok, disconnect := guard.allow(msg.Type)
+		if disconnect {
+			guard.disconnect(conn)
+			break
+		}
+		if !ok {
+			continue
+		}
+		if !h.Inbound(msg.Type) {
+			client.Deliver(models.ErrorMessage("unknownType", msg.Type, "unknown message type"))
+			continue
+		}
+		if badPayload != nil {
+			client.Deliver(models.ErrorMessage("badPayload", msg.Type, badPayload.Err.Error()))
+			continue
+		}
+		msg.ApplyPayload()
+		if problem := tooLong(msg); problem != "" {
+			client.Deliver(models.ErrorMessage("tooLong", msg.Type, problem))
+			continue
+		}
+		h.Handle(msg, client)
 	}
 }
 
-func writePump(client *models.Client, conn *websocket.Conn) {
-	ticker := time.NewTicker(cfg.PingInterval)
+func writePump(client *models.Client, conn *websocket.Conn, h *hub.Hub, link *keepalive.Tracker, tap *wiretap.Recorder, enc codec.Codec) {
+	pinger := time.NewTimer(time.Until(link.Due()))
+	beacon := time.NewTicker(cfg.ServerTimeEvery)
+	probe := time.NewTicker(cfg.ProbeInterval)
 	defer func() {
-		ticker.Stop()
+		pinger.Stop()
+		beacon.Stop()
+		probe.Stop()
 		conn.Close()
 	}()
 
+	// Connection quality is re-graded on every probe and the client is only
+	// sent a new adaptHint when its grade changes.
+	quality := adapt.Good
+
+	// The server clock rides along on outgoing frames; a bare serverTime
+	// beacon is only written when nothing else went out for a while.
+	var lastStamp time.Time
+
+	var expired <-chan time.Time
+	if !client.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(client.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	send := func(message models.Message) error {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+
+		// Clock probes are answered with the time they go out. A stamped
+		// frame is this connection's own, so it can't use the broadcast's
+		// shared encoding.
+		if now := time.Now(); message.Type == "timeSync" || now.Sub(lastStamp) >= cfg.ServerTimeEvery {
+			message.ServerTime = now.UnixMilli()
+			message.Encoded = nil
+			lastStamp = now
+		}
+		return writeFrame(conn, tap, enc, message, client.Protocol)
+	}
+	hangUp := func() {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		if h.ShuttingDown() {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+				websocket.CloseServiceRestart, "The server is restarting."))
+		} else {
+			conn.WriteMessage(websocket.CloseMessage, []byte{})
+		}
+	}
+	held := client.Held()
+
 	for {
 		select {
 		case message, ok := <-client.Send:
-			conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
 			if !ok {
-				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				hangUp()
+				return
+			}
+			if err := send(message); err != nil {
 				return
 			}
 
-			err := conn.WriteJSON(message)
+		case <-held:
+			// Send filled up and messages were held back. What was already
+			// in Send goes out before them.
+			for n := len(client.Send); n > 0; n-- {
+				message, ok := <-client.Send
+				if !ok {
+					hangUp()
+					return
+				}
+				if err := send(message); err != nil {
+					return
+				}
+			}
+			for _, message := range client.TakeHeld() {
+				if err := send(message); err != nil {
+					return
+				}
+			}
+
+		case now := <-beacon.C:
+			if now.Sub(lastStamp) < cfg.ServerTimeEvery {
+				continue
+			}
+			lastStamp = now
+			conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+			err := writeFrame(conn, tap, enc, models.Message{Type: "serverTime", ServerTime: now.UnixMilli()}, client.Protocol)
 			if err != nil {
 				return
 			}
 
-		case <-ticker.C:
-			conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+		case now := <-pinger.C:
+			conn.SetWriteDeadline(now.Add(cfg.WriteTimeout))
+			stamp := make([]byte, 8)
+			binary.BigEndian.PutUint64(stamp, uint64(now.UnixNano()))
+			if err := conn.WriteMessage(websocket.PingMessage, stamp); err != nil {
+				metrics.WriteFailed()
 				return
 			}
+			pinger.Reset(link.Sent(now))
+
+			// The roster only hears about moves between bands
+			score := link.Score()
+			if old := client.Liveness.Swap(int32(score)); keepalive.Band(int(old)) != keepalive.Band(score) {
+				h.PresenceChanged(client)
+			}
+
+		case <-probe.C:
+			grade := adapt.Classify(link.RTT(), len(client.Send), cap(client.Send))
+			if grade != quality {
+				quality = grade
+				conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+				err := writeFrame(conn, tap, enc, models.Message{Type: "adaptHint", Content: grade, Hint: adapt.Hint(grade)}, client.Protocol)
+				if err != nil {
+					return
+				}
+			}
+
+		case <-expired:
+			conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+				websocket.ClosePolicyViolation, "Your guest pass has expired. Thanks for watching!"))
+			return
 		}
 	}
 }
 
-func ServeGenerateRoom(w http.ResponseWriter, r *http.Request) {
+// writeFrame sends msg as a client speaking version gets it, in enc's
+// encoding. A broadcast is encoded and framed once per encoding and version,
+// and every recipient writes the same prepared frame. Tapped connections
+// record the JSON form.
+func writeFrame(conn *websocket.Conn, tap *wiretap.Recorder, enc codec.Codec, msg models.Message, version int) error {
+	msg = models.ForVersion(msg, version)
+	kind := websocket.TextMessage
+	if enc.Binary() {
+		kind = websocket.BinaryMessage
+	}
+	encode := func() ([]byte, error) { return enc.Marshal(msg) }
+
+	var frame *websocket.PreparedMessage
+	var data []byte
+	var err error
+	if msg.Encoded != nil {
+		frame, data, err = msg.Encoded.Prepare(enc.Name()+"/"+strconv.Itoa(version), kind, encode)
+	} else {
+		data, err = encode()
+	}
+	if err != nil {
+		return err
+	}
+
+	if !enc.Binary() {
+		tap.Frame(wiretap.Out, data)
+	} else if tap != nil {
+		if js, err := json.Marshal(msg); err == nil {
+			tap.Frame(wiretap.Out, js)
+		}
+	}
+	if frame != nil {
+		err = conn.WritePreparedMessage(frame)
+	} else {
+		err = conn.WriteMessage(kind, data)
+	}
+	if err != nil {
+		metrics.WriteFailed()
+		return err
+	}
+	metrics.FrameOut(len(data))
+	return nil
+}
+
+func ServeGenerateRoom(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if m := h.Maintenance(); m.Active {
+		http.Error(w, m.Message, http.StatusServiceUnavailable)
+		return
+	}
+
+	// A password makes the room private: it is created right away with the
+	// hash, rather than on first join
+	var req models.GenerateRoomRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	code := generateRoomCode()
+	if req.Password != "" {
+		var err error
+		code, err = reserveRoom(h, tenantOf(r), models.CreateRoomRequest{Password: req.Password}, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(models.RoomCodeResponse{
-		Code: generateRoomCode(),
+		Code: code,
 	})
 }
 
+// closeReason trims s to fit a close frame's 123-byte reason.
+func closeReason(s string) string {
+	if len(s) <= 123 {
+		return s
+	}
+	s = s[:120]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s + "..."
+}
+
+// newGuestID is the ID of a guest joining without a claim token.
+func newGuestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newResumeToken mints the token a connection's successor presents to take
+// its place.
+func newResumeToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func generateRoomCode() string {
 	b := make([]byte, 4)
 	rand.Read(b)
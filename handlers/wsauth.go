@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"coopcinema/jwt"
+	"coopcinema/models"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// tokenRefreshWindow is how long after a token expires its guest ID can
+// still be carried over to a new one.
+const tokenRefreshWindow = 24 * time.Hour
+
+// ServeToken issues a short-lived token for /ws in WS_AUTH=jwt mode:
+// {"name": "...", "token": "<previous token>"}. Signed-in users get their
+// account ID; guests keep the ID of a previous token they present, so
+// reconnecting doesn't make them someone new, or are given a fresh one.
+func ServeToken(keys *jwt.Keys, w http.ResponseWriter, r *http.Request) {
+	if keys == nil {
+		http.Error(w, "Token sign-in is off", http.StatusNotFound)
+		return
+	}
+	if !keys.CanSign() {
+		http.Error(w, "Tokens are issued by your identity provider", http.StatusNotFound)
+		return
+	}
+
+	var req models.TokenRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > 64 {
+		http.Error(w, "name must be 1 to 64 characters", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	userID := accountOf(r)
+	if userID == "" && req.Token != "" {
+		prev, err := keys.Verify(req.Token, now)
+		if err == nil || (errors.Is(err, jwt.ErrExpired) && now.Unix()-prev.ExpiresAt < int64(tokenRefreshWindow.Seconds())) {
+			userID = prev.Subject
+		}
+	}
+	if userID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		userID = hex.EncodeToString(b)
+	}
+
+	expires := now.Add(cfg.JWTTTL)
+	token, err := keys.Sign(jwt.Claims{
+		Subject:   userID,
+		Name:      req.Name,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		http.Error(w, "Could not issue token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.TokenResponse{
+		Token:     token,
+		UserID:    userID,
+		Name:      req.Name,
+		ExpiresAt: expires,
+	})
+}
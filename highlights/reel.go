@@ -0,0 +1,163 @@
+package highlights
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+const (
+	windowSeconds = 10
+	maxPeaks      = 10
+	bookmarkLead  = 5.0
+	bookmarkTail  = 10.0
+	editFrameRate = 25
+)
+
+// Clip is a span of the source media worth keeping in a highlight reel.
+type Clip struct {
+	Start     float64
+	End       float64
+	Reactions int
+	Label     string
+}
+
+// Bookmark is a user-marked moment on the media timeline.
+type Bookmark struct {
+	Time  float64
+	Label string
+}
+
+// Build picks the busiest reaction windows plus every bookmark and returns
+// non-overlapping clips in timeline order.
+func Build(reactions map[int]int, bookmarks []Bookmark) []Clip {
+	var clips []Clip
+
+	type window struct{ start, count int }
+	var windows []window
+	for sec := range reactions {
+		count := 0
+		for s := sec; s < sec+windowSeconds; s++ {
+			count += reactions[s]
+		}
+		windows = append(windows, window{sec, count})
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		if windows[i].count != windows[j].count {
+			return windows[i].count > windows[j].count
+		}
+		return windows[i].start < windows[j].start
+	})
+
+	taken := 0
+	for _, w := range windows {
+		if taken == maxPeaks {
+			break
+		}
+		c := Clip{Start: float64(w.start), End: float64(w.start + windowSeconds), Reactions: w.count}
+		if overlapsAny(clips, c) {
+			continue
+		}
+		clips = append(clips, c)
+		taken++
+	}
+
+	for _, b := range bookmarks {
+		start := b.Time - bookmarkLead
+		if start < 0 {
+			start = 0
+		}
+		clips = append(clips, Clip{Start: start, End: b.Time + bookmarkTail, Label: b.Label})
+	}
+
+	return merge(clips)
+}
+
+func overlapsAny(clips []Clip, c Clip) bool {
+	for _, o := range clips {
+		if c.Start < o.End && o.Start < c.End {
+			return true
+		}
+	}
+	return false
+}
+
+func merge(clips []Clip) []Clip {
+	if len(clips) == 0 {
+		return clips
+	}
+	sort.Slice(clips, func(i, j int) bool { return clips[i].Start < clips[j].Start })
+
+	out := []Clip{clips[0]}
+	for _, c := range clips[1:] {
+		last := &out[len(out)-1]
+		if c.Start > last.End {
+			out = append(out, c)
+			continue
+		}
+		if c.End > last.End {
+			last.End = c.End
+		}
+		last.Reactions += c.Reactions
+		if c.Label != "" {
+			if last.Label != "" {
+				last.Label += "; "
+			}
+			last.Label += c.Label
+		}
+	}
+	return out
+}
+
+// WriteCSV writes clips as start,end,duration,reactions,label rows in seconds.
+func WriteCSV(w io.Writer, clips []Clip) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"start", "end", "duration", "reactions", "label"})
+	for _, c := range clips {
+		cw.Write([]string{
+			strconv.FormatFloat(c.Start, 'f', 2, 64),
+			strconv.FormatFloat(c.End, 'f', 2, 64),
+			strconv.FormatFloat(c.End-c.Start, 'f', 2, 64),
+			strconv.Itoa(c.Reactions),
+			c.Label,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteEDL writes clips as a CMX3600 edit decision list cut back to back on
+// the record timeline.
+func WriteEDL(w io.Writer, title string, clips []Clip) error {
+	if _, err := fmt.Fprintf(w, "TITLE: %s\nFCM: NON-DROP FRAME\n\n", title); err != nil {
+		return err
+	}
+
+	var rec float64
+	for i, c := range clips {
+		dur := c.End - c.Start
+		_, err := fmt.Fprintf(w, "%03d  AX       AA/V  C        %s %s %s %s\n",
+			i+1, timecode(c.Start), timecode(c.End), timecode(rec), timecode(rec+dur))
+		if err != nil {
+			return err
+		}
+		if c.Reactions > 0 {
+			fmt.Fprintf(w, "* COMMENT: %d reactions\n", c.Reactions)
+		}
+		if c.Label != "" {
+			fmt.Fprintf(w, "* COMMENT: %s\n", c.Label)
+		}
+		fmt.Fprintln(w)
+		rec += dur
+	}
+	return nil
+}
+
+func timecode(seconds float64) string {
+	frames := int(seconds*editFrameRate + 0.5)
+	f := frames % editFrameRate
+	s := frames / editFrameRate
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", s/3600, s/60%60, s%60, f)
+}
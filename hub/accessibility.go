@@ -0,0 +1,45 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"encoding/json"
+)
+
+// SetAccessibility replaces a room's caption and audio-description setup and
+// pushes it to every member.
+func (h *Hub) SetAccessibility(roomCode string, a models.Accessibility) bool {
+	room := h.room(roomCode)
+	if room == nil {
+		return false
+	}
+	room.Mu.Lock()
+	room.Accessibility = a
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(roomCode, accessibilityMessage(a))
+	return true
+}
+
+// Accessibility returns a room's caption and audio-description setup.
+func (h *Hub) Accessibility(roomCode string) (models.Accessibility, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return models.Accessibility{}, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return room.Accessibility, true
+}
+
+func (h *Hub) setAccessibility(sender *models.Client, content string) {
+	var a models.Accessibility
+	if err := json.Unmarshal([]byte(content), &a); err != nil {
+		return
+	}
+	h.SetAccessibility(sender.RoomCode, a)
+}
+
+func accessibilityMessage(a models.Accessibility) models.Message {
+	data, _ := json.Marshal(a)
+	return models.Message{Type: "accessibility", Content: string(data)}
+}
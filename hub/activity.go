@@ -0,0 +1,324 @@
+package hub
+
+import (
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"errors"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// trackActivity follows host changes and media loads, updates the room's
+// playback estimate from sync messages and records reactions and bookmarks
+// against the current media position.
+func (h *Hub) trackActivity(room *models.Room, msg models.Message, sender *models.Client) {
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+
+	h.recordMessage(room, msg, sender)
+
+	if mediaTypes[msg.Type] || isPlaybackSync(msg.Type) {
+		room.LastActivity = time.Now()
+	}
+
+	if msg.Slot != "" {
+		trackSlot(room, msg)
+		return
+	}
+	noteCatchUp(room, msg, sender)
+
+	if mediaTypes[msg.Type] {
+		media := msg
+		room.Media = &media
+		room.Position, room.PositionAt, room.Playing = 0, time.Now(), false
+		room.Buffering, room.WaitHold = nil, time.Time{}
+		h.playbackChanged(room)
+		go h.lookupRegions(room.Code, media)
+	}
+
+	switch msg.Type {
+	case "hostchange":
+		room.HostID = msg.UserID
+		room.HostMode = true
+
+	case "hostmodeoff":
+		room.HostMode = false
+
+	case "play", "pause", "seek", "state":
+		room.Position = msg.Timestamp
+		room.PositionAt = time.Now()
+		trackPlayhead(room, sender, msg.Timestamp)
+		if msg.Type != "state" {
+			h.playbackChanged(room)
+		}
+		switch msg.Type {
+		case "play":
+			room.Playing = true
+			room.WaitHold = time.Time{}
+		case "pause":
+			room.Playing = false
+			room.WaitHold = time.Time{}
+		case "state":
+			room.Playing = msg.Playing
+		}
+
+	case "reaction":
+		if room.Reactions == nil {
+			room.Reactions = make(map[int]int)
+		}
+		// Reactions carry the sender's playback position; older clients
+		// don't, so fall back to the room's estimate
+		at := msg.Timestamp
+		if at <= 0 || at > maxMediaPosition {
+			at = currentPosition(room)
+		}
+		room.Reactions[int(at)]++
+		if room.ReactionCounts == nil {
+			room.ReactionCounts = make(map[string]int)
+		}
+		room.ReactionCounts[msg.Content]++
+
+	case "bookmark":
+		at := msg.Timestamp
+		if at < 0 || at > maxMediaPosition {
+			return
+		}
+		if at == 0 {
+			at = currentPosition(room)
+		}
+		b := models.Bookmark{Time: at, Label: msg.Content, UserID: sender.ID, UserName: msg.UserName}
+		if addBookmark(room, &b) == nil {
+			h.record(room, "marker", sender, b.Label, at)
+		}
+	}
+}
+
+// Bookmarks are kept for the life of the room, so there are only so many.
+const (
+	maxBookmarks     = 500 // per room
+	maxUserBookmarks = 50  // per member in a room
+	maxBookmarkLabel = 100 // runes; longer labels are cut short
+)
+
+var ErrTooManyBookmarks = errors.New("too many bookmarks in this room")
+
+// addBookmark files b, its label cut to length, unless the room or its
+// author already has as many as allowed. Callers hold room.Mu.
+func addBookmark(room *models.Room, b *models.Bookmark) error {
+	if len(room.Bookmarks) >= maxBookmarks {
+		return ErrTooManyBookmarks
+	}
+	mine := 0
+	for _, o := range room.Bookmarks {
+		if o.UserID == b.UserID {
+			mine++
+		}
+	}
+	if mine >= maxUserBookmarks {
+		return ErrTooManyBookmarks
+	}
+	if utf8.RuneCountInString(b.Label) > maxBookmarkLabel {
+		b.Label = string([]rune(b.Label)[:maxBookmarkLabel])
+	}
+	room.Bookmarks = append(room.Bookmarks, *b)
+	return nil
+}
+
+// ControlPlayback relays a play, pause or seek the server issues itself,
+// such as a script's, moving the room's playback state as a host's would so
+// later joiners are synced to it.
+func (h *Hub) ControlPlayback(roomCode string, msg models.Message) {
+	room := h.room(roomCode)
+	if room == nil {
+		return
+	}
+	h.trackActivity(room, msg, nil)
+	h.BroadcastRoom(roomCode, msg)
+}
+
+// maxMediaPosition bounds the media positions reactions are filed under;
+// nothing a room plays runs for a week.
+const maxMediaPosition = 7 * 24 * 3600
+
+func currentPosition(room *models.Room) float64 {
+	if room.Playing && !room.PositionAt.IsZero() {
+		return room.Position + time.Since(room.PositionAt).Seconds()
+	}
+	return room.Position
+}
+
+// syncStateMessage tells a client that just joined what the room is
+// playing and where. Callers hold room.Mu.
+func syncStateMessage(room *models.Room) models.Message {
+	msg := models.Message{Type: "syncState", SourceType: "none", SentAt: float64(time.Now().UnixMilli())}
+	if room.Media == nil {
+		return msg
+	}
+	msg.SourceType = sourceKind(room.Media.Type)
+	msg.URL = room.Media.URL
+	msg.UserID = room.Media.UserID
+	msg.Timestamp = currentPosition(room)
+	msg.Playing = room.Playing
+	if regions, known := mediaRegions(room); known && (len(regions.Allowed) > 0 || len(regions.Blocked) > 0) {
+		msg.Regions = &regions
+	}
+	return msg
+}
+
+// Activity returns a copy of a room's reaction heatmap and bookmarks.
+func (h *Hub) Activity(roomCode string) (map[int]int, []models.Bookmark, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, nil, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+
+	reactions := make(map[int]int, len(room.Reactions))
+	for sec, n := range room.Reactions {
+		reactions[sec] = n
+	}
+	bookmarks := append([]models.Bookmark(nil), room.Bookmarks...)
+	return reactions, bookmarks, true
+}
+
+// maxReactionPeaks is how many of the busiest seconds ReactionSummary lists.
+const maxReactionPeaks = 10
+
+// ReactionSummary totals a room's reactions by emoji and picks out the
+// seconds that drew the most.
+func (h *Hub) ReactionSummary(roomCode string) (models.ReactionSummary, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return models.ReactionSummary{}, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+
+	summary := models.ReactionSummary{ByEmoji: make(map[string]int, len(room.ReactionCounts))}
+	for emoji, n := range room.ReactionCounts {
+		summary.ByEmoji[emoji] = n
+		summary.Total += n
+	}
+	summary.Peaks = make([]models.ReactionPeak, 0, len(room.Reactions))
+	for sec, n := range room.Reactions {
+		summary.Peaks = append(summary.Peaks, models.ReactionPeak{Time: sec, Count: n})
+	}
+	sort.Slice(summary.Peaks, func(i, j int) bool {
+		a, b := summary.Peaks[i], summary.Peaks[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Time < b.Time
+	})
+	if len(summary.Peaks) > maxReactionPeaks {
+		summary.Peaks = summary.Peaks[:maxReactionPeaks]
+	}
+	return summary, true
+}
+
+// Playback returns a room's estimated media position and play state.
+func (h *Hub) Playback(roomCode string) (float64, bool, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return 0, false, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return currentPosition(room), room.Playing, true
+}
+
+// RoomCodes returns the codes of all open rooms.
+func (h *Hub) RoomCodes() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	codes := make([]string, 0, len(h.Rooms))
+	for code := range h.Rooms {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// AddBookmark marks the current media position in the sender's room.
+func (h *Hub) AddBookmark(sender *models.Client, label string) (models.Bookmark, error) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return models.Bookmark{}, ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	b := models.Bookmark{Time: currentPosition(room), Label: label, UserID: sender.ID, UserName: sender.Name}
+	if err := addBookmark(room, &b); err != nil {
+		return models.Bookmark{}, err
+	}
+	h.record(room, "marker", sender, b.Label, b.Time)
+	return b, nil
+}
+
+// Occupancy counts open rooms, connected clients and clients in rooms that
+// are currently playing.
+func (h *Hub) Occupancy() (rooms, clients, watching int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for code, room := range h.Rooms {
+		if isHidden(code) {
+			continue
+		}
+		rooms++
+		room.Mu.RLock()
+		clients += len(room.Clients)
+		if room.Playing {
+			watching += len(room.Clients)
+		}
+		room.Mu.RUnlock()
+	}
+	return rooms, clients, watching
+}
+
+// Gauges is Occupancy in the form the metrics package reports.
+func (h *Hub) Gauges() metrics.Gauges {
+	rooms, clients, watching := h.Occupancy()
+	return metrics.Gauges{Rooms: rooms, Clients: clients, Watching: watching}
+}
+
+// RunViewingSampler feeds viewer-time into the metrics and the leaderboard
+// every interval.
+func (h *Hub) RunViewingSampler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, _, watching := h.Occupancy()
+		metrics.AddViewing(time.Duration(watching) * interval)
+		h.creditWatchTime(interval)
+	}
+}
+
+// GuestHistory collects the rooms a user ID joined and the bookmarks it made
+// across every open room.
+func (h *Hub) GuestHistory(userID string) ([]string, []models.RoomBookmark) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var rooms []string
+	var bookmarks []models.RoomBookmark
+	for code, room := range h.Rooms {
+		room.Mu.RLock()
+		for _, e := range room.Timeline {
+			if e.Kind == "join" && e.UserID == userID {
+				rooms = append(rooms, code)
+				break
+			}
+		}
+		for _, b := range room.Bookmarks {
+			if b.UserID == userID {
+				bookmarks = append(bookmarks, models.RoomBookmark{RoomCode: code, Bookmark: b})
+			}
+		}
+		room.Mu.RUnlock()
+	}
+	return rooms, bookmarks
+}
@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"sort"
+)
+
+// AdminRooms lists the open rooms with their members and playback, sorted
+// by code. Hidden rooms are left out.
+func (h *Hub) AdminRooms() []models.AdminRoom {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rooms := make([]models.AdminRoom, 0, len(h.Rooms))
+	for code, room := range h.Rooms {
+		if isHidden(code) {
+			continue
+		}
+		tenantID, public := tenant.Split(code)
+		room.Mu.RLock()
+		state := syncStateMessage(room)
+		rooms = append(rooms, models.AdminRoom{
+			Code:         public,
+			Tenant:       tenantID,
+			Name:         room.Name,
+			Members:      len(room.Clients),
+			HostID:       room.HostID,
+			SourceType:   state.SourceType,
+			URL:          state.URL,
+			Position:     state.Timestamp,
+			Playing:      state.Playing,
+			OpenedAt:     room.OpenedAt,
+			LastActivity: room.LastActivity,
+		})
+		room.Mu.RUnlock()
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].Tenant != rooms[j].Tenant {
+			return rooms[i].Tenant < rooms[j].Tenant
+		}
+		return rooms[i].Code < rooms[j].Code
+	})
+	return rooms
+}
+
+// Resync sends everyone in a room where it is, as joiners are told, so
+// drifted players snap back. It returns false if the room isn't open.
+func (h *Hub) Resync(roomCode string) bool {
+	room := h.room(roomCode)
+	if room == nil {
+		return false
+	}
+	room.Mu.RLock()
+	msg := syncStateMessage(room)
+	room.Mu.RUnlock()
+
+	h.BroadcastRoom(roomCode, msg)
+	return true
+}
+
+// AnnounceAll posts a server message into every open room's chat and
+// returns how many rooms got it. Hidden rooms are skipped.
+func (h *Hub) AnnounceAll(from, text string) int {
+	n := 0
+	for _, code := range h.RoomCodes() {
+		if !isHidden(code) && h.Announce(code, from, text) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,139 @@
+package hub
+
+import (
+	"coopcinema/keepalive"
+	"coopcinema/models"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// How much detail attention summaries carry.
+const (
+	AttentionOff    = "off"    // hosts can't turn summaries on
+	AttentionCounts = "counts" // head counts only
+	AttentionNames  = "names"  // plus who is away
+)
+
+// A member counts as away once their heartbeats stop, their tab is hidden,
+// or their playhead stops advancing while the room is playing.
+const (
+	heartbeatGrace = 90 * time.Second
+	stalledAfter   = 30 * time.Second
+)
+
+// SetAttention turns attention summaries on ("on") or off ("off") for the
+// host's room and tells every member, so nobody is measured unawares.
+func (h *Hub) SetAttention(sender *models.Client, mode string) {
+	if h.Settings().AttentionDetail == AttentionOff || (mode != "on" && mode != "off") {
+		return
+	}
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	room.AttentionOn = mode == "on"
+	room.Attention = nil
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(sender.RoomCode, models.Message{Type: "attentionMode", Content: mode})
+}
+
+// heartbeat records a member's tab visibility (content "visible" or
+// "hidden") and playhead (timestamp).
+func (h *Hub) heartbeat(msg models.Message, sender *models.Client) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	if !room.AttentionOn {
+		return
+	}
+	a := attentionOf(room, sender.ID)
+	a.Hidden = msg.Content == "hidden"
+	a.Heartbeat = time.Now()
+	trackPlayhead(room, sender, msg.Timestamp)
+}
+
+// trackPlayhead notes whether a member's reported playhead moved on; the
+// server's own commands, with no sender, aren't anyone's. Callers hold
+// room.Mu.
+func trackPlayhead(room *models.Room, sender *models.Client, position float64) {
+	if !room.AttentionOn || sender == nil {
+		return
+	}
+	a := attentionOf(room, sender.ID)
+	if position != a.Position {
+		a.Position = position
+		a.Moved = time.Now()
+	}
+}
+
+func attentionOf(room *models.Room, userID string) *models.Attention {
+	if room.Attention == nil {
+		room.Attention = make(map[string]*models.Attention)
+	}
+	a, ok := room.Attention[userID]
+	if !ok {
+		now := time.Now()
+		a = &models.Attention{Heartbeat: now, Moved: now}
+		room.Attention[userID] = a
+	}
+	return a
+}
+
+// RunAttention sends each opted-in room's host an attention summary every
+// interval.
+func (h *Hub) RunAttention(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.mu.RLock()
+		summaries := make(map[string]models.AttentionSummary)
+		for code, room := range h.Rooms {
+			room.Mu.Lock()
+			if room.AttentionOn {
+				summaries[code] = h.summarize(room, now)
+			}
+			room.Mu.Unlock()
+		}
+		h.mu.RUnlock()
+
+		for code, s := range summaries {
+			data, _ := json.Marshal(s)
+			h.NotifyHost(code, models.Message{Type: "attention", Content: string(data)})
+		}
+	}
+}
+
+// summarize counts who in the room is watching. The host isn't counted.
+// Callers hold room.Mu.
+func (h *Hub) summarize(room *models.Room, now time.Time) models.AttentionSummary {
+	var s models.AttentionSummary
+	detail := h.Settings().AttentionDetail
+	for c := range room.Clients {
+		client := c.(*models.Client)
+		if client.ID == room.HostID {
+			continue
+		}
+		s.Total++
+
+		a := attentionOf(room, client.ID)
+		away := a.Hidden ||
+			now.Sub(a.Heartbeat) > heartbeatGrace ||
+			keepalive.Band(int(client.Liveness.Load())) == keepalive.Lost ||
+			(room.Playing && now.Sub(a.Moved) > stalledAfter)
+		if !away {
+			s.Watching++
+		} else if detail == AttentionNames {
+			s.Away = append(s.Away, client.Name)
+		}
+	}
+	sort.Strings(s.Away)
+	return s
+}
@@ -0,0 +1,160 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Transfer moves a connected client into another room, creating it if
+// needed, and tells the client its new room code.
+func (h *Hub) Transfer(client *models.Client, target string) {
+	h.mu.Lock()
+	from := h.Rooms[client.RoomCode]
+	to, exists := h.Rooms[target]
+	if !exists {
+		to = newRoom(target, client.ID)
+		h.Rooms[target] = to
+	}
+	h.mu.Unlock()
+
+	if from != nil {
+		from.Mu.Lock()
+		delete(from.Clients, client)
+		h.record(from, "leave", client, "moved to "+publicCode(target), 0)
+		from.Mu.Unlock()
+	}
+	client.RoomCode = target
+	to.Mu.Lock()
+	to.Clients[client] = true
+	h.record(to, "join", client, "", 0)
+	parent := to.Parent
+	to.Mu.Unlock()
+
+	if !exists {
+		h.roomCreated(to)
+	}
+	log.Printf("🔀 Client %s (%s) moved to room %s", client.ID, client.Name, target)
+
+	deliver(client, models.Message{
+		Type:     "roomTransfer",
+		RoomCode: publicCode(target),
+		Content:  publicCode(parent),
+	})
+
+	if from != nil {
+		h.BroadcastUserList(from)
+		h.closeIfEmpty(from)
+	}
+	h.BroadcastUserList(to)
+}
+
+// StartBreakout splits the host's room according to plan. Members not
+// listed stay in the main room.
+func (h *Hub) StartBreakout(host *models.Client, planJSON string) {
+	var plan models.BreakoutPlan
+	if err := json.Unmarshal([]byte(planJSON), &plan); err != nil || len(plan.Rooms) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	main, exists := h.Rooms[host.RoomCode]
+	if !exists {
+		h.mu.Unlock()
+		return
+	}
+	main.Mu.Lock()
+	if main.Parent != "" {
+		main.Mu.Unlock()
+		h.mu.Unlock()
+		return
+	}
+
+	byID := make(map[string]*models.Client)
+	for c := range main.Clients {
+		client := c.(*models.Client)
+		byID[client.ID] = client
+	}
+
+	type move struct {
+		client *models.Client
+		code   string
+	}
+	var moves []move
+	var children []*models.Room
+	for i, br := range plan.Rooms {
+		code := fmt.Sprintf("%s-b%d", main.Code, len(main.Breakouts)+i+1)
+		child := newRoom(code, "")
+		child.Parent = main.Code
+		child.PasswordHash = main.PasswordHash
+		for _, id := range br.Members {
+			if client, ok := byID[id]; ok && id != host.ID {
+				if child.HostID == "" {
+					child.HostID = id
+				}
+				moves = append(moves, move{client, code})
+				delete(byID, id)
+			}
+		}
+		h.Rooms[code] = child
+		children = append(children, child)
+		main.Breakouts = append(main.Breakouts, code)
+		h.record(main, "breakout", host, br.Name, 0)
+	}
+	main.Mu.Unlock()
+	h.mu.Unlock()
+
+	for _, child := range children {
+		h.roomCreated(child)
+	}
+	for _, m := range moves {
+		h.Transfer(m.client, m.code)
+	}
+	for _, child := range children {
+		h.closeIfEmpty(child)
+	}
+}
+
+// ReturnToMain moves a client from a breakout room back to its main room.
+func (h *Hub) ReturnToMain(client *models.Client) {
+	room := h.room(client.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.RLock()
+	parent := room.Parent
+	room.Mu.RUnlock()
+	if parent != "" {
+		h.Transfer(client, parent)
+	}
+}
+
+// EndBreakout brings everyone in the host's breakout rooms back.
+func (h *Hub) EndBreakout(host *models.Client) {
+	main := h.room(host.RoomCode)
+	if main == nil {
+		return
+	}
+	main.Mu.Lock()
+	breakouts, code := main.Breakouts, main.Code
+	main.Breakouts = nil
+	main.Mu.Unlock()
+
+	var members []*models.Client
+	for _, childCode := range breakouts {
+		if child := h.room(childCode); child != nil {
+			members = append(members, h.members(child)...)
+		}
+	}
+	for _, client := range members {
+		h.Transfer(client, code)
+	}
+}
+
+// publicCode strips the tenant namespace from an internal room code.
+func publicCode(code string) string {
+	_, room := tenant.Split(code)
+	return room
+}
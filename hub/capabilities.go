@@ -0,0 +1,24 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"strings"
+)
+
+// requiredCapability is the capability a client must have declared to be
+// sent a message of this type, or 0 if every client gets it.
+func requiredCapability(msgType string) models.Capabilities {
+	switch {
+	case msgType == "reaction":
+		return models.CapReactions
+	case strings.HasPrefix(msgType, "voice"):
+		return models.CapVoice
+	}
+	return 0
+}
+
+// accepts reports whether a client wants a message of this type.
+func accepts(client *models.Client, msgType string) bool {
+	need := requiredCapability(msgType)
+	return client.Caps&need == need
+}
@@ -0,0 +1,51 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"sort"
+	"time"
+)
+
+// noteCatchUp keeps what a late joiner is told happened before they came:
+// the current media's load and the last play, pause or seek of it. Only the
+// primary slot counts. Callers hold room.Mu.
+func noteCatchUp(room *models.Room, msg models.Message, sender *models.Client) {
+	e := &models.RoomEvent{At: time.Now().UnixMilli()}
+	if sender != nil {
+		e.UserID, e.UserName = sender.ID, sender.Name
+	}
+	switch {
+	case mediaTypes[msg.Type]:
+		e.Kind, e.SourceType, e.URL = "media", msg.Type, msg.URL
+		room.LastLoad = e
+		room.LastPlayback = nil // it was of the media before
+	case msg.Type == "play" || msg.Type == "pause" || msg.Type == "seek":
+		e.Kind, e.Timestamp = msg.Type, msg.Timestamp
+		room.LastPlayback = e
+	}
+}
+
+// catchUpMessage bundles a room's catch-up events and recent chat, oldest
+// first, or reports false if nothing has happened yet. Callers hold room.Mu.
+func catchUpMessage(room *models.Room) (models.Message, bool) {
+	events := make([]models.RoomEvent, 0, len(room.ChatHistory)+2)
+	for _, e := range []*models.RoomEvent{room.LastLoad, room.LastPlayback} {
+		if e != nil {
+			events = append(events, *e)
+		}
+	}
+	for _, c := range room.ChatHistory {
+		events = append(events, models.RoomEvent{
+			Kind:     "chat",
+			At:       c.At,
+			UserID:   c.SenderID,
+			UserName: c.SenderName,
+			Text:     c.Text,
+		})
+	}
+	if len(events) == 0 {
+		return models.Message{}, false
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+	return models.Message{Type: "catchUp", CatchUp: events}, true
+}
@@ -0,0 +1,105 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"strconv"
+	"time"
+)
+
+// SetSlowMode limits every user in the sender's room to one chat message per
+// the given number of seconds. Zero turns slow mode off.
+func (h *Hub) SetSlowMode(sender *models.Client, seconds string) {
+	n, err := strconv.Atoi(seconds)
+	if err != nil || n < 0 {
+		return
+	}
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	room.SlowMode = time.Duration(n) * time.Second
+	room.LastChat = make(map[string]time.Time)
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(sender.RoomCode, models.Message{
+		Type:     "slowmode",
+		Content:  strconv.Itoa(n),
+		Cooldown: float64(n),
+	})
+}
+
+// AllowChat reports whether the sender may post a chat message now. When
+// slow mode rejects the message the sender is told how long to wait.
+func (h *Hub) AllowChat(sender *models.Client) bool {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return true
+	}
+	room.Mu.Lock()
+	if room.SlowMode == 0 || sender.ID == room.HostID {
+		room.Mu.Unlock()
+		return true
+	}
+
+	now := time.Now()
+	slowMode := room.SlowMode
+	remaining := slowMode - now.Sub(room.LastChat[sender.ID])
+	if remaining <= 0 {
+		room.LastChat[sender.ID] = now
+		room.Mu.Unlock()
+		return true
+	}
+	room.Mu.Unlock()
+
+	deliver(sender, models.Message{
+		Type:     "slowModeActive",
+		Content:  strconv.Itoa(int(slowMode.Seconds())),
+		Cooldown: remaining.Seconds(),
+	})
+	return false
+}
+
+// Announce posts a server message into a room's chat under the given name.
+// It returns false if the room isn't open.
+func (h *Hub) Announce(roomCode, from, text string) bool {
+	room := h.room(roomCode)
+	if room == nil {
+		return false
+	}
+	room.Mu.Lock()
+	msg := h.keepChat(room, models.ChatEntry{SenderName: from, Text: text, At: time.Now().UnixMilli()})
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(roomCode, msg)
+	return true
+}
+
+// chat relays a member's message under the name they joined with and keeps
+// it in the room's history.
+func (h *Hub) chat(sender *models.Client, text string) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	msg := h.keepChat(room, models.ChatEntry{SenderID: sender.ID, SenderName: sender.Name, Text: text, At: time.Now().UnixMilli()})
+	room.LastActivity = time.Now()
+	room.Mu.Unlock()
+
+	h.Broadcast(msg, sender)
+}
+
+// keepChat adds an entry to the room's history, dropping the oldest past
+// the ChatHistory setting, and returns the message relaying it. Callers
+// hold room.Mu.
+func (h *Hub) keepChat(room *models.Room, entry models.ChatEntry) models.Message {
+	if keep := h.Settings().ChatHistory; keep > 0 {
+		room.ChatHistory = append(room.ChatHistory, entry)
+		if len(room.ChatHistory) > keep {
+			room.ChatHistory = append([]models.ChatEntry(nil), room.ChatHistory[len(room.ChatHistory)-keep:]...)
+		}
+	}
+	return models.Message{Type: "chat", Chat: &entry}
+}
@@ -0,0 +1,24 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"time"
+)
+
+// TimeSync answers a client's clock probe. The reply echoes the client's
+// sentAt and is stamped with serverTime as it is written, so the client can
+// work out its offset from the server clock and the round trip, NTP style.
+func (h *Hub) TimeSync(msg models.Message, sender *models.Client) {
+	deliver(sender, models.Message{Type: "timeSync", SentAt: msg.SentAt})
+}
+
+// stampServerAt sets msg.ServerAt to when, on the server clock, the
+// position it carries was current: now for the server's own messages, half
+// the sender's round trip ago for a member's.
+func stampServerAt(msg *models.Message, sender *models.Client) {
+	at := time.Now().UnixMilli()
+	if sender != nil {
+		at -= sender.RTT.Load() / 2
+	}
+	msg.ServerAt = at
+}
@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"log"
+	"net/url"
+	"time"
+)
+
+// closedRoomHold is how long a room's code keeps turning joiners away after
+// the room was closed on purpose.
+const closedRoomHold = 10 * time.Minute
+
+// CloseRoom ends a room while people are in it. Everyone gets a roomClosed
+// message with the reason and, if moveTo names a room, a link to it, and is
+// then disconnected. The room is archived like one that emptied, its
+// breakout rooms are closed with it, and its code refuses joins for a while.
+func (h *Hub) CloseRoom(code, reason, moveTo string) error {
+	return h.endRoom(code, reason, moveTo, true)
+}
+
+// endRoom is CloseRoom; hold says whether the code then refuses joins.
+func (h *Hub) endRoom(code, reason, moveTo string, hold bool) error {
+	h.mu.Lock()
+	room, exists := h.Rooms[code]
+	if !exists {
+		h.mu.Unlock()
+		return ErrRoomNotFound
+	}
+	if hold {
+		if h.closed == nil {
+			h.closed = make(map[string]time.Time)
+		}
+		h.closed[code] = time.Now().Add(closedRoomHold)
+	}
+	h.mu.Unlock()
+
+	room.Mu.RLock()
+	breakouts := append([]string(nil), room.Breakouts...)
+	room.Mu.RUnlock()
+
+	for _, child := range breakouts {
+		h.endRoom(child, reason, moveTo, hold)
+	}
+
+	// Members are asked how it went before they're let go
+	if h.FeedbackToken != nil && !isHidden(code) {
+		for _, client := range h.members(room) {
+			deliver(client, models.Message{Type: "feedbackRequest", Content: h.FeedbackToken(code, client.ID)})
+		}
+	}
+
+	msg := models.Message{Type: "roomClosed", Content: reason}
+	if moveTo != "" {
+		msg.RoomCode = moveTo
+		msg.URL = "/?room=" + url.QueryEscape(moveTo)
+	}
+	h.BroadcastRoom(code, msg)
+
+	// Each connection writes the notice before it sees its channel closed
+	for _, client := range h.members(room) {
+		if client.Close() {
+			metrics.Dropped(metrics.DropRoomClosed)
+		}
+	}
+
+	log.Printf("🚪 Room %s closed: %s", code, reason)
+	h.closeRoom(room)
+	return nil
+}
+
+// closeRoom removes a room and runs the RoomClosed hooks, which archive it.
+func (h *Hub) closeRoom(room *models.Room) {
+	h.mu.Lock()
+	room.Mu.Lock()
+	if h.Rooms[room.Code] == room {
+		delete(h.Rooms, room.Code)
+	}
+	closeObservers(room)
+	if room.Webhook != nil && room.Webhook.Pending != nil {
+		room.Webhook.Pending.Stop()
+	}
+	room.Mu.Unlock()
+	h.mu.Unlock()
+
+	for _, hk := range h.visibleHooks(room) {
+		if hk.RoomClosed != nil {
+			hk.RoomClosed(room)
+		}
+	}
+}
+
+// closedNotice returns why a recently closed room's code isn't taking
+// joiners. Callers hold h.mu.
+func (h *Hub) closedNotice(code string) (string, bool) {
+	until, ok := h.closed[code]
+	if !ok || time.Now().After(until) {
+		return "", false
+	}
+	return "This room was closed by its host.", true
+}
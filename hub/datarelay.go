@@ -0,0 +1,191 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"coopcinema/ratelimit"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRelayChunk is the most data one relayData message may carry: a 16 KB
+// file chunk once base64-encoded, with room to spare.
+const maxRelayChunk = 32 << 10
+
+// Relay kinds: what a relay stands in for.
+const (
+	RelayFile  = "file"
+	RelayVoice = "voice"
+)
+
+// A data relay carries what two members' browsers would have sent each
+// other over WebRTC when they can't connect directly (both behind
+// symmetric NATs, say). Either end asks for one with relayOpen once its
+// peer connection fails; from then on relayData between the two goes
+// through the server, each member's share capped at the hub's RelayRate.
+type dataRelay struct {
+	kind string
+	a, b *models.Client
+}
+
+// other is the end of r that isn't c, nil if c isn't an end of r.
+func (r *dataRelay) other(c *models.Client) *models.Client {
+	switch c {
+	case r.a:
+		return r.b
+	case r.b:
+		return r.a
+	}
+	return nil
+}
+
+type relayKey struct {
+	kind, a, b string // user IDs, a before b
+}
+
+func newRelayKey(kind, id1, id2 string) relayKey {
+	if id2 < id1 {
+		id1, id2 = id2, id1
+	}
+	return relayKey{kind, id1, id2}
+}
+
+// relayTable holds the open data relays, under their own lock so relayed data
+// never waits on the rooms.
+type relayTable struct {
+	mu      sync.Mutex
+	open    map[relayKey]*dataRelay
+	limiter *ratelimit.Limiter // bytes, by sender user ID
+}
+
+// setRate caps what each member may send through relays, in bytes per
+// second, letting a second's worth (and at least a whole chunk) through at
+// once.
+func (rs *relayTable) setRate(rate int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rate <= 0 {
+		return
+	}
+	burst := float64(max(rate, maxRelayChunk))
+	if rs.limiter == nil {
+		rs.limiter = ratelimit.New(float64(rate), burst)
+		return
+	}
+	rs.limiter.SetRate(float64(rate), burst)
+}
+
+// RelayOpen sets up a relay of msg.Content's kind between the sender and
+// the member msg.To, who must both be in voice chat for a voice relay.
+// Both get relayOpen naming the other, with the rate cap in signal. If the
+// relay is off or full, the sender gets an error instead.
+func (h *Hub) RelayOpen(msg models.Message, sender *models.Client) {
+	kind := msg.Content
+	if (kind != RelayFile && kind != RelayVoice) || msg.To == "" || msg.To == sender.ID {
+		return
+	}
+	if kind == RelayVoice && !sender.InVoice.Load() {
+		return
+	}
+
+	var peer *models.Client
+	if room := h.room(sender.RoomCode); room != nil {
+		room.Mu.RLock()
+		for c := range room.Clients {
+			if client := c.(*models.Client); client.ID == msg.To && (kind != RelayVoice || client.InVoice.Load()) {
+				peer = client
+				break
+			}
+		}
+		room.Mu.RUnlock()
+	}
+	if peer == nil {
+		return
+	}
+
+	s := h.Settings()
+	if s.RelayRate <= 0 {
+		deliver(sender, models.ErrorMessage("relayUnavailable", msg.Type, "this server doesn't relay"))
+		return
+	}
+	key := newRelayKey(kind, sender.ID, peer.ID)
+	h.relays.mu.Lock()
+	if _, exists := h.relays.open[key]; !exists && len(h.relays.open) >= s.RelayMax {
+		h.relays.mu.Unlock()
+		deliver(sender, models.ErrorMessage("relayUnavailable", msg.Type, "too many relays open, try again later"))
+		return
+	}
+	if h.relays.open == nil {
+		h.relays.open = make(map[relayKey]*dataRelay)
+	}
+	h.relays.open[key] = &dataRelay{kind: kind, a: sender, b: peer}
+	h.relays.mu.Unlock()
+
+	signal := relayTerms(s.RelayRate)
+	deliver(peer, models.Message{Type: "relayOpen", UserID: sender.ID, UserName: sender.Name, Content: kind, Signal: signal})
+	deliver(sender, models.Message{Type: "relayOpen", UserID: peer.ID, UserName: peer.Name, Content: kind, Signal: signal})
+}
+
+// relayTerms is the signal of relayOpen: what each end may send.
+func relayTerms(rate int) []byte {
+	return []byte(`{"rate":` + strconv.Itoa(rate) + `,"maxChunk":` + strconv.Itoa(maxRelayChunk) + `}`)
+}
+
+// RelayData passes msg.Signal to the other end of the sender's relay of
+// msg.Content's kind with msg.To. A sender over its rate is held up until
+// it is back under it, so nothing it sends is lost; its connection's
+// reader simply stops reading for that long.
+func (h *Hub) RelayData(msg models.Message, sender *models.Client) {
+	if msg.To == "" || len(msg.Signal) == 0 || len(msg.Signal) > maxRelayChunk {
+		return
+	}
+	h.relays.mu.Lock()
+	r := h.relays.open[newRelayKey(msg.Content, sender.ID, msg.To)]
+	limiter := h.relays.limiter
+	h.relays.mu.Unlock()
+	if r == nil || limiter == nil {
+		return
+	}
+	peer := r.other(sender)
+	if peer == nil {
+		return
+	}
+
+	if wait := limiter.Take(sender.ID, float64(len(msg.Signal))); wait > 0 {
+		time.Sleep(wait)
+	}
+	deliver(peer, models.Message{Type: "relayData", UserID: sender.ID, Content: r.kind, Signal: msg.Signal})
+}
+
+// RelayClose ends the sender's relay of msg.Content's kind with msg.To.
+func (h *Hub) RelayClose(msg models.Message, sender *models.Client) {
+	key := newRelayKey(msg.Content, sender.ID, msg.To)
+	h.relays.mu.Lock()
+	r := h.relays.open[key]
+	if r == nil || r.other(sender) == nil {
+		h.relays.mu.Unlock()
+		return
+	}
+	delete(h.relays.open, key)
+	h.relays.mu.Unlock()
+
+	deliver(r.other(sender), models.Message{Type: "relayClose", UserID: sender.ID, UserName: sender.Name, Content: r.kind})
+}
+
+// closeRelays ends client's relays, those of one kind or, for "", all of
+// them, and tells the other ends.
+func (h *Hub) closeRelays(client *models.Client, kind string) {
+	var ended []*dataRelay
+	h.relays.mu.Lock()
+	for key, r := range h.relays.open {
+		if r.other(client) != nil && (kind == "" || r.kind == kind) {
+			delete(h.relays.open, key)
+			ended = append(ended, r)
+		}
+	}
+	h.relays.mu.Unlock()
+
+	for _, r := range ended {
+		deliver(r.other(client), models.Message{Type: "relayClose", UserID: client.ID, UserName: client.Name, Content: r.kind})
+	}
+}
@@ -0,0 +1,178 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"errors"
+	"sort"
+)
+
+var ErrNoDJ = errors.New("DJ mode is off")
+
+// SetDJMode turns DJ mode on ("on") or off ("off") for the host's room.
+// While it's on only the current DJ may load media.
+func (h *Hub) SetDJMode(sender *models.Client, mode string) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	switch mode {
+	case "on":
+		if room.DJ != nil {
+			room.Mu.Unlock()
+			return
+		}
+		// The host spins first, then everyone else by name
+		room.DJ = &models.DJRotation{Order: []string{room.HostID}}
+		syncDJOrder(room)
+	case "off":
+		room.DJ = nil
+	default:
+		room.Mu.Unlock()
+		return
+	}
+	msg, code := djMessage(room), room.Code
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(code, msg)
+}
+
+// mayLoadMedia reports whether the sender may load media: always, unless DJ
+// mode is on and it isn't their turn.
+func (h *Hub) mayLoadMedia(sender *models.Client) bool {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return true
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	if room.DJ == nil {
+		return true
+	}
+	syncDJOrder(room)
+	return room.DJ.Order[0] == sender.ID
+}
+
+// passDJ hands the turn to the next member in line and announces it.
+func (h *Hub) passDJ(roomCode string) {
+	room := h.room(roomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	if room.DJ == nil {
+		room.Mu.Unlock()
+		return
+	}
+	syncDJOrder(room)
+	dj := room.DJ
+	if len(dj.Order) == 0 {
+		room.Mu.Unlock()
+		return
+	}
+	dj.Order = append(dj.Order[1:], dj.Order[0])
+	dj.SkipVotes = nil
+	msg := djMessage(room)
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(roomCode, msg)
+}
+
+// djLeft moves the turn on when the current DJ leaves the room.
+func (h *Hub) djLeft(room *models.Room, client *models.Client) {
+	room.Mu.Lock()
+	if room.DJ == nil || len(room.DJ.Order) == 0 || room.DJ.Order[0] != client.ID {
+		room.Mu.Unlock()
+		return
+	}
+	syncDJOrder(room)
+	room.DJ.SkipVotes = nil
+	msg, code := djMessage(room), room.Code
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(code, msg)
+}
+
+// VoteSkip records a vote to take the turn away from the current DJ. Once
+// more than half the room agrees the turn passes on. It returns the votes
+// so far and how many are needed.
+func (h *Hub) VoteSkip(client *models.Client) (votes, needed int, passed bool, err error) {
+	room := h.room(client.RoomCode)
+	if room == nil {
+		return 0, 0, false, ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	if room.DJ == nil {
+		room.Mu.Unlock()
+		return 0, 0, false, ErrNoDJ
+	}
+	dj := room.DJ
+	if dj.SkipVotes == nil {
+		dj.SkipVotes = make(map[string]bool)
+	}
+	dj.SkipVotes[client.ID] = true
+	for id := range dj.SkipVotes {
+		if !inRoom(room, id) {
+			delete(dj.SkipVotes, id)
+		}
+	}
+	votes, needed = len(dj.SkipVotes), len(room.Clients)/2+1
+	room.Mu.Unlock()
+
+	if votes >= needed {
+		h.passDJ(client.RoomCode)
+		return votes, needed, true, nil
+	}
+	return votes, needed, false, nil
+}
+
+// syncDJOrder drops members who left and queues newcomers at the back.
+// Callers hold room.Mu.
+func syncDJOrder(room *models.Room) {
+	dj := room.DJ
+	seen := make(map[string]bool, len(dj.Order))
+	order := dj.Order[:0]
+	for _, id := range dj.Order {
+		if inRoom(room, id) && !seen[id] {
+			order = append(order, id)
+			seen[id] = true
+		}
+	}
+
+	var newcomers []*models.Client
+	for c := range room.Clients {
+		client := c.(*models.Client)
+		if !seen[client.ID] {
+			newcomers = append(newcomers, client)
+			seen[client.ID] = true
+		}
+	}
+	sort.Slice(newcomers, func(i, j int) bool { return newcomers[i].Name < newcomers[j].Name })
+	for _, client := range newcomers {
+		order = append(order, client.ID)
+	}
+	dj.Order = order
+}
+
+func inRoom(room *models.Room, userID string) bool {
+	for c := range room.Clients {
+		if c.(*models.Client).ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// djMessage announces DJ mode and whose turn it is. Callers hold room.Mu.
+func djMessage(room *models.Room) models.Message {
+	if room.DJ == nil || len(room.DJ.Order) == 0 {
+		return models.Message{Type: "dj", Content: "off"}
+	}
+	msg := models.Message{Type: "dj", Content: "on", UserID: room.DJ.Order[0]}
+	for c := range room.Clients {
+		if client := c.(*models.Client); client.ID == msg.UserID {
+			msg.UserName = client.Name
+		}
+	}
+	return msg
+}
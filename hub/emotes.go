@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"sort"
+)
+
+// SetEmote registers or replaces a custom reaction in a room. It returns
+// the blob key the name had before, for the caller to release, and false if
+// the room does not exist. Each name holds its own reference to its blob.
+func (h *Hub) SetEmote(roomCode, name, blobKey string) (string, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return "", false
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	if room.Emotes == nil {
+		room.Emotes = make(map[string]string)
+	}
+	old := room.Emotes[name]
+	room.Emotes[name] = blobKey
+	return old, true
+}
+
+// DeleteEmote removes a custom reaction from a room. It returns the blob key
+// the name had, for the caller to release, and false if there was no such
+// reaction.
+func (h *Hub) DeleteEmote(roomCode, name string) (string, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return "", false
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	old, ok := room.Emotes[name]
+	if !ok {
+		return "", false
+	}
+	delete(room.Emotes, name)
+	return old, true
+}
+
+// Emotes lists a room's custom reactions sorted by name, with URLs built by
+// urlFor from each blob key.
+func (h *Hub) Emotes(roomCode string, urlFor func(key string) string) ([]models.Emote, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	emotes := []models.Emote{}
+	for name, key := range room.Emotes {
+		emotes = append(emotes, models.Emote{Name: name, URL: urlFor(key)})
+	}
+	sort.Slice(emotes, func(i, j int) bool { return emotes[i].Name < emotes[j].Name })
+	return emotes, true
+}
+
+// AllowReaction reports whether a reaction may be relayed. Once a room
+// defines a custom set, only registered names are broadcast.
+func (h *Hub) AllowReaction(sender *models.Client, name string) bool {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return true
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	if len(room.Emotes) == 0 {
+		return true
+	}
+	_, ok := room.Emotes[name]
+	return ok
+}
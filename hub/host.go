@@ -0,0 +1,77 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"log"
+	"sort"
+)
+
+// hostControlled lists playback messages that, in host mode, only the host
+// may send.
+var hostControlled = map[string]bool{
+	"play":           true,
+	"pause":          true,
+	"seek":           true,
+	"ended":          true,
+	"queueNext":      true,
+	"queueRemove":    true,
+	"queueReorder":   true,
+	"subtitleOffset": true,
+	"setMedia":       true,
+}
+
+// mayControlPlayback reports whether the sender may move the room's shared
+// playhead: anyone unless host mode is on.
+func (h *Hub) mayControlPlayback(sender *models.Client) bool {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return true
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return !room.HostMode || room.HostID == sender.ID
+}
+
+// TransferHost hands hosting from the sender to another member of the room
+// and tells everyone with a promote message. Host mode stays as it was.
+func (h *Hub) TransferHost(sender *models.Client, userID string) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	if userID == room.HostID || !inRoom(room, userID) {
+		room.Mu.Unlock()
+		return
+	}
+	room.HostID = userID
+	h.record(room, "host", sender, userID, 0)
+	code := room.Code
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(code, models.Message{Type: "promote", UserID: userID})
+	h.BroadcastUserList(room)
+}
+
+// promoteIfHostLeft picks a new host when the host's last connection leaves
+// a room that still has members: the member with the lowest ID, the same one
+// clients ask for playback state.
+func (h *Hub) promoteIfHostLeft(room *models.Room, left *models.Client) {
+	room.Mu.Lock()
+	if left.ID != room.HostID || inRoom(room, left.ID) || len(room.Clients) == 0 {
+		room.Mu.Unlock()
+		return
+	}
+	ids := make([]string, 0, len(room.Clients))
+	for c := range room.Clients {
+		ids = append(ids, c.(*models.Client).ID)
+	}
+	sort.Strings(ids)
+	room.HostID = ids[0]
+	h.record(room, "host", nil, room.HostID, 0)
+	host, code := room.HostID, room.Code
+	room.Mu.Unlock()
+
+	log.Printf("👑 %s is now host of room %s", host, code)
+	h.BroadcastRoom(code, models.Message{Type: "promote", UserID: host})
+}
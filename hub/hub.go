@@ -1,126 +1,580 @@
 package hub
 
 import (
+	"coopcinema/codec"
+	"coopcinema/eventlog"
+	"coopcinema/geoip"
+	"coopcinema/keepalive"
+	"coopcinema/leaderboard"
+	"coopcinema/lyrics"
+	"coopcinema/metrics"
 	"coopcinema/models"
 	"encoding/json"
 	"log"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// HiddenRoomPrefix marks internal rooms such as the canary's. They are left
+// out of metrics, occupancy and lifecycle hooks.
+const HiddenRoomPrefix = "_canary-"
+
+func isHidden(roomCode string) bool {
+	return strings.HasPrefix(roomCode, HiddenRoomPrefix)
+}
+
 type Hub struct {
-	Rooms      map[string]*models.Room
-	Register   chan *models.Client
-	Unregister chan *models.Client
-	mu         sync.RWMutex
+	Rooms       map[string]*models.Room
+	Schedules   map[string]*models.Schedule
+	EventLog    *eventlog.Writer   // optional inbound message recording
+	Leaderboard *leaderboard.Store // optional watch-time standings for scheduled rooms
+	// YouTubeAPIKey lets the hub ask where YouTube videos can play, to warn
+	// rooms with members elsewhere
+	YouTubeAPIKey string
+	GeoIP         *geoip.DB // resolves members' countries; nil if unknown
+	// FeedbackToken, if set, signs the token each member of a closing room
+	// rates the session with
+	FeedbackToken func(roomCode, userID string) string
+	mu            sync.RWMutex
+
+	loops map[string]*roomLoop // by room code; see roomloop.go
+
+	middleware   []stagedMiddleware
+	pipeline     Handler
+	typeHandlers map[string]Handler
+	hooks        []Hooks
+
+	maintenance      models.Maintenance
+	maintenanceTimer *time.Timer
+
+	retired map[string]*retiredCode // old room code -> where it went
+	closed  map[string]time.Time    // deliberately closed room code -> when it may reopen
+
+	shuttingDown atomic.Bool // rooms are kept, not closed, as they empty
+
+	settings atomic.Pointer[Settings] // see settings.go
+
+	relays relayTable // see datarelay.go
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		Rooms:      make(map[string]*models.Room),
-		Register:   make(chan *models.Client),
-		Unregister: make(chan *models.Client),
-	}
+// Hooks are optional callbacks for room lifecycle events. They run on the
+// room's goroutine and must not block.
+type Hooks struct {
+	RoomCreated  func(room *models.Room)
+	RoomClosed   func(room *models.Room)
+	ClientJoined func(room *models.Room, client *models.Client)
+	ClientLeft   func(room *models.Room, client *models.Client)
 }
 
-func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.Register:
-			h.registerClient(client)
-		case client := <-h.Unregister:
-			h.unregisterClient(client)
-		}
+// AddHooks registers lifecycle callbacks. It must be called before the
+// first client joins.
+func (h *Hub) AddHooks(hooks Hooks) {
+	h.hooks = append(h.hooks, hooks)
+}
+
+func NewHub() *Hub {
+	h := &Hub{
+		Rooms:     make(map[string]*models.Room),
+		Schedules: make(map[string]*models.Schedule),
+		loops:     make(map[string]*roomLoop),
 	}
+	h.registerDefaultMiddleware()
+	return h
 }
 
 func (h *Hub) registerClient(client *models.Client) {
 	h.mu.Lock()
 	room, exists := h.Rooms[client.RoomCode]
 	if !exists {
-		room = &models.Room{
-			Code:    client.RoomCode,
-			Clients: make(map[interface{}]bool),
-		}
+		room = newRoom(client.RoomCode, client.ID)
 		h.Rooms[client.RoomCode] = room
 	}
 	h.mu.Unlock()
 
+	if !exists {
+		h.roomCreated(room)
+	}
+
+	room.Mu.Lock()
+	if room.HostID == "" && room.Parent == "" {
+		room.HostID = client.ID // first into a reserved room
+	}
 	room.Clients[client] = true
-	log.Printf("✅ Client %s (%s) joined room %s. Room size: %d",
-		client.ID, client.Name, client.RoomCode, len(room.Clients))
+	stale := takeOver(room, client)
+	resumed, gone := takeAway(room, client)
+	resumed = resumed || stale != nil
+	if gone != nil {
+		h.record(room, "leave", gone, "", 0)
+	}
+	if !resumed {
+		h.record(room, "join", client, "", 0)
+	}
+	size := len(room.Clients)
+	room.Mu.Unlock()
+	if stale != nil {
+		stale.Close()
+	}
+	if gone != nil {
+		h.clientLeft(room, gone, size)
+	}
+	if resumed {
+		log.Printf("🔁 Client %s (%s) resumed in room %s", client.ID, client.Name, client.RoomCode)
+		deliver(client, models.Message{Type: "resumed"})
+	} else {
+		metrics.Joined()
+		for _, hk := range h.visibleHooks(room) {
+			if hk.ClientJoined != nil {
+				hk.ClientJoined(room, client)
+			}
+		}
+		log.Printf("✅ Client %s (%s) joined room %s. Room size: %d",
+			client.ID, client.Name, client.RoomCode, size)
+	}
 
 	h.BroadcastUserList(room)
-}
+	h.regionsJoined(room, client)
 
-func (h *Hub) unregisterClient(client *models.Client) {
+	// Late joiners pick up what is playing and where, whether it is known
+	// to be broken, who controls it in host mode, who loaded it and last
+	// moved it along with recent chat, the room's
+	// accessibility setup, any maintenance banner, secondary media, whether
+	// attention is measured, the quality cap, whose turn it is in DJ mode,
+	// the playlist and shared subtitles
 	h.mu.RLock()
-	room, exists := h.Rooms[client.RoomCode]
+	m := h.maintenance
 	h.mu.RUnlock()
+	room.Mu.RLock()
+	state := syncStateMessage(room)
+	var unavailable *models.Message
+	if mediaUnavailable(room) {
+		msg := mediaUnavailableMessage(room)
+		unavailable = &msg
+	}
+	var history []models.ChatEntry
+	catchUp, caughtUp := catchUpMessage(room)
+	if client.Protocol < 3 {
+		history, caughtUp = append(history, room.ChatHistory...), false
+	}
+	hostMode, hostID := room.HostMode, room.HostID
+	a := room.Accessibility
+	var dj *models.Message
+	if room.DJ != nil {
+		msg := djMessage(room)
+		dj = &msg
+	}
+	qualityCap := room.QualityCap
+	attentionOn := room.AttentionOn
+	slots := slotCatchUp(room)
+	var queue *models.Message
+	if room.Playlist.Current != nil || len(room.Playlist.Items) > 0 {
+		msg := queueMessage(room)
+		queue = &msg
+	}
+	var subtitles *models.Message
+	if subtitlesCurrent(room) {
+		msg := subtitlesMessage(room)
+		subtitles = &msg
+	}
+	room.Mu.RUnlock()
+	deliver(client, state)
+	if unavailable != nil {
+		deliver(client, *unavailable)
+	}
+	if caughtUp {
+		deliver(client, catchUp)
+	} else if len(history) > 0 {
+		deliver(client, models.Message{Type: "chatHistory", History: history})
+	}
+	if hostMode {
+		deliver(client, models.Message{Type: "hostchange", UserID: hostID})
+	}
+	if a != (models.Accessibility{}) {
+		deliver(client, accessibilityMessage(a))
+	}
+	if m.Active || !m.At.IsZero() {
+		deliver(client, maintenanceMessage(m))
+	}
+	for _, msg := range slots {
+		deliver(client, msg)
+	}
+	if attentionOn {
+		deliver(client, models.Message{Type: "attentionMode", Content: "on"})
+	}
+	if qualityCap > 0 {
+		deliver(client, qualityCapMessage(qualityCap))
+	}
+	if dj != nil {
+		deliver(client, *dj)
+	}
+	if queue != nil {
+		deliver(client, *queue)
+	}
+	if subtitles != nil {
+		deliver(client, *subtitles)
+	}
+}
+
+// unregisterClient is the only place a client is torn down. Anything
+// else that wants a client gone closes it, and its connection's reader then
+// unregisters it here. A client whose connection dropped may be held away
+// instead, and comes back here when its grace runs out.
+func (h *Hub) unregisterClient(client *models.Client) {
+	// Only a client the server hadn't already closed may come back
+	resumable := client.Close()
+	if resumable {
+		metrics.Dropped(metrics.DropLeft)
+	}
+
+	room := h.room(client.RoomCode)
+	exists := room != nil
+	var member, away, expired bool
+	var size int
+	if exists {
+		room.Mu.Lock()
+		member = room.Clients[client]
+	}
+	if member {
+		delete(room.Clients, client)
+		away = resumable && h.holdAway(room, client)
+	} else if exists {
+		expired = dropAway(room, client)
+	}
+	if (member && !away) || expired {
+		h.record(room, "leave", client, "", 0)
+	}
+	if exists {
+		size = len(room.Clients)
+		room.Mu.Unlock()
+	}
 
+	if away {
+		log.Printf("💤 Client %s (%s) dropped from room %s; keeping their place for %s",
+			client.ID, client.Name, client.RoomCode, h.Settings().ResumeGrace)
+		h.voiceLeft(room, client)
+		h.closeRelays(client, "")
+		h.bufferingLeft(room, client)
+		h.BroadcastUserList(room)
+		return
+	}
 	if exists {
-		if _, ok := room.Clients[client]; ok {
-			delete(room.Clients, client)
-			close(client.Send)
-			log.Printf("❌ Client %s (%s) left room %s. Room size: %d",
-				client.ID, client.Name, client.RoomCode, len(room.Clients))
+		if (member && !away) || expired {
+			h.clientLeft(room, client, size)
 		}
 
+		h.promoteIfHostLeft(room, client)
+		h.voiceLeft(room, client)
+		h.closeRelays(client, "")
+		h.bufferingLeft(room, client)
 		h.BroadcastUserList(room)
+		h.djLeft(room, client)
+		h.closeIfEmpty(room)
+	}
+}
 
-		if len(room.Clients) == 0 {
-			h.mu.Lock()
-			delete(h.Rooms, client.RoomCode)
-			h.mu.Unlock()
-			log.Printf("🗑️  Room %s deleted (empty)", client.RoomCode)
+// clientLeft counts and logs a member gone for good and runs the hooks.
+func (h *Hub) clientLeft(room *models.Room, client *models.Client, size int) {
+	metrics.Left()
+	log.Printf("❌ Client %s (%s) left room %s. Room size: %d",
+		client.ID, client.Name, client.RoomCode, size)
+	for _, hk := range h.visibleHooks(room) {
+		if hk.ClientLeft != nil {
+			hk.ClientLeft(room, client)
 		}
 	}
 }
 
+func newRoom(code, hostID string) *models.Room {
+	now := time.Now()
+	return &models.Room{
+		Code:         code,
+		Clients:      make(map[interface{}]bool),
+		HostID:       hostID,
+		RosterMode:   models.RosterFull,
+		OpenedAt:     now,
+		LastActivity: now,
+	}
+}
+
+// visibleHooks returns the lifecycle hooks that apply to a room: none for
+// hidden rooms.
+func (h *Hub) visibleHooks(room *models.Room) []Hooks {
+	if isHidden(room.Code) {
+		return nil
+	}
+	return h.hooks
+}
+
+func (h *Hub) roomCreated(room *models.Room) {
+	if !isHidden(room.Code) {
+		metrics.RoomCreated()
+	}
+	for _, hk := range h.visibleHooks(room) {
+		if hk.RoomCreated != nil {
+			hk.RoomCreated(room)
+		}
+	}
+}
+
+func (h *Hub) closeIfEmpty(room *models.Room) {
+	room.Mu.RLock()
+	empty := len(room.Clients) == 0 && len(room.Away) == 0
+	room.Mu.RUnlock()
+	if !empty || h.shuttingDown.Load() {
+		return
+	}
+
+	log.Printf("🗑️  Room %s deleted (empty)", room.Code)
+	h.closeRoom(room)
+}
+
 func (h *Hub) BroadcastUserList(room *models.Room) {
-	users := []map[string]string{}
-	for c := range room.Clients {
-		client := c.(*models.Client)
-		users = append(users, map[string]string{
-			"id":   client.ID,
-			"name": client.Name,
-		})
+	room.Mu.RLock()
+	clients := membersLocked(room)
+	hostID, rosterMode := room.HostID, room.RosterMode
+	away := awayEntries(room, hostID)
+	room.Mu.RUnlock()
+
+	users := []models.RosterEntry{}
+	for _, client := range clients {
+		score := int(client.Liveness.Load())
+		user := models.RosterEntry{
+			ID:       client.ID,
+			Name:     client.Name,
+			Host:     client.ID == hostID,
+			Liveness: score,
+			Link:     keepalive.Band(score),
+		}
+		if client.InVoice.Load() {
+			user.Voice = true
+			user.Muted = client.Muted.Load()
+			user.Speaking = client.Speaking.Load()
+		}
+		users = append(users, user)
 	}
+	users = append(users, away...)
 
-	userListJSON, _ := json.Marshal(users)
-	msg := models.Message{
+	full := &models.UserListPayload{Users: users}
+	fullJSON := legacyRoster(users)
+	metrics.Broadcast("userList")
+	h.notifyObservers(room, models.Message{
 		Type:     "userList",
-		UserName: string(userListJSON),
+		UserName: "[]",
+		Viewers:  len(users),
+		Payload:  &models.UserListPayload{Users: []models.RosterEntry{}, Viewers: len(users)},
+	})
+
+	// Everyone shown the full roster shares its frames, as does everyone
+	// shown only the head count
+	shared, anonymous := codec.NewShared(), codec.NewShared()
+	for _, client := range clients {
+		msg := models.Message{
+			Type:     "userList",
+			UserName: fullJSON,
+			Payload:  full,
+			Encoded:  shared,
+		}
+
+		if client.ID != hostID {
+			switch rosterMode {
+			case models.RosterAnonymous:
+				msg.Encoded = anonymous
+				msg.UserName = "[]"
+				msg.Viewers = len(users)
+				msg.Payload = &models.UserListPayload{Users: []models.RosterEntry{}, Viewers: len(users)}
+			case models.RosterHostOnly:
+				self := []models.RosterEntry{{ID: client.ID, Name: client.Name}}
+				for _, u := range users {
+					if u.ID == client.ID {
+						self[0] = u
+						break
+					}
+				}
+				msg.UserName = legacyRoster(self)
+				msg.Payload = &models.UserListPayload{Users: self}
+				msg.Encoded = nil
+			}
+		}
+
+		deliverOrDrop(client, msg)
 	}
+}
 
-	for c := range room.Clients {
-		client := c.(*models.Client)
-		select {
-		case client.Send <- msg:
-		default:
-			close(client.Send)
-			delete(room.Clients, client)
+// legacyRoster encodes users the way userList carried them in userName
+// before payloads: a JSON array of string maps.
+func legacyRoster(users []models.RosterEntry) string {
+	roster := make([]map[string]string, len(users))
+	for i, u := range users {
+		user := map[string]string{
+			"id":       u.ID,
+			"name":     u.Name,
+			"liveness": strconv.Itoa(u.Liveness),
+			"link":     u.Link,
+		}
+		if u.Host {
+			user["host"] = "true"
+		}
+		if u.Away {
+			user["away"] = "true"
 		}
+		if u.Voice {
+			user["voice"] = "true"
+			user["muted"] = strconv.FormatBool(u.Muted)
+			user["speaking"] = strconv.FormatBool(u.Speaking)
+		}
+		roster[i] = user
 	}
+	data, _ := json.Marshal(roster)
+	return string(data)
 }
 
+// SetRosterMode changes how much of the roster non-host clients receive.
+func (h *Hub) SetRosterMode(sender *models.Client, mode string) {
+	switch mode {
+	case models.RosterFull, models.RosterAnonymous, models.RosterHostOnly:
+	default:
+		return
+	}
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	room.RosterMode = mode
+	room.Mu.Unlock()
+
+	h.BroadcastUserList(room)
+}
+
+// Broadcast relays a member's message to the rest of its room. It is
+// handed to the room's loop, which relays a room's messages in the order
+// they came.
 func (h *Hub) Broadcast(msg models.Message, sender *models.Client) {
-	h.mu.RLock()
-	room, exists := h.Rooms[sender.RoomCode]
-	h.mu.RUnlock()
+	enqueue(h, sender.RoomCode, func(l *roomLoop) chan relay { return l.broadcast }, relay{sender.RoomCode, msg, sender})
+}
 
-	if !exists {
+// BroadcastRoom sends a server-originated message to every client in a room.
+func (h *Hub) BroadcastRoom(roomCode string, msg models.Message) {
+	h.broadcast(roomCode, msg, nil)
+}
+
+func (h *Hub) broadcast(roomCode string, msg models.Message, sender *models.Client) {
+	room := h.room(roomCode)
+	if room == nil {
 		return
 	}
 
-	for c := range room.Clients {
-		client := c.(*models.Client)
-		if client != sender {
-			select {
-			case client.Send <- msg:
-			default:
-				close(client.Send)
-				delete(room.Clients, client)
+	if sender != nil && h.holdForPreRoll(room, msg) {
+		return
+	}
+
+	if sender != nil {
+		if h.EventLog != nil {
+			h.EventLog.Write(eventlog.Event{
+				At:        time.Now(),
+				RoomCode:  roomCode,
+				UserID:    sender.ID,
+				Type:      msg.Type,
+				Timestamp: msg.Timestamp,
+				SentAt:    msg.SentAt,
+				Playing:   msg.Playing,
+				Content:   msg.Content,
+			})
+		}
+		h.trackActivity(room, msg, sender)
+		if mediaTypes[msg.Type] && msg.Slot == "" {
+			h.leaveQueue(room, msg.URL)
+		}
+		if msg.Type == "hostchange" {
+			room.Mu.RLock()
+			rosterMode := room.RosterMode
+			room.Mu.RUnlock()
+			if rosterMode != models.RosterFull {
+				h.BroadcastUserList(room)
 			}
 		}
 	}
+
+	if isPlaybackSync(msg.Type) {
+		stampServerAt(&msg, sender)
+		room.Mu.RLock()
+		if len(room.Lyrics) > 0 && msg.Slot == "" {
+			idx := lyrics.ActiveIndex(room.Lyrics, msg.Timestamp)
+			msg.CueIndex = &idx
+		}
+		room.Mu.RUnlock()
+	}
+
+	metrics.Broadcast(h.metricType(msg.Type))
+	h.notifyObservers(room, msg)
+
+	// Members are written the same prepared frame per encoding and version
+	msg.Encoded = codec.NewShared()
+	for _, client := range h.members(room) {
+		if client != sender && accepts(client, msg.Type) {
+			deliverOrDrop(client, msg)
+		}
+	}
+}
+
+// SetLyrics attaches a parsed cue list to a room. It returns false if the
+// room does not exist.
+func (h *Hub) SetLyrics(roomCode string, cues []models.LyricCue) bool {
+	room := h.room(roomCode)
+	if room == nil {
+		return false
+	}
+	room.Mu.Lock()
+	room.Lyrics = cues
+	room.Mu.Unlock()
+	return true
+}
+
+// Lyrics returns the cue list attached to a room, if any.
+func (h *Hub) Lyrics(roomCode string) ([]models.LyricCue, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return room.Lyrics, true
+}
+
+func isPlaybackSync(msgType string) bool {
+	switch msgType {
+	case "play", "pause", "seek", "state":
+		return true
+	}
+	return false
+}
+
+// deliver queues msg for client without blocking and counts it if it can't
+// be.
+func deliver(client *models.Client, msg models.Message) bool {
+	if client.Deliver(msg) {
+		return true
+	}
+	if client.Closed() {
+		metrics.Dropped(metrics.DropClosed)
+	} else {
+		metrics.Dropped(metrics.DropDiscard)
+	}
+	return false
+}
+
+// deliverOrDrop is deliver for fan-outs, which hang up on clients that have
+// fallen too far behind to catch up.
+func deliverOrDrop(client *models.Client, msg models.Message) {
+	if client.Deliver(msg) {
+		return
+	}
+	if client.Close() {
+		metrics.Dropped(metrics.DropSlow)
+	} else {
+		metrics.Dropped(metrics.DropClosed)
+	}
 }
@@ -0,0 +1,329 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testClient is a member whose connection is a goroutine reading what it's
+// sent until the hub closes it.
+type testClient struct {
+	*models.Client
+	got  chan models.Message
+	done chan struct{}
+}
+
+func newTestClient(id, roomCode string) *testClient {
+	c := &testClient{
+		Client: &models.Client{ID: id, Name: id, RoomCode: roomCode, Send: make(chan models.Message, 256), Protocol: 3},
+		got:    make(chan models.Message, 1024),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		for msg := range c.Send {
+			select {
+			case c.got <- msg:
+			default: // nobody is looking; don't hold up the hub
+			}
+		}
+	}()
+	return c
+}
+
+// await returns the next message of type typ c is sent.
+func (c *testClient) await(t *testing.T, typ string) models.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-c.got:
+			if msg.Type == typ {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("%s: no %q message", c.ID, typ)
+		}
+	}
+}
+
+// roomClosed waits for code's room to be gone; Leave only hands the client
+// to the room's loop.
+func roomClosed(h *Hub, code string) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if _, _, ok := h.RoomInfo(code); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBroadcastSkipsSender(t *testing.T) {
+	h := NewHub()
+	a, b := newTestClient("a", "room"), newTestClient("b", "room")
+	h.Join(a.Client)
+	h.Join(b.Client)
+
+	h.Broadcast(models.Message{Type: "chat", Content: "hi"}, a.Client)
+	if msg := b.await(t, "chat"); msg.Content != "hi" {
+		t.Fatalf("b got %q, want hi", msg.Content)
+	}
+
+	// Once the broadcast is handled, a later one from b is what a sees
+	h.Broadcast(models.Message{Type: "chat", Content: "back"}, b.Client)
+	if msg := a.await(t, "chat"); msg.Content != "back" {
+		t.Fatalf("a got its own message %q", msg.Content)
+	}
+
+	h.Leave(a.Client)
+	h.Leave(b.Client)
+	<-a.done
+	<-b.done
+}
+
+func TestLastLeaveClosesRoom(t *testing.T) {
+	h := NewHub()
+	a, b := newTestClient("a", "room"), newTestClient("b", "room")
+	h.Join(a.Client)
+	h.Join(b.Client)
+
+	h.Leave(a.Client)
+	<-a.done
+	if _, _, ok := h.RoomInfo("room"); !ok {
+		t.Fatal("room closed with b still in it")
+	}
+	h.Leave(b.Client)
+	if !roomClosed(h, "room") {
+		t.Fatal("room still open after everyone left")
+	}
+}
+
+// TestConcurrentMembership joins, broadcasts to and leaves several rooms
+// from many goroutines at once. Run it with -race.
+func TestConcurrentMembership(t *testing.T) {
+	const (
+		rooms     = 4
+		perRoom   = 16
+		messages  = 20
+		rejoiners = 4
+	)
+	h := NewHub()
+
+	var wg sync.WaitGroup
+	for r := range rooms {
+		code := fmt.Sprintf("room%d", r)
+		for i := range perRoom {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c := newTestClient(fmt.Sprintf("%s-%d", code, i), code)
+				h.Join(c.Client)
+				for n := range messages {
+					h.Broadcast(models.Message{Type: "chat", Content: fmt.Sprint(n)}, c.Client)
+					if n%5 == 0 {
+						h.BroadcastRoom(code, models.Message{Type: "pause", Timestamp: float64(n)})
+					}
+				}
+				h.Leave(c.Client)
+				<-c.done
+			}()
+		}
+
+		// Members that come and go while the others talk, each on a new
+		// connection
+		for i := range rejoiners {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := range messages / 4 {
+					c := newTestClient(fmt.Sprintf("%s-r%d", code, i), code)
+					h.Join(c.Client)
+					h.Broadcast(models.Message{Type: "chat", Content: fmt.Sprint(n)}, c.Client)
+					h.PresenceChanged(c.Client)
+					h.Leave(c.Client)
+					<-c.done
+				}
+			}()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("members still joining or leaving after 30s")
+	}
+
+	for r := range rooms {
+		if !roomClosed(h, fmt.Sprintf("room%d", r)) {
+			t.Errorf("room%d still open after everyone left", r)
+		}
+	}
+	// A loop retires just after its room closes
+	var left, loops int
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		h.mu.RLock()
+		left, loops = len(h.Rooms), len(h.loops)
+		h.mu.RUnlock()
+		if left == 0 && loops == 0 {
+			return
+		}
+	}
+	t.Errorf("%d rooms and %d room loops left", left, loops)
+}
+
+func TestRelay(t *testing.T) {
+	h := NewHub()
+	h.Configure(Settings{RelayRate: 64 << 10, RelayMax: 1})
+	a, b, c := newTestClient("a", "room"), newTestClient("b", "room"), newTestClient("c", "room")
+	h.Join(a.Client)
+	h.Join(b.Client)
+	h.Join(c.Client)
+
+	h.Handle(models.Message{Type: "relayOpen", To: "b", Content: RelayFile}, a.Client)
+	if msg := b.await(t, "relayOpen"); msg.UserID != "a" || msg.Content != RelayFile {
+		t.Fatalf("b got relayOpen from %q of %q", msg.UserID, msg.Content)
+	}
+	if msg := a.await(t, "relayOpen"); msg.UserID != "b" {
+		t.Fatalf("a got relayOpen naming %q, want b", msg.UserID)
+	}
+
+	h.Handle(models.Message{Type: "relayData", To: "a", Content: RelayFile, Signal: []byte(`{"data":"aGk="}`)}, b.Client)
+	if msg := a.await(t, "relayData"); msg.UserID != "b" || string(msg.Signal) != `{"data":"aGk="}` {
+		t.Fatalf("a got relayData %s from %q", msg.Signal, msg.UserID)
+	}
+
+	// Only one relay may be open, and c isn't an end of this one
+	h.Handle(models.Message{Type: "relayOpen", To: "a", Content: RelayFile}, c.Client)
+	if msg := c.await(t, "error"); msg.Payload.(*models.ErrorPayload).Code != "relayUnavailable" {
+		t.Fatalf("c got %+v, want relayUnavailable", msg.Payload)
+	}
+	h.Handle(models.Message{Type: "relayData", To: "a", Content: RelayFile, Signal: []byte(`{}`)}, c.Client)
+
+	h.Leave(b.Client)
+	if msg := a.await(t, "relayClose"); msg.UserID != "b" {
+		t.Fatalf("a got relayClose from %q, want b", msg.UserID)
+	}
+	h.Leave(a.Client)
+	h.Leave(c.Client)
+	<-a.done
+	<-b.done
+	<-c.done
+}
+
+// TestSettingsDuringBroadcast changes a room's roster mode and lyrics while
+// its loop relays messages that read them. Run it with -race.
+func TestSettingsDuringBroadcast(t *testing.T) {
+	h := NewHub()
+	a, b := newTestClient("a", "room"), newTestClient("b", "room")
+	h.Join(a.Client)
+	h.Join(b.Client)
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		modes := []string{models.RosterFull, models.RosterAnonymous, models.RosterHostOnly}
+		for n := 0; ; n++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			h.SetRosterMode(a.Client, modes[n%len(modes)])
+			h.SetLyrics("room", []models.LyricCue{{Time: float64(n), Text: fmt.Sprint(n)}})
+		}
+	}()
+	for n := range 2000 {
+		h.Broadcast(models.Message{Type: "play", Timestamp: float64(n)}, a.Client)
+		h.Broadcast(models.Message{Type: "hostchange", UserID: "b"}, b.Client)
+	}
+	close(stop)
+	<-stopped
+
+	// Leaving goes through the loop after everything sent before it
+	h.Leave(a.Client)
+	h.Leave(b.Client)
+	<-a.done
+	<-b.done
+}
+
+// TestScheduleRestored checks a schedule, for a room that isn't open as
+// much as for one that is, comes back from a snapshot in its time zone.
+func TestScheduleRestored(t *testing.T) {
+	h := NewHub()
+	start := time.Date(2030, 3, 22, 20, 0, 0, 0, time.FixedZone("", 3600))
+	s := &models.Schedule{RoomCode: "later", Start: start, TimeZone: "Europe/Berlin", RRule: "FREQ=WEEKLY;BYDAY=FR"}
+	if err := h.SetSchedule(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetSchedule(&models.Schedule{RoomCode: "x", Start: start, TimeZone: "Mars/Olympus"}); !errors.Is(err, ErrTimeZone) {
+		t.Fatalf("unknown time zone: %v", err)
+	}
+
+	restored := NewHub()
+	restored.Restore(h.Snapshot())
+	if len(restored.AdminRooms()) != 0 {
+		t.Fatal("a schedule alone opened a room")
+	}
+	got, ok := restored.Schedule("later")
+	if !ok || got.Rule == nil || !got.Next.Equal(s.Next) {
+		t.Fatalf("restored %+v, want next %s", got, s.Next)
+	}
+	// Once the clocks go forward, still 20:00 in Berlin
+	if next := got.Rule.Next(got.Start, time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)); next.UTC().Hour() != 18 {
+		t.Errorf("a Friday in summer at %s, want 20:00 Berlin time", next)
+	}
+}
+
+// TestBookmarkLimits checks bookmarks are capped per member and per room,
+// labels are cut short and positions off the media timeline are dropped.
+func TestBookmarkLimits(t *testing.T) {
+	h := NewHub()
+	a, b := newTestClient("a", "room"), newTestClient("b", "room")
+	h.Join(a.Client)
+	h.Join(b.Client)
+	b.await(t, "syncState")
+
+	long := strings.Repeat("é", 2*maxBookmarkLabel)
+	for i := 0; i < maxUserBookmarks; i++ {
+		if _, err := h.AddBookmark(a.Client, long); err != nil {
+			t.Fatalf("bookmark %d: %v", i, err)
+		}
+	}
+	if _, err := h.AddBookmark(a.Client, "one more"); !errors.Is(err, ErrTooManyBookmarks) {
+		t.Fatalf("bookmark over the limit: %v", err)
+	}
+	for _, at := range []float64{-5, maxMediaPosition + 1} {
+		h.Broadcast(models.Message{Type: "bookmark", Content: "off the end", Timestamp: at}, a.Client)
+		b.await(t, "bookmark")
+	}
+
+	_, bookmarks, _ := h.Activity("room")
+	if len(bookmarks) != maxUserBookmarks {
+		t.Fatalf("%d bookmarks kept, want %d", len(bookmarks), maxUserBookmarks)
+	}
+	if n := utf8.RuneCountInString(bookmarks[0].Label); n != maxBookmarkLabel {
+		t.Errorf("label kept at %d characters", n)
+	}
+
+	h.Leave(a.Client)
+	h.Leave(b.Client)
+}
@@ -0,0 +1,64 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"errors"
+	"time"
+)
+
+var (
+	ErrBadToken       = errors.New("invalid API token")
+	ErrTypeNotAllowed = errors.New("token lacks the scope for this")
+)
+
+// injectScopes maps the messages an external system may post to the
+// token scope each needs. Playback messages are applied at the room's
+// current position.
+var injectScopes = map[string]string{
+	"chat":  ScopePostChat,
+	"play":  ScopeControlPlayback,
+	"pause": ScopeControlPlayback,
+	"seek":  ScopeControlPlayback,
+}
+
+// Inject posts a message from an external system into a room. Chat is shown
+// under the token's name; play, pause and seek move the room's playback.
+func (h *Hub) Inject(roomCode, token string, msg models.Message) error {
+	room := h.room(roomCode)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	scope, ok := injectScopes[msg.Type]
+	if !ok {
+		room.Mu.Unlock()
+		return ErrTypeNotAllowed
+	}
+	grant, err := authorize(room, token, scope)
+	if err != nil {
+		room.Mu.Unlock()
+		return err
+	}
+
+	out := models.Message{Type: msg.Type, UserName: grant.Name}
+	switch msg.Type {
+	case "chat":
+		out = h.keepChat(room, models.ChatEntry{SenderName: grant.Name, Text: msg.Content, At: time.Now().UnixMilli()})
+	case "play", "pause", "seek":
+		out.Timestamp = currentPosition(room)
+		if msg.Type == "seek" {
+			out.Timestamp = msg.Timestamp
+		}
+		out.SentAt = float64(time.Now().UnixMilli())
+		room.Position = out.Timestamp
+		room.PositionAt = time.Now()
+		if msg.Type != "seek" {
+			room.Playing = msg.Type == "play"
+		}
+		h.playbackChanged(room)
+	}
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(roomCode, out)
+	return nil
+}
@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"fmt"
+	"time"
+)
+
+// expiryWarning is how long before the janitor closes a room its members
+// are warned.
+const expiryWarning = 5 * time.Minute
+
+// RunJanitor closes rooms every interval that have sat idle for idle, with
+// no playback change or chat and nothing playing, and rooms open for longer
+// than ttl. Either limit is off when zero. Members get a roomExpiring
+// warning first, and can keep an idle room open by using it. Breakout rooms
+// close with their main room.
+func (h *Hub) RunJanitor(interval, idle, ttl time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.sweepRooms(now, idle, ttl)
+	}
+}
+
+// roomExpiry is a room's coming closing time and the reason given for it.
+type roomExpiry struct {
+	code   string
+	at     time.Time
+	limit  string // "idle" or "ttl"
+	reason string
+}
+
+func (h *Hub) sweepRooms(now time.Time, idle, ttl time.Duration) {
+	if h.ShuttingDown() {
+		return
+	}
+
+	var warn, evict []roomExpiry
+	h.mu.RLock()
+	for code, room := range h.Rooms {
+		if isHidden(code) {
+			continue
+		}
+		room.Mu.Lock()
+		e, ok := expiryOf(room, idle, ttl)
+		if ok && room.Parent == "" {
+			e.code = code
+			switch {
+			case !now.Before(e.at):
+				evict = append(evict, e)
+			case e.at.Sub(now) <= expiryWarning && !room.ExpiryNotice.Equal(e.at):
+				room.ExpiryNotice = e.at
+				warn = append(warn, e)
+			}
+		}
+		room.Mu.Unlock()
+	}
+	h.mu.RUnlock()
+
+	for _, e := range warn {
+		h.BroadcastRoom(e.code, models.Message{
+			Type:     "roomExpiring",
+			Content:  e.limit,
+			Cooldown: e.at.Sub(now).Seconds(),
+		})
+	}
+	for _, e := range evict {
+		h.endRoom(e.code, e.reason, "", false)
+	}
+}
+
+// expiryOf returns when the janitor will close room, whichever of its
+// limits comes first. Callers hold room.Mu.
+func expiryOf(room *models.Room, idle, ttl time.Duration) (roomExpiry, bool) {
+	var e roomExpiry
+	if idle > 0 && !room.Playing {
+		e.at, e.limit = room.LastActivity.Add(idle), "idle"
+		e.reason = "This room was closed after " + spell(idle) + " without activity."
+	}
+	if ttl > 0 {
+		if at := room.OpenedAt.Add(ttl); e.at.IsZero() || at.Before(e.at) {
+			e.at, e.limit = at, "ttl"
+			e.reason = "This room was closed after being open for " + spell(ttl) + "."
+		}
+	}
+	return e, !e.at.IsZero()
+}
+
+// spell writes d in whole hours or minutes for a notice members read.
+func spell(d time.Duration) string {
+	n, unit := int(d.Round(time.Minute)/time.Minute), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		n, unit = int(d/time.Hour), "hour"
+	}
+	n = max(n, 1)
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,128 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Limits on a room's key-value store.
+const (
+	kvMaxKeys     = 64
+	kvMaxKeyLen   = 64
+	kvMaxValueLen = 1024
+	kvMaxTotal    = 16 << 10
+	kvDefaultTTL  = time.Hour
+	kvMaxTTL      = 24 * time.Hour
+)
+
+var (
+	ErrKVKey   = errors.New("key must be 1-64 bytes")
+	ErrKVValue = errors.New("value is over 1 KB")
+	ErrKVFull  = errors.New("room key-value store is full")
+)
+
+// SetKV stores a value in the sender's room and tells the room. An empty
+// value deletes the key. TTL defaults to an hour and is capped at a day.
+func (h *Hub) SetKV(sender *models.Client, e models.KVEntry) error {
+	if e.Key == "" || len(e.Key) > kvMaxKeyLen {
+		return ErrKVKey
+	}
+	if len(e.Value) > kvMaxValueLen {
+		return ErrKVValue
+	}
+	ttl := kvDefaultTTL
+	if e.TTL > 0 {
+		ttl = min(time.Duration(e.TTL)*time.Second, kvMaxTTL)
+	}
+	now := time.Now()
+	e.TTL = 0
+	e.ExpiresAt = now.Add(ttl)
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	expireKV(room, now)
+
+	if e.Value == "" {
+		delete(room.KV, e.Key)
+		e.ExpiresAt = time.Time{}
+	} else {
+		total := len(e.Key) + len(e.Value)
+		for k, old := range room.KV {
+			if k != e.Key {
+				total += len(k) + len(old.Value)
+			}
+		}
+		_, replacing := room.KV[e.Key]
+		if total > kvMaxTotal || (!replacing && len(room.KV) >= kvMaxKeys) {
+			room.Mu.Unlock()
+			return ErrKVFull
+		}
+		if room.KV == nil {
+			room.KV = make(map[string]models.KVEntry)
+		}
+		room.KV[e.Key] = e
+	}
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(sender.RoomCode, kvMessage(e))
+	return nil
+}
+
+// GetKV returns a live value from a room's store.
+func (h *Hub) GetKV(roomCode, key string) (models.KVEntry, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return models.KVEntry{}, false
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	expireKV(room, time.Now())
+	e, ok := room.KV[key]
+	return e, ok
+}
+
+// handleKV answers kvSet and kvGet. Errors and lookups go back to the sender
+// only.
+func (h *Hub) handleKV(msg models.Message, sender *models.Client) {
+	var reply models.Message
+	switch msg.Type {
+	case "kvSet":
+		var e models.KVEntry
+		if err := json.Unmarshal([]byte(msg.Content), &e); err != nil {
+			reply = models.Message{Type: "kv", Error: "invalid kvSet"}
+			break
+		}
+		if err := h.SetKV(sender, e); err != nil {
+			reply = models.Message{Type: "kv", Error: err.Error()}
+			break
+		}
+		return
+	case "kvGet":
+		e, ok := h.GetKV(sender.RoomCode, msg.Content)
+		if !ok {
+			e = models.KVEntry{Key: msg.Content}
+		}
+		reply = kvMessage(e)
+	}
+
+	deliver(sender, reply)
+}
+
+// expireKV drops expired entries. Callers hold room.Mu.
+func expireKV(room *models.Room, now time.Time) {
+	for k, e := range room.KV {
+		if now.After(e.ExpiresAt) {
+			delete(room.KV, k)
+		}
+	}
+}
+
+func kvMessage(e models.KVEntry) models.Message {
+	data, _ := json.Marshal(e)
+	return models.Message{Type: "kv", Content: string(data)}
+}
@@ -0,0 +1,43 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"log"
+	"time"
+)
+
+// creditWatchTime adds one sample of watch time to everyone in a playing
+// scheduled room and announces any milestones they reach. Only scheduled
+// rooms are persistent enough to keep a leaderboard.
+func (h *Hub) creditWatchTime(interval time.Duration) {
+	if h.Leaderboard == nil {
+		return
+	}
+
+	h.mu.RLock()
+	watchers := make(map[string][]string)
+	for code, room := range h.Rooms {
+		if _, scheduled := h.Schedules[code]; !scheduled {
+			continue
+		}
+		room.Mu.RLock()
+		if room.Playing {
+			for c := range room.Clients {
+				watchers[code] = append(watchers[code], c.(*models.Client).Name)
+			}
+		}
+		room.Mu.RUnlock()
+	}
+	h.mu.RUnlock()
+
+	for code, names := range watchers {
+		milestones, err := h.Leaderboard.Credit(code, names, interval)
+		if err != nil {
+			log.Printf("leaderboard for room %s: %v", code, err)
+		}
+		for _, m := range milestones {
+			log.Printf("🏆 %s in room %s", m, code)
+			h.BroadcastRoom(code, models.Message{Type: "milestone", Content: m})
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const defaultMaintenanceMessage = "We're doing some maintenance: rooms that are already open keep running, but new rooms can't be started right now."
+
+// SetMaintenance turns maintenance mode on or off, or schedules it for m.At.
+// Every open room is told so it can show a banner.
+func (h *Hub) SetMaintenance(m models.Maintenance) models.Maintenance {
+	if m.Message == "" {
+		m.Message = defaultMaintenanceMessage
+	}
+
+	h.mu.Lock()
+	if h.maintenanceTimer != nil {
+		h.maintenanceTimer.Stop()
+		h.maintenanceTimer = nil
+	}
+	if m.Active && time.Until(m.At) > 0 {
+		// Scheduled: announce now, block new rooms from At
+		m.Active = false
+		message := m.Message
+		h.maintenanceTimer = time.AfterFunc(time.Until(m.At), func() {
+			h.SetMaintenance(models.Maintenance{Active: true, Message: message})
+		})
+		log.Printf("🚧 Maintenance scheduled for %s", m.At.Format(time.RFC3339))
+	} else {
+		m.At = time.Time{}
+		if m.Active {
+			log.Printf("🚧 Maintenance mode on")
+		} else {
+			log.Printf("🚧 Maintenance mode off")
+		}
+	}
+	h.maintenance = m
+	codes := make([]string, 0, len(h.Rooms))
+	for code := range h.Rooms {
+		codes = append(codes, code)
+	}
+	h.mu.Unlock()
+
+	msg := maintenanceMessage(m)
+	for _, code := range codes {
+		h.BroadcastRoom(code, msg)
+	}
+	return m
+}
+
+// Maintenance returns the current maintenance state.
+func (h *Hub) Maintenance() models.Maintenance {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.maintenance
+}
+
+// AcceptsRoom reports whether a client may join roomCode. During maintenance
+// only rooms that are already open can be joined, and a room closed by its
+// host can't be reopened for a while; otherwise the reason is returned.
+func (h *Hub) AcceptsRoom(roomCode string) (bool, string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if notice, closed := h.closedNotice(roomCode); closed {
+		return false, notice
+	}
+	if !h.maintenance.Active || isHidden(roomCode) {
+		return true, ""
+	}
+	if _, exists := h.Rooms[roomCode]; exists {
+		return true, ""
+	}
+	return false, h.maintenance.Message
+}
+
+func maintenanceMessage(m models.Maintenance) models.Message {
+	data, _ := json.Marshal(m)
+	return models.Message{Type: "maintenance", Content: string(data)}
+}
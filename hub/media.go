@@ -0,0 +1,98 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFileName is the longest local file name a room can be told to open.
+const maxFileName = 255
+
+// mediaKinds maps setMedia's source kinds to the load message each stands
+// for.
+var mediaKinds = map[string]string{
+	"youtube": "youtube",
+	"url":     "directurl",
+	"file":    "file",
+}
+
+// SetMedia loads media for the sender's room from msg.SourceType, a kind in
+// mediaKinds, and msg.URL: a YouTube ID or link, a media URL that passes
+// the allowlist, or the name of a local file every member opens
+// themselves. It goes out as the load message it stands for, so it is
+// kept and delivered to late joiners like any other. What doesn't pass
+// comes back to the sender as mediaRejected.
+func (h *Hub) SetMedia(msg models.Message, sender *models.Client) {
+	load, reason := h.mediaLoad(msg.SourceType, msg.URL)
+	if reason != "" {
+		deliver(sender, models.Message{Type: "mediaRejected", SourceType: msg.SourceType, URL: msg.URL, Content: reason})
+		return
+	}
+	load.UserID = msg.UserID
+	h.Broadcast(load, sender)
+}
+
+// mediaLoad checks a setMedia request and returns the load message for it,
+// or why it was refused.
+func (h *Hub) mediaLoad(kind, raw string) (models.Message, string) {
+	raw = strings.TrimSpace(raw)
+	switch kind {
+	case "youtube":
+		id := youTubeID(raw)
+		if id == "" {
+			return models.Message{}, "not a YouTube video"
+		}
+		raw = id
+	case "url":
+		if len(raw) > maxQueueURL || !h.MediaURLAllowed(raw) {
+			return models.Message{}, "media URL not allowed"
+		}
+	case "file":
+		// Only the name is shared, to tell members which file to open
+		raw = path.Base(strings.ReplaceAll(raw, `\`, "/"))
+		if raw == "" || raw == "." || raw == "/" || utf8.RuneCountInString(raw) > maxFileName {
+			return models.Message{}, "not a file name"
+		}
+	default:
+		return models.Message{}, "unknown source kind"
+	}
+	return models.Message{Type: mediaKinds[kind], URL: raw}, ""
+}
+
+// MediaURLAllowed reports whether members may load media from raw: a path
+// on this server, such as an uploaded video, or an http(s) URL on a host in
+// the MediaAllowlist setting, or any host when the list is empty.
+func (h *Hub) MediaURLAllowed(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	allowlist := h.Settings().MediaAllowlist
+	if len(allowlist) == 0 {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range allowlist {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceKind is how syncState and the rooms API name a media type.
+func sourceKind(mediaType string) string {
+	if mediaType == "directurl" {
+		return "url"
+	}
+	return mediaType
+}
@@ -0,0 +1,155 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// mediaDeadAfter is how many checks in a row must fail before a room is
+// told its media is gone, so one network hiccup doesn't alarm anyone.
+const mediaDeadAfter = 2
+
+// mediaCheckClient only reaches public addresses. Media on a private
+// network isn't checked at all.
+var mediaCheckClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: publicOnly,
+		}).DialContext,
+	},
+}
+
+// RunMediaCheck re-checks every room's direct media URL (files and HLS
+// streams) each interval and tells rooms whose media stopped answering,
+// before members run into player errors one by one.
+func (h *Hub) RunMediaCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.mu.RLock()
+		rooms := make(map[string][]string) // media URL -> room codes
+		for code, room := range h.Rooms {
+			room.Mu.RLock()
+			if room.Media != nil && room.Media.Type == "directurl" && !isHidden(code) {
+				rooms[room.Media.URL] = append(rooms[room.Media.URL], code)
+			}
+			room.Mu.RUnlock()
+		}
+		h.mu.RUnlock()
+
+		for mediaURL, codes := range rooms {
+			reason, checked := probeMedia(mediaURL)
+			if !checked {
+				continue
+			}
+			for _, code := range codes {
+				h.mediaChecked(code, mediaURL, reason)
+			}
+		}
+	}
+}
+
+// probeMedia asks whether a media URL still serves something, and returns
+// why not, or "" if it does. checked is false when the URL can't be
+// checked from here: not http(s), or on a private network.
+func probeMedia(rawURL string) (reason string, checked bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+
+	status, err := mediaRequest(http.MethodHead, rawURL)
+	// Some servers don't do HEAD; a one-byte GET asks the same
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = mediaRequest(http.MethodGet, rawURL)
+	}
+	switch {
+	case errors.Is(err, errPrivateAddress):
+		return "", false
+	case err != nil:
+		return "unreachable", true
+	case status >= 400:
+		return "HTTP " + strconv.Itoa(status), true
+	}
+	return "", true
+}
+
+func mediaRequest(method, rawURL string) (int, error) {
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := mediaCheckClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// mediaChecked records a check of a room's media and tells the room once
+// it has failed mediaDeadAfter times in a row. A check that passes starts
+// the count over.
+func (h *Hub) mediaChecked(code, mediaURL, reason string) {
+	room := h.room(code)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	if room.Media == nil || room.Media.URL != mediaURL {
+		room.Mu.Unlock()
+		return
+	}
+	health := &room.MediaHealth
+	if health.URL != mediaURL {
+		*health = models.MediaHealth{URL: mediaURL}
+	}
+	if reason == "" {
+		health.Failures, health.Reason, health.Notified = 0, "", false
+		room.Mu.Unlock()
+		return
+	}
+	health.Failures++
+	health.Reason = reason
+	notify := health.Failures >= mediaDeadAfter && !health.Notified
+	health.Notified = health.Notified || notify
+	msg := mediaUnavailableMessage(room)
+	room.Mu.Unlock()
+
+	if notify {
+		log.Printf("📼 Media in room %s is unavailable (%s): %s", code, reason, mediaURL)
+		h.BroadcastRoom(code, msg)
+	}
+}
+
+// mediaUnavailable reports whether the room was told its current media is
+// gone. Callers hold room.Mu.
+func mediaUnavailable(room *models.Room) bool {
+	return room.Media != nil && room.MediaHealth.Notified && room.MediaHealth.URL == room.Media.URL
+}
+
+// mediaUnavailableMessage says why a room's media failed and what members
+// can do: load a fresh link, or in DJ mode vote to pass the turn on.
+// Callers hold room.Mu.
+func mediaUnavailableMessage(room *models.Room) models.Message {
+	msg := models.Message{
+		Type:        "mediaUnavailable",
+		URL:         room.Media.URL,
+		Content:     room.MediaHealth.Reason,
+		Suggestions: []string{"reshare"},
+	}
+	if room.DJ != nil {
+		msg.Suggestions = append(msg.Suggestions, "voteskip")
+	}
+	return msg
+}
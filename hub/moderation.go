@@ -0,0 +1,154 @@
+package hub
+
+import (
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrRoomNotFound = errors.New("room not found")
+	ErrUserNotFound = errors.New("user not found")
+	ErrNoPoll       = errors.New("no poll is running")
+	ErrBadOption    = errors.New("no such option")
+	ErrInviteUsed   = errors.New("invite has already been used")
+)
+
+// Kick disconnects the first client in the room whose name matches
+// (case-insensitively) and keeps them from rejoining this session.
+func (h *Hub) Kick(roomCode, name string) (*models.Client, error) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	room.Mu.Lock()
+
+	var target *models.Client
+	for c := range room.Clients {
+		client := c.(*models.Client)
+		if strings.EqualFold(client.Name, name) {
+			target = client
+			break
+		}
+	}
+	if target == nil {
+		room.Mu.Unlock()
+		return nil, ErrUserNotFound
+	}
+
+	if room.Kicked == nil {
+		room.Kicked = make(map[string]bool)
+	}
+	room.Kicked[target.ID] = true
+	room.Mu.Unlock()
+
+	// The connection hangs up and unregisters like any other leave, which
+	// takes the target off the roster
+	if target.Close() {
+		metrics.Dropped(metrics.DropKicked)
+	}
+	return target, nil
+}
+
+// IsKicked reports whether a user was kicked from a room.
+func (h *Hub) IsKicked(roomCode, userID string) bool {
+	room := h.room(roomCode)
+	if room == nil {
+		return false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return room.Kicked[userID]
+}
+
+// RedeemInvite records userID as the one user a single-use invite admits
+// to a room. The same user may redeem it again, so they can reconnect.
+func (h *Hub) RedeemInvite(roomCode, inviteID, userID string) error {
+	room := h.room(roomCode)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	if by, used := room.Invites[inviteID]; used {
+		if by != userID {
+			return ErrInviteUsed
+		}
+		return nil
+	}
+	if room.Invites == nil {
+		room.Invites = make(map[string]string)
+	}
+	room.Invites[inviteID] = userID
+	return nil
+}
+
+// StartPoll replaces the room's poll and announces it.
+func (h *Hub) StartPoll(roomCode, question string, options []string) error {
+	room := h.room(roomCode)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	room.Poll = &models.Poll{
+		Question: question,
+		Options:  options,
+		Votes:    make(map[string]int),
+		Tally:    make([]int, len(options)),
+	}
+	h.record(room, "poll", nil, question, 0)
+	payload, _ := json.Marshal(room.Poll)
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(roomCode, models.Message{Type: "poll", Content: string(payload)})
+	return nil
+}
+
+// Vote records (or changes) a user's vote and broadcasts the new tally.
+func (h *Hub) Vote(roomCode, userID string, option int) error {
+	room := h.room(roomCode)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	poll := room.Poll
+	if poll == nil {
+		room.Mu.Unlock()
+		return ErrNoPoll
+	}
+	if option < 0 || option >= len(poll.Options) {
+		room.Mu.Unlock()
+		return ErrBadOption
+	}
+
+	if prev, voted := poll.Votes[userID]; voted {
+		poll.Tally[prev]--
+	}
+	poll.Votes[userID] = option
+	poll.Tally[option]++
+	payload, _ := json.Marshal(poll)
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(roomCode, models.Message{Type: "poll", Content: string(payload)})
+	return nil
+}
+
+// NotifyHost sends a message to the room's host only. It returns false if
+// the host isn't connected.
+func (h *Hub) NotifyHost(roomCode string, msg models.Message) bool {
+	room := h.room(roomCode)
+	if room == nil {
+		return false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	for c := range room.Clients {
+		client := c.(*models.Client)
+		if client.ID == room.HostID && deliver(client, msg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package hub
+
+import (
+	"coopcinema/models"
+)
+
+// observerBuffer is how many messages an observer may fall behind before
+// further ones are dropped for it.
+const observerBuffer = 64
+
+// Observe subscribes to a room's messages with an observe token. Observers
+// can't send anything and don't appear in the roster. The channel closes
+// when the room does; call cancel to unsubscribe.
+func (h *Hub) Observe(roomCode, token string) (<-chan models.Message, models.ObserverState, func(), error) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, models.ObserverState{}, nil, ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	if _, err := authorize(room, token, ScopeReadState); err != nil {
+		return nil, models.ObserverState{}, nil, err
+	}
+	ch, state, cancel := h.observe(room)
+	return ch, state, cancel, nil
+}
+
+// Watch is Observe for callers trusted with every room, such as the gRPC
+// API, so it needs no token.
+func (h *Hub) Watch(roomCode string) (<-chan models.Message, models.ObserverState, func(), error) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, models.ObserverState{}, nil, ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	if isHidden(roomCode) {
+		return nil, models.ObserverState{}, nil, ErrRoomNotFound
+	}
+	ch, state, cancel := h.observe(room)
+	return ch, state, cancel, nil
+}
+
+// observe adds an observer to room. Callers hold room.Mu.
+func (h *Hub) observe(room *models.Room) (<-chan models.Message, models.ObserverState, func()) {
+	ch := make(chan models.Message, observerBuffer)
+	if room.Observers == nil {
+		room.Observers = make(map[chan models.Message]bool)
+	}
+	room.Observers[ch] = true
+
+	state := models.ObserverState{
+		RoomCode: publicCode(room.Code),
+		Media:    room.Media,
+		Position: currentPosition(room),
+		Playing:  room.Playing,
+		Viewers:  len(room.Clients),
+	}
+	cancel := func() {
+		room.Mu.Lock()
+		defer room.Mu.Unlock()
+		if room.Observers[ch] {
+			delete(room.Observers, ch)
+			close(ch)
+		}
+	}
+	return ch, state, cancel
+}
+
+// notifyObservers copies a message to a room's observers, dropping it for
+// any that are behind.
+func (h *Hub) notifyObservers(room *models.Room, msg models.Message) {
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+
+	for ch := range room.Observers {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// closeObservers ends every observer stream of a closed room. Callers hold
+// room.Mu.
+func closeObservers(room *models.Room) {
+	for ch := range room.Observers {
+		delete(room.Observers, ch)
+		close(ch)
+	}
+}
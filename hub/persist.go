@@ -0,0 +1,125 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"log"
+	"time"
+)
+
+// Snapshot captures the rooms worth bringing back after a restart, with
+// their schedules, and the schedules of codes with no room open. Hidden and
+// breakout rooms are left out.
+func (h *Hub) Snapshot() []models.RoomSnapshot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rooms := make([]models.RoomSnapshot, 0, len(h.Rooms))
+	for code, room := range h.Rooms {
+		if isHidden(code) {
+			continue
+		}
+		room.Mu.RLock()
+		if room.Parent != "" {
+			room.Mu.RUnlock()
+			continue
+		}
+		var media *models.Message
+		if room.Media != nil {
+			m := *room.Media
+			media = &m
+		}
+		var playlist *models.Playlist
+		if room.Playlist.Current != nil || len(room.Playlist.Items) > 0 {
+			playlist = queueMessage(room).Queue
+		}
+		rooms = append(rooms, models.RoomSnapshot{
+			Code:         code,
+			HostID:       room.HostID,
+			HostMode:     room.HostMode,
+			RosterMode:   room.RosterMode,
+			PasswordHash: room.PasswordHash,
+			Name:         room.Name,
+			MaxMembers:   room.MaxMembers,
+			Owner:        room.Owner,
+			Media:        media,
+			Position:     currentPosition(room),
+			ChatHistory:  append([]models.ChatEntry(nil), room.ChatHistory...),
+			Playlist:     playlist,
+			Schedule:     h.scheduleCopy(code),
+		})
+		room.Mu.RUnlock()
+	}
+	for code, s := range h.Schedules {
+		if _, open := h.Rooms[code]; open || isHidden(code) || s.Status == models.ScheduleEnded {
+			continue
+		}
+		rooms = append(rooms, models.RoomSnapshot{Code: code, Schedule: h.scheduleCopy(code), ScheduleOnly: true})
+	}
+	return rooms
+}
+
+// scheduleCopy returns a copy of a code's schedule, or nil. Callers hold
+// h.mu.
+func (h *Hub) scheduleCopy(code string) *models.Schedule {
+	s, ok := h.Schedules[code]
+	if !ok {
+		return nil
+	}
+	c := *s
+	return &c
+}
+
+// Restore recreates rooms from a snapshot, before any client connects.
+// Playback comes back paused where it was, so nobody misses what played
+// while the server was down, and rooms nobody returns to are dropped after
+// a while.
+func (h *Hub) Restore(snapshots []models.RoomSnapshot) {
+	restored := 0
+	for _, s := range snapshots {
+		if s.Schedule != nil {
+			s.Schedule.RoomCode = s.Code
+			if err := compileSchedule(s.Schedule); err != nil {
+				log.Printf("restore schedule for room %s: %v", s.Code, err)
+			} else {
+				h.mu.Lock()
+				h.Schedules[s.Code] = s.Schedule
+				h.mu.Unlock()
+			}
+		}
+		if s.ScheduleOnly {
+			continue
+		}
+
+		room := newRoom(s.Code, s.HostID)
+		room.HostMode = s.HostMode
+		if s.RosterMode != "" {
+			room.RosterMode = s.RosterMode
+		}
+		room.PasswordHash = s.PasswordHash
+		room.Name = s.Name
+		room.MaxMembers = s.MaxMembers
+		room.Owner = s.Owner
+		room.Media = s.Media
+		room.Position = s.Position
+		room.PositionAt = time.Now()
+		room.ChatHistory = s.ChatHistory
+		if s.Playlist != nil {
+			room.Playlist = *s.Playlist
+		}
+
+		h.mu.Lock()
+		if _, taken := h.Rooms[s.Code]; taken {
+			h.mu.Unlock()
+			continue
+		}
+		h.Rooms[s.Code] = room
+		h.mu.Unlock()
+
+		h.roomCreated(room)
+		h.expireUnclaimed(room)
+		restored++
+	}
+	if restored > 0 {
+		log.Printf("♻️  Restored %d rooms", restored)
+	}
+}
@@ -0,0 +1,249 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"sort"
+)
+
+// Handler processes one inbound client message.
+type Handler func(msg models.Message, sender *models.Client)
+
+// Middleware wraps a Handler. It may drop the message by not calling next,
+// rewrite it, or act on it before and after the rest of the chain.
+type Middleware func(next Handler) Handler
+
+// Stage orders middleware in the inbound pipeline. Middleware registered for
+// an earlier stage runs first; within a stage, registration order is kept.
+type Stage int
+
+const (
+	StageAuthz Stage = iota
+	StageRateLimit
+	StageValidation
+	StageFilter
+)
+
+type stagedMiddleware struct {
+	stage Stage
+	mw    Middleware
+}
+
+// Use registers middleware for every inbound message. It must be called
+// before clients connect.
+func (h *Hub) Use(stage Stage, mw Middleware) {
+	h.middleware = append(h.middleware, stagedMiddleware{stage, mw})
+	sort.SliceStable(h.middleware, func(i, j int) bool {
+		return h.middleware[i].stage < h.middleware[j].stage
+	})
+
+	next := Handler(h.dispatch)
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		next = h.middleware[i].mw(next)
+	}
+	h.pipeline = next
+}
+
+// Handle runs an inbound message through the middleware chain and then the
+// message handler.
+func (h *Hub) Handle(msg models.Message, sender *models.Client) {
+	h.pipeline(msg, sender)
+}
+
+// HandleType registers a handler for a custom message type. Messages of that
+// type still pass through the middleware chain but are not relayed unless the
+// handler does so itself. It must be called before clients connect.
+func (h *Hub) HandleType(msgType string, handler Handler) {
+	if h.typeHandlers == nil {
+		h.typeHandlers = make(map[string]Handler)
+	}
+	h.typeHandlers[msgType] = handler
+}
+
+// dispatch applies room control messages and relays everything else.
+func (h *Hub) dispatch(msg models.Message, sender *models.Client) {
+	if handler, ok := h.typeHandlers[msg.Type]; ok {
+		handler(msg, sender)
+		return
+	}
+
+	switch msg.Type {
+	case "rostermode":
+		h.SetRosterMode(sender, msg.Content)
+	case "slowmode":
+		h.SetSlowMode(sender, msg.Content)
+	case "preroll":
+		h.SetPreRoll(sender, msg.Content)
+	case "accessibility":
+		h.setAccessibility(sender, msg.Content)
+	case "djmode":
+		h.SetDJMode(sender, msg.Content)
+	case "slotControl":
+		h.SetSlotController(sender, msg)
+	case "rendition":
+		h.reportRendition(sender, msg.Content)
+	case "qualityCap":
+		h.SetQualityCap(sender, msg.Content)
+	case "attentionmode":
+		h.SetAttention(sender, msg.Content)
+	case "heartbeat":
+		h.heartbeat(msg, sender)
+	case "timeSync":
+		h.TimeSync(msg, sender)
+	case "waitmode":
+		h.SetWaitMode(sender, msg.Content)
+	case "buffering", "bufferend", "ready":
+		h.BufferReport(msg, sender)
+	case "breakout":
+		h.StartBreakout(sender, msg.Content)
+	case "breakoutEnd":
+		h.EndBreakout(sender)
+	case "returnToMain":
+		h.ReturnToMain(sender)
+	case "chat":
+		h.chat(sender, msg.Content)
+	case "closeRoom":
+		h.CloseRoom(sender.RoomCode, msg.Content, msg.RoomCode)
+	case "transferHost":
+		h.TransferHost(sender, msg.Content)
+	case "kvSet", "kvGet":
+		h.handleKV(msg, sender)
+	case "queueAdd":
+		h.QueueAdd(sender, msg)
+	case "queueRemove":
+		h.QueueRemove(sender, msg.Content)
+	case "queueReorder":
+		h.QueueReorder(sender, msg.Content)
+	case "queueNext":
+		h.QueueNext(sender)
+	case "ended":
+		h.MediaEnded(sender, msg.URL)
+	case "subtitleOffset":
+		h.SetSubtitleOffset(msg, sender)
+	case "setMedia":
+		h.SetMedia(msg, sender)
+	case "signal":
+		h.Signal(msg, sender)
+	case "voiceJoin":
+		h.VoiceJoin(sender)
+	case "voiceLeave":
+		h.VoiceLeave(sender)
+	case "voiceState":
+		h.VoiceState(sender, msg.Content)
+	case "voiceSignal":
+		h.VoiceSignal(msg, sender)
+	case "relayOpen":
+		h.RelayOpen(msg, sender)
+	case "relayData":
+		h.RelayData(msg, sender)
+	case "relayClose":
+		h.RelayClose(msg, sender)
+	default:
+		h.Broadcast(msg, sender)
+	}
+}
+
+// hostOnly lists message types only the room's host may send.
+var hostOnly = map[string]bool{
+	"rostermode":    true,
+	"slowmode":      true,
+	"preroll":       true,
+	"accessibility": true,
+	"breakout":      true,
+	"breakoutEnd":   true,
+	"djmode":        true,
+	"qualityCap":    true,
+	"attentionmode": true,
+	"waitmode":      true,
+	"slotControl":   true,
+	"hostchange":    true,
+	"hostmodeoff":   true,
+	"transferHost":  true,
+	"closeRoom":     true,
+}
+
+func (h *Hub) registerDefaultMiddleware() {
+	h.Use(StageAuthz, func(next Handler) Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if hostOnly[msg.Type] && !h.IsHost(sender) {
+				return
+			}
+			next(msg, sender)
+		}
+	})
+
+	// In host mode only the host moves the main playhead
+	h.Use(StageAuthz, func(next Handler) Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if hostControlled[msg.Type] && msg.Slot == "" && !h.mayControlPlayback(sender) {
+				return
+			}
+			next(msg, sender)
+		}
+	})
+
+	// Secondary media slots may have their own controller
+	h.Use(StageAuthz, func(next Handler) Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if msg.Slot != "" && msg.Type != "slotControl" && !h.mayControlSlot(sender, msg.Slot) {
+				return
+			}
+			next(msg, sender)
+		}
+	})
+
+	// In DJ mode only the current DJ loads media, and each load passes the
+	// turn on
+	h.Use(StageAuthz, func(next Handler) Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if !loadsMedia(msg.Type) || msg.Slot != "" {
+				next(msg, sender)
+				return
+			}
+			if !h.mayLoadMedia(sender) {
+				return
+			}
+			next(msg, sender)
+			h.passDJ(sender.RoomCode)
+		}
+	})
+
+	h.Use(StageRateLimit, func(next Handler) Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if msg.Type == "chat" && !h.AllowChat(sender) {
+				return
+			}
+			next(msg, sender)
+		}
+	})
+
+	h.Use(StageValidation, func(next Handler) Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if msg.Type == "" {
+				return
+			}
+			if msg.Type == "reaction" && !h.AllowReaction(sender, msg.Content) {
+				return
+			}
+			if msg.Type == "directurl" && !h.MediaURLAllowed(msg.URL) {
+				return
+			}
+			next(msg, sender)
+		}
+	})
+}
+
+// IsHost reports whether the client is the host of its room.
+func (h *Hub) IsHost(client *models.Client) bool {
+	return h.IsHostID(client.RoomCode, client.ID)
+}
+
+// IsHostID reports whether userID hosts the room.
+func (h *Hub) IsHostID(roomCode, userID string) bool {
+	room := h.room(roomCode)
+	if room == nil {
+		return false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return room.HostID == userID
+}
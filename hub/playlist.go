@@ -0,0 +1,204 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+const (
+	maxQueue      = 100  // items a playlist holds
+	maxQueueTitle = 200  // bytes of an item's title
+	maxQueueURL   = 2048 // bytes of an item's URL
+)
+
+// QueueAdd appends media to the sender's room playlist: msg.SourceType is
+// the media message type, msg.URL what to load and msg.Content an optional
+// title. If nothing has been loaded in the room yet it plays right away.
+func (h *Hub) QueueAdd(sender *models.Client, msg models.Message) {
+	if !mediaTypes[msg.SourceType] || msg.URL == "" || len(msg.URL) > maxQueueURL {
+		return
+	}
+	if msg.SourceType == "directurl" && !h.MediaURLAllowed(msg.URL) {
+		return
+	}
+	title := strings.TrimSpace(msg.Content)
+	if len(title) > maxQueueTitle {
+		title = title[:maxQueueTitle]
+	}
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	if len(room.Playlist.Items) >= maxQueue {
+		room.Mu.Unlock()
+		return
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	room.Playlist.Items = append(room.Playlist.Items, models.QueueItem{
+		ID:        hex.EncodeToString(b),
+		Type:      msg.SourceType,
+		URL:       msg.URL,
+		Title:     title,
+		AddedBy:   sender.Name,
+		AddedByID: sender.ID,
+	})
+	idle := room.Media == nil
+	update, code := queueMessage(room), room.Code
+	room.Mu.Unlock()
+
+	if idle {
+		h.advanceQueue(room)
+		return
+	}
+	h.BroadcastRoom(code, update)
+}
+
+// QueueRemove takes the item with the given ID out of the playlist.
+func (h *Hub) QueueRemove(sender *models.Client, id string) {
+	h.editQueue(sender, func(items []models.QueueItem) []models.QueueItem {
+		for i, item := range items {
+			if item.ID == id {
+				return append(items[:i], items[i+1:]...)
+			}
+		}
+		return nil
+	})
+}
+
+// QueueReorder puts the playlist in the order of the item IDs listed in
+// order, a JSON array. Items it leaves out follow in their current order.
+func (h *Hub) QueueReorder(sender *models.Client, order string) {
+	var ids []string
+	if err := json.Unmarshal([]byte(order), &ids); err != nil {
+		return
+	}
+	h.editQueue(sender, func(items []models.QueueItem) []models.QueueItem {
+		placed := make(map[string]bool, len(ids))
+		reordered := make([]models.QueueItem, 0, len(items))
+		for _, id := range ids {
+			for _, item := range items {
+				if item.ID == id && !placed[id] {
+					placed[id] = true
+					reordered = append(reordered, item)
+				}
+			}
+		}
+		for _, item := range items {
+			if !placed[item.ID] {
+				reordered = append(reordered, item)
+			}
+		}
+		return reordered
+	})
+}
+
+// editQueue replaces the playlist with what edit returns, unless that is
+// nil, and sends the room the new queue.
+func (h *Hub) editQueue(sender *models.Client, edit func([]models.QueueItem) []models.QueueItem) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	items := edit(append([]models.QueueItem(nil), room.Playlist.Items...))
+	if items == nil {
+		room.Mu.Unlock()
+		return
+	}
+	room.Playlist.Items = items
+	update, code := queueMessage(room), room.Code
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(code, update)
+}
+
+// QueueNext skips to the next item in the sender's room playlist.
+func (h *Hub) QueueNext(sender *models.Client) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.RLock()
+	next := len(room.Playlist.Items) > 0
+	room.Mu.RUnlock()
+
+	if next {
+		h.advanceQueue(room)
+	}
+}
+
+// MediaEnded moves the playlist on when a member reports that the room's
+// media, url, played to the end. Everyone's player reports it, so reports
+// for anything but what is loaded now are late and ignored.
+func (h *Hub) MediaEnded(sender *models.Client, url string) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.RLock()
+	current := room.Media != nil && room.Media.URL == url
+	room.Mu.RUnlock()
+
+	if current {
+		h.advanceQueue(room)
+	}
+}
+
+// advanceQueue loads the next playlist item for the whole room. With
+// nothing left, the finished item is just cleared.
+func (h *Hub) advanceQueue(room *models.Room) {
+	room.Mu.Lock()
+	pl := &room.Playlist
+	code := room.Code
+	if len(pl.Items) == 0 {
+		cleared := pl.Current != nil
+		pl.Current = nil
+		update := queueMessage(room)
+		room.Mu.Unlock()
+		if cleared {
+			h.BroadcastRoom(code, update)
+		}
+		return
+	}
+	next := pl.Items[0]
+	pl.Items = pl.Items[1:]
+	pl.Current = &next
+	update := queueMessage(room)
+	room.Mu.Unlock()
+
+	load := models.Message{Type: next.Type, URL: next.URL}
+	h.trackActivity(room, load, nil)
+	h.BroadcastRoom(code, update)
+	h.BroadcastRoom(code, load)
+}
+
+// leaveQueue clears the playlist's current item when a member loads
+// something else, so the room isn't shown the wrong thing as playing.
+func (h *Hub) leaveQueue(room *models.Room, url string) {
+	room.Mu.Lock()
+	if room.Playlist.Current == nil || room.Playlist.Current.URL == url {
+		room.Mu.Unlock()
+		return
+	}
+	room.Playlist.Current = nil
+	update, code := queueMessage(room), room.Code
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(code, update)
+}
+
+// queueMessage carries a copy of the room's playlist. Callers hold room.Mu.
+func queueMessage(room *models.Room) models.Message {
+	pl := models.Playlist{Items: append([]models.QueueItem{}, room.Playlist.Items...)}
+	if room.Playlist.Current != nil {
+		current := *room.Playlist.Current
+		pl.Current = &current
+	}
+	return models.Message{Type: "queue", Queue: &pl}
+}
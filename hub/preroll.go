@@ -0,0 +1,73 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"encoding/json"
+	"time"
+)
+
+// maxPreRoll caps how long a pre-roll may hold back the feature.
+const maxPreRoll = 2 * time.Minute
+
+// SetPreRoll attaches (or, with an empty spec, clears) the pre-roll that
+// plays before the room's next media load.
+func (h *Hub) SetPreRoll(sender *models.Client, spec string) {
+	var pr *models.PreRoll
+	if spec != "" {
+		pr = &models.PreRoll{}
+		if err := json.Unmarshal([]byte(spec), pr); err != nil {
+			return
+		}
+		switch {
+		case pr.Kind == models.PreRollClip && pr.URL == "":
+			return
+		case pr.Kind != models.PreRollClip && pr.Kind != models.PreRollCountdown:
+			return
+		case pr.Seconds <= 0 || time.Duration(pr.Seconds)*time.Second > maxPreRoll:
+			return
+		}
+	}
+
+	if room := h.room(sender.RoomCode); room != nil {
+		room.Mu.Lock()
+		room.PreRoll = pr
+		room.Mu.Unlock()
+	}
+}
+
+// holdForPreRoll starts the room's pre-roll if one is attached and a media
+// load arrives. The load is relayed once the pre-roll finishes. It reports
+// whether the message was held.
+func (h *Hub) holdForPreRoll(room *models.Room, msg models.Message) bool {
+	room.Mu.Lock()
+	pr := room.PreRoll
+	if pr == nil || !mediaTypes[msg.Type] || msg.Slot != "" || room.PreRollPending != nil {
+		room.Mu.Unlock()
+		return false
+	}
+	room.PreRoll = nil
+	held := msg
+	room.PreRollPending = &held
+	started := *pr
+	started.StartAt = time.Now().UnixMilli()
+	code := room.Code
+	room.Mu.Unlock()
+
+	payload, _ := json.Marshal(started)
+	h.BroadcastRoom(code, models.Message{Type: "preroll", Content: string(payload)})
+
+	time.AfterFunc(time.Duration(started.Seconds)*time.Second, func() {
+		room.Mu.Lock()
+		feature := room.PreRollPending
+		room.PreRollPending = nil
+		code := room.Code
+		room.Mu.Unlock()
+		if feature == nil {
+			return
+		}
+
+		h.broadcast(code, *feature, nil)
+		h.BroadcastRoom(code, models.Message{Type: "prerollEnd"})
+	})
+	return true
+}
@@ -0,0 +1,253 @@
+package hub
+
+import (
+	"coopcinema/codec"
+	"coopcinema/models"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Message directions.
+const (
+	fromClient = "client"
+	fromServer = "server"
+	both       = "both"
+)
+
+// protocol documents the built-in message types. Permissions and
+// capabilities are filled in from the same tables the pipeline enforces, so
+// only descriptions and fields live here.
+var protocol = []models.MessageSpec{
+	{Type: "play", Direction: both, Fields: []string{"payload", "timestamp", "sentAt", "serverAt", "slot"}, Description: "Start playback at timestamp (seconds)"},
+	{Type: "pause", Direction: both, Fields: []string{"payload", "timestamp", "sentAt", "serverAt", "slot"}, Description: "Pause playback at timestamp"},
+	{Type: "seek", Direction: both, Fields: []string{"payload", "timestamp", "sentAt", "serverAt", "slot"}, Description: "Jump to timestamp"},
+	{Type: "state", Direction: both, Fields: []string{"payload", "timestamp", "playing", "sentAt", "serverAt", "slot"}, Description: "Periodic playback report for drift correction"},
+	{Type: "youtube", Direction: both, Fields: []string{"url", "slot"}, Description: "Load a YouTube video by ID or URL"},
+	{Type: "vimeo", Direction: both, Fields: []string{"url", "slot"}, Description: "Load a Vimeo video"},
+	{Type: "twitch", Direction: both, Fields: []string{"url", "slot"}, Description: "Load a Twitch channel or video"},
+	{Type: "dailymotion", Direction: both, Fields: []string{"url", "slot"}, Description: "Load a Dailymotion video"},
+	{Type: "directurl", Direction: both, Fields: []string{"url", "slot"}, Description: "Load a media file by URL"},
+	{Type: "file", Direction: both, Fields: []string{"url"}, Description: "Play a local file every member opens themselves; url is its name"},
+	{Type: "setMedia", Direction: fromClient, Fields: []string{"sourceType", "url"}, Description: "Load media by kind: sourceType youtube (ID or link), url (a media URL on an allowed host) or file (a local file's name). Goes out as the matching load message; host only in host mode"},
+	{Type: "signal", Direction: both, Fields: []string{"to", "signal", "userID", "userName"}, Description: "WebRTC signaling (offer, answer or ICE candidate, any JSON up to 64 KB) for the member with user ID to; delivered to them alone with the sender's userID and userName. Only signaling passes through the server, never what peers send each other"},
+	{Type: "voiceJoin", Direction: both, Fields: []string{"userID", "userName"}, Description: "Join the room's voice chat, muted; members already in it should offer the newcomer an audio connection"},
+	{Type: "voiceLeave", Direction: both, Fields: []string{"userID", "userName"}, Description: "Leave voice chat; also sent when a member in it disconnects"},
+	{Type: "voiceState", Direction: both, Fields: []string{"content", "userID", "userName"}, Description: "A voice chat member's content is muted, unmuted, speaking or quiet"},
+	{Type: "voiceSignal", Direction: both, Fields: []string{"to", "signal", "userID", "userName"}, Description: "Like signal, for audio connections between two members in voice chat"},
+	{Type: "relayOpen", Direction: both, Fields: []string{"to", "content", "signal", "userID", "userName"}, Description: "Ask for a relay through the server to member to, of kind content (file or voice), when a peer connection to them fails; voice needs both in voice chat. Both ends then get relayOpen naming the other, with signal {rate, maxChunk}: the bytes a second each may send and the largest relayData signal. Refused with an error relayUnavailable when relaying is off or full"},
+	{Type: "relayData", Direction: both, Fields: []string{"to", "content", "signal", "userID"}, Description: "Data for the other end of an open relay of kind content, any JSON up to maxChunk; a sender over its rate is read no further until it is back under it"},
+	{Type: "relayClose", Direction: both, Fields: []string{"to", "content", "userID", "userName"}, Description: "End a relay; also sent when the other end leaves the room, or voice chat for a voice relay"},
+	{Type: "mediaRejected", Direction: fromServer, Fields: []string{"sourceType", "url", "content"}, Description: "A setMedia was refused; content says why"},
+	{Type: "chat", Direction: both, Fields: []string{"payload", "content", "chat"}, Description: "Chat message: payload {text} (or content) from clients, where a leading / runs a command instead; payload and chat {senderID, senderName, text, at} from the server"},
+	{Type: "chatHistory", Direction: fromServer, Fields: []string{"history"}, Description: "On joining, to clients older than version 3: the room's recent chat, oldest first"},
+	{Type: "catchUp", Direction: fromServer, Fields: []string{"catchUp"}, Description: "On joining, from version 3: who loaded the media, the last play, pause or seek since and the room's recent chat, as events {kind, at, userID, userName, sourceType, url, timestamp, text}, oldest first"},
+	{Type: "reaction", Direction: both, Fields: []string{"userName", "content", "timestamp"}, Description: "Emoji or custom emote reaction at the sender's media position"},
+	{Type: "status", Direction: both, Fields: []string{"userID", "content"}, Description: "A member is playing, paused or buffering"},
+	{Type: "buffering", Direction: both, Fields: []string{"userID"}, Description: "A member started buffering. In wait mode it isn't relayed: the server pauses the room instead"},
+	{Type: "ready", Direction: fromClient, Fields: []string{"userID"}, Description: "A member can play again after buffering. Relayed as bufferend outside wait mode"},
+	{Type: "bufferend", Direction: both, Fields: []string{"userID"}, Description: "A member finished buffering; older clients send it instead of ready"},
+	{Type: "bookmark", Direction: both, Fields: []string{"timestamp", "content", "userName"}, Description: "Mark a moment; content is the label"},
+	{Type: "hostchange", Direction: both, Fields: []string{"userID"}, Description: "Hand hosting to userID"},
+	{Type: "hostmodeoff", Direction: both, Description: "Turn host mode off"},
+	{Type: "closeRoom", Direction: fromClient, Fields: []string{"content", "roomCode"}, Description: "End the room for everyone; content is the reason, roomCode an optional room to move to"},
+	{Type: "roomClosed", Direction: fromServer, Fields: []string{"content", "roomCode", "url"}, Description: "The room was closed: the reason, and where to go next if the host named a room"},
+	{Type: "queueAdd", Direction: fromClient, Fields: []string{"sourceType", "url", "content"}, Description: "Add media to the playlist: sourceType is the load type (youtube, directurl, ...), content an optional title. Plays right away if nothing was loaded yet"},
+	{Type: "queueRemove", Direction: fromClient, Fields: []string{"content"}, Description: "Take the playlist item whose ID is content out"},
+	{Type: "queueReorder", Direction: fromClient, Fields: []string{"content"}, Description: "Reorder the playlist; content is a JSON array of item IDs, and items left out follow"},
+	{Type: "queueNext", Direction: fromClient, Description: "Skip to the next playlist item"},
+	{Type: "ended", Direction: fromClient, Fields: []string{"url"}, Description: "The media at url played to the end; the playlist moves on if it is still loaded"},
+	{Type: "queue", Direction: fromServer, Fields: []string{"queue"}, Description: "The playlist: the current item and what plays next, on every change and on joining"},
+	{Type: "subtitlesAvailable", Direction: fromServer, Fields: []string{"url", "content", "timestamp"}, Description: "Load the WebVTT subtitles at url, labelled content and shifted by timestamp seconds, for the media playing now"},
+	{Type: "subtitlesRemoved", Direction: fromServer, Description: "The room's subtitles were taken down"},
+	{Type: "mediaProgress", Direction: fromServer, Fields: []string{"url", "content", "timestamp"}, Description: "The uploaded video at url, named content, is being transcoded to HLS; timestamp is the share done, 0 to 1"},
+	{Type: "mediaReady", Direction: fromServer, Fields: []string{"url", "content"}, Description: "An uploaded video, named content, finished transcoding; url is its HLS playlist, to load as a directurl"},
+	{Type: "mediaFailed", Direction: fromServer, Fields: []string{"url", "content"}, Description: "Transcoding the uploaded video at url, named content, failed"},
+	{Type: "subtitleOffset", Direction: both, Fields: []string{"timestamp", "userName"}, Description: "Shift the room's subtitles by timestamp seconds (at most 600 either way)"},
+	{Type: "roomExpiring", Direction: fromServer, Fields: []string{"content", "cooldown"}, Description: "The room closes in cooldown seconds: content is idle (playing or chatting keeps it open) or ttl (it has been open too long)"},
+	{Type: "feedbackRequest", Direction: fromServer, Fields: []string{"content"}, Description: "Just before roomClosed: a token for rating the session at POST /api/feedback"},
+	{Type: "transferHost", Direction: fromClient, Fields: []string{"content"}, Description: "Hand hosting to the member whose ID is content, without changing host mode"},
+	{Type: "promote", Direction: fromServer, Fields: []string{"userID"}, Description: "userID is now the host, handed off or because the host left"},
+	{Type: "rostermode", Direction: fromClient, Fields: []string{"content"}, Description: "Set roster visibility: full, anonymous or host"},
+	{Type: "slowmode", Direction: both, Fields: []string{"content", "cooldown"}, Description: "Set the minimum seconds between chat messages per member"},
+	{Type: "preroll", Direction: both, Fields: []string{"content"}, Description: "Set (client) or start (server) the pre-roll played before the next media load"},
+	{Type: "accessibility", Direction: both, Fields: []string{"content"}, Description: "Room accessibility settings as JSON"},
+	{Type: "breakout", Direction: fromClient, Fields: []string{"content"}, Description: "Split the room by a JSON breakout plan"},
+	{Type: "breakoutEnd", Direction: fromClient, Description: "Bring everyone back from breakout rooms"},
+	{Type: "returnToMain", Direction: fromClient, Description: "Leave a breakout room for the main room"},
+	{Type: "djmode", Direction: fromClient, Fields: []string{"content"}, Description: "Turn DJ mode on or off"},
+	{Type: "slotControl", Direction: both, Fields: []string{"slot", "userID"}, Description: "Only userID (and the host) may control the slot; empty userID lets anyone"},
+	{Type: "slotClear", Direction: both, Fields: []string{"slot"}, Description: "Stop and close the media in a secondary slot"},
+	{Type: "rendition", Direction: fromClient, Fields: []string{"content"}, Description: "The video height this member is playing"},
+	{Type: "qualityCap", Direction: both, Fields: []string{"content"}, Description: "Highest rendition height players should pick, 0 for no cap"},
+	{Type: "renditions", Direction: fromServer, Fields: []string{"content"}, Description: "To the host: what each member is playing, as a JSON array"},
+	{Type: "attentionmode", Direction: fromClient, Fields: []string{"content"}, Description: "Turn attention summaries on or off"},
+	{Type: "attentionMode", Direction: fromServer, Fields: []string{"content"}, Description: "Attention summaries are on or off; members send heartbeats while on"},
+	{Type: "waitmode", Direction: fromClient, Fields: []string{"content"}, Description: "Turn wait for everyone on or off"},
+	{Type: "waitMode", Direction: fromServer, Fields: []string{"content"}, Description: "Wait for everyone is on or off: while on, the server pauses the room (a pause with content waiting) when a member buffers and plays it (content ready) once everyone is ready, or after 30 seconds"},
+	{Type: "waiting", Direction: fromServer, Fields: []string{"content"}, Description: "While the room is paused for buffering: a JSON array of the names of members it is waiting for"},
+	{Type: "heartbeat", Direction: fromClient, Fields: []string{"content", "timestamp"}, Description: "Tab visible or hidden, and the playhead"},
+	{Type: "attention", Direction: fromServer, Fields: []string{"content"}, Description: "To the host: JSON {watching, total, away}"},
+	{Type: "kvSet", Direction: fromClient, Fields: []string{"content"}, Description: "Store a key-value entry, JSON {key, value, ttl}"},
+	{Type: "kvGet", Direction: fromClient, Fields: []string{"content"}, Description: "Read the entry whose key is content"},
+	{Type: "kv", Direction: fromServer, Fields: []string{"content", "error"}, Description: "A key-value entry as JSON, after a kvSet or kvGet"},
+	{Type: "syncState", Direction: fromServer, Fields: []string{"sourceType", "url", "userID", "timestamp", "playing", "sentAt", "regions"}, Description: "On joining: what the room is playing, who loaded it, and where, as of sentAt, and where it can play if its provider restricts it"},
+	{Type: "mediaUnavailable", Direction: fromServer, Fields: []string{"url", "content", "suggestions"}, Description: "The room's media URL stopped answering: why, and what members can do (reshare, voteskip)"},
+	{Type: "regionWarning", Direction: fromServer, Fields: []string{"url", "regions", "viewers", "userName"}, Description: "Some members can't play the room's media where they are: how many, who (as a JSON array in userName, with a full roster) and the provider's regions"},
+	{Type: "userList", Direction: fromServer, Fields: []string{"payload", "userName", "viewers"}, Description: "Roster: payload {users: [{id, name, host, liveness, link, voice, muted, speaking}], viewers}, with users empty and only a head count in viewers in an anonymous room. userName carries the same roster as a JSON array of strings for older clients"},
+	{Type: "timeSync", Direction: both, Fields: []string{"sentAt", "serverTime"}, Description: "Clock probe: the reply, to the sender alone, echoes sentAt and carries serverTime as it was written, for estimating clock offset and round trip"},
+	{Type: "error", Direction: fromServer, Fields: []string{"payload", "error"}, Description: "A message was refused, to its sender alone: payload {code, message, type}, code unknownType for a type clients can't send or badPayload for a payload that doesn't match its type"},
+	{Type: "hello", Direction: fromServer, Fields: []string{"payload", "content", "userID"}, Description: "First message on every connection: payload {version, minVersion, maxVersion}, the protocol version the server will speak (content has it too) and the range it knows; userID is who the server knows the client as"},
+	{Type: "serverTime", Direction: fromServer, Fields: []string{"serverTime"}, Description: "Server clock in Unix milliseconds when nothing else went out"},
+	{Type: "claimToken", Direction: fromServer, Fields: []string{"content", "userID"}, Description: "Token for rejoining as this guest (claim=) and claiming its history after signing in"},
+	{Type: "resumeToken", Direction: fromServer, Fields: []string{"content", "cooldown"}, Description: "Token for resuming this connection's place if it drops: reconnect with resume=<token> within cooldown seconds"},
+	{Type: "resumed", Direction: fromServer, Description: "The connection took back the place of the one that dropped; the room's state follows as on joining"},
+	{Type: "deviceToken", Direction: fromServer, Fields: []string{"content"}, Description: "Token naming this browser, for keeping preferences without an account"},
+	{Type: "preferences", Direction: fromServer, Fields: []string{"preferences"}, Description: "The user's saved preferences, on joining"},
+	{Type: "commandResult", Direction: fromServer, Fields: []string{"command", "content", "error"}, Description: "Reply to a slash command, only to its sender"},
+	{Type: "poll", Direction: fromServer, Fields: []string{"content"}, Description: "Poll and tally as JSON"},
+	{Type: "lyrics", Direction: fromServer, Description: "The room's lyrics changed; fetch them again"},
+	{Type: "rateLimited", Direction: fromServer, Fields: []string{"content", "cooldown"}, Description: "Messages of type content are being dropped for coming too fast; seconds until the next is accepted. Keep going and the connection is closed (1008)"},
+	{Type: "serverShutdown", Direction: fromServer, Fields: []string{"content", "cooldown"}, Description: "The server is restarting and is about to close the connection (1012); reconnect after cooldown seconds"},
+	{Type: "slowModeActive", Direction: fromServer, Fields: []string{"cooldown"}, Description: "Chat refused by slow mode; seconds to wait"},
+	{Type: "schedule", Direction: fromServer, Fields: []string{"content"}, Description: "A scheduled session went live"},
+	{Type: "roomTransfer", Direction: fromServer, Fields: []string{"roomCode", "content"}, Description: "Moved to roomCode; content is the main room, empty when back in it"},
+	{Type: "adaptHint", Direction: fromServer, Fields: []string{"content", "hint"}, Description: "Connection grade and how to adapt to it"},
+	{Type: "prerollEnd", Direction: fromServer, Description: "The pre-roll finished"},
+	{Type: "milestone", Direction: fromServer, Fields: []string{"content"}, Description: "Leaderboard milestone announcement"},
+	{Type: "maintenance", Direction: fromServer, Fields: []string{"content"}, Description: "Maintenance notice as JSON"},
+	{Type: "queued", Direction: fromServer, Fields: []string{"content"}, Description: "Place in the join queue"},
+	{Type: "codeRotated", Direction: fromServer, Fields: []string{"roomCode", "url"}, Description: "The room has a new code and share link"},
+	{Type: "joinAttack", Direction: fromServer, Fields: []string{"content", "cooldown"}, Description: "To the host: failed joins so far and how long credentialed joins are paused"},
+	{Type: "dj", Direction: fromServer, Fields: []string{"content", "userID", "userName"}, Description: "DJ mode on or off and whose turn it is"},
+}
+
+// protocolTypes is the set of built-in message types.
+var protocolTypes = func() map[string]bool {
+	types := make(map[string]bool, len(protocol))
+	for _, spec := range protocol {
+		types[spec.Type] = true
+	}
+	return types
+}()
+
+// Inbound reports whether clients may send msgType: a built-in type that
+// isn't server-only, or one registered with HandleType.
+func (h *Hub) Inbound(msgType string) bool {
+	return inboundTypes[msgType] || h.typeHandlers[msgType] != nil
+}
+
+// inboundTypes is the set of built-in types clients may send.
+var inboundTypes = func() map[string]bool {
+	types := make(map[string]bool, len(protocol))
+	for _, spec := range protocol {
+		if spec.Direction != fromServer {
+			types[spec.Type] = true
+		}
+	}
+	return types
+}()
+
+// metricType labels metrics with msgType if it is a known message type, or
+// "other", so clients can't mint new labels.
+func (h *Hub) metricType(msgType string) string {
+	if protocolTypes[msgType] || h.typeHandlers[msgType] != nil {
+		return msgType
+	}
+	return "other"
+}
+
+// Protocol describes the message types this server handles, including
+// those registered with HandleType.
+func (h *Hub) Protocol() models.ProtocolDoc {
+	doc := models.ProtocolDoc{
+		Fields:       messageFields(),
+		Capabilities: models.CapabilityNames(),
+	}
+
+	known := make(map[string]bool, len(protocol))
+	for _, spec := range protocol {
+		known[spec.Type] = true
+		doc.Messages = append(doc.Messages, withRules(spec))
+	}
+	for msgType := range h.typeHandlers {
+		if !known[msgType] {
+			doc.Messages = append(doc.Messages, withRules(models.MessageSpec{
+				Type:        msgType,
+				Direction:   fromClient,
+				Description: "Registered by a plugin",
+			}))
+		}
+	}
+	sort.Slice(doc.Messages, func(i, j int) bool {
+		return doc.Messages[i].Type < doc.Messages[j].Type
+	})
+	return doc
+}
+
+// Capabilities lists the protocol versions this server speaks and the
+// message types it accepts and sends, including those registered with
+// HandleType.
+func (h *Hub) Capabilities() models.CapabilitiesDoc {
+	doc := models.CapabilitiesDoc{
+		ProtocolVersion:    models.ProtocolVersion,
+		MinProtocolVersion: models.MinProtocolVersion,
+		Encodings:          codec.Subprotocols,
+		PayloadTypes:       models.PayloadTypes(),
+		Capabilities:       models.CapabilityNames(),
+	}
+	for _, spec := range h.Protocol().Messages {
+		if spec.Direction != fromServer {
+			doc.ClientTypes = append(doc.ClientTypes, spec.Type)
+		}
+		if spec.Direction != fromClient {
+			doc.ServerTypes = append(doc.ServerTypes, spec.Type)
+		}
+	}
+	return doc
+}
+
+func withRules(spec models.MessageSpec) models.MessageSpec {
+	if spec.Direction != fromServer {
+		switch {
+		case hostOnly[spec.Type]:
+			spec.Permission = "host"
+		case loadsMedia(spec.Type):
+			spec.Permission = "dj"
+		}
+	}
+	if spec.Direction != fromClient {
+		spec.Capability = requiredCapability(spec.Type).Name()
+	}
+	return spec
+}
+
+// messageFields lists the JSON fields of models.Message.
+func messageFields() []models.FieldSpec {
+	var fields []models.FieldSpec
+	t := reflect.TypeOf(models.Message{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, models.FieldSpec{Name: name, Type: jsonType(t.Field(i).Type)})
+	}
+	return fields
+}
+
+func jsonType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return "number"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,77 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// maxRendition bounds reported and capped heights (8K).
+const maxRendition = 4320
+
+// reportRendition records the video height a member is playing and, when it
+// changed, sends the host the room's renditions.
+func (h *Hub) reportRendition(sender *models.Client, content string) {
+	height, err := strconv.Atoi(content)
+	if err != nil || height < 0 || height > maxRendition {
+		return
+	}
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	if room.Renditions[sender.ID] == height {
+		room.Mu.Unlock()
+		return
+	}
+	if room.Renditions == nil {
+		room.Renditions = make(map[string]int)
+	}
+	room.Renditions[sender.ID] = height
+	msg := renditionsMessage(room)
+	room.Mu.Unlock()
+
+	h.NotifyHost(sender.RoomCode, msg)
+}
+
+// SetQualityCap caps the rendition members' players should pick, so one
+// viewer on a poor connection isn't stalling on a rendition it can't keep
+// up with. A height of 0 lifts the cap.
+func (h *Hub) SetQualityCap(sender *models.Client, content string) {
+	height, err := strconv.Atoi(content)
+	if err != nil || height < 0 || height > maxRendition {
+		return
+	}
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	room.QualityCap = height
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(sender.RoomCode, qualityCapMessage(height))
+}
+
+// renditionsMessage lists what each member is playing, lowest first.
+// Callers hold room.Mu.
+func renditionsMessage(room *models.Room) models.Message {
+	list := []models.Rendition{}
+	for c := range room.Clients {
+		client := c.(*models.Client)
+		if height, ok := room.Renditions[client.ID]; ok {
+			list = append(list, models.Rendition{UserID: client.ID, UserName: client.Name, Height: height})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Height < list[j].Height })
+	data, _ := json.Marshal(list)
+	return models.Message{Type: "renditions", Content: string(data)}
+}
+
+func qualityCapMessage(height int) models.Message {
+	return models.Message{Type: "qualityCap", Content: strconv.Itoa(height)}
+}
@@ -0,0 +1,159 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// youTubeVideosURL is the YouTube Data API's videos endpoint.
+const youTubeVideosURL = "https://www.googleapis.com/youtube/v3/videos"
+
+var regionClient = &http.Client{Timeout: 10 * time.Second}
+
+var youTubeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// lookupRegions asks the media's provider where it can play and tells the
+// room if some members can't play it. Only YouTube says, and only with
+// YouTubeAPIKey set.
+func (h *Hub) lookupRegions(code string, media models.Message) {
+	id := youTubeID(media.URL)
+	if media.Type != "youtube" || h.YouTubeAPIKey == "" || id == "" {
+		return
+	}
+	regions, err := youTubeRegions(h.YouTubeAPIKey, id)
+	if err != nil {
+		log.Printf("regions: %s: %v", id, err)
+		return
+	}
+
+	room := h.room(code)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	if room.Media == nil || room.Media.URL != media.URL {
+		room.Mu.Unlock()
+		return
+	}
+	room.MediaRegions = models.MediaRegions{URL: media.URL, Regions: regions}
+	msg, warn := regionsMessage(room)
+	room.Mu.Unlock()
+
+	if warn {
+		h.BroadcastRoom(code, msg)
+	}
+}
+
+// regionsJoined tells the room when a member who just joined can't play
+// its media.
+func (h *Hub) regionsJoined(room *models.Room, client *models.Client) {
+	room.Mu.RLock()
+	regions, known := mediaRegions(room)
+	msg, warn := regionsMessage(room)
+	code := room.Code
+	room.Mu.RUnlock()
+
+	if known && warn && !regions.Allows(client.Country) {
+		h.BroadcastRoom(code, msg)
+	}
+}
+
+// mediaRegions returns where the room's current media can play, if it was
+// looked up. Callers hold room.Mu.
+func mediaRegions(room *models.Room) (models.Regions, bool) {
+	if room.Media == nil || room.MediaRegions.URL != room.Media.URL {
+		return models.Regions{}, false
+	}
+	return room.MediaRegions.Regions, true
+}
+
+// regionsMessage is the warning that members in the room can't play its
+// media where they are: how many, and who when the roster is public. warn
+// is false when everyone can. Callers hold room.Mu.
+func regionsMessage(room *models.Room) (msg models.Message, warn bool) {
+	regions, known := mediaRegions(room)
+	if !known {
+		return models.Message{}, false
+	}
+
+	var names []string
+	for c := range room.Clients {
+		if client, ok := c.(*models.Client); ok && !regions.Allows(client.Country) {
+			names = append(names, client.Name+" ("+client.Country+")")
+		}
+	}
+	if len(names) == 0 {
+		return models.Message{}, false
+	}
+
+	msg = models.Message{Type: "regionWarning", URL: room.Media.URL, Regions: &regions, Viewers: len(names)}
+	if room.RosterMode == models.RosterFull {
+		list, _ := json.Marshal(names)
+		msg.UserName = string(list)
+	}
+	return msg, true
+}
+
+// youTubeRegions reads a video's region restriction from the YouTube Data
+// API.
+func youTubeRegions(apiKey, id string) (models.Regions, error) {
+	q := url.Values{"part": {"contentDetails"}, "id": {id}, "key": {apiKey}}
+	resp, err := regionClient.Get(youTubeVideosURL + "?" + q.Encode())
+	if err != nil {
+		return models.Regions{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return models.Regions{}, fmt.Errorf("YouTube API answered %s", resp.Status)
+	}
+
+	var body struct {
+		Items []struct {
+			ContentDetails struct {
+				RegionRestriction models.Regions `json:"regionRestriction"`
+			} `json:"contentDetails"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return models.Regions{}, err
+	}
+	if len(body.Items) == 0 {
+		return models.Regions{}, fmt.Errorf("no such video")
+	}
+	return body.Items[0].ContentDetails.RegionRestriction, nil
+}
+
+// youTubeID extracts the video ID from an ID or a watch, share, embed,
+// shorts or live link, as the player accepts them.
+func youTubeID(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if youTubeIDPattern.MatchString(raw) {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	var id string
+	switch host := strings.TrimPrefix(u.Hostname(), "www."); host {
+	case "youtu.be":
+		id = strings.TrimPrefix(u.Path, "/")
+	case "youtube.com", "m.youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		if v := u.Query().Get("v"); v != "" {
+			id = v
+		} else if parts := strings.Split(strings.Trim(u.Path, "/"), "/"); len(parts) == 2 {
+			id = parts[1] // /embed/ID, /shorts/ID, /live/ID
+		}
+	}
+	if !youTubeIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
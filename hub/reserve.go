@@ -0,0 +1,95 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrRoomTaken is returned when reserving a code that already has a room.
+var ErrRoomTaken = errors.New("room already exists")
+
+// unclaimedRoomHold is how long a room set up before anyone is in it (one
+// created with options, or restored after a restart) waits for them.
+const unclaimedRoomHold = 10 * time.Minute
+
+// Reserve creates an empty room with opts, so a password or member cap is
+// in place before anyone joins. Whoever joins first becomes the host. A
+// room nobody joins goes away after a while.
+func (h *Hub) Reserve(code string, opts models.RoomOptions) error {
+	h.mu.Lock()
+	if _, taken := h.Rooms[code]; taken {
+		h.mu.Unlock()
+		return ErrRoomTaken
+	}
+	room := newRoom(code, "")
+	room.Name = opts.Name
+	room.PasswordHash = opts.PasswordHash
+	room.MaxMembers = opts.MaxMembers
+	room.Owner = opts.Owner
+	h.Rooms[code] = room
+	h.mu.Unlock()
+
+	h.roomCreated(room)
+	log.Printf("🔑 Room %s reserved", code)
+
+	h.expireUnclaimed(room)
+	return nil
+}
+
+// expireUnclaimed deletes room if it is still empty once unclaimedRoomHold
+// has passed. A room that was joined and emptied is already gone by then.
+func (h *Hub) expireUnclaimed(room *models.Room) {
+	time.AfterFunc(unclaimedRoomHold, func() {
+		h.mu.RLock()
+		room.Mu.RLock()
+		unclaimed := h.Rooms[room.Code] == room && len(room.Clients) == 0
+		room.Mu.RUnlock()
+		h.mu.RUnlock()
+		if unclaimed {
+			log.Printf("🗑️  Room %s deleted (nobody came)", room.Code)
+			h.closeRoom(room)
+		}
+	})
+}
+
+// PasswordHash returns the bcrypt hash protecting a room, or nil if the
+// room is open or doesn't exist.
+func (h *Hub) PasswordHash(code string) []byte {
+	room := h.room(code)
+	if room == nil {
+		return nil
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return room.PasswordHash
+}
+
+// Full reports whether a room with a member cap has no space for userID.
+// A member reconnecting before their old connection is gone isn't counted
+// twice.
+func (h *Hub) Full(code, userID string) bool {
+	room := h.room(code)
+	if room == nil {
+		return false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	if room.MaxMembers == 0 {
+		return false
+	}
+	members := 0
+	for c := range room.Clients {
+		if c.(*models.Client).ID != userID {
+			members++
+		}
+	}
+	// Away members keep their seats
+	for id := range room.Away {
+		if id != userID {
+			members++
+		}
+	}
+	return members >= room.MaxMembers
+}
@@ -0,0 +1,98 @@
+package hub
+
+import (
+	"coopcinema/keepalive"
+	"coopcinema/models"
+	"crypto/subtle"
+	"time"
+)
+
+// A member whose connection drops, rather than being closed by them or by
+// the server, keeps its place for ResumeGrace: it stays in the roster as
+// away, keeps the host role and keeps the room open. Its next connection
+// presenting the old resume token takes the place back without a leave
+// and join; otherwise the member leaves once the grace runs out.
+
+// holdAway keeps a dropped client's place, reporting whether it did.
+// Callers hold room.Mu.
+func (h *Hub) holdAway(room *models.Room, client *models.Client) bool {
+	grace := h.Settings().ResumeGrace
+	if grace <= 0 || !client.Dropped.Load() || client.ResumeToken == "" || h.shuttingDown.Load() {
+		return false
+	}
+	if inRoom(room, client.ID) {
+		return false // already back on another connection
+	}
+	if room.Away == nil {
+		room.Away = make(map[string]*models.AwayMember)
+	}
+	room.Away[client.ID] = &models.AwayMember{
+		Client: client,
+		Until:  time.Now().Add(grace),
+		// Leaving again once it is no longer a member ends the hold
+		Timer: time.AfterFunc(grace, func() { h.Leave(client) }),
+	}
+	return true
+}
+
+// dropAway ends client's hold when its grace has run out, reporting
+// whether it was still held. Callers hold room.Mu.
+func dropAway(room *models.Room, client *models.Client) bool {
+	a, ok := room.Away[client.ID]
+	if !ok || a.Client != client {
+		return false
+	}
+	delete(room.Away, client.ID)
+	return true
+}
+
+// takeAway ends the hold on the place of the user client joins as. It
+// reports whether client resumed it, or else returns the connection that
+// held it, which has now left for good. Callers hold room.Mu.
+func takeAway(room *models.Room, client *models.Client) (resumed bool, gone *models.Client) {
+	a, ok := room.Away[client.ID]
+	if !ok {
+		return false, nil
+	}
+	delete(room.Away, client.ID)
+	a.Timer.Stop()
+	if client.ResumeFrom != "" && subtle.ConstantTimeCompare([]byte(client.ResumeFrom), []byte(a.Client.ResumeToken)) == 1 {
+		return true, nil
+	}
+	return false, a.Client
+}
+
+// takeOver finds the connection client's resume token names when it is
+// still a member, its end having died without the server noticing yet, and
+// removes it so client can take its place. The caller closes it. Callers
+// hold room.Mu.
+func takeOver(room *models.Room, client *models.Client) *models.Client {
+	if client.ResumeFrom == "" {
+		return nil
+	}
+	for c := range room.Clients {
+		old := c.(*models.Client)
+		if old != client && old.ID == client.ID &&
+			subtle.ConstantTimeCompare([]byte(client.ResumeFrom), []byte(old.ResumeToken)) == 1 {
+			delete(room.Clients, old)
+			return old
+		}
+	}
+	return nil
+}
+
+// awayEntries are the roster entries of a room's away members. Callers
+// hold room.Mu.
+func awayEntries(room *models.Room, hostID string) []models.RosterEntry {
+	entries := make([]models.RosterEntry, 0, len(room.Away))
+	for _, a := range room.Away {
+		entries = append(entries, models.RosterEntry{
+			ID:   a.Client.ID,
+			Name: a.Client.Name,
+			Host: a.Client.ID == hostID,
+			Link: keepalive.Band(0),
+			Away: true,
+		})
+	}
+	return entries
+}
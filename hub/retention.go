@@ -0,0 +1,123 @@
+package hub
+
+import (
+	"coopcinema/retention"
+	"coopcinema/tenant"
+	"time"
+)
+
+// timelinePruner expires room timeline entries under the events class.
+type timelinePruner struct{ h *Hub }
+
+// TimelinePruner returns a retention pruner for room activity timelines.
+func (h *Hub) TimelinePruner() retention.Pruner {
+	return timelinePruner{h}
+}
+
+func (timelinePruner) Name() string           { return "room timelines" }
+func (timelinePruner) Class() retention.Class { return retention.Events }
+
+func (p timelinePruner) Prune(cutoff func(string) time.Time) int {
+	p.h.mu.RLock()
+	defer p.h.mu.RUnlock()
+
+	removed := 0
+	for code, room := range p.h.Rooms {
+		tenantID, _ := tenant.Split(code)
+		limit := cutoff(tenantID)
+		room.Mu.Lock()
+		i := 0
+		for i < len(room.Timeline) && room.Timeline[i].At.Before(limit) {
+			i++
+		}
+		if i > 0 {
+			room.Timeline = append(room.Timeline[:0:0], room.Timeline[i:]...)
+			removed += i
+		}
+		room.Mu.Unlock()
+	}
+	return removed
+}
+
+func (p timelinePruner) Scan(cutoff func(string) time.Time, ttl func(string) time.Duration) (int, time.Time) {
+	p.h.mu.RLock()
+	defer p.h.mu.RUnlock()
+
+	due := 0
+	var next time.Time
+	for code, room := range p.h.Rooms {
+		tenantID, _ := tenant.Split(code)
+		limit := cutoff(tenantID)
+		room.Mu.RLock()
+		for _, e := range room.Timeline {
+			if e.At.Before(limit) {
+				due++
+				continue
+			}
+			if expires := e.At.Add(ttl(tenantID)); next.IsZero() || expires.Before(next) {
+				next = expires
+			}
+			break
+		}
+		room.Mu.RUnlock()
+	}
+	return due, next
+}
+
+// chatPruner expires room chat history under the chat class.
+type chatPruner struct{ h *Hub }
+
+// ChatPruner returns a retention pruner for room chat history.
+func (h *Hub) ChatPruner() retention.Pruner {
+	return chatPruner{h}
+}
+
+func (chatPruner) Name() string           { return "room chat history" }
+func (chatPruner) Class() retention.Class { return retention.Chat }
+
+func (p chatPruner) Prune(cutoff func(string) time.Time) int {
+	p.h.mu.RLock()
+	defer p.h.mu.RUnlock()
+
+	removed := 0
+	for code, room := range p.h.Rooms {
+		tenantID, _ := tenant.Split(code)
+		limit := cutoff(tenantID).UnixMilli()
+		room.Mu.Lock()
+		i := 0
+		for i < len(room.ChatHistory) && room.ChatHistory[i].At < limit {
+			i++
+		}
+		if i > 0 {
+			room.ChatHistory = append(room.ChatHistory[:0:0], room.ChatHistory[i:]...)
+			removed += i
+		}
+		room.Mu.Unlock()
+	}
+	return removed
+}
+
+func (p chatPruner) Scan(cutoff func(string) time.Time, ttl func(string) time.Duration) (int, time.Time) {
+	p.h.mu.RLock()
+	defer p.h.mu.RUnlock()
+
+	due := 0
+	var next time.Time
+	for code, room := range p.h.Rooms {
+		tenantID, _ := tenant.Split(code)
+		limit := cutoff(tenantID).UnixMilli()
+		room.Mu.RLock()
+		for _, e := range room.ChatHistory {
+			if e.At < limit {
+				due++
+				continue
+			}
+			if expires := time.UnixMilli(e.At).Add(ttl(tenantID)); next.IsZero() || expires.Before(next) {
+				next = expires
+			}
+			break
+		}
+		room.Mu.RUnlock()
+	}
+	return due, next
+}
@@ -0,0 +1,89 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ExportConfig collects a room's settings, lyrics, custom reactions (as blob
+// keys) and schedule.
+func (h *Hub) ExportConfig(roomCode string) (models.RoomConfig, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return models.RoomConfig{}, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	c := models.RoomConfig{
+		Version:       models.RoomConfigVersion,
+		RosterMode:    room.RosterMode,
+		SlowMode:      int(room.SlowMode / time.Second),
+		Accessibility: room.Accessibility,
+		PreRoll:       room.PreRoll,
+		Lyrics:        room.Lyrics,
+	}
+	for name, key := range room.Emotes {
+		c.Emotes = append(c.Emotes, models.EmoteFile{Name: name, Key: key})
+	}
+	sort.Slice(c.Emotes, func(i, j int) bool { return c.Emotes[i].Name < c.Emotes[j].Name })
+	if s, ok := h.Schedules[roomCode]; ok {
+		schedule := *s
+		c.Schedule = &schedule
+	}
+	return c, true
+}
+
+// ImportConfig applies an exported setup to an open room, replacing its
+// settings, lyrics and custom reactions. Emote keys must already be in the
+// blob store. It returns the blob keys of the reactions it replaced, for the
+// caller to release.
+func (h *Hub) ImportConfig(roomCode string, c models.RoomConfig) ([]string, error) {
+	if c.Version != models.RoomConfigVersion {
+		return nil, fmt.Errorf("unsupported config version %d", c.Version)
+	}
+	switch c.RosterMode {
+	case models.RosterFull, models.RosterAnonymous, models.RosterHostOnly:
+	default:
+		return nil, errors.New("invalid roster mode")
+	}
+	if c.SlowMode < 0 {
+		return nil, errors.New("invalid slow mode")
+	}
+
+	if c.Schedule != nil {
+		if err := compileSchedule(c.Schedule); err != nil {
+			return nil, err
+		}
+	}
+
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	var replaced []string
+	for _, key := range room.Emotes {
+		replaced = append(replaced, key)
+	}
+	room.RosterMode = c.RosterMode
+	room.SlowMode = time.Duration(c.SlowMode) * time.Second
+	room.Accessibility = c.Accessibility
+	room.PreRoll = c.PreRoll
+	room.Lyrics = c.Lyrics
+	room.Emotes = make(map[string]string, len(c.Emotes))
+	for _, e := range c.Emotes {
+		room.Emotes[e.Name] = e.Key
+	}
+	room.Mu.Unlock()
+
+	if c.Schedule != nil {
+		c.Schedule.RoomCode = roomCode
+		h.SetSchedule(c.Schedule)
+	}
+	h.BroadcastUserList(room)
+	h.BroadcastRoom(roomCode, accessibilityMessage(c.Accessibility))
+	return replaced, nil
+}
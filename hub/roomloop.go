@@ -0,0 +1,156 @@
+package hub
+
+import "coopcinema/models"
+
+// roomLoop is a room's own goroutine. Joins, leaves, presence changes and
+// members' broadcasts for the room are handled there one at a time, so no
+// two of them race on the room and a busy room never holds up another.
+//
+// Room state, membership included, is guarded by the room's own lock,
+// room.Mu. h.mu only guards the hub's tables (h.Rooms, h.loops and the
+// like), and a loop takes it just long enough to look its room up. Where
+// both are needed h.mu comes first, and room.Mu is never held while taking
+// h.mu or another room's lock.
+type roomLoop struct {
+	code       string
+	register   chan *models.Client
+	unregister chan *models.Client
+	presence   chan *models.Client
+	broadcast  chan relay
+	done       chan struct{} // closed when the loop exits
+}
+
+// relay is a member's message on its way to the rest of the room.
+type relay struct {
+	code   string
+	msg    models.Message
+	sender *models.Client
+}
+
+// Join adds client to its room, creating the room if need be. It returns
+// once the room's loop has taken the client.
+func (h *Hub) Join(client *models.Client) {
+	enqueue(h, client.RoomCode, func(l *roomLoop) chan *models.Client { return l.register }, client)
+}
+
+// Leave removes client from its room and closes it if it wasn't already.
+func (h *Hub) Leave(client *models.Client) {
+	enqueue(h, client.RoomCode, func(l *roomLoop) chan *models.Client { return l.unregister }, client)
+}
+
+// PresenceChanged re-sends the user list of client's room after its
+// liveness band changed.
+func (h *Hub) PresenceChanged(client *models.Client) {
+	enqueue(h, client.RoomCode, func(l *roomLoop) chan *models.Client { return l.presence }, client)
+}
+
+// enqueue hands v to a channel of code's loop, starting the loop if there is
+// none and trying a new one if it exits first.
+func enqueue[T any](h *Hub, code string, ch func(*roomLoop) chan T, v T) {
+	for {
+		l := h.loopFor(code)
+		select {
+		case ch(l) <- v:
+			return
+		case <-l.done:
+		}
+	}
+}
+
+// loopFor returns code's loop, starting it if it isn't running.
+func (h *Hub) loopFor(code string) *roomLoop {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if l, ok := h.loops[code]; ok {
+		return l
+	}
+	l := &roomLoop{
+		code:       code,
+		register:   make(chan *models.Client),
+		unregister: make(chan *models.Client),
+		presence:   make(chan *models.Client),
+		broadcast:  make(chan relay),
+		done:       make(chan struct{}),
+	}
+	h.loops[code] = l
+	go h.runLoop(l)
+	return l
+}
+
+// runLoop serves a room until the room is gone.
+func (h *Hub) runLoop(l *roomLoop) {
+	for {
+		select {
+		case client := <-l.register:
+			h.registerClient(client)
+		case client := <-l.unregister:
+			h.unregisterClient(client)
+		case client := <-l.presence:
+			if room := h.room(client.RoomCode); room != nil && isMember(room, client) {
+				h.BroadcastUserList(room)
+			}
+		case r := <-l.broadcast:
+			h.broadcast(r.code, r.msg, r.sender)
+		}
+		if h.retireLoop(l) {
+			return
+		}
+	}
+}
+
+// retireLoop stops l once its room no longer exists, unless the room was
+// given a new code and l now serves that. Anyone still waiting on l then
+// starts a new loop.
+func (h *Hub) retireLoop(l *roomLoop) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.loops[l.code] != l {
+		return false
+	}
+	if _, exists := h.Rooms[l.code]; exists {
+		return false
+	}
+	delete(h.loops, l.code)
+	close(l.done)
+	return true
+}
+
+// renameLoop moves the loop serving oldCode to newCode after a code
+// rotation. Callers hold h.mu.
+func (h *Hub) renameLoop(oldCode, newCode string) {
+	if l, ok := h.loops[oldCode]; ok {
+		delete(h.loops, oldCode)
+		l.code = newCode
+		h.loops[newCode] = l
+	}
+}
+
+// room returns the open room with code, nil if there is none.
+func (h *Hub) room(code string) *models.Room {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.Rooms[code]
+}
+
+// isMember reports whether client is in room.
+func isMember(room *models.Room, client *models.Client) bool {
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return room.Clients[client]
+}
+
+// members returns the clients in room at this moment.
+func (h *Hub) members(room *models.Room) []*models.Client {
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	return membersLocked(room)
+}
+
+// membersLocked is members for callers holding room.Mu.
+func membersLocked(room *models.Room) []*models.Client {
+	clients := make([]*models.Client, 0, len(room.Clients))
+	for c := range room.Clients {
+		clients = append(clients, c.(*models.Client))
+	}
+	return clients
+}
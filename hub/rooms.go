@@ -0,0 +1,60 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"sort"
+)
+
+// RoomInfo describes a room for the REST API, along with its owner.
+func (h *Hub) RoomInfo(code string) (info models.RoomInfo, owner string, ok bool) {
+	room := h.room(code)
+	if room == nil {
+		return models.RoomInfo{}, "", false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	if isHidden(code) {
+		return models.RoomInfo{}, "", false
+	}
+	return roomInfo(room), room.Owner, true
+}
+
+// OwnedRooms describes the rooms owner created in a tenant ("" for the
+// default instance), by code.
+func (h *Hub) OwnedRooms(owner, tenantID string) []models.RoomInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rooms := []models.RoomInfo{}
+	for code, room := range h.Rooms {
+		if id, _ := tenant.Split(code); id != tenantID {
+			continue
+		}
+		room.Mu.RLock()
+		if room.Owner == owner {
+			rooms = append(rooms, roomInfo(room))
+		}
+		room.Mu.RUnlock()
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Code < rooms[j].Code })
+	return rooms
+}
+
+// roomInfo is the API view of a room. Callers hold room.Mu.
+func roomInfo(room *models.Room) models.RoomInfo {
+	state := syncStateMessage(room)
+	return models.RoomInfo{
+		Code:       publicCode(room.Code),
+		Name:       room.Name,
+		Members:    len(room.Clients),
+		MaxMembers: room.MaxMembers,
+		Protected:  room.PasswordHash != nil,
+		Playback: models.RoomPlayback{
+			SourceType: state.SourceType,
+			URL:        state.URL,
+			Position:   state.Timestamp,
+			Playing:    state.Playing,
+		},
+	}
+}
@@ -0,0 +1,125 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+)
+
+var ErrRotateBreakout = errors.New("breakout rooms can't change code")
+
+// retiredCode remembers a rotated-away room code: who was in the room when
+// it changed, so they can reconnect after a blip, and the code it became.
+type retiredCode struct {
+	code    string
+	members map[string]bool
+}
+
+// RotateCode gives a room a fresh code, for when its link has leaked. Members
+// stay connected and are sent a codeRotated message with the new link; the
+// old code stops admitting anyone who wasn't in the room. It returns the new
+// code.
+func (h *Hub) RotateCode(oldCode string) (string, error) {
+	b := make([]byte, 4)
+	rand.Read(b)
+	newCode := hex.EncodeToString(b)
+	if tenantID, _ := tenant.Split(oldCode); tenantID != "" {
+		newCode = tenant.Code(tenantID, newCode)
+	}
+
+	h.mu.Lock()
+	room, exists := h.Rooms[oldCode]
+	if !exists {
+		h.mu.Unlock()
+		return "", ErrRoomNotFound
+	}
+	if _, taken := h.Rooms[newCode]; taken {
+		h.mu.Unlock()
+		return h.RotateCode(oldCode)
+	}
+	room.Mu.Lock()
+	if room.Parent != "" {
+		room.Mu.Unlock()
+		h.mu.Unlock()
+		return "", ErrRotateBreakout
+	}
+
+	delete(h.Rooms, oldCode)
+	h.Rooms[newCode] = room
+	room.Code = newCode
+	h.renameLoop(oldCode, newCode)
+
+	members := make(map[string]bool, len(room.Clients))
+	for c := range room.Clients {
+		client := c.(*models.Client)
+		client.RoomCode = newCode
+		members[client.ID] = true
+	}
+	for id, a := range room.Away {
+		a.Client.RoomCode = newCode
+		members[id] = true
+	}
+	breakouts := append([]string(nil), room.Breakouts...)
+	room.Mu.Unlock()
+
+	for _, code := range breakouts {
+		if child, ok := h.Rooms[code]; ok {
+			child.Mu.Lock()
+			child.Parent = newCode
+			child.Mu.Unlock()
+		}
+	}
+	if s, ok := h.Schedules[oldCode]; ok {
+		delete(h.Schedules, oldCode)
+		s.RoomCode = newCode
+		h.Schedules[newCode] = s
+	}
+
+	// Codes retired earlier now lead to the new one
+	if h.retired == nil {
+		h.retired = make(map[string]*retiredCode)
+	}
+	for _, r := range h.retired {
+		if r.code == oldCode {
+			r.code = newCode
+		}
+	}
+	h.retired[oldCode] = &retiredCode{code: newCode, members: members}
+	h.mu.Unlock()
+
+	if h.Leaderboard != nil {
+		if err := h.Leaderboard.Rename(oldCode, newCode); err != nil {
+			log.Printf("leaderboard: %v", err)
+		}
+	}
+
+	log.Printf("🔑 Room %s is now %s", oldCode, newCode)
+	public := publicCode(newCode)
+	h.BroadcastRoom(newCode, models.Message{
+		Type:     "codeRotated",
+		RoomCode: public,
+		URL:      "/?room=" + url.QueryEscape(public),
+	})
+	return newCode, nil
+}
+
+// ResolveCode returns the room code a join for roomCode should go to: the
+// code itself, or for a retired code, its replacement if userID was in the
+// room when it changed. ok is false if the join should be refused.
+func (h *Hub) ResolveCode(roomCode, userID string) (code string, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r, retired := h.retired[roomCode]
+	if !retired {
+		return roomCode, true
+	}
+	if !r.members[userID] {
+		return "", false
+	}
+	return r.code, true
+}
@@ -0,0 +1,168 @@
+package hub
+
+import (
+	"bytes"
+	"coopcinema/models"
+	"coopcinema/schedule"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+)
+
+var ErrTimeZone = errors.New("time zone must be an IANA name such as Europe/Berlin")
+
+// SetSchedule registers a scheduled (optionally recurring) session for a
+// room code. Schedules outlive the room itself so the code can be reused
+// every occurrence. Reminders, like room webhooks, only go to public
+// http(s) addresses.
+func (h *Hub) SetSchedule(s *models.Schedule) error {
+	if s.ReminderURL != "" {
+		u, err := url.Parse(s.ReminderURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrWebhookURL
+		}
+	}
+	if err := compileSchedule(s); err != nil {
+		return err
+	}
+	s.Next = s.Start
+	if s.Rule != nil {
+		s.Next = s.Rule.Next(s.Start, time.Now().Add(-time.Second))
+	}
+	s.Status = models.ScheduleScheduled
+	if s.Next.IsZero() {
+		s.Status = models.ScheduleEnded
+	}
+
+	h.mu.Lock()
+	h.Schedules[s.RoomCode] = s
+	h.mu.Unlock()
+	return nil
+}
+
+// compileSchedule parses a schedule's rule, once rather than on every
+// scheduler tick, and moves its start into its time zone so occurrences
+// keep their local time when the clocks change.
+func compileSchedule(s *models.Schedule) error {
+	loc := time.UTC
+	if s.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(s.TimeZone); err != nil || s.TimeZone == "Local" {
+			return ErrTimeZone
+		}
+	}
+	s.Start = s.Start.In(loc)
+	s.Rule = nil
+	if s.RRule != "" {
+		rule, err := schedule.Parse(s.RRule)
+		if err != nil {
+			return err
+		}
+		s.Rule = rule
+	}
+	return nil
+}
+
+// Schedule returns a copy of the schedule for a room code.
+func (h *Hub) Schedule(roomCode string) (models.Schedule, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	s, ok := h.Schedules[roomCode]
+	if !ok {
+		return models.Schedule{}, false
+	}
+	return *s, true
+}
+
+// PassRequired reports whether a room's schedule only lets its host in
+// without a guest pass.
+func (h *Hub) PassRequired(roomCode string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s, ok := h.Schedules[roomCode]
+	return ok && s.PassRequired
+}
+
+// RunScheduler advances schedules every tick: it fires reminder webhooks
+// reminderLead before each occurrence and, when an occurrence starts, resets
+// the room's per-session state, tells the room it is live and moves the
+// schedule on to the next occurrence.
+func (h *Hub) RunScheduler(tick, reminderLead time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.mu.Lock()
+		var started []string
+		for code, s := range h.Schedules {
+			if s.Status == models.ScheduleEnded {
+				continue
+			}
+			if !s.Reminded && s.ReminderURL != "" && now.After(s.Next.Add(-reminderLead)) {
+				s.Reminded = true
+				go sendReminder(s.ReminderURL, *s)
+			}
+			if now.Before(s.Next) {
+				continue
+			}
+
+			if room, ok := h.Rooms[code]; ok {
+				room.Mu.Lock()
+				resetSession(room)
+				room.Mu.Unlock()
+			}
+			started = append(started, code)
+			s.Reminded = false
+			s.Next = time.Time{}
+			if s.Rule != nil {
+				s.Next = s.Rule.Next(s.Start, now)
+			}
+			if s.Next.IsZero() {
+				s.Status = models.ScheduleEnded
+			}
+		}
+		h.mu.Unlock()
+
+		for _, code := range started {
+			log.Printf("📅 Scheduled session started in room %s", code)
+			if h.Leaderboard != nil {
+				h.Leaderboard.StartSession(code)
+			}
+			h.BroadcastRoom(code, models.Message{Type: "schedule", Content: models.ScheduleLive})
+		}
+	}
+}
+
+// resetSession clears per-session state, so joiners aren't caught up on the
+// last session's chat or timeline, while keeping the roster and room
+// settings.
+func resetSession(room *models.Room) {
+	room.Reactions = nil
+	room.ReactionCounts = nil
+	room.Bookmarks = nil
+	room.Poll = nil
+	room.ChatHistory = nil
+	room.Timeline = nil
+	room.LastPlayback = nil
+	room.LastChat = make(map[string]time.Time)
+	room.Position = 0
+	room.PositionAt = time.Time{}
+	room.Playing = false
+}
+
+func sendReminder(url string, s models.Schedule) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"event":    "reminder",
+		"roomCode": s.RoomCode,
+		"startsAt": s.Next,
+	})
+	resp, err := roomWebhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("reminder webhook for room %s failed: %v", s.RoomCode, err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,38 @@
+package hub
+
+import "time"
+
+// Settings are the hub's tunables that may change while it runs, when the
+// server's configuration is reloaded. Rooms pick up a change the next time
+// they use the setting.
+type Settings struct {
+	// AttentionDetail caps what attention summaries reveal: AttentionOff,
+	// AttentionCounts or AttentionNames
+	AttentionDetail string
+	ChatHistory     int // chat messages kept per room for late joiners
+	// ResumeGrace is how long a dropped member's place is kept for its
+	// next connection; see resume.go
+	ResumeGrace time.Duration
+	// MediaAllowlist limits the hosts media URLs may be loaded from, each
+	// entry also covering its subdomains; empty allows any
+	MediaAllowlist []string
+	// RelayRate caps what each member may send through data relays, in
+	// bytes per second; 0 turns relaying off. RelayMax caps how many
+	// relays are open at once. See datarelay.go.
+	RelayRate int
+	RelayMax  int
+}
+
+// Configure replaces the hub's settings.
+func (h *Hub) Configure(s Settings) {
+	h.relays.setRate(s.RelayRate)
+	h.settings.Store(&s)
+}
+
+// Settings returns the hub's current settings.
+func (h *Hub) Settings() Settings {
+	if s := h.settings.Load(); s != nil {
+		return *s
+	}
+	return Settings{}
+}
@@ -0,0 +1,86 @@
+package hub
+
+import (
+	"context"
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"math/rand/v2"
+	"time"
+)
+
+// shutdownPoll is how often Shutdown checks whether everyone has gone.
+const shutdownPoll = 50 * time.Millisecond
+
+// Shutdown tells every connected client the server is going away, with a
+// hint to reconnect after between reconnect and twice that so they don't
+// all come back at once, then disconnects them. It returns once every
+// connection has been let go or ctx is done. Rooms are kept, not closed, as
+// they empty, so they can still be snapshotted or archived afterwards.
+func (h *Hub) Shutdown(ctx context.Context, reconnect time.Duration) error {
+	h.shuttingDown.Store(true)
+
+	// Anyone who was still mid-handshake is caught on a later pass
+	ticker := time.NewTicker(shutdownPoll)
+	defer ticker.Stop()
+	for h.disconnectAll(reconnect) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// ShuttingDown reports whether Shutdown was called.
+func (h *Hub) ShuttingDown() bool {
+	return h.shuttingDown.Load()
+}
+
+// CloseRooms closes every room as if it had emptied, running the RoomClosed
+// hooks, which archive it.
+func (h *Hub) CloseRooms() {
+	h.mu.RLock()
+	rooms := make([]*models.Room, 0, len(h.Rooms))
+	for _, room := range h.Rooms {
+		rooms = append(rooms, room)
+	}
+	h.mu.RUnlock()
+
+	for _, room := range rooms {
+		h.closeRoom(room)
+	}
+}
+
+// disconnectAll sends serverShutdown to every client not yet told and
+// closes it. It returns how many clients are still in a room, hidden rooms
+// included.
+func (h *Hub) disconnectAll(reconnect time.Duration) int {
+	h.mu.RLock()
+	var clients []*models.Client
+	for _, room := range h.Rooms {
+		room.Mu.RLock()
+		for c := range room.Clients {
+			clients = append(clients, c.(*models.Client))
+		}
+		room.Mu.RUnlock()
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		if client.Closed() {
+			continue
+		}
+		after := reconnect + rand.N(reconnect+1)
+		deliver(client, models.Message{
+			Type:     "serverShutdown",
+			Content:  "The server is restarting.",
+			Cooldown: after.Seconds(),
+		})
+		// The writer sends the notice, then a Service Restart close frame
+		if client.Close() {
+			metrics.Dropped(metrics.DropShutdown)
+		}
+	}
+	return len(clients)
+}
@@ -0,0 +1,40 @@
+package hub
+
+import "coopcinema/models"
+
+// maxSignal is the most signaling data one message may carry; an SDP offer
+// with many codecs and candidates runs to a few kilobytes.
+const maxSignal = 64 << 10
+
+// Signal passes WebRTC signaling, msg.Signal, from the sender to the room
+// member whose user ID is msg.To, so members can connect to each other
+// directly. Nothing else of a peer connection comes through the server.
+func (h *Hub) Signal(msg models.Message, sender *models.Client) {
+	h.relaySignal(msg, sender, func(*models.Client) bool { return true })
+}
+
+// relaySignal delivers msg.Signal, as a message of msg.Type, to the
+// members of the sender's room with user ID msg.To that to accepts.
+func (h *Hub) relaySignal(msg models.Message, sender *models.Client, to func(*models.Client) bool) {
+	if msg.To == "" || msg.To == sender.ID || len(msg.Signal) == 0 || len(msg.Signal) > maxSignal {
+		return
+	}
+
+	var peers []*models.Client
+	if room := h.room(sender.RoomCode); room != nil {
+		room.Mu.RLock()
+		for c := range room.Clients {
+			if client := c.(*models.Client); client.ID == msg.To && to(client) {
+				peers = append(peers, client)
+			}
+		}
+		room.Mu.RUnlock()
+	}
+
+	relay := models.Message{Type: msg.Type, UserID: sender.ID, UserName: sender.Name, To: msg.To, Signal: msg.Signal}
+	for _, peer := range peers {
+		if accepts(peer, relay.Type) {
+			deliver(peer, relay)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"time"
+)
+
+// mediaSlots are the slots besides the primary a room can play at once.
+var mediaSlots = map[string]bool{
+	models.SlotSecondary: true,
+}
+
+// trackSlot updates a secondary slot from a load, playback or slotClear
+// message. Callers hold room.Mu.
+func trackSlot(room *models.Room, msg models.Message) {
+	slot := slotOf(room, msg.Slot)
+	switch {
+	case mediaTypes[msg.Type]:
+		media := msg
+		slot.Media = &media
+		slot.Position, slot.PositionAt, slot.Playing = 0, time.Now(), false
+	case msg.Type == "slotClear":
+		slot.Media = nil
+		slot.Playing = false
+	case isPlaybackSync(msg.Type):
+		slot.Position = msg.Timestamp
+		slot.PositionAt = time.Now()
+		switch msg.Type {
+		case "play":
+			slot.Playing = true
+		case "pause":
+			slot.Playing = false
+		case "state":
+			slot.Playing = msg.Playing
+		}
+	}
+}
+
+func slotOf(room *models.Room, name string) *models.MediaSlot {
+	if room.Slots == nil {
+		room.Slots = make(map[string]*models.MediaSlot)
+	}
+	slot, ok := room.Slots[name]
+	if !ok {
+		slot = &models.MediaSlot{}
+		room.Slots[name] = slot
+	}
+	return slot
+}
+
+// mayControlSlot reports whether the sender may load or control a slot: it
+// must exist, and when the host gave it a controller only they and the host
+// may.
+func (h *Hub) mayControlSlot(sender *models.Client, name string) bool {
+	if !mediaSlots[name] {
+		return false
+	}
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	slot, ok := room.Slots[name]
+	return !ok || slot.Controller == "" || slot.Controller == sender.ID || room.HostID == sender.ID
+}
+
+// SetSlotController hands control of a slot (msg.Slot) to one member
+// (msg.UserID), or back to everyone when UserID is empty.
+func (h *Hub) SetSlotController(sender *models.Client, msg models.Message) {
+	if !mediaSlots[msg.Slot] {
+		return
+	}
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	slotOf(room, msg.Slot).Controller = msg.UserID
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(sender.RoomCode, models.Message{Type: "slotControl", Slot: msg.Slot, UserID: msg.UserID})
+}
+
+// slotCatchUp brings a late joiner up to date on the secondary slots: the
+// media, then where playback is. Callers hold room.Mu.
+func slotCatchUp(room *models.Room) []models.Message {
+	var msgs []models.Message
+	for name, slot := range room.Slots {
+		if slot.Controller != "" {
+			msgs = append(msgs, models.Message{Type: "slotControl", Slot: name, UserID: slot.Controller})
+		}
+		if slot.Media == nil {
+			continue
+		}
+		position := slot.Position
+		if slot.Playing {
+			position += time.Since(slot.PositionAt).Seconds()
+		}
+		playback := models.Message{Type: "pause", Slot: name, Timestamp: position, SentAt: float64(time.Now().UnixMilli())}
+		if slot.Playing {
+			playback.Type = "play"
+		}
+		msgs = append(msgs, *slot.Media, playback)
+	}
+	return msgs
+}
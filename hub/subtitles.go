@@ -0,0 +1,118 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"math"
+)
+
+// maxSubtitleOffset bounds how far subtitles can be shifted, in seconds.
+const maxSubtitleOffset = 600
+
+// SetSubtitles shares a subtitle track with a room for the media it is
+// playing, replacing any earlier track and resetting the offset. Members
+// get a subtitlesAvailable message. It returns the replaced track, if any,
+// so the room's hold on its file can be released.
+func (h *Hub) SetSubtitles(roomCode string, track models.SubtitleTrack) (*models.SubtitleTrack, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, false
+	}
+	room.Mu.Lock()
+	old := room.Subtitles
+	track.Media = ""
+	if room.Media != nil {
+		track.Media = room.Media.URL
+	}
+	room.Subtitles = &track
+	room.SubtitleOffset = 0
+	msg := subtitlesMessage(room)
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(roomCode, msg)
+	return old, true
+}
+
+// ClearSubtitles stops sharing a room's subtitles and returns the track
+// that was shared.
+func (h *Hub) ClearSubtitles(roomCode string) (*models.SubtitleTrack, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, false
+	}
+	room.Mu.Lock()
+	if room.Subtitles == nil {
+		room.Mu.Unlock()
+		return nil, false
+	}
+	old := room.Subtitles
+	room.Subtitles = nil
+	room.SubtitleOffset = 0
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(roomCode, models.Message{Type: "subtitlesRemoved"})
+	return old, true
+}
+
+// Subtitles describes the subtitles shared for what a room is playing.
+func (h *Hub) Subtitles(roomCode string) (models.SubtitlesResponse, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return models.SubtitlesResponse{}, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+	if !subtitlesCurrent(room) {
+		return models.SubtitlesResponse{}, false
+	}
+	return models.SubtitlesResponse{
+		URL:    room.Subtitles.URL,
+		Label:  room.Subtitles.Label,
+		Offset: room.SubtitleOffset,
+	}, true
+}
+
+// SetSubtitleOffset shifts the room's subtitles by msg.Timestamp seconds
+// and relays the change like a seek.
+func (h *Hub) SetSubtitleOffset(msg models.Message, sender *models.Client) {
+	if math.IsNaN(msg.Timestamp) || math.Abs(msg.Timestamp) > maxSubtitleOffset {
+		return
+	}
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	if !subtitlesCurrent(room) {
+		room.Mu.Unlock()
+		return
+	}
+	room.SubtitleOffset = msg.Timestamp
+	room.Mu.Unlock()
+
+	h.Broadcast(models.Message{Type: "subtitleOffset", Timestamp: msg.Timestamp, UserName: sender.Name}, sender)
+}
+
+// subtitlesCurrent reports whether the room's subtitles were shared for the
+// media it is playing now. Callers hold room.Mu.
+func subtitlesCurrent(room *models.Room) bool {
+	if room.Subtitles == nil {
+		return false
+	}
+	media := ""
+	if room.Media != nil {
+		media = room.Media.URL
+	}
+	return room.Subtitles.Media == media
+}
+
+// subtitlesMessage tells members to load the room's subtitles, shifted by
+// timestamp seconds. Callers hold room.Mu.
+func subtitlesMessage(room *models.Room) models.Message {
+	return models.Message{
+		Type:      "subtitlesAvailable",
+		URL:       room.Subtitles.URL,
+		Content:   room.Subtitles.Label,
+		Timestamp: room.SubtitleOffset,
+	}
+}
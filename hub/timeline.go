@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"time"
+)
+
+// timelineLimit caps how many activity entries a room keeps.
+const timelineLimit = 1000
+
+var mediaTypes = map[string]bool{
+	"youtube":     true,
+	"vimeo":       true,
+	"twitch":      true,
+	"dailymotion": true,
+	"directurl":   true,
+	"file":        true,
+}
+
+// loadsMedia reports whether a message type loads the room's media.
+func loadsMedia(msgType string) bool {
+	return mediaTypes[msgType] || msgType == "setMedia"
+}
+
+// record adds an activity entry to a room. Callers hold room.Mu.
+func (h *Hub) record(room *models.Room, kind string, client *models.Client, detail string, position float64) {
+	e := models.TimelineEntry{
+		At:       time.Now(),
+		Kind:     kind,
+		Detail:   detail,
+		Position: position,
+	}
+	if client != nil {
+		e.UserID = client.ID
+		e.UserName = client.Name
+	}
+	room.AppendTimeline(e, timelineLimit)
+}
+
+// recordMessage derives timeline entries from relayed client messages.
+// Callers hold room.Mu.
+func (h *Hub) recordMessage(room *models.Room, msg models.Message, sender *models.Client) {
+	switch {
+	case mediaTypes[msg.Type]:
+		h.record(room, "media", sender, msg.Type+":"+msg.URL, 0)
+	case msg.Type == "seek":
+		h.record(room, "seek", sender, "", msg.Timestamp)
+	}
+}
+
+// Timeline returns up to limit entries older than before (all entries when
+// before is zero), newest first, and the cursor for the next page.
+func (h *Hub) Timeline(roomCode string, before int64, limit int) ([]models.TimelineEntry, int64, bool) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, 0, false
+	}
+	room.Mu.RLock()
+	defer room.Mu.RUnlock()
+
+	entries := []models.TimelineEntry{}
+	for i := len(room.Timeline) - 1; i >= 0 && len(entries) < limit; i-- {
+		e := room.Timeline[i]
+		if before > 0 && e.ID >= before {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	var next int64
+	if len(entries) == limit {
+		last := entries[len(entries)-1].ID
+		if room.Timeline[0].ID < last {
+			next = last
+		}
+	}
+	return entries, next, true
+}
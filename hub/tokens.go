@@ -0,0 +1,127 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Room API token scopes.
+const (
+	ScopePostChat        = "post-chat"        // post chat under the token's name
+	ScopeControlPlayback = "control-playback" // play, pause and seek
+	ScopeReadState       = "read-state"       // follow the observer stream
+)
+
+var tokenScopes = map[string]bool{
+	ScopePostChat:        true,
+	ScopeControlPlayback: true,
+	ScopeReadState:       true,
+}
+
+var ErrTokenNotFound = errors.New("no such token")
+
+// MintToken creates an API token for a room with the given scopes. A ttl of
+// 0 makes it last as long as the room. It returns the secret, which isn't
+// kept anywhere it can be listed, and the grant.
+func (h *Hub) MintToken(roomCode, name string, scopes []string, ttl time.Duration) (string, models.APIToken, error) {
+	if len(scopes) == 0 {
+		return "", models.APIToken{}, fmt.Errorf("at least one scope is needed")
+	}
+	for _, s := range scopes {
+		if !tokenScopes[s] {
+			return "", models.APIToken{}, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+
+	secret := randomHex(24)
+	grant := &models.APIToken{
+		ID:        randomHex(6),
+		Name:      name,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		CreatedAt: time.Now().UTC(),
+	}
+	if ttl > 0 {
+		grant.ExpiresAt = grant.CreatedAt.Add(ttl)
+	}
+
+	room := h.room(roomCode)
+	if room == nil {
+		return "", models.APIToken{}, ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	if room.APITokens == nil {
+		room.APITokens = make(map[string]*models.APIToken)
+	}
+	room.APITokens[secret] = grant
+	return secret, *grant, nil
+}
+
+// Tokens lists a room's unexpired tokens, oldest first.
+func (h *Hub) Tokens(roomCode string) ([]models.APIToken, error) {
+	room := h.room(roomCode)
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	pruneTokens(room, time.Now())
+	list := []models.APIToken{}
+	for _, grant := range room.APITokens {
+		list = append(list, *grant)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// RevokeToken deletes a room's token by ID.
+func (h *Hub) RevokeToken(roomCode, id string) error {
+	room := h.room(roomCode)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	for secret, grant := range room.APITokens {
+		if grant.ID == id {
+			delete(room.APITokens, secret)
+			return nil
+		}
+	}
+	return ErrTokenNotFound
+}
+
+// authorize checks that a token is valid for the room and carries scope.
+// Callers hold room.Mu.
+func authorize(room *models.Room, secret, scope string) (*models.APIToken, error) {
+	pruneTokens(room, time.Now())
+	grant, ok := room.APITokens[secret]
+	if !ok {
+		return nil, ErrBadToken
+	}
+	if !slices.Contains(grant.Scopes, scope) {
+		return nil, ErrTypeNotAllowed
+	}
+	return grant, nil
+}
+
+// pruneTokens drops expired tokens. Callers hold room.Mu.
+func pruneTokens(room *models.Room, now time.Time) {
+	for secret, grant := range room.APITokens {
+		if !grant.ExpiresAt.IsZero() && now.After(grant.ExpiresAt) {
+			delete(room.APITokens, secret)
+		}
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,83 @@
+package hub
+
+import "coopcinema/models"
+
+// VoiceJoin puts the sender in their room's voice chat, muted. Members
+// already in it get voiceJoin and are expected to offer the newcomer an
+// audio connection with voiceSignal.
+func (h *Hub) VoiceJoin(sender *models.Client) {
+	if sender.InVoice.Swap(true) {
+		return
+	}
+	sender.Muted.Store(true)
+	sender.Speaking.Store(false)
+	h.voiceChanged(sender, models.Message{Type: "voiceJoin", UserID: sender.ID, UserName: sender.Name})
+}
+
+// VoiceLeave takes the sender out of voice chat.
+func (h *Hub) VoiceLeave(sender *models.Client) {
+	if !sender.InVoice.Swap(false) {
+		return
+	}
+	sender.Speaking.Store(false)
+	h.closeRelays(sender, RelayVoice)
+	h.voiceChanged(sender, models.Message{Type: "voiceLeave", UserID: sender.ID, UserName: sender.Name})
+}
+
+// VoiceState records that the sender muted, unmuted, started or stopped
+// speaking, and tells the room. Muting shows in the user list straight
+// away; speaking, which flips constantly, only goes out as voiceState and
+// is picked up by the next user list.
+func (h *Hub) VoiceState(sender *models.Client, state string) {
+	if !sender.InVoice.Load() {
+		return
+	}
+	var changed bool
+	switch state {
+	case "muted":
+		changed = !sender.Muted.Swap(true)
+		sender.Speaking.Store(false)
+	case "unmuted":
+		changed = sender.Muted.Swap(false)
+	case "speaking":
+		changed = !sender.Muted.Load() && !sender.Speaking.Swap(true)
+	case "quiet":
+		changed = sender.Speaking.Swap(false)
+	}
+	if !changed {
+		return
+	}
+
+	msg := models.Message{Type: "voiceState", UserID: sender.ID, UserName: sender.Name, Content: state}
+	if state == "muted" || state == "unmuted" {
+		h.voiceChanged(sender, msg)
+		return
+	}
+	h.Broadcast(msg, sender)
+}
+
+// VoiceSignal passes audio connection signaling between two members who
+// are both in voice chat.
+func (h *Hub) VoiceSignal(msg models.Message, sender *models.Client) {
+	if !sender.InVoice.Load() {
+		return
+	}
+	h.relaySignal(msg, sender, func(peer *models.Client) bool { return peer.InVoice.Load() })
+}
+
+// voiceLeft tells the room a member who was in voice chat disconnected.
+func (h *Hub) voiceLeft(room *models.Room, client *models.Client) {
+	if client.InVoice.Swap(false) {
+		h.BroadcastRoom(room.Code, models.Message{Type: "voiceLeave", UserID: client.ID, UserName: client.Name})
+	}
+}
+
+// voiceChanged sends the room msg and a user list with the sender's new
+// voice presence.
+func (h *Hub) voiceChanged(sender *models.Client, msg models.Message) {
+	h.Broadcast(msg, sender)
+
+	if room := h.room(sender.RoomCode); room != nil {
+		h.BroadcastUserList(room)
+	}
+}
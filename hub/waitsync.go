@@ -0,0 +1,160 @@
+package hub
+
+import (
+	"coopcinema/models"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// waitTimeout is the longest a room waits for a member who never reports
+// ready before playing on without them.
+const waitTimeout = 30 * time.Second
+
+// SetWaitMode turns "wait for everyone" on ("on") or off ("off") for the
+// host's room. While it is on, a member buffering pauses the room for
+// everyone and the server resumes it once they all report ready, instead
+// of each client pausing and resuming on its own. Turning it off resumes a
+// room that is waiting.
+func (h *Hub) SetWaitMode(sender *models.Client, mode string) {
+	if mode != "on" && mode != "off" {
+		return
+	}
+
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	room.WaitForAll = mode == "on"
+	room.Buffering = nil
+	resume, resumed := resumeIfReady(room)
+	room.Mu.Unlock()
+
+	h.BroadcastRoom(room.Code, models.Message{Type: "waitMode", Content: mode})
+	if resumed {
+		h.BroadcastRoom(room.Code, resume)
+	}
+}
+
+// BufferReport handles a member's buffering, bufferend or ready report.
+// Outside wait mode it is relayed for clients to act on themselves, with
+// ready sent on as bufferend for clients that predate it. In wait mode the
+// first member to buffer pauses the room and the last to be ready resumes
+// it.
+func (h *Hub) BufferReport(msg models.Message, sender *models.Client) {
+	room := h.room(sender.RoomCode)
+	if room == nil {
+		return
+	}
+	room.Mu.Lock()
+	if !room.WaitForAll {
+		room.Mu.Unlock()
+		if msg.Type == "ready" {
+			msg.Type = "bufferend"
+		}
+		h.Broadcast(msg, sender)
+		return
+	}
+
+	var out []models.Message
+	if msg.Type == "buffering" {
+		if room.Buffering == nil {
+			room.Buffering = make(map[string]bool)
+		}
+		changed := !room.Buffering[sender.ID]
+		room.Buffering[sender.ID] = true
+		if room.Playing {
+			out = h.holdForBuffering(room)
+		} else if changed && !room.WaitHold.IsZero() {
+			out = append(out, waitingMessage(room))
+		}
+	} else if room.Buffering[sender.ID] {
+		delete(room.Buffering, sender.ID)
+		if resume, ok := resumeIfReady(room); ok {
+			out = append(out, resume)
+		} else if !room.WaitHold.IsZero() {
+			out = append(out, waitingMessage(room))
+		}
+	}
+	code := room.Code
+	room.Mu.Unlock()
+
+	for _, m := range out {
+		h.BroadcastRoom(code, m)
+	}
+}
+
+// holdForBuffering pauses a playing room where it is and returns the pause
+// and waiting list to send everyone. If nobody is ready within waitTimeout
+// the room plays on. Callers hold room.Mu.
+func (h *Hub) holdForBuffering(room *models.Room) []models.Message {
+	at := currentPosition(room)
+	room.Position, room.PositionAt, room.Playing = at, time.Now(), false
+	room.WaitHold = room.PositionAt
+	h.playbackChanged(room)
+
+	held := room.WaitHold
+	time.AfterFunc(waitTimeout, func() {
+		room.Mu.Lock()
+		if !room.WaitHold.Equal(held) {
+			room.Mu.Unlock()
+			return
+		}
+		room.Buffering = nil
+		resume, ok := resumeIfReady(room)
+		code := room.Code
+		room.Mu.Unlock()
+		if ok {
+			h.BroadcastRoom(code, resume)
+		}
+	})
+
+	// Stamped with the host's ID so clients in host mode follow it
+	pause := models.Message{Type: "pause", Timestamp: at, Content: "waiting", UserID: room.HostID}
+	return []models.Message{pause, waitingMessage(room)}
+}
+
+// resumeIfReady ends a hold once nobody is buffering, returning the play to
+// send everyone from where the room paused. Callers hold room.Mu.
+func resumeIfReady(room *models.Room) (models.Message, bool) {
+	if room.WaitHold.IsZero() || len(room.Buffering) > 0 {
+		return models.Message{}, false
+	}
+	room.WaitHold = time.Time{}
+	room.PositionAt, room.Playing = time.Now(), true
+	return models.Message{Type: "play", Timestamp: room.Position, Content: "ready", UserID: room.HostID}, true
+}
+
+// waitingMessage lists the names of the members a held room is waiting
+// for. Callers hold room.Mu.
+func waitingMessage(room *models.Room) models.Message {
+	seen := make(map[string]bool)
+	names := []string{}
+	for c := range room.Clients {
+		client := c.(*models.Client)
+		if room.Buffering[client.ID] && !seen[client.ID] {
+			seen[client.ID] = true
+			names = append(names, client.Name)
+		}
+	}
+	sort.Strings(names)
+	data, _ := json.Marshal(names)
+	return models.Message{Type: "waiting", Content: string(data)}
+}
+
+// bufferingLeft stops waiting for a member who disconnected mid-buffer.
+func (h *Hub) bufferingLeft(room *models.Room, client *models.Client) {
+	room.Mu.Lock()
+	if !room.Buffering[client.ID] || inRoom(room, client.ID) {
+		room.Mu.Unlock()
+		return
+	}
+	delete(room.Buffering, client.ID)
+	resume, ok := resumeIfReady(room)
+	code := room.Code
+	room.Mu.Unlock()
+	if ok {
+		h.BroadcastRoom(code, resume)
+	}
+}
@@ -0,0 +1,143 @@
+package hub
+
+import (
+	"bytes"
+	"coopcinema/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Playback changes within this window go out as one delivery carrying the
+// latest state.
+const webhookDebounce = 2 * time.Second
+
+var ErrWebhookURL = errors.New("webhook URL must be http(s)")
+
+var errPrivateAddress = errors.New("address not allowed")
+
+// publicOnly refuses connections to loopback, private or link-local
+// addresses, so room members can't point the server at its own network.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// roomWebhookClient only reaches public addresses.
+var roomWebhookClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: publicOnly,
+		}).DialContext,
+	},
+}
+
+// PlaybackEvent is the body of a room webhook delivery.
+type PlaybackEvent struct {
+	Event    string    `json:"event"`
+	RoomCode string    `json:"roomCode"`
+	Media    string    `json:"media,omitempty"` // youtube, vimeo, directurl, ...
+	MediaURL string    `json:"mediaURL,omitempty"`
+	Position float64   `json:"position"`
+	Playing  bool      `json:"playing"`
+	At       time.Time `json:"at"`
+}
+
+// SetWebhook registers a URL to receive the room's playback changes, or
+// removes it when rawURL is empty. It returns the signing secret: each
+// delivery carries X-Coopcinema-Signature: sha256=<hex HMAC of the body>.
+func (h *Hub) SetWebhook(roomCode, rawURL string) (string, error) {
+	if rawURL != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", ErrWebhookURL
+		}
+	}
+
+	room := h.room(roomCode)
+	if room == nil {
+		return "", ErrRoomNotFound
+	}
+	room.Mu.Lock()
+	defer room.Mu.Unlock()
+	if room.Webhook != nil && room.Webhook.Pending != nil {
+		room.Webhook.Pending.Stop()
+	}
+	if rawURL == "" {
+		room.Webhook = nil
+		return "", nil
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	room.Webhook = &models.RoomWebhook{URL: rawURL, Secret: hex.EncodeToString(b)}
+	return room.Webhook.Secret, nil
+}
+
+// playbackChanged queues a webhook delivery for a play, pause, seek or
+// media load. Callers hold room.Mu.
+func (h *Hub) playbackChanged(room *models.Room) {
+	wh := room.Webhook
+	if wh == nil || wh.Pending != nil {
+		return
+	}
+	wh.Pending = time.AfterFunc(webhookDebounce, func() {
+		h.deliverWebhook(room, wh)
+	})
+}
+
+func (h *Hub) deliverWebhook(room *models.Room, wh *models.RoomWebhook) {
+	room.Mu.Lock()
+	wh.Pending = nil
+	if room.Webhook != wh {
+		room.Mu.Unlock()
+		return
+	}
+	ev := PlaybackEvent{
+		Event:    "playback",
+		RoomCode: publicCode(room.Code),
+		Position: currentPosition(room),
+		Playing:  room.Playing,
+		At:       time.Now().UTC(),
+	}
+	if room.Media != nil {
+		ev.Media = room.Media.Type
+		ev.MediaURL = room.Media.URL
+	}
+	room.Mu.Unlock()
+
+	body, _ := json.Marshal(ev)
+	mac := hmac.New(sha256.New, []byte(wh.Secret))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Coopcinema-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := roomWebhookClient.Do(req)
+	if err != nil {
+		log.Printf("room webhook for %s failed: %v", room.Code, err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,35 @@
+// Package ipaddr normalizes client addresses for per-IP accounting. IPv6
+// clients usually control a whole prefix (a /64 for a typical home or VPS),
+// so they are accounted by prefix rather than by address to keep limits and
+// bans from being sidestepped by rotating addresses.
+package ipaddr
+
+import "net/netip"
+
+// Normalize returns the canonical form of an address, with IPv4-mapped IPv6
+// addresses turned back into IPv4. Unparseable input is returned unchanged.
+func Normalize(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	return addr.Unmap().WithZone("").String()
+}
+
+// Key is what an address is accounted under: an IPv4 address as is, an IPv6
+// address as its enclosing /bits prefix, e.g. "2001:db8:1:2::/64".
+func Key(ip string, bits int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() || bits <= 0 || bits >= 128 {
+		return addr.String()
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
@@ -0,0 +1,206 @@
+// Package jwt signs and verifies the compact JSON Web Tokens that
+// authenticate WebSocket connections: HS256 with a shared secret, or RS256
+// with an RSA key pair. Only the algorithm the configured key is for is
+// accepted, so a token can't pick its own.
+package jwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// leeway absorbs clock skew between the token's issuer and this server.
+const leeway = 30 * time.Second
+
+var (
+	ErrInvalid = errors.New("token is invalid")
+	ErrExpired = errors.New("token has expired")
+	ErrNoKey   = errors.New("no key to sign tokens with")
+)
+
+// Claims are the registered claims read from a token, plus the display
+// name.
+type Claims struct {
+	Subject   string `json:"sub"`
+	Name      string `json:"name"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Keys verify tokens and, when there is a secret or private key, sign
+// them.
+type Keys struct {
+	secret  []byte
+	public  *rsa.PublicKey
+	private *rsa.PrivateKey
+}
+
+// NewHMAC returns keys for HS256 tokens.
+func NewHMAC(secret []byte) *Keys {
+	return &Keys{secret: secret}
+}
+
+// LoadRSA returns keys for RS256 tokens from PEM files: a public key to
+// verify with and, optionally, a private key to sign with. With only a
+// private key, its public half verifies.
+func LoadRSA(publicPath, privatePath string) (*Keys, error) {
+	k := &Keys{}
+	if privatePath != "" {
+		block, err := readPEM(privatePath)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", privatePath, err)
+		}
+		private, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an RSA private key", privatePath)
+		}
+		k.private, k.public = private, &private.PublicKey
+	}
+	if publicPath != "" {
+		block, err := readPEM(publicPath)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", publicPath, err)
+		}
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an RSA public key", publicPath)
+		}
+		k.public = public
+	}
+	if k.public == nil {
+		return nil, errors.New("no RSA key given")
+	}
+	return k, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	return block, nil
+}
+
+// CanSign reports whether the keys can issue tokens, not just check them.
+func (k *Keys) CanSign() bool {
+	return k.secret != nil || k.private != nil
+}
+
+func (k *Keys) alg() string {
+	if k.secret != nil {
+		return "HS256"
+	}
+	return "RS256"
+}
+
+// Sign issues a token carrying c.
+func (k *Keys) Sign(c Claims) (string, error) {
+	if !k.CanSign() {
+		return "", ErrNoKey
+	}
+	header, _ := json.Marshal(map[string]string{"alg": k.alg(), "typ": "JWT"})
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	signed := encode(header) + "." + encode(payload)
+
+	var sig []byte
+	if k.secret != nil {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	}
+	return signed + "." + encode(sig), nil
+}
+
+// Verify checks a token's algorithm, signature and expiry, and returns its
+// claims. Tokens must name a subject and an expiry.
+func (k *Keys) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalid
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJSON(parts[0], &header); err != nil || header.Alg != k.alg() {
+		return Claims{}, ErrInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+
+	signed := parts[0] + "." + parts[1]
+	if k.secret != nil {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return Claims{}, ErrInvalid
+		}
+	} else {
+		digest := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], sig) != nil {
+			return Claims{}, ErrInvalid
+		}
+	}
+
+	var c Claims
+	if err := decodeJSON(parts[1], &c); err != nil || c.Subject == "" || c.ExpiresAt == 0 {
+		return Claims{}, ErrInvalid
+	}
+	if now.Add(-leeway).Unix() >= c.ExpiresAt {
+		return c, ErrExpired
+	}
+	return c, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJSON(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,221 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Unix(1_700_000_000, 0)
+
+func claims() Claims {
+	return Claims{Subject: "alice", Name: "Alice", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+}
+
+// rsaKeys writes a fresh key pair as PEM files and loads verify-only and
+// signing keys from them.
+func rsaKeys(t *testing.T) (verify, sign *Keys, private *rsa.PrivateKey) {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	publicDER, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	publicPath := filepath.Join(dir, "public.pem")
+	privatePath := filepath.Join(dir, "private.pem")
+	os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o600)
+	os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}), 0o600)
+
+	if verify, err = LoadRSA(publicPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	if sign, err = LoadRSA("", privatePath); err != nil {
+		t.Fatal(err)
+	}
+	return verify, sign, private
+}
+
+// forge makes a token with the given header and claims, signed by sign
+// over the first two parts.
+func forge(header map[string]string, c Claims, sign func(signed string) []byte) string {
+	h, _ := json.Marshal(header)
+	p, _ := json.Marshal(c)
+	signed := encode(h) + "." + encode(p)
+	return signed + "." + encode(sign(signed))
+}
+
+func hs256(secret []byte) func(string) []byte {
+	return func(signed string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	verify, sign, _ := rsaKeys(t)
+	for name, k := range map[string]struct{ sign, verify *Keys }{
+		"HS256": {NewHMAC([]byte("secret")), NewHMAC([]byte("secret"))},
+		"RS256": {sign, verify},
+	} {
+		t.Run(name, func(t *testing.T) {
+			token, err := k.sign.Sign(claims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := k.verify.Verify(token, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != claims() {
+				t.Fatalf("got %+v, want %+v", got, claims())
+			}
+		})
+	}
+	if _, err := verify.Sign(claims()); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("signing with only a public key: %v, want ErrNoKey", err)
+	}
+}
+
+func TestWrongAlgorithm(t *testing.T) {
+	secret := []byte("secret")
+	verify, sign, private := rsaKeys(t)
+
+	rs256, err := sign.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHMAC(secret).Verify(rs256, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("RS256 token checked with an HMAC secret: %v, want ErrInvalid", err)
+	}
+
+	hs, _ := NewHMAC(secret).Sign(claims())
+	if _, err := verify.Verify(hs, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("HS256 token checked with an RSA key: %v, want ErrInvalid", err)
+	}
+
+	// The classic confusion: HS256 keyed with the RSA public key, which
+	// anyone can have
+	publicDER, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	confused := forge(map[string]string{"alg": "HS256", "typ": "JWT"}, claims(), hs256(publicPEM))
+	if _, err := verify.Verify(confused, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("HS256 token keyed with the public key: %v, want ErrInvalid", err)
+	}
+
+	for _, alg := range []string{"HS512", "hs256", "", "RS256 "} {
+		token := forge(map[string]string{"alg": alg}, claims(), hs256(secret))
+		if _, err := NewHMAC(secret).Verify(token, now); !errors.Is(err, ErrInvalid) {
+			t.Errorf("alg %q: %v, want ErrInvalid", alg, err)
+		}
+	}
+}
+
+func TestNoneAlgorithm(t *testing.T) {
+	verify, _, _ := rsaKeys(t)
+	empty := func(string) []byte { return nil }
+	for _, alg := range []string{"none", "None", "NONE"} {
+		token := forge(map[string]string{"alg": alg, "typ": "JWT"}, claims(), empty)
+		for name, k := range map[string]*Keys{"HMAC": NewHMAC([]byte("secret")), "RSA": verify} {
+			if _, err := k.Verify(token, now); !errors.Is(err, ErrInvalid) {
+				t.Errorf("alg %s against %s keys: %v, want ErrInvalid", alg, name, err)
+			}
+			// Nor with the trailing dot dropped
+			if _, err := k.Verify(strings.TrimSuffix(token, "."), now); !errors.Is(err, ErrInvalid) {
+				t.Errorf("alg %s without a signature part against %s keys: %v, want ErrInvalid", alg, name, err)
+			}
+		}
+	}
+}
+
+func TestTampered(t *testing.T) {
+	_, sign, _ := rsaKeys(t)
+	for name, k := range map[string]*Keys{"HS256": NewHMAC([]byte("secret")), "RS256": sign} {
+		t.Run(name, func(t *testing.T) {
+			token, err := k.Sign(claims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts := strings.Split(token, ".")
+
+			sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			sig[len(sig)/2] ^= 1
+			badSig := parts[0] + "." + parts[1] + "." + encode(sig)
+
+			other := claims()
+			other.Subject = "mallory"
+			payload, _ := json.Marshal(other)
+			badPayload := parts[0] + "." + encode(payload) + "." + parts[2]
+
+			otherKey, _ := NewHMAC([]byte("other secret")).Sign(claims())
+
+			for what, token := range map[string]string{
+				"signature":          badSig,
+				"payload":            badPayload,
+				"no signature":       parts[0] + "." + parts[1] + ".",
+				"not base64":         parts[0] + "." + parts[1] + ".!!!",
+				"too many parts":     token + ".x",
+				"too few parts":      parts[0] + "." + parts[1],
+				"other HMAC secret":  otherKey,
+				"garbage":            "not a token",
+				"header not JSON":    encode([]byte("{")) + "." + parts[1] + "." + parts[2],
+				"empty":              "",
+				"signature appended": token + parts[2],
+			} {
+				if what == "other HMAC secret" && name == "RS256" {
+					continue
+				}
+				if _, err := k.Verify(token, now); !errors.Is(err, ErrInvalid) {
+					t.Errorf("tampered %s: %v, want ErrInvalid", what, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	k := NewHMAC([]byte("secret"))
+	c := claims()
+	c.ExpiresAt = now.Unix()
+	token, _ := k.Sign(c)
+
+	// Within leeway of the expiry it still passes
+	if _, err := k.Verify(token, now.Add(leeway-time.Second)); err != nil {
+		t.Errorf("just inside leeway: %v", err)
+	}
+	got, err := k.Verify(token, now.Add(leeway))
+	if !errors.Is(err, ErrExpired) {
+		t.Fatalf("past leeway: %v, want ErrExpired", err)
+	}
+	if got.Subject != "alice" {
+		t.Errorf("expired token's claims: %+v", got)
+	}
+	if _, err := k.Verify(token, now.Add(24*time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Errorf("a day later: %v, want ErrExpired", err)
+	}
+}
+
+func TestRequiredClaims(t *testing.T) {
+	k := NewHMAC([]byte("secret"))
+	noSubject, noExpiry := claims(), claims()
+	noSubject.Subject = ""
+	noExpiry.ExpiresAt = 0
+	for name, c := range map[string]Claims{"subject": noSubject, "expiry": noExpiry} {
+		token, _ := k.Sign(c)
+		if _, err := k.Verify(token, now); !errors.Is(err, ErrInvalid) {
+			t.Errorf("no %s: %v, want ErrInvalid", name, err)
+		}
+	}
+}
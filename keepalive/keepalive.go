@@ -0,0 +1,156 @@
+// Package keepalive paces WebSocket pings per connection. Connections that
+// answer promptly are pinged less often; slow or lossy ones are pinged more
+// often so a dead peer is noticed sooner. Each connection gets a liveness
+// score from 0 to 100 that the roster shows next to its user.
+package keepalive
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	MinInterval = 10 * time.Second
+	MaxInterval = 60 * time.Second
+
+	// startInterval is where new connections begin, before anything is
+	// known about them.
+	startInterval = 30 * time.Second
+
+	minGrace = 5 * time.Second
+
+	// weight is how much a single observation moves the running averages.
+	weight = 0.25
+)
+
+// Liveness bands, coarse enough that the roster doesn't churn on every pong.
+const (
+	Healthy = "healthy"
+	Flaky   = "flaky"
+	Lost    = "lost"
+)
+
+// Tracker follows one connection's pings and pongs. It is shared by the
+// connection's reader, which reports pongs, and its writer, which sends
+// pings.
+type Tracker struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time     // when the next ping is due
+	pending  int64         // stamp of the latest unanswered ping, 0 if none
+	rtt      time.Duration // running average
+	loss     float64       // running share of pings not answered before the next
+}
+
+func New() *Tracker {
+	return &Tracker{interval: startInterval, next: time.Now().Add(startInterval)}
+}
+
+// Sent records a ping stamped at now and returns how long to wait before
+// the next one.
+func (t *Tracker) Sent(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending != 0 {
+		t.observeLoss(1)
+	}
+	t.pending = now.UnixNano()
+	t.adjust()
+	t.next = now.Add(t.interval)
+	return t.interval
+}
+
+// Pong records the answer to the ping stamped sent and returns when the
+// connection should be given up on if nothing else arrives.
+func (t *Tracker) Pong(sent int64, now time.Time) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if rtt := time.Duration(now.UnixNano() - sent); rtt >= 0 {
+		if t.rtt == 0 {
+			t.rtt = rtt
+		} else {
+			t.rtt += time.Duration(weight * float64(rtt-t.rtt))
+		}
+	}
+	if sent == t.pending {
+		t.pending = 0
+		t.observeLoss(0)
+	}
+	return t.deadline()
+}
+
+// Due is when the next ping should be sent.
+func (t *Tracker) Due() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.next
+}
+
+// Deadline is when the connection should be given up on if nothing arrives:
+// a grace period after the next ping is due.
+func (t *Tracker) Deadline() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deadline()
+}
+
+func (t *Tracker) deadline() time.Time {
+	return t.next.Add(max(minGrace, 4*t.rtt))
+}
+
+// RTT is the running average round-trip time.
+func (t *Tracker) RTT() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rtt
+}
+
+// Score rates the connection from 0 (gone quiet) to 100 (prompt and
+// reliable).
+func (t *Tracker) Score() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.score()
+}
+
+func (t *Tracker) score() int {
+	// A round trip costs a point per 20ms past the first 100ms, up to 50;
+	// loss costs up to 60.
+	penalty := 0.0
+	if t.rtt > 100*time.Millisecond {
+		penalty += min(50, float64(t.rtt-100*time.Millisecond)/float64(20*time.Millisecond))
+	}
+	penalty += 60 * t.loss
+	return max(0, 100-int(penalty))
+}
+
+// Band returns the coarse liveness band for a score.
+func Band(score int) string {
+	switch {
+	case score >= 70:
+		return Healthy
+	case score >= 30:
+		return Flaky
+	default:
+		return Lost
+	}
+}
+
+func (t *Tracker) observeLoss(missed float64) {
+	t.loss += weight * (missed - t.loss)
+}
+
+// adjust lengthens the interval for steady connections and shortens it for
+// shaky ones.
+func (t *Tracker) adjust() {
+	switch Band(t.score()) {
+	case Healthy:
+		t.interval = min(MaxInterval, t.interval*3/2)
+	case Lost:
+		t.interval = MinInterval
+	default:
+		t.interval = max(MinInterval, t.interval/2)
+	}
+}
@@ -0,0 +1,169 @@
+// Package leaderboard accumulates watch time and attendance streaks for
+// persistent rooms across sessions.
+package leaderboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hour marks announced to the room when a member crosses them.
+var hourMilestones = []int{1, 10, 25, 50, 100, 250, 500, 1000}
+
+// Streak lengths announced to the room.
+var streakMilestones = []int{3, 5, 10, 25, 52, 100}
+
+// Member is one person's standing in a room. Members are keyed by display
+// name since guest IDs do not survive a page reload.
+type Member struct {
+	Name         string  `json:"name"`
+	WatchSeconds float64 `json:"watchSeconds"`
+	Sessions     int     `json:"sessions"`
+	Streak       int     `json:"streak"`
+	BestStreak   int     `json:"bestStreak"`
+	LastSession  int     `json:"lastSession"`
+}
+
+// Board is the standing of every member of one room.
+type Board struct {
+	Sessions int                `json:"sessions"`
+	Members  map[string]*Member `json:"members"`
+}
+
+// Store persists boards as a JSON file.
+type Store struct {
+	path string
+
+	mu     sync.Mutex
+	boards map[string]*Board
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, boards: make(map[string]*Board)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.boards); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StartSession begins a new session for a room. A member's streak carries on
+// if they watched during the previous one.
+func (s *Store) StartSession(roomCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.board(roomCode).Sessions++
+}
+
+// Credit adds watch time to each named member of a room and returns the
+// milestone announcements it caused.
+func (s *Store) Credit(roomCode string, names []string, d time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.board(roomCode)
+	var milestones []string
+	for _, name := range names {
+		key := strings.ToLower(name)
+		m, ok := b.Members[key]
+		if !ok {
+			m = &Member{}
+			b.Members[key] = m
+		}
+		m.Name = name
+
+		if m.LastSession != b.Sessions {
+			if m.LastSession == b.Sessions-1 && m.Sessions > 0 {
+				m.Streak++
+			} else {
+				m.Streak = 1
+			}
+			m.BestStreak = max(m.BestStreak, m.Streak)
+			m.LastSession = b.Sessions
+			m.Sessions++
+			if n := crossed(streakMilestones, m.Streak-1, m.Streak); n > 0 {
+				milestones = append(milestones, fmt.Sprintf("%s made %d sessions in a row", name, n))
+			}
+		}
+
+		before := int(m.WatchSeconds / 3600)
+		m.WatchSeconds += d.Seconds()
+		if n := crossed(hourMilestones, before, int(m.WatchSeconds/3600)); n > 0 {
+			milestones = append(milestones, fmt.Sprintf("%s hit %d hours", name, n))
+		}
+	}
+	return milestones, s.save()
+}
+
+// Standings returns a room's members ranked by watch time.
+func (s *Store) Standings(roomCode string) []Member {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.boards[roomCode]
+	if !ok {
+		return []Member{}
+	}
+	members := make([]Member, 0, len(b.Members))
+	for _, m := range b.Members {
+		members = append(members, *m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].WatchSeconds > members[j].WatchSeconds
+	})
+	return members
+}
+
+// Rename moves a room's standings to a new room code.
+func (s *Store) Rename(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.boards[from]
+	if !ok {
+		return nil
+	}
+	delete(s.boards, from)
+	s.boards[to] = b
+	return s.save()
+}
+
+func (s *Store) board(roomCode string) *Board {
+	b, ok := s.boards[roomCode]
+	if !ok {
+		b = &Board{Members: make(map[string]*Member)}
+		s.boards[roomCode] = b
+	}
+	return b
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.boards, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
+
+// crossed returns the highest mark passed going from before to after, or 0.
+func crossed(marks []int, before, after int) int {
+	n := 0
+	for _, m := range marks {
+		if before < m && after >= m {
+			n = m
+		}
+	}
+	return n
+}
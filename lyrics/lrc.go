@@ -0,0 +1,57 @@
+package lyrics
+
+import (
+	"bufio"
+	"coopcinema/models"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var timeTag = regexp.MustCompile(`\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+
+// Parse reads an LRC file and returns its cues sorted by start time.
+// Metadata tags such as [ar:] or [ti:] are ignored; a line carrying
+// several time tags produces one cue per tag.
+func Parse(r io.Reader) ([]models.LyricCue, error) {
+	var cues []models.LyricCue
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		tags := timeTag.FindAllStringSubmatchIndex(line, -1)
+		if len(tags) == 0 {
+			continue
+		}
+
+		text := strings.TrimSpace(line[tags[len(tags)-1][1]:])
+		for _, t := range tags {
+			min, _ := strconv.Atoi(line[t[2]:t[3]])
+			sec, _ := strconv.Atoi(line[t[4]:t[5]])
+			at := float64(min*60 + sec)
+			if t[6] != -1 {
+				frac := line[t[6]:t[7]]
+				n, _ := strconv.Atoi(frac)
+				div := 1.0
+				for range frac {
+					div *= 10
+				}
+				at += float64(n) / div
+			}
+			cues = append(cues, models.LyricCue{Time: at, Text: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Time < cues[j].Time })
+	return cues, nil
+}
+
+// ActiveIndex returns the index of the cue playing at the given position,
+// or -1 if playback is before the first cue.
+func ActiveIndex(cues []models.LyricCue, position float64) int {
+	return sort.Search(len(cues), func(i int) bool { return cues[i].Time > position }) - 1
+}
@@ -1,37 +1,845 @@
 package main
 
 import (
+	"context"
+	"coopcinema/accounts"
+	"coopcinema/archive"
+	"coopcinema/bans"
+	"coopcinema/blobstore"
+	"coopcinema/canary"
+	"coopcinema/commands"
 	"coopcinema/config"
+	"coopcinema/eventlog"
+	"coopcinema/feedback"
+	"coopcinema/feeds"
 	"coopcinema/games"
+	"coopcinema/geoip"
 	"coopcinema/handlers"
 	"coopcinema/hub"
+	"coopcinema/jwt"
+	"coopcinema/leaderboard"
+	"coopcinema/mediastore"
+	"coopcinema/memstore"
+	"coopcinema/metrics"
+	"coopcinema/models"
+	"coopcinema/oauth"
+	"coopcinema/plugin"
+	"coopcinema/retention"
+	"coopcinema/roomstore"
+	"coopcinema/scripting"
+	"coopcinema/tenant"
+	"coopcinema/transcode"
+	"crypto/tls"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	_ "time/tzdata" // schedules' time zones, where the image has no zone database
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+// Recent ban lookups that passed the bloom filter are cached this deep.
+const banCacheSize = 4096
+
 func main() {
-	cfg := config.Load()
+	simulatePath := flag.String("simulate", "", "replay an event log offline and report predicted drift, then exit")
+	thresholds := flag.String("thresholds", "0.25,0.5,1", "comma-separated drift thresholds (seconds) to simulate")
+	intervals := flag.String("intervals", "0s,5s,15s", "comma-separated correction intervals to simulate")
+	replayPath := flag.String("replay", "", "replay a wiretap recording against a running server, then exit")
+	replayServer := flag.String("replay-server", "ws://127.0.0.1:8080/ws", "WebSocket endpoint to replay against")
+	replaySpeed := flag.Float64("replay-speed", 1, "replay this many times faster than recorded")
+	watchRoom := flag.String("watch", "", "join this room and keep a local mpv in sync with it, then exit when mpv quits")
+	watchServer := flag.String("watch-server", "ws://127.0.0.1:8080/ws", "WebSocket endpoint of the server to watch on")
+	watchName := flag.String("watch-name", "mpv", "name to join the room as")
+	mpvPath := flag.String("mpv", "mpv", "mpv binary to launch for -watch")
+	mpvSocket := flag.String("mpv-socket", "", "attach to an mpv already listening on this IPC socket instead of launching one")
+	layers := config.Flags(flag.CommandLine)
+	flag.Parse()
+
+	if *simulatePath != "" {
+		if err := runSimulation(*simulatePath, *thresholds, *intervals); err != nil {
+			log.Fatal("simulate: ", err)
+		}
+		return
+	}
+	if *replayPath != "" {
+		if err := runReplay(*replayPath, *replayServer, *replaySpeed); err != nil {
+			log.Fatal("replay: ", err)
+		}
+		return
+	}
+	if *watchRoom != "" {
+		if err := runWatch(*watchServer, *watchRoom, *watchName, *mpvPath, *mpvSocket); err != nil {
+			log.Fatal("watch: ", err)
+		}
+		return
+	}
+
+	cfg, err := layers.Load()
+	if err != nil {
+		log.Fatal("config: ", err)
+	}
+	if layers.PrintOnly() {
+		if err := cfg.Write(os.Stdout); err != nil {
+			log.Fatal("config: ", err)
+		}
+		return
+	}
+	if err := cfg.KeepClaimSecret(); err != nil {
+		log.Fatal("claim secret: ", err)
+	}
+	handlers.Configure(cfg)
+
+	store, err := blobstore.New(cfg.BlobDir)
+	if err != nil {
+		log.Fatal("blob store: ", err)
+	}
+
+	media, err := mediastore.New(cfg.MediaDir)
+	if err != nil {
+		log.Fatal("media store: ", err)
+	}
+
+	accountStore, err := accounts.Open(cfg.AccountsFile)
+	if err != nil {
+		log.Fatal("accounts: ", err)
+	}
+
+	prefStore, err := accounts.OpenPreferences(cfg.PreferencesFile)
+	if err != nil {
+		log.Fatal("preferences: ", err)
+	}
+
+	// WS_AUTH=jwt: /ws trusts only signed tokens, HS256 with JWT_SECRET or
+	// RS256 with JWT_PUBLIC_KEY / JWT_PRIVATE_KEY
+	var wsKeys *jwt.Keys
+	if cfg.WSAuth == "jwt" {
+		if len(cfg.JWTSecret) > 0 {
+			wsKeys = jwt.NewHMAC(cfg.JWTSecret)
+		} else {
+			wsKeys, err = jwt.LoadRSA(cfg.JWTPublicKey, cfg.JWTPrivateKey)
+			if err != nil {
+				log.Fatal("jwt: ", err)
+			}
+		}
+		log.Printf("🔐 WebSocket connections need a signed token")
+	}
+	if cfg.AllowAnyOrigin {
+		log.Printf("⚠️  Any website may open WebSockets to this server (ALLOW_ANY_ORIGIN)")
+	}
+
+	var providers []*oauth.Provider
+	if cfg.OAuthFile != "" {
+		providers, err = oauth.Load(cfg.OAuthFile)
+		if err != nil {
+			log.Fatal("oauth: ", err)
+		}
+		log.Printf("🔑 Sign-in with %d OAuth provider(s) from %s", len(providers), cfg.OAuthFile)
+	}
+
+	var feedbackStore *feedback.Store
+	if cfg.FeedbackFile != "" {
+		feedbackStore, err = feedback.Open(cfg.FeedbackFile)
+		if err != nil {
+			log.Fatal("feedback: ", err)
+		}
+	}
+
+	board, err := leaderboard.Open(cfg.LeaderboardFile)
+	if err != nil {
+		log.Fatal("leaderboard: ", err)
+	}
+
+	// Bans and rooms can share one snapshot file instead of a file or
+	// database each
+	var mem *memstore.Store
+	if cfg.BansStore == "memory" || cfg.RoomStore == "memory" {
+		mem, err = memstore.Open(cfg.MemoryStoreFile)
+		if err != nil {
+			log.Fatal("memory store: ", err)
+		}
+		go mem.Run(cfg.MemorySnapshot)
+	}
+
+	var banList *bans.List
+	if cfg.BansFile != "" || cfg.BansStore == "memory" {
+		var banStore bans.Store
+		if cfg.BansStore == "memory" {
+			if banStore, err = bans.NewMemoryStore(mem); err != nil {
+				log.Fatal("bans: ", err)
+			}
+		} else if banStore, err = bans.NewFileStore(cfg.BansFile); err != nil {
+			log.Fatal("bans: ", err)
+		}
+		banList, err = bans.Load(banStore, banCacheSize)
+		if err != nil {
+			log.Fatal("bans: ", err)
+		}
+		log.Printf("🚫 Ban list loaded (%s store)", cfg.BansStore)
+	}
+
+	archiver, err := archive.New(store, cfg.ArchiveIndex, cfg.ArchiveRetention)
+	if err != nil {
+		log.Fatal("archive: ", err)
+	}
+
+	// Rooms, and the tenants kept beside them, survive restarts in the room
+	// store
+	var rooms roomstore.Store
+	if cfg.RoomStore == "memory" {
+		rooms = roomstore.NewMemoryStore(mem)
+	} else if cfg.RoomStore != "" {
+		if rooms, err = roomstore.Open(cfg.RoomStore, cfg.RoomStoreDSN); err != nil {
+			log.Fatal("room store: ", err)
+		}
+	}
+
+	// Tenants are changed through the admin API; TENANTS_FILE, if set, is
+	// put into the store at startup
+	var saver tenant.Saver
+	if rooms != nil {
+		saver = rooms
+	}
+	tenants, err := tenant.Open(saver)
+	if err != nil {
+		log.Fatal("tenants: ", err)
+	}
+	if cfg.TenantsFile != "" {
+		n, err := tenants.Import(cfg.TenantsFile)
+		if err != nil {
+			log.Fatal("tenants: ", err)
+		}
+		log.Printf("🏘️  %d tenants imported from %s", n, cfg.TenantsFile)
+	}
+
+	policy, err := retentionPolicy(cfg.RetentionRules, tenants)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pruning := &retention.Job{Policy: policy}
 
 	h := hub.NewHub()
-	go h.Run()
+	h.Leaderboard = board
+	h.Configure(hubSettings(cfg))
+	h.YouTubeAPIKey = cfg.YouTubeAPIKey
+	if feedbackStore != nil {
+		h.FeedbackToken = handlers.FeedbackToken
+	}
+	if cfg.GeoIPDB != "" {
+		db, err := geoip.Open(cfg.GeoIPDB)
+		if err != nil {
+			log.Fatal("geoip: ", err)
+		}
+		h.GeoIP = db
+		log.Printf("🌍 GeoIP countries loaded from %s", cfg.GeoIPDB)
+	}
+	if cfg.EventLogPath != "" {
+		w, err := eventlog.Open(cfg.EventLogPath)
+		if err != nil {
+			log.Fatal("event log: ", err)
+		}
+		defer w.Close()
+		h.EventLog = w
+		pruning.Add(w)
+		log.Printf("📝 Recording inbound messages to %s", cfg.EventLogPath)
+	}
+	var transcoder *transcode.Pool
+	if cfg.FFmpegPath != "" {
+		transcoder = transcode.NewPool(cfg.FFmpegPath, cfg.TranscodeWorkers, func(j transcode.Job) {
+			h.BroadcastRoom(j.Room, models.Message{Type: "mediaProgress", URL: j.Source, Content: j.Name, Timestamp: j.Progress})
+		}, func(j transcode.Job) {
+			if j.Status == transcode.Done {
+				h.BroadcastRoom(j.Room, models.Message{Type: "mediaReady", URL: j.Playlist, Content: j.Name})
+				return
+			}
+			log.Printf("transcode %s in room %s: %s", j.ID, j.Room, j.Error)
+			h.BroadcastRoom(j.Room, models.Message{Type: "mediaFailed", URL: j.Source, Content: j.Name})
+		})
+		log.Printf("🎞️ Transcoding .mkv/.mov uploads to HLS with %s (%d at a time)", cfg.FFmpegPath, cfg.TranscodeWorkers)
+	}
+
+	// Shutdown waits for archives still being written
+	var archiving sync.WaitGroup
+	h.AddHooks(hub.Hooks{
+		RoomClosed: func(room *models.Room) {
+			archiving.Add(1)
+			go func() {
+				defer archiving.Done()
+				if err := archiver.Archive(room); err != nil {
+					log.Printf("archive room %s: %v", room.Code, err)
+				}
+				// The room lets go of its custom reaction images and
+				// subtitles, which other rooms may share, and uploaded
+				// videos go with it
+				for _, key := range room.Emotes {
+					store.Release(key)
+				}
+				if room.Subtitles != nil {
+					store.Release(room.Subtitles.Key)
+				}
+				if transcoder != nil {
+					transcoder.CancelRoom(room.Code)
+				}
+				if err := media.DeleteRoom(room.Code); err != nil {
+					log.Printf("delete media for room %s: %v", room.Code, err)
+				}
+			}()
+		},
+	})
+	go archiver.RunRetention(time.Hour)
+
+	pruning.Add(h.TimelinePruner())
+	pruning.Add(h.ChatPruner())
+	go pruning.Run(cfg.PruneInterval)
+
+	commands.Install(h)
+	plugin.Install(h, http.DefaultServeMux)
+
+	if cfg.ScriptsDir != "" {
+		engine, err := scripting.Load(h, cfg.ScriptsDir, cfg.ScriptTimeout, cfg.ScriptMemory)
+		if err != nil {
+			log.Fatal("scripts: ", err)
+		}
+		engine.Install()
+	}
+
+	// Rooms come back once every lifecycle hook is in place
+	if rooms != nil {
+		saved, err := rooms.Load()
+		if err != nil {
+			log.Fatal("room store: ", err)
+		}
+		h.Restore(saved)
+		go roomstore.Run(rooms, h.Snapshot, cfg.RoomSnapshot)
+	}
+
+	go h.RunScheduler(cfg.ScheduleTick, cfg.ReminderLead)
+	go h.RunViewingSampler(cfg.ViewingSample)
+	go h.RunAttention(cfg.AttentionEvery)
+	if cfg.RoomIdleTimeout > 0 || cfg.RoomTTL > 0 {
+		go h.RunJanitor(time.Minute, cfg.RoomIdleTimeout, cfg.RoomTTL)
+	}
+	if cfg.MediaCheckEvery > 0 {
+		go h.RunMediaCheck(cfg.MediaCheckEvery)
+	}
+	go metrics.RunTrends(10*time.Second, h.Gauges)
+	if cfg.PushgatewayURL != "" {
+		go metrics.RunPush(cfg.PushgatewayURL, cfg.PushgatewayEvery, h.Gauges, cfg.ScalingCapacity)
+		log.Printf("📤 Pushing metrics to %s every %s", cfg.PushgatewayURL, cfg.PushgatewayEvery)
+	}
 
-	fs := http.FileServer(http.Dir("./public"))
-	http.Handle("/", fs)
+	if err := watchFeeds(h, tenants, cfg.FeedsState); err != nil {
+		log.Fatal("feeds: ", err)
+	}
+
+	probe := &canary.Canary{
+		WSURL:    loopbackWS(cfg.ServerAddr),
+		Timeout:  5 * time.Second,
+		AlertURL: cfg.CanaryAlertURL,
+		SlowStep: cfg.CanarySlow,
+	}
+	if wsKeys != nil {
+		probe.Token = func(userID, name string) (string, error) {
+			return wsKeys.Sign(jwt.Claims{Subject: userID, Name: name, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+		}
+	}
+	if cfg.CanaryInterval > 0 {
+		go probe.Run(cfg.CanaryInterval)
+		log.Printf("🐤 Canary probing %s every %s", probe.WSURL, cfg.CanaryInterval)
+	}
+
+	http.Handle("/", handlers.Frontend(frontend(cfg.PublicDir)))
 
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		handlers.ServeWs(h, w, r)
+		handlers.ServeWs(h, banList, prefStore, wsKeys, w, r)
+	})
+
+	http.HandleFunc("/generate-room", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeGenerateRoom(h, w, r)
+	})
+
+	http.HandleFunc("/lyrics", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeLyrics(h, w, r)
+	})
+
+	http.HandleFunc("/highlights", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeHighlights(h, w, r)
 	})
 
-	http.HandleFunc("/generate-room", handlers.ServeGenerateRoom)
+	http.HandleFunc("/schedule", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeSchedule(h, w, r)
+	})
+
+	http.HandleFunc("/guest-pass", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeGuestPass(h, w, r)
+	})
+
+	http.HandleFunc("GET /api/rooms/{code}/emotes", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeEmotes(h, w, r)
+	})
+	http.HandleFunc("POST /api/rooms/{code}/emotes", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeUploadEmote(h, store, w, r)
+	})
+	http.HandleFunc("DELETE /api/rooms/{code}/emotes/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeDeleteEmote(h, store, w, r)
+	})
+	http.HandleFunc("GET /api/rooms/{code}/reactions", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeReactionSummary(h, w, r)
+	})
+	http.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeStats(h, w, r)
+	})
+	http.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeMetrics(h, w, r)
+	})
+	http.HandleFunc("GET /api/scaling", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeScaling(h, w, r)
+	})
+	http.HandleFunc("GET /api/protocol/messages", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeProtocol(h, w, r)
+	})
+	http.HandleFunc("GET /api/v1/branding", handlers.ServeBranding)
+	http.HandleFunc("GET /api/v1/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeCapabilities(h, w, r)
+	})
+	http.HandleFunc("GET /api/rooms/{code}/timeline", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeTimeline(h, w, r)
+	})
+	http.HandleFunc("POST /api/rooms/{code}/messages", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeInjectMessage(h, w, r)
+	})
+	http.HandleFunc("GET /api/rooms/{code}/tokens", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeTokens(h, w, r)
+	})
+	http.HandleFunc("POST /api/rooms/{code}/tokens", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeMintToken(h, w, r)
+	})
+	http.HandleFunc("DELETE /api/rooms/{code}/tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeRevokeToken(h, w, r)
+	})
+	http.HandleFunc("GET /api/rooms/{code}/observe", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeObserve(h, w, r)
+	})
+	http.HandleFunc("GET /overlay/{code}", handlers.ServeOverlay)
+	http.HandleFunc("GET /api/rooms/{code}/leaderboard", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeLeaderboard(h, w, r)
+	})
+	http.HandleFunc("POST /api/account/claim", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeClaim(h, accountStore, w, r)
+	})
+	http.HandleFunc("GET /api/account", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeAccount(accountStore, w, r)
+	})
+	http.HandleFunc("GET /auth/providers", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeAuthProviders(providers, w, r)
+	})
+	http.HandleFunc("GET /auth/login", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeLogin(providers, w, r)
+	})
+	http.HandleFunc("GET /auth/callback", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeCallback(providers, w, r)
+	})
+	http.HandleFunc("POST /auth/logout", handlers.ServeLogout)
+	http.HandleFunc("GET /auth/me", handlers.ServeMe)
+	http.HandleFunc("POST /api/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeToken(wsKeys, w, r)
+	})
+	http.HandleFunc("POST /api/v1/rooms", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeCreateRoom(h, w, r)
+	})
+	http.HandleFunc("GET /api/v1/rooms", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeOwnedRooms(h, w, r)
+	})
+	http.HandleFunc("GET /api/v1/rooms/{code}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeRoomInfo(h, w, r)
+	})
+	http.HandleFunc("POST /api/v1/rooms/{code}/invites", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeCreateInvite(h, w, r)
+	})
+	http.HandleFunc("GET /api/v1/rooms/{code}/qr", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeRoomQR(h, w, r)
+	})
+	http.HandleFunc("GET /api/v1/rooms/{code}/subtitles", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeSubtitles(h, w, r)
+	})
+	http.HandleFunc("POST /api/v1/rooms/{code}/subtitles", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeUploadSubtitles(h, store, w, r)
+	})
+	http.HandleFunc("DELETE /api/v1/rooms/{code}/subtitles", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeDeleteSubtitles(h, store, w, r)
+	})
+	http.HandleFunc("POST /api/v1/rooms/{code}/media", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeUploadMedia(h, media, transcoder, w, r)
+	})
+	http.HandleFunc("GET /api/v1/rooms/{code}/media/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeTranscodeJob(h, transcoder, w, r)
+	})
+	http.HandleFunc("GET /media/{code}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeMedia(h, media, w, r)
+	})
+	http.HandleFunc("GET /media/{code}/{id}/hls/{file}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeMediaStream(h, media, w, r)
+	})
+	http.HandleFunc("DELETE /api/v1/rooms/{code}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeDeleteRoom(h, w, r)
+	})
+	http.HandleFunc("GET /api/me/preferences", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeGetPreferences(prefStore, w, r)
+	})
+	http.HandleFunc("PUT /api/me/preferences", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServePutPreferences(prefStore, w, r)
+	})
+	http.HandleFunc("POST /api/feedback", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeFeedback(feedbackStore, w, r)
+	})
+	http.HandleFunc("GET /api/admin/archives", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeArchives(archiver, w, r)
+	})
+	http.HandleFunc("GET /api/admin/archives/{key}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeArchive(archiver, store, w, r)
+	})
+	http.HandleFunc("GET /api/admin/retention", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeRetentionReport(pruning, w, r)
+	})
+	http.HandleFunc("GET /api/admin/rooms/{code}/config", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeExportRoom(h, store, w, r)
+	})
+	http.HandleFunc("PUT /api/admin/rooms/{code}/config", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeImportRoom(h, store, w, r)
+	})
+	http.HandleFunc("GET /api/admin/rooms", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeAdminRooms(h, w, r)
+	})
+	http.HandleFunc("POST /api/admin/rooms/{code}/resync", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeResyncRoom(h, w, r)
+	})
+	http.HandleFunc("DELETE /api/admin/rooms/{code}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeCloseRoom(h, w, r)
+	})
+	http.HandleFunc("POST /api/admin/announce", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeAnnounce(h, w, r)
+	})
+	http.HandleFunc("POST /api/admin/bans", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeBan(banList, w, r)
+	})
+	http.HandleFunc("GET /api/admin/tenants", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeTenants(tenants, w, r)
+	})
+	http.HandleFunc("PUT /api/admin/tenants/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServePutTenant(tenants, w, r)
+	})
+	http.HandleFunc("DELETE /api/admin/tenants/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeDeleteTenant(tenants, w, r)
+	})
+	http.HandleFunc("GET /api/admin/canary", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeCanary(probe, w, r)
+	})
+	http.HandleFunc("GET /api/admin/drops", handlers.ServeDrops)
+	http.HandleFunc("GET /api/admin/feedback", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeFeedbackSummary(feedbackStore, w, r)
+	})
+	http.HandleFunc("POST /api/admin/wiretap", handlers.ServeWiretap)
+	http.HandleFunc("GET /api/admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeMaintenance(h, w, r)
+	})
+	http.HandleFunc("PUT /api/admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeMaintenance(h, w, r)
+	})
+	http.HandleFunc("GET /blobs/{key}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeBlob(store, w, r)
+	})
 
 	if cfg.GamesEnabled {
 		games.Register()
 	}
 
-	log.Printf("🎬 Co-op Video Theater starting on %s", cfg.ServerAddr)
-	log.Printf("📂 Serving static files from ./public")
+	handler := tenant.Middleware(tenants, http.DefaultServeMux)
+
+	log.Printf("🎬 Co-op Video Theater starting on %s (%s)", cfg.ServerAddr, cfg.ListenNetwork)
+	if cfg.PublicDir != "" {
+		log.Printf("📂 Serving static files from %s", cfg.PublicDir)
+	} else {
+		log.Printf("📂 Serving the built-in static files")
+	}
+
+	var servers []*http.Server
+	switch {
+	case cfg.TLSCert != "" || cfg.TLSKey != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			log.Fatal("tls: ", err)
+		}
+		servers = append(servers, serve(&http.Server{Handler: redirectHTTPS(cfg.TLSAddr, handler)}, cfg.ListenNetwork, cfg.ServerAddr, false))
+
+		log.Printf("🔒 Serving TLS with %s on %s", cfg.TLSCert, cfg.TLSAddr)
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+		servers = append(servers, serve(&http.Server{Handler: handler, TLSConfig: tlsConfig}, cfg.ListenNetwork, cfg.TLSAddr, true))
+
+	case cfg.AutocertDir != "":
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cfg.AutocertDir),
+			HostPolicy: hostPolicy(cfg.AutocertDomains, tenants),
+			Email:      cfg.AutocertEmail,
+		}
+		servers = append(servers, serve(&http.Server{Handler: m.HTTPHandler(redirectHTTPS(cfg.TLSAddr, handler))}, cfg.ListenNetwork, cfg.ServerAddr, false))
+
+		if len(cfg.AutocertDomains) > 0 {
+			log.Printf("🔒 Serving TLS for %s on %s", strings.Join(cfg.AutocertDomains, ", "), cfg.TLSAddr)
+		} else {
+			log.Printf("🔒 Serving TLS for tenant hostnames on %s", cfg.TLSAddr)
+		}
+		servers = append(servers, serve(&http.Server{Handler: handler, TLSConfig: m.TLSConfig()}, cfg.ListenNetwork, cfg.TLSAddr, true))
+
+	default:
+		servers = append(servers, serve(&http.Server{Handler: handler}, cfg.ListenNetwork, cfg.ServerAddr, false))
+	}
+
+	go reloadOnHangup(layers, cfg, h)
+
+	if cfg.GRPCAddr != "" {
+		grpcServer := &http.Server{Handler: h2c.NewHandler(handlers.GRPC(h), &http2.Server{})}
+		servers = append(servers, serve(grpcServer, cfg.ListenNetwork, cfg.GRPCAddr, false))
+		log.Printf("🔌 gRPC API on %s", cfg.GRPCAddr)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	log.Printf("🛑 %s: draining connections (up to %s)", sig, cfg.DrainTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	defer cancel()
+	shutdown(ctx, h, cfg.ReconnectHint, servers, rooms, mem, &archiving)
+	if transcoder != nil {
+		transcoder.Stop()
+	}
+	log.Printf("👋 Stopped")
+}
+
+// hubSettings are the hub's share of cfg, the part a reload can change.
+func hubSettings(cfg *config.Config) hub.Settings {
+	return hub.Settings{
+		AttentionDetail: cfg.AttentionDetail,
+		ChatHistory:     cfg.ChatHistory,
+		ResumeGrace:     cfg.ResumeGrace,
+		MediaAllowlist:  cfg.MediaAllowlist,
+		RelayRate:       cfg.RelayRate,
+		RelayMax:        cfg.RelayMax,
+	}
+}
+
+// reloadOnHangup reloads the settings on every SIGHUP and applies those that
+// can change while rooms are open, leaving connections as they are. A
+// config that doesn't load is logged and the running settings kept.
+func reloadOnHangup(layers *config.Layers, started *config.Config, h *hub.Hub) {
+	cfg := started
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		next, err := layers.Load()
+		if err != nil {
+			log.Printf("⚠️  Config not reloaded: %v", err)
+			continue
+		}
+		applied, _ := cfg.Changed(next)
+		_, restart := started.Changed(next)
+		h.Configure(hubSettings(next))
+		handlers.Reload(next)
+		cfg = next
+		if len(applied) == 0 {
+			log.Printf("🔄 Config reloaded, nothing to apply")
+		} else {
+			log.Printf("🔄 Config reloaded: %s", strings.Join(applied, ", "))
+		}
+		if len(restart) > 0 {
+			log.Printf("⚠️  Restart to apply %s", strings.Join(restart, ", "))
+		}
+	}
+}
+
+// serve starts srv on a new listener and returns it. The process exits if
+// it stops for any reason other than Shutdown.
+func serve(srv *http.Server, network, addr string, tls bool) *http.Server {
+	l := listen(network, addr)
+	go func() {
+		var err error
+		if tls {
+			err = srv.ServeTLS(l, "", "")
+		} else {
+			err = srv.Serve(l)
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal("Serve: ", err)
+		}
+	}()
+	return srv
+}
+
+// shutdown stops taking connections, tells everyone connected the server is
+// restarting and lets them go, then saves the rooms for the next start or,
+// with no room store, archives them, and writes out the memory store.
+// Whatever hasn't finished when ctx is done is abandoned.
+func shutdown(ctx context.Context, h *hub.Hub, reconnect time.Duration, servers []*http.Server, rooms roomstore.Store, mem *memstore.Store, archiving *sync.WaitGroup) {
+	// Shutdown closes the listeners right away, then waits for requests in
+	// flight; WebSockets are hijacked, so the hub lets those go
+	stopped := make(chan struct{})
+	go func() {
+		for _, srv := range servers {
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Printf("shutdown: %v", err)
+			}
+		}
+		close(stopped)
+	}()
+
+	if err := h.Shutdown(ctx, reconnect); err != nil {
+		log.Printf("shutdown: clients still connected: %v", err)
+	}
+	<-stopped
+
+	if rooms != nil {
+		if err := rooms.Save(h.Snapshot()); err != nil {
+			log.Printf("shutdown: save rooms: %v", err)
+		}
+	} else {
+		h.CloseRooms()
+	}
+	if mem != nil {
+		if err := mem.Snapshot(); err != nil {
+			log.Printf("shutdown: memory store: %v", err)
+		}
+	}
+
+	archived := make(chan struct{})
+	go func() {
+		archiving.Wait()
+		close(archived)
+	}()
+	select {
+	case <-archived:
+	case <-ctx.Done():
+		log.Printf("shutdown: archives still being written: %v", ctx.Err())
+	}
+}
+
+// hostPolicy lets autocert issue certificates for the listed domains and
+// for tenants' registered hostnames.
+func hostPolicy(domains []string, tenants *tenant.Store) autocert.HostPolicy {
+	whitelist := autocert.HostWhitelist(domains...)
+	return func(ctx context.Context, host string) error {
+		if err := whitelist(ctx, host); err == nil {
+			return nil
+		}
+		return tenants.HostPolicy(ctx, host)
+	}
+}
+
+// redirectHTTPS sends plain HTTP requests to the same URL on the TLS
+// listener. Requests from this machine are served as they are, so the canary
+// and local health checks don't need certificates.
+func redirectHTTPS(tlsAddr string, next http.Handler) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			if addr := net.ParseIP(ip); addr != nil && addr.IsLoopback() {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// listen opens addr on the configured address family.
+func listen(network, addr string) net.Listener {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		log.Fatal("listen: ", err)
+	}
+	return l
+}
+
+// watchFeeds starts polling every tenant's feeds, announcing new entries in
+// the tenant's chosen room while it is open.
+func watchFeeds(h *hub.Hub, tenants *tenant.Store, statePath string) error {
+	poller, err := feeds.NewPoller(statePath, func(roomCode string, item feeds.Item) bool {
+		text := "New: " + item.Title
+		if item.Link != "" {
+			text += " " + item.Link
+		}
+		return h.Announce(roomCode, "📰 Feed", text+". Schedule a party?")
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tenants.All() {
+		for _, f := range t.Feeds {
+			var every time.Duration
+			if f.Every != "" {
+				if every, err = time.ParseDuration(f.Every); err != nil {
+					return fmt.Errorf("tenant %s feed %s: %w", t.ID, f.URL, err)
+				}
+			}
+			go poller.Watch(feeds.Source{URL: f.URL, RoomCode: tenant.Code(t.ID, f.Room), Every: every})
+			log.Printf("📰 Watching %s for tenant %s room %s", f.URL, t.ID, f.Room)
+		}
+	}
+	return nil
+}
+
+// loopbackWS is the /ws URL the canary dials to reach this server.
+func loopbackWS(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "ws://" + addr + "/ws"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "ws://" + net.JoinHostPort(host, port) + "/ws"
+}
+
+// retentionPolicy combines the instance-wide rules with each tenant's
+// overrides.
+func retentionPolicy(rules string, tenants *tenant.Store) (retention.Policy, error) {
+	policy := retention.Policy{Tenants: make(map[string]map[retention.Class]time.Duration)}
+
+	def, err := retention.ParseRules(rules)
+	if err != nil {
+		return policy, err
+	}
+	policy.Default = def
 
-	if err := http.ListenAndServe(cfg.ServerAddr, nil); err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	for _, t := range tenants.All() {
+		var parts []string
+		for class, d := range t.Retention {
+			parts = append(parts, class+"="+d)
+		}
+		overrides, err := retention.ParseRules(strings.Join(parts, ","))
+		if err != nil {
+			return policy, fmt.Errorf("tenant %s: %w", t.ID, err)
+		}
+		policy.Tenants[t.ID] = overrides
 	}
+	return policy, nil
 }
@@ -0,0 +1,111 @@
+// Package mediastore keeps videos members upload to a room on disk, one
+// directory per room, until the room closes.
+package mediastore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNotFound = errors.New("media not found")
+	ErrTooLarge = errors.New("media is too large")
+)
+
+// Store keeps uploaded videos under a directory on disk.
+type Store struct {
+	dir string
+}
+
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Create copies r into a new file for room and returns its ID: random, so
+// the URL it is served at can't be guessed, plus ext. The file only
+// appears once it has been copied whole; past limit bytes it is dropped
+// with ErrTooLarge.
+func (s *Store) Create(room, ext string, r io.Reader, limit int64) (id string, size int64, err error) {
+	dir := s.roomDir(room)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	id = hex.EncodeToString(b) + ext
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err = io.Copy(tmp, io.LimitReader(r, limit+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size > limit {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, id)); err != nil {
+		return "", 0, err
+	}
+	return id, size, nil
+}
+
+// Path returns the file path of a room's video, rejecting anything that is
+// not a plain file name in the room's directory.
+func (s *Store) Path(room, id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", ErrNotFound
+	}
+	return regular(filepath.Join(s.roomDir(room), id))
+}
+
+// StreamDir returns the directory for the HLS rendition of a room's video.
+func (s *Store) StreamDir(room, id string) string {
+	return filepath.Join(s.roomDir(room), strings.TrimSuffix(id, filepath.Ext(id))+".hls")
+}
+
+// StreamPath returns the path of a playlist or segment, name, in the HLS
+// rendition of a room's video.
+func (s *Store) StreamPath(room, id, name string) (string, error) {
+	for _, part := range []string{id, name} {
+		if part == "" || strings.ContainsAny(part, `/\`) || strings.HasPrefix(part, ".") {
+			return "", ErrNotFound
+		}
+	}
+	return regular(filepath.Join(s.StreamDir(room, id), name))
+}
+
+// regular returns path if it names a regular file, so a directory is never
+// served as a listing.
+func regular(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// DeleteRoom removes every video uploaded to a room.
+func (s *Store) DeleteRoom(room string) error {
+	return os.RemoveAll(s.roomDir(room))
+}
+
+// roomDir names a room's directory by its hex-encoded code, since scoped
+// codes carry a tenant prefix that isn't safe in every file system.
+func (s *Store) roomDir(room string) string {
+	return filepath.Join(s.dir, hex.EncodeToString([]byte(room)))
+}
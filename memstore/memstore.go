@@ -0,0 +1,103 @@
+// Package memstore keeps state in memory and snapshots it to a single JSON
+// file, for small deployments that would rather not run a database. Each
+// user of the store owns a named section of it; what changed since the last
+// snapshot is lost if the process dies.
+package memstore
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Store holds each section as the JSON it will be snapshotted as, so what
+// callers put in can't change underneath it.
+type Store struct {
+	path string
+
+	mu       sync.Mutex
+	sections map[string]json.RawMessage
+	dirty    bool
+}
+
+// Open restores the snapshot at path, if there is one.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, sections: make(map[string]json.RawMessage)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.sections); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get decodes section into v. It reports false, leaving v alone, if the
+// section was never put.
+func (s *Store) Get(section string, v any) (bool, error) {
+	s.mu.Lock()
+	data, ok := s.sections[section]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// Put replaces section with v, to be written out with the next snapshot.
+func (s *Store) Put(section string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sections[section] = data
+	s.dirty = true
+	return nil
+}
+
+// Snapshot writes every section to the file if anything changed since the
+// last one. The file is replaced whole, so a crash mid-write leaves the
+// previous snapshot.
+func (s *Store) Snapshot() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(s.sections, "", "  ")
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err == nil {
+		tmp := s.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Run snapshots every interval, forever.
+func (s *Store) Run(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.Snapshot(); err != nil {
+			log.Printf("memstore: snapshot: %v", err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package metrics keeps process-wide counters about rooms and viewing.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	mu             sync.Mutex
+	partiesHosted  int64
+	viewingSeconds float64
+	startedAt      = time.Now()
+
+	drops      = make(map[string]int64)
+	broadcasts = make(map[string]int64) // by message type
+
+	// Bumped on every frame, so kept off mu
+	joins, leaves   atomic.Int64
+	framesIn        atomic.Int64
+	framesOut       atomic.Int64
+	bytesIn         atomic.Int64
+	bytesOut        atomic.Int64
+	writeFailures   atomic.Int64
+	upgradeFailures atomic.Int64
+
+	canaryRuns     int64
+	canaryFailures int64
+	canaryLatency  time.Duration
+)
+
+// RoomCreated counts a new watch party.
+func RoomCreated() {
+	mu.Lock()
+	partiesHosted++
+	mu.Unlock()
+}
+
+// AddViewing adds viewer-time, e.g. 5 viewers watching for 30s adds 150s.
+func AddViewing(d time.Duration) {
+	mu.Lock()
+	viewingSeconds += d.Seconds()
+	mu.Unlock()
+}
+
+// Reasons a client's connection was dropped or a message to it was lost.
+const (
+	DropLeft       = "left"       // the client disconnected
+	DropKicked     = "kicked"     // the host removed it
+	DropSlow       = "slow"       // its writer was behind past SLOW_CLIENT_GRACE during a fan-out
+	DropDiscard    = "discarded"  // a one-off message was refused while its writer was behind
+	DropClosed     = "closed"     // a message arrived after it was closed
+	DropRoomClosed = "roomClosed" // the host or an admin closed its room
+	DropFlooded    = "flooded"    // it kept sending past its message rate limits
+	DropShutdown   = "shutdown"   // the server was shutting down
+)
+
+// Dropped counts one drop for reason.
+func Dropped(reason string) {
+	mu.Lock()
+	drops[reason]++
+	mu.Unlock()
+}
+
+// Drops returns the drop counts by reason since start.
+func Drops() map[string]int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return copyCounts(drops)
+}
+
+// Joined and Left count clients entering and leaving rooms.
+func Joined() { joins.Add(1) }
+func Left()   { leaves.Add(1) }
+
+// FrameIn and FrameOut count WebSocket frames of n bytes read from and
+// written to clients; WriteFailed counts writes that failed and ended a
+// connection.
+func FrameIn(n int) {
+	framesIn.Add(1)
+	bytesIn.Add(int64(n))
+}
+
+func FrameOut(n int) {
+	framesOut.Add(1)
+	bytesOut.Add(int64(n))
+}
+
+func WriteFailed() { writeFailures.Add(1) }
+
+// UpgradeFailed counts requests to /ws that never became a WebSocket.
+func UpgradeFailed() { upgradeFailures.Add(1) }
+
+// Broadcast counts a message fanned out to a room, by type.
+func Broadcast(msgType string) {
+	mu.Lock()
+	broadcasts[msgType]++
+	mu.Unlock()
+}
+
+// RecordCanary counts a synthetic end-to-end probe and its latency.
+func RecordCanary(ok bool, latency time.Duration) {
+	mu.Lock()
+	canaryRuns++
+	if ok {
+		canaryLatency = latency
+	} else {
+		canaryFailures++
+	}
+	mu.Unlock()
+}
+
+// Totals are the cumulative counters since start.
+type Totals struct {
+	PartiesHosted  int64
+	HoursWatched   float64
+	Uptime         time.Duration
+	CanaryRuns     int64
+	CanaryFailures int64
+	CanaryLatency  time.Duration // of the last successful probe
+}
+
+func Snapshot() Totals {
+	mu.Lock()
+	defer mu.Unlock()
+	return Totals{
+		PartiesHosted:  partiesHosted,
+		HoursWatched:   viewingSeconds / 3600,
+		Uptime:         time.Since(startedAt),
+		CanaryRuns:     canaryRuns,
+		CanaryFailures: canaryFailures,
+		CanaryLatency:  canaryLatency,
+	}
+}
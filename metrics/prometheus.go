@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Gauges are the point-in-time values the hub reports at scrape time.
+type Gauges struct {
+	Rooms    int `json:"rooms"`
+	Clients  int `json:"clients"`
+	Watching int `json:"watching"`
+}
+
+// WritePrometheus writes every metric in the Prometheus text format, with
+// scaling hints when capacity (clients per replica) is set.
+func WritePrometheus(w io.Writer, g Gauges, capacity int) {
+	gauge(w, "coopcinema_rooms", "Open rooms.", float64(g.Rooms))
+	gauge(w, "coopcinema_clients", "Connected clients.", float64(g.Clients))
+	gauge(w, "coopcinema_watching_clients", "Clients in rooms that are playing.", float64(g.Watching))
+
+	t := Snapshot()
+	counter(w, "coopcinema_rooms_created_total", "Rooms opened since start.", float64(t.PartiesHosted))
+	counter(w, "coopcinema_viewing_seconds_total", "Viewer-seconds watched since start.", t.HoursWatched*3600)
+	counter(w, "coopcinema_joins_total", "Clients that joined a room.", float64(joins.Load()))
+	counter(w, "coopcinema_leaves_total", "Clients that left a room.", float64(leaves.Load()))
+	counter(w, "coopcinema_frames_received_total", "WebSocket frames read from clients.", float64(framesIn.Load()))
+	counter(w, "coopcinema_frames_sent_total", "WebSocket frames written to clients.", float64(framesOut.Load()))
+	counter(w, "coopcinema_received_bytes_total", "Bytes of WebSocket messages read from clients.", float64(bytesIn.Load()))
+	counter(w, "coopcinema_sent_bytes_total", "Bytes of WebSocket messages written to clients.", float64(bytesOut.Load()))
+	counter(w, "coopcinema_write_failures_total", "Writes to clients that failed and ended the connection.", float64(writeFailures.Load()))
+	counter(w, "coopcinema_upgrade_failures_total", "Requests to /ws that failed the WebSocket upgrade.", float64(upgradeFailures.Load()))
+
+	mu.Lock()
+	byType := copyCounts(broadcasts)
+	byReason := copyCounts(drops)
+	mu.Unlock()
+	labeled(w, "coopcinema_broadcasts_total", "Messages fanned out to a room, by type.", "type", byType)
+	labeled(w, "coopcinema_dropped_total", "Dropped connections and lost messages, by reason.", "reason", byReason)
+
+	counter(w, "coopcinema_canary_runs_total", "Canary probes run.", float64(t.CanaryRuns))
+	counter(w, "coopcinema_canary_failures_total", "Canary probes that failed.", float64(t.CanaryFailures))
+	gauge(w, "coopcinema_canary_latency_seconds", "Latency of the last successful canary probe.", t.CanaryLatency.Seconds())
+
+	if capacity > 0 {
+		s := ScalingSignals(g, capacity)
+		gauge(w, "coopcinema_clients_avg_5m", "Connected clients averaged over five minutes.", s.FiveMinutes.Clients)
+		gauge(w, "coopcinema_utilization", "Connected clients as a share of SCALING_CAPACITY.", s.Utilization)
+		gauge(w, "coopcinema_desired_replicas", "Replicas the recent load calls for at SCALING_CAPACITY each.", float64(s.DesiredReplicas))
+	}
+}
+
+func gauge(w io.Writer, name, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, v)
+}
+
+func counter(w io.Writer, name, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %g\n", name, help, name, name, v)
+}
+
+func labeled(w io.Writer, name, help, label string, counts map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, counts[k])
+	}
+}
+
+func copyCounts(m map[string]int64) map[string]int64 {
+	c := make(map[string]int64, len(m))
+	for k, n := range m {
+		c[k] = n
+	}
+	return c
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var pushClient = &http.Client{Timeout: 10 * time.Second}
+
+// RunPush sends every metric to a Prometheus Pushgateway every interval,
+// forever, grouped under job "coopcinema" and this host's name, for
+// deployments that can't be scraped.
+func RunPush(gateway string, every time.Duration, gauges func() Gauges, capacity int) {
+	host, _ := os.Hostname()
+	target := fmt.Sprintf("%s/metrics/job/coopcinema/instance/%s", gateway, url.PathEscape(host))
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		var body bytes.Buffer
+		WritePrometheus(&body, gauges(), capacity)
+		req, err := http.NewRequest(http.MethodPut, target, &body)
+		if err != nil {
+			log.Printf("metrics: push: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+		resp, err := pushClient.Do(req)
+		if err != nil {
+			log.Printf("metrics: push: %v", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("metrics: push: gateway answered %s", resp.Status)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// trendWindow is how far back load trends look.
+const trendWindow = 5 * time.Minute
+
+type sample struct {
+	at       time.Time
+	gauges   Gauges
+	bytesIn  int64
+	bytesOut int64
+}
+
+var (
+	trendMu sync.Mutex
+	samples []sample // oldest first, spanning trendWindow
+)
+
+// RunTrends samples load every interval, forever, for ScalingSignals.
+func RunTrends(every time.Duration, gauges func() Gauges) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s := sample{at: now, gauges: gauges(), bytesIn: bytesIn.Load(), bytesOut: bytesOut.Load()}
+		trendMu.Lock()
+		samples = append(samples, s)
+		for len(samples) > 1 && now.Sub(samples[0].at) > trendWindow {
+			samples = samples[1:]
+		}
+		trendMu.Unlock()
+	}
+}
+
+// Trend is load averaged over a window.
+type Trend struct {
+	Clients        float64 `json:"clients"`
+	Rooms          float64 `json:"rooms"`
+	BytesInPerSec  float64 `json:"bytesInPerSec"`
+	BytesOutPerSec float64 `json:"bytesOutPerSec"`
+}
+
+// Scaling is load as an autoscaler wants it: now, recent averages, and,
+// when a per-replica client capacity is configured, how full this replica
+// is and how many replicas the load calls for.
+type Scaling struct {
+	Now             Gauges  `json:"now"`
+	OneMinute       Trend   `json:"1m"`
+	FiveMinutes     Trend   `json:"5m"`
+	Capacity        int     `json:"capacity,omitempty"`
+	Utilization     float64 `json:"utilization,omitempty"`
+	DesiredReplicas int     `json:"desiredReplicas,omitempty"`
+}
+
+// ScalingSignals sizes the current load against capacity clients per
+// replica (0 for no hint). The replica hint follows the busiest of now and
+// the last one and five minutes, so it goes up quickly and down slowly.
+func ScalingSignals(now Gauges, capacity int) Scaling {
+	s := Scaling{
+		Now:         now,
+		OneMinute:   trend(time.Minute),
+		FiveMinutes: trend(trendWindow),
+		Capacity:    capacity,
+	}
+	if capacity > 0 {
+		s.Utilization = float64(now.Clients) / float64(capacity)
+		busiest := math.Max(float64(now.Clients), math.Max(s.OneMinute.Clients, s.FiveMinutes.Clients))
+		s.DesiredReplicas = max(1, int(math.Ceil(busiest/float64(capacity))))
+	}
+	return s
+}
+
+// trend averages the samples taken within window.
+func trend(window time.Duration) Trend {
+	trendMu.Lock()
+	defer trendMu.Unlock()
+
+	if len(samples) == 0 {
+		return Trend{}
+	}
+	last := samples[len(samples)-1]
+	first := last
+	var t Trend
+	n := 0
+	for i := len(samples) - 1; i >= 0 && last.at.Sub(samples[i].at) <= window; i-- {
+		first = samples[i]
+		t.Clients += float64(first.gauges.Clients)
+		t.Rooms += float64(first.gauges.Rooms)
+		n++
+	}
+	t.Clients /= float64(n)
+	t.Rooms /= float64(n)
+	if secs := last.at.Sub(first.at).Seconds(); secs > 0 {
+		t.BytesInPerSec = float64(last.bytesIn-first.bytesIn) / secs
+		t.BytesOutPerSec = float64(last.bytesOut-first.bytesOut) / secs
+	}
+	return t
+}
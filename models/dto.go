@@ -1,31 +1,866 @@
 package models
 
+import (
+	"coopcinema/codec"
+	"coopcinema/schedule"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 type Message struct {
-	Type       string  `json:"type"`
-	Timestamp  float64 `json:"timestamp"`
-	RoomCode   string  `json:"roomCode,omitempty"`
+	Type       string      `json:"type"`
+	Timestamp  float64     `json:"timestamp"`
+	RoomCode   string      `json:"roomCode,omitempty"`
+	UserName   string      `json:"userName,omitempty"`
+	UserID     string      `json:"userID,omitempty"`
+	URL        string      `json:"url,omitempty"`
+	Content    string      `json:"content,omitempty"`
+	SentAt     float64     `json:"sentAt,omitempty"`
+	SourceType string      `json:"sourceType,omitempty"`
+	Playing    bool        `json:"playing,omitempty"`
+	CueIndex   *int        `json:"cueIndex,omitempty"`
+	Viewers    int         `json:"viewers,omitempty"`
+	Cooldown   float64     `json:"cooldown,omitempty"`
+	ServerTime int64       `json:"serverTime,omitempty"` // Unix ms, stamped by writePump
+	ServerAt   int64       `json:"serverAt,omitempty"`   // Unix ms on the server clock at which a play, pause, seek or state position held
+	Command    string      `json:"command,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Hint       *AdaptHint  `json:"hint,omitempty"`
+	Slot       string      `json:"slot,omitempty"` // media slot for loads and playback; empty is the primary
+	Chat       *ChatEntry  `json:"chat,omitempty"`
+	History    []ChatEntry `json:"history,omitempty"`
+	CatchUp    []RoomEvent `json:"catchUp,omitempty"`
+
+	Preferences *Preferences `json:"preferences,omitempty"`
+	Suggestions []string     `json:"suggestions,omitempty"` // what members can do about a mediaUnavailable
+	Regions     *Regions     `json:"regions,omitempty"`     // where the media can play, if its provider restricts it
+	Queue       *Playlist    `json:"queue,omitempty"`       // the room's playlist
+
+	To     string          `json:"to,omitempty"`     // user ID a signal is addressed to
+	Signal json.RawMessage `json:"signal,omitempty"` // WebRTC offer, answer or ICE candidate, passed on as is
+
+	Payload any `json:"payload,omitempty"` // typed by message type; see payload.go
+
+	Encoded *codec.Shared `json:"-"` // set on broadcasts so recipients share each prepared frame
+}
+
+// ChatEntry is one chat message as the server relayed it. At is the
+// server's clock in Unix milliseconds.
+type ChatEntry struct {
+	SenderID   string `json:"senderID,omitempty"` // empty for server and bot messages
+	SenderName string `json:"senderName"`
+	Text       string `json:"text"`
+	At         int64  `json:"at"`
+}
+
+// RoomEvent is one entry of a catchUp: the media being loaded, a play,
+// pause or seek, or a chat message. At is the server's clock in Unix
+// milliseconds.
+type RoomEvent struct {
+	Kind       string  `json:"kind"` // media, play, pause, seek or chat
+	At         int64   `json:"at"`
+	UserID     string  `json:"userID,omitempty"` // empty when the server did it
 	UserName   string  `json:"userName,omitempty"`
-	UserID     string  `json:"userID,omitempty"`
+	SourceType string  `json:"sourceType,omitempty"` // media: the load type
 	URL        string  `json:"url,omitempty"`
-	Content    string  `json:"content,omitempty"`
-	SentAt     float64 `json:"sentAt,omitempty"`
-	SourceType string  `json:"sourceType,omitempty"`
-	Playing    bool    `json:"playing,omitempty"`
+	Timestamp  float64 `json:"timestamp,omitempty"` // play, pause, seek: the position
+	Text       string  `json:"text,omitempty"`      // chat
+}
+
+// CapabilitiesDoc is what a client needs to know to talk to this server:
+// the protocol versions it speaks and what it will accept and send.
+type CapabilitiesDoc struct {
+	ProtocolVersion    int      `json:"protocolVersion"`
+	MinProtocolVersion int      `json:"minProtocolVersion"`
+	Encodings          []string `json:"encodings"`    // WebSocket subprotocols; binary frames are MessagePack
+	ClientTypes        []string `json:"clientTypes"`  // message types clients may send
+	ServerTypes        []string `json:"serverTypes"`  // message types the server may send
+	PayloadTypes       []string `json:"payloadTypes"` // types carrying a typed payload, from version 2
+	Capabilities       []string `json:"capabilities"` // names for the caps query parameter
+}
+
+// Branding is how the instance presents itself, for white-labelling.
+type Branding struct {
+	Title   string            `json:"title"`
+	LogoURL string            `json:"logoUrl,omitempty"`
+	Colors  map[string]string `json:"colors,omitempty"` // palette entry -> CSS hex color
+	MOTD    string            `json:"motd,omitempty"`
+}
+
+// ProtocolDoc describes the WebSocket protocol the running server speaks.
+type ProtocolDoc struct {
+	Fields       []FieldSpec   `json:"fields"`   // every message is one JSON object with these optional fields
+	Messages     []MessageSpec `json:"messages"` // sorted by type
+	Capabilities []string      `json:"capabilities"`
+}
+
+type FieldSpec struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // JSON type
+}
+
+// MessageSpec documents one message type.
+type MessageSpec struct {
+	Type        string   `json:"type"`
+	Direction   string   `json:"direction"` // "client", "server" or "both"
+	Description string   `json:"description"`
+	Fields      []string `json:"fields,omitempty"`
+	Permission  string   `json:"permission,omitempty"` // "host", or "dj" while DJ mode is on
+	Capability  string   `json:"capability,omitempty"` // only sent to clients that declared it
+}
+
+// Attention is what the server last heard from a member about whether
+// they're watching.
+type Attention struct {
+	Hidden    bool      // tab in the background at the last heartbeat
+	Heartbeat time.Time // last heartbeat
+	Position  float64   // last reported playhead
+	Moved     time.Time // when the reported playhead last advanced
+}
+
+// AttentionSummary tells the host how many members are actually watching.
+// Away lists names only when the operator allows it.
+type AttentionSummary struct {
+	Watching int      `json:"watching"`
+	Total    int      `json:"total"`
+	Away     []string `json:"away,omitempty"`
+}
+
+// MediaHealth tracks whether a room's direct media URL still answers.
+type MediaHealth struct {
+	URL      string // the URL checked; a new load starts over
+	Failures int    // failed checks in a row
+	Reason   string // why the last check failed
+	Notified bool   // the room was told the media is unavailable
+}
+
+// Regions is where a provider lets media play, as ISO 3166 country codes.
+// With Allowed empty it plays everywhere not Blocked.
+type Regions struct {
+	Allowed []string `json:"allowed,omitempty"`
+	Blocked []string `json:"blocked,omitempty"`
+}
+
+// Allows reports whether media can play in country. An unknown country
+// ("") is given the benefit of the doubt.
+func (r Regions) Allows(country string) bool {
+	if country == "" {
+		return true
+	}
+	for _, c := range r.Blocked {
+		if c == country {
+			return false
+		}
+	}
+	if len(r.Allowed) == 0 {
+		return true
+	}
+	for _, c := range r.Allowed {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
+
+// MediaRegions is what a room learned about where its media can play.
+type MediaRegions struct {
+	URL     string  // the media looked up; a new load starts over
+	Regions Regions // nil lists when the provider doesn't restrict it
+}
+
+// Feedback is one member's rating of a session, sent after its room
+// closed.
+type Feedback struct {
+	Tenant  string    `json:"tenant,omitempty"`
+	Room    string    `json:"room"`
+	UserID  string    `json:"userID"`
+	Session string    `json:"session"` // when the room closed, as RFC 3339
+	Rating  int       `json:"rating"`  // 1-5 stars
+	Text    string    `json:"text,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// FeedbackSummary sums up a tenant's session feedback for operators.
+type FeedbackSummary struct {
+	Responses int        `json:"responses"`
+	Average   float64    `json:"average"`
+	Ratings   [5]int     `json:"ratings"`            // responses per star, one star first
+	Comments  []Feedback `json:"comments,omitempty"` // latest responses with text, newest first
+}
+
+// SlotSecondary is the picture-in-picture slot next to the primary media.
+const SlotSecondary = "secondary"
+
+// MediaSlot is the media and playback state of a secondary slot.
+type MediaSlot struct {
+	Media      *Message // last load, nil when cleared
+	Position   float64
+	PositionAt time.Time
+	Playing    bool
+	Controller string // user ID allowed to control the slot besides the host; "" for anyone
+}
+
+// Rendition is what one member reports playing, for the host.
+type Rendition struct {
+	UserID   string `json:"userID"`
+	UserName string `json:"userName"`
+	Height   int    `json:"height"`
+}
+
+// Preferences follow a user from room to room. They are kept per account,
+// or per device for guests.
+type Preferences struct {
+	Name             string          `json:"name,omitempty"`             // default theater name
+	SubtitleLanguage string          `json:"subtitleLanguage,omitempty"` // preferred caption track
+	AVOffset         float64         `json:"avOffset,omitempty"`         // seconds to play ahead (+) or behind (-) the room
+	Notifications    map[string]bool `json:"notifications,omitempty"`    // "chatSound", "chatToast"
+	Theme            string          `json:"theme,omitempty"`
+}
+
+// AdaptHint tells a client how to behave on its current connection.
+type AdaptHint struct {
+	DriftReports       bool    `json:"driftReports"`       // keep sending periodic state/status reports
+	MaxReactionsPerSec float64 `json:"maxReactionsPerSec"` // throttle outgoing reactions
+	BufferTarget       float64 `json:"bufferTarget"`       // seconds of media to buffer ahead
 }
 
 type Client struct {
-	ID       string
-	Name     string
-	Conn     interface{} // *websocket.Conn
-	Send     chan Message
-	RoomCode string
+	ID        string
+	Name      string
+	Conn      interface{}  // *websocket.Conn
+	Send      chan Message // read by the connection's writer; queue with Deliver, never close directly
+	RoomCode  string
+	ExpiresAt time.Time    // set when joined with a guest pass
+	Caps      Capabilities // optional traffic the client declared it handles
+	Protocol  int          // negotiated protocol version
+	Country   string       // ISO 3166 code from the GeoIP database, "" if unknown
+	Account   string       // signed-in identity, e.g. "github:583231"; "" for guests
+	Liveness  atomic.Int32 // 0-100, kept current by the connection's keepalive
+	RTT       atomic.Int64 // round trip in ms, kept current by the connection's keepalive
+
+	// Voice chat presence
+	InVoice  atomic.Bool
+	Muted    atomic.Bool
+	Speaking atomic.Bool
+
+	// While its writer is behind: how long before the client is given up
+	// on, and how many chat messages wait meanwhile. See held.go.
+	StallGrace  time.Duration
+	ChatBacklog int
+
+	// ResumeToken lets the next connection take this one's place in the
+	// room if it drops; ResumeFrom is the token this one presented.
+	// Dropped is set when the connection was lost rather than closed by
+	// the client.
+	ResumeToken string
+	ResumeFrom  string
+	Dropped     atomic.Bool
+
+	sendMu sync.RWMutex // held for reading while queueing, for writing while closing
+	closed atomic.Bool
+	held   heldQueue
+}
+
+// Deliver queues msg for the client without blocking, holding it back if
+// Send is full. It returns false if the client was closed or its writer
+// has been behind for too long.
+func (c *Client) Deliver(msg Message) bool {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+
+	if c.closed.Load() {
+		return false
+	}
+	c.held.mu.Lock()
+	defer c.held.mu.Unlock()
+
+	// Once anything is held, later messages queue behind it
+	if len(c.held.msgs) == 0 {
+		select {
+		case c.Send <- msg:
+			return true
+		default:
+		}
+	}
+	return c.hold(msg)
+}
+
+// Close closes Send so the writer hangs up. Only the first call does
+// anything; it reports whether it was this one.
+func (c *Client) Close() bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.closed.CompareAndSwap(false, true) {
+		return false
+	}
+	close(c.Send)
+	return true
+}
+
+// Closed reports whether the client was closed.
+func (c *Client) Closed() bool {
+	return c.closed.Load()
+}
+
+// Capabilities is a bit set of optional message kinds a client handles.
+// Clients that send no capability list at handshake get everything.
+type Capabilities uint8
+
+const (
+	CapReactions Capabilities = 1 << iota
+	CapVoice
+
+	CapAll = CapReactions | CapVoice
+)
+
+var capabilityNames = map[string]Capabilities{
+	"reactions": CapReactions,
+	"voice":     CapVoice,
+}
+
+// CapabilityNames lists the names accepted by ParseCapabilities.
+func CapabilityNames() []string {
+	names := make([]string, 0, len(capabilityNames))
+	for name := range capabilityNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name returns the name of a single capability, or "" for none.
+func (c Capabilities) Name() string {
+	for name, cap := range capabilityNames {
+		if cap == c {
+			return name
+		}
+	}
+	return ""
+}
+
+// ParseCapabilities reads a comma-separated capability list such as
+// "reactions,voice". Unknown names are ignored.
+func ParseCapabilities(list string) Capabilities {
+	var caps Capabilities
+	for _, name := range strings.Split(list, ",") {
+		caps |= capabilityNames[strings.TrimSpace(name)]
+	}
+	return caps
+}
+
+// Roster visibility modes for non-host clients.
+const (
+	RosterFull      = "full"      // everyone sees every name
+	RosterAnonymous = "anonymous" // viewers only see a head count
+	RosterHostOnly  = "host"      // viewers only see themselves
+)
+
+// AwayMember is a member whose connection dropped, still counted in the
+// room until Until in case it comes back with Client's resume token.
+type AwayMember struct {
+	Client *Client
+	Until  time.Time
+	Timer  *time.Timer // ends the grace period
 }
 
 type Room struct {
-	Code    string
-	Clients map[interface{}]bool
+	// Mu guards the room's fields. The hub takes it after its own lock,
+	// never before, and never holds two rooms' at once.
+	Mu sync.RWMutex
+
+	Code       string
+	Clients    map[interface{}]bool
+	HostID     string
+	HostMode   bool // only the host's play, pause and seek are relayed
+	RosterMode string
+	Lyrics     []LyricCue
+	Emotes     map[string]string // custom reaction name -> blob key
+
+	PasswordHash []byte // bcrypt hash joiners must match, nil for an open room
+	Name         string // set when created through the API
+	MaxMembers   int    // 0 for no cap
+	Owner        string // who created it through the API: "account:<id>" or "device:<id>"
+
+	SlowMode time.Duration        // minimum gap between chat messages per user
+	LastChat map[string]time.Time // user ID -> last accepted chat message
+	Kicked   map[string]bool      // user IDs removed by the host
+	Invites  map[string]string    // single-use invite ID -> user ID who redeemed it
+	Poll     *Poll
+
+	Away map[string]*AwayMember // user ID -> member whose connection dropped, kept for a resume
+
+	PreRoll        *PreRoll // played once before the next media load
+	PreRollPending *Message // media load held back while the pre-roll plays
+	Accessibility  Accessibility
+
+	APITokens map[string]*APIToken  // secret -> grant, for inbound webhooks and observers
+	Observers map[chan Message]bool // read-only event streams; not in the roster
+	Media     *Message              // last media load
+
+	MediaHealth  MediaHealth  // checks of Media when it is a direct URL
+	MediaRegions MediaRegions // where Media can play, for provider media
+
+	KV map[string]KVEntry // shared state for client apps and bots
+
+	DJ *DJRotation // nil unless DJ mode is on
+
+	Playlist Playlist // media queued to play next
+
+	Subtitles      *SubtitleTrack // shared subtitles for the media loaded when they were uploaded
+	SubtitleOffset float64        // seconds added to every cue's times
+
+	Webhook *RoomWebhook // host's playback webhook, if registered
+
+	Renditions map[string]int // user ID -> video height the member reports playing
+	QualityCap int            // highest rendition members should pick, 0 for no cap
+
+	WaitForAll bool            // pause everyone while a member buffers
+	Buffering  map[string]bool // user IDs buffering, tracked in wait mode
+	WaitHold   time.Time       // when the room was paused for buffering, zero if it isn't
+
+	AttentionOn bool                  // host asked for attention summaries
+	Attention   map[string]*Attention // user ID -> latest heartbeat and playhead
+
+	OpenedAt     time.Time // when the room was created or restored
+	LastActivity time.Time // last playback change or member chat
+	ExpiryNotice time.Time // the closing time members were last warned of
+
+	Parent    string   // main room code when this is a breakout room
+	Breakouts []string // breakout room codes split off this room
+
+	ChatHistory []ChatEntry // most recent last, capped at Hub.ChatHistory
+
+	// What late joiners are caught up on besides ChatHistory: who loaded
+	// the current media and the last play, pause or seek since
+	LastLoad     *RoomEvent
+	LastPlayback *RoomEvent
+
+	Timeline   []TimelineEntry // most recent last, capped
+	timelineID int64
+
+	// Last playback position reported by a client, used to place
+	// reactions and bookmarks on the media timeline.
+	Position   float64
+	PositionAt time.Time
+	Playing    bool
+
+	Slots map[string]*MediaSlot // secondary media by slot; the primary's state is above
+
+	Reactions      map[int]int    // media second -> reaction count
+	ReactionCounts map[string]int // emoji or emote name -> reaction count
+	Bookmarks      []Bookmark
+}
+
+// DJRotation passes the right to pick the next track round-robin: each
+// media load by the DJ hands the turn to the next member in line.
+type DJRotation struct {
+	Order     []string        // user IDs, current DJ first
+	SkipVotes map[string]bool // user IDs voting to pass the turn on
+}
+
+// Playlist is a room's queue: what it started last and what plays after.
+type Playlist struct {
+	Current *QueueItem  `json:"current,omitempty"` // nil once other media is loaded
+	Items   []QueueItem `json:"items"`             // up next, in order
+}
+
+// SubtitleTrack is a WebVTT file members' players show over the media.
+type SubtitleTrack struct {
+	Key   string // blob store key
+	URL   string // where players fetch it
+	Label string
+	Media string // URL of the media it was uploaded for
+}
+
+// SubtitlesResponse describes a room's shared subtitles.
+type SubtitlesResponse struct {
+	URL    string  `json:"url"`
+	Label  string  `json:"label,omitempty"`
+	Offset float64 `json:"offset"`
+	Cues   int     `json:"cues,omitempty"`
+}
+
+// MediaUploadResponse describes a video uploaded to a room.
+type MediaUploadResponse struct {
+	URL    string `json:"url"`
+	Name   string `json:"name,omitempty"`
+	Size   int64  `json:"size"`
+	Stream string `json:"stream,omitempty"` // HLS playlist being prepared
+}
+
+// QueueItem is one media load waiting in a playlist.
+type QueueItem struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"` // media message type: youtube, directurl, ...
+	URL       string `json:"url"`
+	Title     string `json:"title,omitempty"`
+	AddedBy   string `json:"addedBy,omitempty"` // member name
+	AddedByID string `json:"addedByID,omitempty"`
+}
+
+// RoomWebhook is a URL the host registered to hear about playback changes.
+// Deliveries are signed with Secret.
+type RoomWebhook struct {
+	URL     string
+	Secret  string
+	Pending *time.Timer // delivery waiting out the debounce window
+}
+
+// RoomOptions configure a room created before anyone joins it.
+type RoomOptions struct {
+	Name         string
+	PasswordHash []byte
+	MaxMembers   int
+	Owner        string
+}
+
+// CreateRoomRequest is the body of POST /api/v1/rooms.
+type CreateRoomRequest struct {
+	Name       string `json:"name,omitempty"`
+	Password   string `json:"password,omitempty"`
+	MaxMembers int    `json:"maxMembers,omitempty"`
+}
+
+// FeedbackRequest is the body of POST /api/feedback.
+type FeedbackRequest struct {
+	Token  string `json:"token"`
+	Rating int    `json:"rating"`
+	Text   string `json:"text,omitempty"`
+}
+
+// TokenRequest is the body of POST /api/v1/token.
+type TokenRequest struct {
+	Name  string `json:"name"`
+	Token string `json:"token,omitempty"` // a previous token, to keep its user ID
+}
+
+// TokenResponse carries a token for /ws and who it says the caller is.
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"userID"`
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RoomInfo describes a room through the REST API.
+type RoomInfo struct {
+	Code       string       `json:"code"`
+	Name       string       `json:"name,omitempty"`
+	Members    int          `json:"members"`
+	MaxMembers int          `json:"maxMembers,omitempty"`
+	Protected  bool         `json:"protected"`
+	Playback   RoomPlayback `json:"playback"`
+}
+
+// RoomPlayback is what a room is playing and where.
+type RoomPlayback struct {
+	SourceType string  `json:"sourceType"` // "none" when nothing is loaded
+	URL        string  `json:"url,omitempty"`
+	Position   float64 `json:"position"`
+	Playing    bool    `json:"playing"`
+}
+
+// RoomSnapshot is what survives a restart of a room: its code, who hosts
+// it, and what was playing where.
+type RoomSnapshot struct {
+	Code         string      `json:"code"`
+	HostID       string      `json:"hostID,omitempty"`
+	HostMode     bool        `json:"hostMode,omitempty"`
+	RosterMode   string      `json:"rosterMode,omitempty"`
+	PasswordHash []byte      `json:"passwordHash,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	MaxMembers   int         `json:"maxMembers,omitempty"`
+	Owner        string      `json:"owner,omitempty"`
+	Media        *Message    `json:"media,omitempty"`
+	Position     float64     `json:"position"`
+	ChatHistory  []ChatEntry `json:"chatHistory,omitempty"`
+	Playlist     *Playlist   `json:"playlist,omitempty"`
+	Schedule     *Schedule   `json:"schedule,omitempty"`
+	ScheduleOnly bool        `json:"scheduleOnly,omitempty"` // no room is open under the code, only its schedule is kept
+}
+
+type Bookmark struct {
+	Time     float64 `json:"time"`
+	Label    string  `json:"label"`
+	UserID   string  `json:"userID,omitempty"`
+	UserName string  `json:"userName"`
+}
+
+type RoomBookmark struct {
+	RoomCode string `json:"roomCode"`
+	Bookmark
+}
+
+type LyricCue struct {
+	Time float64 `json:"time"`
+	Text string  `json:"text"`
+}
+
+// GenerateRoomRequest is the optional body of a room code request.
+type GenerateRoomRequest struct {
+	Password string `json:"password,omitempty"`
 }
 
 type RoomCodeResponse struct {
 	Code string `json:"code"`
 }
+
+type LyricsResponse struct {
+	Cues []LyricCue `json:"cues"`
+}
+
+// Schedule statuses.
+const (
+	ScheduleScheduled = "scheduled"
+	ScheduleLive      = "live" // sent to the room when an occurrence starts
+	ScheduleEnded     = "ended"
+)
+
+type Schedule struct {
+	RoomCode     string         `json:"roomCode"`
+	Start        time.Time      `json:"start"`
+	TimeZone     string         `json:"timeZone,omitempty"` // IANA zone whose wall-clock time starts keep; UTC if empty
+	RRule        string         `json:"rrule,omitempty"`
+	Rule         *schedule.Rule `json:"-"` // RRule, parsed when the schedule is set
+	ReminderURL  string         `json:"reminderURL,omitempty"`
+	PassRequired bool           `json:"passRequired,omitempty"` // only the host joins without a guest pass or invite
+	Status       string         `json:"status"`
+	Next         time.Time      `json:"next,omitempty"`
+	Reminded     bool           `json:"-"`
+}
+
+type GuestPassResponse struct {
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	NotBefore time.Time `json:"notBefore"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// InviteRequest asks for an invite to a room. TTL is a Go duration.
+type InviteRequest struct {
+	TTL       string `json:"ttl"`
+	SingleUse bool   `json:"singleUse"`
+}
+
+// InviteResponse is an invite: a token for /ws's invite parameter and the
+// join link carrying it.
+type InviteResponse struct {
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	SingleUse bool      `json:"singleUse"`
+}
+
+// ReactionSummary is a room's reactions so far, for a post-watch recap.
+type ReactionSummary struct {
+	Total   int            `json:"total"`
+	ByEmoji map[string]int `json:"byEmoji"`
+	Peaks   []ReactionPeak `json:"peaks"` // busiest seconds, busiest first
+}
+
+type ReactionPeak struct {
+	Time  int `json:"time"` // media second
+	Count int `json:"count"`
+}
+
+type Emote struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type Poll struct {
+	Question string         `json:"question"`
+	Options  []string       `json:"options"`
+	Votes    map[string]int `json:"-"` // user ID -> option index
+	Tally    []int          `json:"tally"`
+}
+
+type TimelineEntry struct {
+	ID       int64     `json:"id"`
+	At       time.Time `json:"at"`
+	Kind     string    `json:"kind"` // join, leave, media, seek, marker, poll, breakout
+	UserID   string    `json:"userID,omitempty"`
+	UserName string    `json:"userName,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+	Position float64   `json:"position,omitempty"`
+}
+
+// AppendTimeline records an entry, dropping the oldest beyond limit.
+func (r *Room) AppendTimeline(e TimelineEntry, limit int) {
+	r.timelineID++
+	e.ID = r.timelineID
+	r.Timeline = append(r.Timeline, e)
+	if len(r.Timeline) > limit {
+		r.Timeline = append([]TimelineEntry(nil), r.Timeline[len(r.Timeline)-limit:]...)
+	}
+}
+
+type TimelineResponse struct {
+	Entries    []TimelineEntry `json:"entries"`
+	NextBefore int64           `json:"nextBefore,omitempty"`
+}
+
+type PublicStats struct {
+	ActiveRooms   int       `json:"activeRooms"`
+	PartiesHosted int64     `json:"partiesHosted"`
+	HoursWatched  float64   `json:"hoursWatched"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Maintenance is the operator maintenance state. With At in the future it is
+// scheduled and becomes active at that time.
+type Maintenance struct {
+	Active  bool      `json:"active"`
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at,omitempty"`
+}
+
+type BanRequest struct {
+	IP     string `json:"ip,omitempty"`
+	UserID string `json:"userID,omitempty"`
+}
+
+// CloseRoomRequest is the optional body of an admin room closure.
+type CloseRoomRequest struct {
+	Reason string `json:"reason,omitempty"`
+	MoveTo string `json:"moveTo,omitempty"` // room code members are pointed to
+}
+
+// AdminRoom is one open room as the admin API lists it.
+type AdminRoom struct {
+	Code         string    `json:"code"`
+	Tenant       string    `json:"tenant,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	Members      int       `json:"members"`
+	HostID       string    `json:"hostID,omitempty"`
+	SourceType   string    `json:"sourceType"` // "none" when nothing is loaded
+	URL          string    `json:"url,omitempty"`
+	Position     float64   `json:"position"` // estimated, in seconds
+	Playing      bool      `json:"playing"`
+	OpenedAt     time.Time `json:"openedAt"`
+	LastActivity time.Time `json:"lastActivity"`
+}
+
+// AnnouncementRequest posts an admin message into one room's chat, or
+// every room's when Room is empty.
+type AnnouncementRequest struct {
+	Message string `json:"message"`
+	Room    string `json:"room,omitempty"`
+}
+
+// AnnouncementResponse says how many rooms an announcement reached.
+type AnnouncementResponse struct {
+	Rooms int `json:"rooms"`
+}
+
+// WiretapRequest arms recording of a user's next connection.
+type WiretapRequest struct {
+	UserID string `json:"userID"`
+}
+
+type ClaimRequest struct {
+	Token string `json:"token"`
+}
+
+type BreakoutPlan struct {
+	Rooms []BreakoutRoom `json:"rooms"`
+}
+
+type BreakoutRoom struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"` // user IDs
+}
+
+// Pre-roll kinds.
+const (
+	PreRollClip      = "clip"      // a short video at URL
+	PreRollCountdown = "countdown" // a generated countdown card
+)
+
+type PreRoll struct {
+	Kind    string `json:"kind"`
+	URL     string `json:"url,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Seconds int    `json:"seconds"`
+	StartAt int64  `json:"startAt,omitempty"` // server Unix ms, set when it plays
+}
+
+// Accessibility is the room-wide caption and audio-description setup every
+// member's player applies to each media load.
+type Accessibility struct {
+	ForceCaptions    bool   `json:"forceCaptions"`
+	CaptionLanguage  string `json:"captionLanguage,omitempty"`
+	AudioDescription string `json:"audioDescription,omitempty"` // language of the described audio track
+}
+
+// APIToken lets an external system act on one room within its scopes.
+type APIToken struct {
+	ID        string    `json:"id"` // for listing and revoking; not the secret
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"` // zero: lasts as long as the room
+}
+
+// MintTokenRequest asks for a room API token. TTL is a Go duration; empty
+// means the token lasts as long as the room.
+type MintTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	TTL    string   `json:"ttl,omitempty"`
+}
+
+// MintTokenResponse is the only time the token itself is shown.
+type MintTokenResponse struct {
+	Token string `json:"token"`
+	APIToken
+}
+
+// RoomConfigVersion is the current RoomConfig format.
+const RoomConfigVersion = 1
+
+// RoomConfig is a room's portable setup, exported as JSON so it can be
+// imported on another instance.
+type RoomConfig struct {
+	Version       int           `json:"version"`
+	RosterMode    string        `json:"rosterMode"`
+	SlowMode      int           `json:"slowMode"` // seconds
+	Accessibility Accessibility `json:"accessibility"`
+	PreRoll       *PreRoll      `json:"preRoll,omitempty"`
+	Lyrics        []LyricCue    `json:"lyrics,omitempty"`
+	Emotes        []EmoteFile   `json:"emotes,omitempty"`
+	Schedule      *Schedule     `json:"schedule,omitempty"`
+}
+
+// EmoteFile carries a custom reaction's image inline so it survives the move
+// to another blob store.
+type EmoteFile struct {
+	Name string `json:"name"`
+	Key  string `json:"-"`
+	Ext  string `json:"ext"`
+	Data []byte `json:"data"`
+}
+
+// ObserverState is the snapshot an observer stream starts with.
+type ObserverState struct {
+	RoomCode string   `json:"roomCode"`
+	Media    *Message `json:"media,omitempty"`
+	Position float64  `json:"position"`
+	Playing  bool     `json:"playing"`
+	Viewers  int      `json:"viewers"`
+}
+
+// KVEntry is one value in a room's key-value store. It is sent as the
+// content of "kv" messages.
+type KVEntry struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value,omitempty"`
+	TTL       int       `json:"ttl,omitempty"` // seconds, on kvSet
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
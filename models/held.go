@@ -0,0 +1,114 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// While a client's writer is behind and Send is full, what Deliver is given
+// waits in the client's held queue rather than costing it its connection.
+// A playback message or user list only matters as the latest of its kind,
+// so a newer one replaces the one waiting; chat waits up to ChatBacklog
+// messages, dropping the oldest; anything else waits as it is, up to Send's
+// capacity. The client is given up on once the writer hasn't caught up for
+// StallGrace.
+type heldQueue struct {
+	mu           sync.Mutex
+	msgs         []Message
+	chats        int // chat messages in msgs
+	others       int // messages in msgs that are neither chat nor coalesced
+	stalledSince time.Time
+	wake         chan struct{}
+}
+
+// coalesceKey names what msg supersedes, "" if it stands on its own.
+func coalesceKey(msg Message) string {
+	switch msg.Type {
+	case "play", "pause", "seek", "state":
+		return "playback/" + msg.Slot
+	case "userList":
+		return "userList"
+	}
+	return ""
+}
+
+// add holds msg behind the rest. It returns false when msg can neither
+// replace nor push out an older one and the queue is full. Callers hold
+// q.mu.
+func (q *heldQueue) add(msg Message, chatBacklog, limit int) bool {
+	if key := coalesceKey(msg); key != "" {
+		for i, m := range q.msgs {
+			if coalesceKey(m) == key {
+				q.msgs = append(q.msgs[:i], q.msgs[i+1:]...)
+				break
+			}
+		}
+	} else if msg.Type == "chat" {
+		if chatBacklog <= 0 {
+			return true
+		}
+		if q.chats >= chatBacklog {
+			for i, m := range q.msgs {
+				if m.Type == "chat" {
+					q.msgs = append(q.msgs[:i], q.msgs[i+1:]...)
+					q.chats--
+					break
+				}
+			}
+		}
+		q.chats++
+	} else {
+		if q.others >= limit {
+			return false
+		}
+		q.others++
+	}
+	q.msgs = append(q.msgs, msg)
+	return true
+}
+
+// hold queues msg for the writer to take once it has written what is in
+// Send, and wakes it. Callers hold q.mu.
+func (c *Client) hold(msg Message) bool {
+	q := &c.held
+	if len(q.msgs) == 0 {
+		q.stalledSince = time.Now()
+	} else if time.Since(q.stalledSince) > c.StallGrace {
+		return false
+	}
+	if !q.add(msg, c.ChatBacklog, cap(c.Send)) {
+		return false
+	}
+	select {
+	case c.heldWake() <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Held signals the writer that messages are waiting for TakeHeld.
+func (c *Client) Held() <-chan struct{} {
+	c.held.mu.Lock()
+	defer c.held.mu.Unlock()
+	return c.heldWake()
+}
+
+// heldWake returns the held queue's wake channel, making it on first use.
+// Callers hold c.held.mu.
+func (c *Client) heldWake() chan struct{} {
+	if c.held.wake == nil {
+		c.held.wake = make(chan struct{}, 1)
+	}
+	return c.held.wake
+}
+
+// TakeHeld empties the held queue. The writer calls it once it has written
+// everything that was in Send when it was woken, so messages still go out in
+// the order they were delivered.
+func (c *Client) TakeHeld() []Message {
+	c.held.mu.Lock()
+	defer c.held.mu.Unlock()
+	msgs := c.held.msgs
+	c.held.msgs, c.held.chats, c.held.others = nil, 0, 0
+	return msgs
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Protocol versions. Version 1 clients get the flat fields only. Version 2
+// adds typed payloads and drops the JSON roster in userList's userName.
+// Version 3 gets catchUp on joining where older clients get chatHistory.
+// Clients that don't ask for a version speak 1.
+const (
+	MinProtocolVersion = 1
+	ProtocolVersion    = 3
+)
+
+// A message's payload field carries a typed struct chosen by its type. The
+// flat fields alongside it remain for version 1 clients, which never see a
+// payload.
+
+// PlaybackPayload is the payload of play, pause, seek and state.
+type PlaybackPayload struct {
+	Timestamp float64 `json:"timestamp"`
+	Playing   bool    `json:"playing,omitempty"`
+	SentAt    float64 `json:"sentAt,omitempty"`
+	ServerAt  int64   `json:"serverAt,omitempty"` // set by the server
+	Slot      string  `json:"slot,omitempty"`
+}
+
+// UserListPayload is the payload of userList. Users is empty when the room
+// only shows a head count, in Viewers.
+type UserListPayload struct {
+	Users   []RosterEntry `json:"users"`
+	Viewers int           `json:"viewers,omitempty"`
+}
+
+// RosterEntry is one member in a userList.
+type RosterEntry struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Host     bool   `json:"host,omitempty"`
+	Liveness int    `json:"liveness"` // 0-100
+	Link     string `json:"link"`     // keepalive band
+	Voice    bool   `json:"voice,omitempty"`
+	Muted    bool   `json:"muted,omitempty"`
+	Speaking bool   `json:"speaking,omitempty"`
+	Away     bool   `json:"away,omitempty"` // dropped and may resume
+}
+
+// ChatPayload is the payload of chat: the text from clients, the whole
+// entry from the server.
+type ChatPayload ChatEntry
+
+// HelloPayload is the payload of hello, the first message on every
+// connection: the version the server will speak, and the range it knows.
+type HelloPayload struct {
+	Version    int `json:"version"`
+	MinVersion int `json:"minVersion"`
+	MaxVersion int `json:"maxVersion"`
+}
+
+// ErrorPayload is the payload of error, sent when the server refuses a
+// message.
+type ErrorPayload struct {
+	Code    string `json:"code"` // unknownType, badPayload, tooLong or relayUnavailable
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"` // the refused message's type
+}
+
+// payloadTypes maps message types to the payload they carry.
+var payloadTypes = map[string]func() any{
+	"play":     func() any { return new(PlaybackPayload) },
+	"pause":    func() any { return new(PlaybackPayload) },
+	"seek":     func() any { return new(PlaybackPayload) },
+	"state":    func() any { return new(PlaybackPayload) },
+	"userList": func() any { return new(UserListPayload) },
+	"chat":     func() any { return new(ChatPayload) },
+	"error":    func() any { return new(ErrorPayload) },
+	"hello":    func() any { return new(HelloPayload) },
+}
+
+// PayloadTypes lists the message types that carry a payload.
+func PayloadTypes() []string {
+	types := make([]string, 0, len(payloadTypes))
+	for t := range payloadTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// PayloadError is a message whose payload doesn't match its type. The rest
+// of the message is still decoded.
+type PayloadError struct {
+	Type string
+	Err  error
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("%s payload: %v", e.Type, e.Err)
+}
+
+func (e *PayloadError) Unwrap() error { return e.Err }
+
+// UnmarshalJSON decodes the payload strictly into the struct for the
+// message's type: unknown fields and types without a payload are refused
+// with a *PayloadError.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	var msg struct {
+		plain
+		Payload json.RawMessage `json:"payload,omitempty"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*m = Message(msg.plain)
+	m.Payload = nil
+
+	if len(msg.Payload) == 0 || bytes.Equal(msg.Payload, []byte("null")) {
+		return nil
+	}
+	newPayload, ok := payloadTypes[m.Type]
+	if !ok {
+		return &PayloadError{Type: m.Type, Err: errors.New("this type takes no payload")}
+	}
+	payload := newPayload()
+	dec := json.NewDecoder(bytes.NewReader(msg.Payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(payload); err != nil {
+		return &PayloadError{Type: m.Type, Err: err}
+	}
+	if v, ok := payload.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return &PayloadError{Type: m.Type, Err: err}
+		}
+	}
+	m.Payload = payload
+	return nil
+}
+
+func (p *PlaybackPayload) validate() error {
+	if p.Timestamp < 0 {
+		return errors.New("timestamp is negative")
+	}
+	return nil
+}
+
+func (p *ChatPayload) validate() error {
+	if p.Text == "" {
+		return errors.New("text is empty")
+	}
+	return nil
+}
+
+// ApplyPayload copies a client's payload into the flat fields the hub works
+// with and drops it; the server builds its own on the way out.
+func (m *Message) ApplyPayload() {
+	switch p := m.Payload.(type) {
+	case *PlaybackPayload:
+		m.Timestamp, m.Playing, m.SentAt, m.Slot = p.Timestamp, p.Playing, p.SentAt, p.Slot
+	case *ChatPayload:
+		m.Content = p.Text
+	}
+	m.Payload = nil
+}
+
+// WithPayload returns msg with the payload for its type built from the flat
+// fields, unless it already has one.
+func WithPayload(msg Message) Message {
+	if msg.Payload != nil {
+		return msg
+	}
+	switch msg.Type {
+	case "play", "pause", "seek", "state":
+		msg.Payload = &PlaybackPayload{
+			Timestamp: msg.Timestamp,
+			Playing:   msg.Playing,
+			SentAt:    msg.SentAt,
+			ServerAt:  msg.ServerAt,
+			Slot:      msg.Slot,
+		}
+	case "chat":
+		if msg.Chat != nil {
+			p := ChatPayload(*msg.Chat)
+			msg.Payload = &p
+		}
+	}
+	return msg
+}
+
+// ForVersion returns msg as a client speaking version should get it.
+func ForVersion(msg Message, version int) Message {
+	if version < 2 {
+		msg.Payload = nil
+		return msg
+	}
+	msg = WithPayload(msg)
+	if msg.Type == "userList" && msg.Payload != nil {
+		msg.UserName = ""
+	}
+	return msg
+}
+
+// Hello is the first message to a client speaking version.
+func Hello(version int) Message {
+	return Message{
+		Type:    "hello",
+		Content: fmt.Sprint(version),
+		Payload: &HelloPayload{Version: version, MinVersion: MinProtocolVersion, MaxVersion: ProtocolVersion},
+	}
+}
+
+// NegotiateVersion picks the version to speak with a client that asked for
+// requested, "" if it didn't ask. Newer clients are met at ProtocolVersion;
+// ok is false for a version that isn't a number or is older than
+// MinProtocolVersion.
+func NegotiateVersion(requested string) (version int, ok bool) {
+	if requested == "" {
+		return 1, true
+	}
+	version, err := strconv.Atoi(requested)
+	if err != nil || version < MinProtocolVersion {
+		return 0, false
+	}
+	return min(version, ProtocolVersion), true
+}
+
+// ErrorMessage refuses a message of type msgType.
+func ErrorMessage(code, msgType, text string) Message {
+	return Message{
+		Type:    "error",
+		Error:   text,
+		Payload: &ErrorPayload{Code: code, Message: text, Type: msgType},
+	}
+}
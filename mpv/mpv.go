@@ -0,0 +1,228 @@
+// Package mpv drives an mpv player over its JSON IPC socket
+// (--input-ipc-server): commands, property reads and the events mpv sends
+// back.
+package mpv
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by commands once the connection to mpv is gone,
+// usually because the player was quit.
+var ErrClosed = errors.New("mpv: connection closed")
+
+// startTimeout bounds how long Start waits for a new mpv's socket.
+const startTimeout = 5 * time.Second
+
+// Event is something mpv reported unasked: "seek", "playback-restart",
+// "file-loaded", "end-file", or "property-change" for an observed property.
+type Event struct {
+	Name string          `json:"event"`
+	ID   int             `json:"id"`
+	Prop string          `json:"name"` // the property, for property-change
+	Data json.RawMessage `json:"data"`
+}
+
+// response is mpv's reply to one command.
+type response struct {
+	RequestID int             `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Player is a connection to one mpv.
+type Player struct {
+	conn net.Conn
+	cmd  *exec.Cmd // the mpv Start launched, nil if Dial attached to one
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan response
+
+	events chan Event
+	done   chan struct{} // closed when the connection drops
+}
+
+// Dial attaches to an mpv already listening on socket.
+func Dial(socket string) (*Player, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	p := &Player{
+		conn:    conn,
+		pending: make(map[int]chan response),
+		events:  make(chan Event, 256),
+		done:    make(chan struct{}),
+	}
+	go p.read()
+	return p, nil
+}
+
+// Start launches binary (mpv, or a path to it) idle with a window, listening
+// on socket, and attaches to it. The player is quit by Close.
+func Start(ctx context.Context, binary, socket string) (*Player, error) {
+	os.Remove(socket)
+	cmd := exec.CommandContext(ctx, binary, "--idle=yes", "--force-window=yes", "--keep-open=yes",
+		"--input-ipc-server="+socket)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.Now().Add(startTimeout)
+	for {
+		p, err := Dial(socket)
+		if err == nil {
+			p.cmd = cmd
+			return p, nil
+		}
+		select {
+		case err := <-exited:
+			return nil, fmt.Errorf("mpv exited: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			return nil, fmt.Errorf("mpv didn't open %s: %w", socket, err)
+		}
+	}
+}
+
+// read dispatches replies to their commands and events to Events until the
+// connection drops. Events arriving while Events is full are dropped, so a
+// slow reader never holds up replies.
+func (p *Player) read() {
+	defer func() {
+		p.mu.Lock()
+		for id, ch := range p.pending {
+			close(ch)
+			delete(p.pending, id)
+		}
+		p.mu.Unlock()
+		close(p.done)
+	}()
+
+	scanner := bufio.NewScanner(p.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var ev Event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+		if ev.Name != "" {
+			select {
+			case p.events <- ev:
+			default:
+			}
+			continue
+		}
+		var resp response
+		if err := json.Unmarshal(line, &resp); err != nil {
+			continue
+		}
+		p.mu.Lock()
+		ch, ok := p.pending[resp.RequestID]
+		delete(p.pending, resp.RequestID)
+		p.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// Command runs an mpv input command, e.g. Command("seek", 30, "absolute"),
+// and returns its result.
+func (p *Player) Command(args ...any) (json.RawMessage, error) {
+	ch := make(chan response, 1)
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	data, err := json.Marshal(map[string]any{"command": args, "request_id": id})
+	if err != nil {
+		return nil, err
+	}
+	p.writeMu.Lock()
+	_, err = p.conn.Write(append(data, '\n'))
+	p.writeMu.Unlock()
+	if err != nil {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		return nil, ErrClosed
+	}
+	if resp.Error != "" && resp.Error != "success" {
+		return nil, fmt.Errorf("mpv: %v: %s", args[0], resp.Error)
+	}
+	return resp.Data, nil
+}
+
+// Load opens path, a file or URL, in place of what is playing.
+func (p *Player) Load(path string) error {
+	_, err := p.Command("loadfile", path, "replace")
+	return err
+}
+
+// SetPaused pauses or resumes playback.
+func (p *Player) SetPaused(paused bool) error {
+	_, err := p.Command("set_property", "pause", paused)
+	return err
+}
+
+// Seek moves to position seconds.
+func (p *Player) Seek(position float64) error {
+	_, err := p.Command("seek", position, "absolute+exact")
+	return err
+}
+
+// Position returns the playback position in seconds.
+func (p *Player) Position() (float64, error) {
+	data, err := p.Command("get_property", "time-pos")
+	if err != nil {
+		return 0, err
+	}
+	var pos float64
+	err = json.Unmarshal(data, &pos)
+	return pos, err
+}
+
+// Observe asks mpv to report changes to a property as property-change
+// events.
+func (p *Player) Observe(id int, property string) error {
+	_, err := p.Command("observe_property", id, property)
+	return err
+}
+
+// Events delivers what mpv reports unasked.
+func (p *Player) Events() <-chan Event { return p.events }
+
+// Done is closed once the connection to mpv is gone.
+func (p *Player) Done() <-chan struct{} { return p.done }
+
+// Close detaches from mpv, quitting it first if Start launched it.
+func (p *Player) Close() error {
+	if p.cmd != nil {
+		p.Command("quit")
+	}
+	return p.conn.Close()
+}
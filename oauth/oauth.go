@@ -0,0 +1,215 @@
+// Package oauth signs users in through OAuth 2.0 providers with the
+// authorization code flow, so they keep one identity across sessions and
+// devices. Google and GitHub need only client credentials; other providers
+// give their endpoints and user info fields.
+package oauth
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Provider is one configured sign-in provider.
+type Provider struct {
+	Name         string   `json:"name"`            // in URLs and identities, e.g. "google"
+	Label        string   `json:"label,omitempty"` // on the sign-in button; defaults to Name
+	ClientID     string   `json:"clientID"`
+	ClientSecret string   `json:"clientSecret"`
+	AuthURL      string   `json:"authURL,omitempty"`
+	TokenURL     string   `json:"tokenURL,omitempty"`
+	UserInfoURL  string   `json:"userInfoURL,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+	IDField      string   `json:"idField,omitempty"`   // user info field holding the stable user ID
+	NameField    string   `json:"nameField,omitempty"` // user info field holding the display name
+}
+
+// presets fill in what Google and GitHub configs leave out.
+var presets = map[string]Provider{
+	"google": {
+		Label:       "Google",
+		AuthURL:     "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:    "https://oauth2.googleapis.com/token",
+		UserInfoURL: "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:      []string{"openid", "profile"},
+		IDField:     "sub",
+		NameField:   "name",
+	},
+	"github": {
+		Label:       "GitHub",
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserInfoURL: "https://api.github.com/user",
+		Scopes:      []string{"read:user"},
+		IDField:     "id",
+		NameField:   "name",
+	},
+}
+
+// Identity is a signed-in user. ID is scoped by provider, e.g.
+// "github:583231", so two providers' users never collide.
+type Identity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Load reads providers from a JSON array in path.
+func Load(path string) ([]*Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var providers []*Provider
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range providers {
+		if preset, ok := presets[p.Name]; ok {
+			p.fill(preset)
+		}
+		if p.Label == "" {
+			p.Label = p.Name
+		}
+		switch {
+		case p.Name == "" || strings.ContainsAny(p.Name, ":/?&"):
+			return nil, fmt.Errorf("%s: provider name %q is not usable", path, p.Name)
+		case seen[p.Name]:
+			return nil, fmt.Errorf("%s: provider %q is listed twice", path, p.Name)
+		case p.ClientID == "" || p.AuthURL == "" || p.TokenURL == "" || p.UserInfoURL == "" || p.IDField == "":
+			return nil, fmt.Errorf("%s: provider %q needs clientID, authURL, tokenURL, userInfoURL and idField", path, p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return providers, nil
+}
+
+func (p *Provider) fill(preset Provider) {
+	if p.Label == "" {
+		p.Label = preset.Label
+	}
+	if p.AuthURL == "" {
+		p.AuthURL = preset.AuthURL
+	}
+	if p.TokenURL == "" {
+		p.TokenURL = preset.TokenURL
+	}
+	if p.UserInfoURL == "" {
+		p.UserInfoURL = preset.UserInfoURL
+	}
+	if p.Scopes == nil {
+		p.Scopes = preset.Scopes
+	}
+	if p.IDField == "" {
+		p.IDField = preset.IDField
+	}
+	if p.NameField == "" {
+		p.NameField = preset.NameField
+	}
+}
+
+// AuthCodeURL is where to send the user to sign in.
+func (p *Provider) AuthCodeURL(redirectURI, state string) string {
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.ClientID},
+		"redirect_uri":  {redirectURI},
+		"scope":         {strings.Join(p.Scopes, " ")},
+		"state":         {state},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + q.Encode()
+}
+
+// Exchange trades the code from the provider's redirect for an access
+// token and looks up who it belongs to.
+func (p *Provider) Exchange(ctx context.Context, code, redirectURI string) (Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers form-encoded unless asked for JSON
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := fetchJSON(req, &token); err != nil {
+		return Identity{}, fmt.Errorf("token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return Identity{}, fmt.Errorf("token: %s", cmp.Or(token.Error, "no access token"))
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, p.UserInfoURL, nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var info map[string]any
+	if err := fetchJSON(req, &info); err != nil {
+		return Identity{}, fmt.Errorf("user info: %w", err)
+	}
+	id := field(info, p.IDField)
+	if id == "" {
+		return Identity{}, errors.New("user info has no " + p.IDField)
+	}
+	// Fall back through the usual name fields; GitHub users may have no name
+	name := field(info, p.NameField)
+	for _, f := range []string{"name", "login", "preferred_username", "nickname"} {
+		if name != "" {
+			break
+		}
+		name = field(info, f)
+	}
+	return Identity{ID: p.Name + ":" + id, Name: name}, nil
+}
+
+func fetchJSON(req *http.Request, v any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// field reads a string or number from user info; numeric IDs such as
+// GitHub's come back as float64.
+func field(info map[string]any, name string) string {
+	switch v := info[name].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("sign-in is invalid or has expired")
+
+// Session is what the session cookie remembers about a signed-in user.
+type Session struct {
+	Identity
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// State round-trips through the provider: which provider the user went
+// to, where to send them back and the nonce their browser must still
+// hold in a cookie.
+type State struct {
+	Provider  string    `json:"provider"`
+	Return    string    `json:"return"`
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// Seal signs a session or state for purpose ("session" or "state"), so
+// one can't pass as the other.
+func Seal(secret []byte, purpose string, v any) string {
+	payload, _ := json.Marshal(v)
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + sign(secret, purpose, body)
+}
+
+// OpenSession checks a sealed session and that it hasn't expired.
+func OpenSession(secret []byte, sealed string, now time.Time) (Session, error) {
+	var s Session
+	if err := open(secret, "session", sealed, &s); err != nil || !now.Before(s.ExpiresAt) {
+		return Session{}, ErrInvalid
+	}
+	return s, nil
+}
+
+// OpenState checks a sealed state and that it hasn't expired.
+func OpenState(secret []byte, sealed string, now time.Time) (State, error) {
+	var s State
+	if err := open(secret, "state", sealed, &s); err != nil || !now.Before(s.ExpiresAt) {
+		return State{}, ErrInvalid
+	}
+	return s, nil
+}
+
+func open(secret []byte, purpose, sealed string, v any) error {
+	body, sig, ok := strings.Cut(sealed, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(secret, purpose, body))) {
+		return ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return ErrInvalid
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func sign(secret []byte, purpose, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose + ":" + body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
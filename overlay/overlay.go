@@ -0,0 +1,22 @@
+// Package overlay renders the transparent OBS browser-source page that shows
+// a room's chat, reactions and applause meter from its observer stream.
+package overlay
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+)
+
+//go:embed overlay.html
+var pageSource string
+
+var page = template.Must(template.New("overlay").Parse(pageSource))
+
+// Render writes the overlay page for a room code and read-state token.
+func Render(w io.Writer, roomCode, token string) error {
+	return page.Execute(w, struct {
+		Code  string
+		Token string
+	}{roomCode, token})
+}
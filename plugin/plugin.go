@@ -0,0 +1,91 @@
+// Package plugin lets downstream forks add features without patching the
+// hub. A plugin registers itself from an init function and is compiled in
+// with a blank import in main:
+//
+//	import _ "example.com/coopcinema-analytics"
+//
+// A plugin implements any subset of the optional interfaces below.
+package plugin
+
+import (
+	"coopcinema/hub"
+	"coopcinema/models"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Plugin is the minimum every plugin implements.
+type Plugin interface {
+	Name() string
+}
+
+// RoomHooks receives room lifecycle callbacks.
+type RoomHooks interface {
+	Hooks() hub.Hooks
+}
+
+// MessageHooks sees every inbound message. BeforeMessage may rewrite the
+// message or return false to drop it; AfterMessage runs once it was handled.
+type MessageHooks interface {
+	BeforeMessage(msg *models.Message, sender *models.Client) bool
+	AfterMessage(msg models.Message, sender *models.Client)
+}
+
+// MessageTypes handles custom message types.
+type MessageTypes interface {
+	MessageHandlers() map[string]hub.Handler
+}
+
+// Routes mounts custom HTTP routes.
+type Routes interface {
+	RegisterRoutes(mux *http.ServeMux, h *hub.Hub)
+}
+
+var (
+	mu      sync.Mutex
+	plugins []Plugin
+)
+
+// Register adds a plugin. Call it from an init function.
+func Register(p Plugin) {
+	mu.Lock()
+	defer mu.Unlock()
+	plugins = append(plugins, p)
+}
+
+// Install wires every registered plugin into the hub and mux.
+func Install(h *hub.Hub, mux *http.ServeMux) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, p := range plugins {
+		if rh, ok := p.(RoomHooks); ok {
+			h.AddHooks(rh.Hooks())
+		}
+		if mh, ok := p.(MessageHooks); ok {
+			h.Use(hub.StageFilter, messageMiddleware(mh))
+		}
+		if mt, ok := p.(MessageTypes); ok {
+			for msgType, handler := range mt.MessageHandlers() {
+				h.HandleType(msgType, handler)
+			}
+		}
+		if r, ok := p.(Routes); ok {
+			r.RegisterRoutes(mux, h)
+		}
+		log.Printf("🧩 Plugin %s loaded", p.Name())
+	}
+}
+
+func messageMiddleware(mh MessageHooks) hub.Middleware {
+	return func(next hub.Handler) hub.Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if !mh.BeforeMessage(&msg, sender) {
+				return
+			}
+			next(msg, sender)
+			mh.AfterMessage(msg, sender)
+		}
+	}
+}
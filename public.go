@@ -0,0 +1,20 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed public
+var embedded embed.FS
+
+// frontend is the web UI: dir on disk when one is given, so it can be
+// changed without a rebuild, else the copy built into the binary.
+func frontend(dir string) http.FileSystem {
+	if dir != "" {
+		return http.Dir(dir)
+	}
+	public, _ := fs.Sub(embedded, "public")
+	return http.FS(public)
+}
@@ -37,7 +37,12 @@ const nouns = [
 // Application state
 let ws;
 let currentRoom = null;
-let myUserId = generateId();
+let roomPassword = ''; // sent on every (re)connect to a private room
+let wsToken = ''; // sign-in token for /ws when the server requires one; '' when it doesn't
+let wsTokenOff = false; // the server said it doesn't use tokens
+let myPrefs = {}; // saved preferences, from /api/me/preferences or the join
+let signedIn = false; // an OAuth session names us; the server uses its ID
+let myUserId = ''; // the server tells us in hello
 let myUserName = "";
 let isLocalAction = false;
 let syncTimeout = null;
@@ -67,6 +72,9 @@ let dmPlayer = null;
 let dmReady = false;
 let dmIgnoreEvents = false;
 
+// Room accessibility setup (forced captions, audio description)
+let accessibility = { forceCaptions: false };
+
 // Chat state
 let chatOpen = false;
 
@@ -89,10 +97,6 @@ let statusInterval = null;
 // UTILITY FUNCTIONS
 // ============================================
 
-function generateId() {
-    return Math.random().toString(36).substr(2, 9);
-}
-
 function generateName() {
     const adj = adjectives[Math.floor(Math.random() * adjectives.length)];
     const noun = nouns[Math.floor(Math.random() * nouns.length)];
@@ -151,8 +155,20 @@ async function createRoom() {
         return;
     }
 
+    roomPassword = document.getElementById('roomPasswordInput').value;
+
     try {
-        const response = await fetch('/generate-room');
+        const response = roomPassword
+            ? await fetch('/generate-room', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ password: roomPassword })
+            })
+            : await fetch('/generate-room');
+        if (!response.ok) {
+            alert(await response.text());
+            return;
+        }
         const data = await response.json();
         currentRoom = data.code;
         isRoomCreator = true;
@@ -160,6 +176,7 @@ async function createRoom() {
         showRoom();
         connectWebSocket();
         saveRoomToStorage();
+        rememberName();
     } catch (error) {
         console.error('Error creating room:', error);
         alert('Failed to create room. Please try again.');
@@ -182,9 +199,11 @@ function joinRoom() {
 
     currentRoom = roomCode;
     isRoomCreator = false;
+    roomPassword = '';
     showRoom();
     connectWebSocket();
     saveRoomToStorage();
+    rememberName();
 }
 
 function showRoom() {
@@ -198,7 +217,11 @@ function showRoom() {
 }
 
 function leaveRoom() {
-    if (ws) ws.close();
+    leaveVoice();
+    // Closing normally gives up our place rather than holding it for a
+    // reconnect
+    sessionStorage.removeItem('coopcinema_resume');
+    if (ws) ws.close(1000);
 
     document.getElementById('lobby').style.display = 'block';
     document.getElementById('room').style.display = 'none';
@@ -236,6 +259,8 @@ function leaveRoom() {
 
     currentSource = 'none';
     currentSourceUrl = '';
+    queueState = { items: [] };
+    renderQueue();
     currentRoom = null;
     isHost = false;
     hostMode = false;
@@ -311,13 +336,92 @@ function dismissRejoin() {
     clearRoomStorage();
 }
 
+function rateSession(stars) {
+    feedbackRating = stars;
+    document.querySelectorAll('#feedbackStars button').forEach((b, i) => {
+        b.classList.toggle('selected', i < stars);
+    });
+    document.getElementById('feedbackSubmit').disabled = false;
+}
+
+async function submitFeedback() {
+    const body = {
+        token: feedbackToken,
+        rating: feedbackRating,
+        text: document.getElementById('feedbackText').value
+    };
+    try {
+        await fetch('/api/feedback', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        });
+    } catch (e) {
+        console.error('Could not send feedback:', e);
+    }
+    dismissFeedback();
+}
+
+function dismissFeedback() {
+    document.getElementById('feedbackModal').style.display = 'none';
+    feedbackToken = '';
+}
+
 // ============================================
 // WEBSOCKET CONNECTION
 // ============================================
 
-function connectWebSocket() {
+// fetchWsToken gets a fresh sign-in token for /ws, keeping our user ID
+// from the last one. Servers without token sign-in answer 404 once and
+// aren't asked again.
+async function fetchWsToken() {
+    if (wsTokenOff) return;
+    try {
+        const res = await fetch('/api/v1/token', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ name: myUserName, token: wsToken })
+        });
+        if (res.status === 404) {
+            wsTokenOff = true;
+            return;
+        }
+        if (!res.ok) return;
+        const data = await res.json();
+        wsToken = data.token;
+        myUserId = data.userID;
+    } catch (e) {
+        console.error('Could not get a sign-in token:', e);
+    }
+}
+
+async function connectWebSocket() {
+    await fetchWsToken();
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const wsUrl = `${protocol}//${window.location.host}/ws?room=${currentRoom}&name=${encodeURIComponent(myUserName)}&id=${myUserId}`;
+    let wsUrl = `${protocol}//${window.location.host}/ws?room=${currentRoom}&name=${encodeURIComponent(myUserName)}&v=${PROTOCOL_VERSION}`;
+    if (wsToken) wsUrl += `&token=${encodeURIComponent(wsToken)}`;
+    // Opt out of reaction floods when the viewer prefers reduced motion
+    const reducedMotion = window.matchMedia('(prefers-reduced-motion: reduce)').matches;
+    const caps = [];
+    if (!reducedMotion) caps.push('reactions');
+    if (voiceSupported()) caps.push('voice');
+    wsUrl += `&caps=${caps.join(',')}`;
+    const guestPass = new URLSearchParams(window.location.search).get('pass');
+    if (guestPass) wsUrl += `&pass=${encodeURIComponent(guestPass)}`;
+    const invite = new URLSearchParams(window.location.search).get('invite');
+    if (invite) wsUrl += `&invite=${encodeURIComponent(invite)}`;
+    // Coming back from a dropped connection (or a reload) takes our old
+    // place in the room
+    const resumeToken = sessionStorage.getItem('coopcinema_resume');
+    if (resumeToken) wsUrl += `&resume=${encodeURIComponent(resumeToken)}`;
+    // As a guest, this tab keeps the ID the server gave it
+    const claimToken = sessionStorage.getItem('coopcinema_claim');
+    if (claimToken) wsUrl += `&claim=${encodeURIComponent(claimToken)}`;
+    if (roomPassword) wsUrl += `&password=${encodeURIComponent(roomPassword)}`;
+    const deviceToken = localStorage.getItem('coopcinema_device');
+    if (deviceToken) wsUrl += `&device=${encodeURIComponent(deviceToken)}`;
+    // Opening the room link with ?record=1 agrees to a debug recording
+    if (new URLSearchParams(window.location.search).get('record') === '1') wsUrl += '&record=1';
 
     ws = new WebSocket(wsUrl);
 
@@ -326,23 +430,49 @@ function connectWebSocket() {
         document.getElementById('statusDot').className = 'status-dot connected';
         document.getElementById('statusText').textContent = 'Connected';
         startStatusUpdates();
+        startClockSync();
+        rejoinVoice();
     };
 
-    ws.onclose = () => {
+    ws.onclose = (event) => {
         console.log('Disconnected from room');
         document.getElementById('statusDot').className = 'status-dot disconnected';
-        document.getElementById('statusText').textContent = 'Reconnecting...';
 
         if (statusInterval) {
             clearInterval(statusInterval);
             statusInterval = null;
         }
 
+        if (roomClosed) return;
+        // Private room: ask for the password and try again right away
+        if (event.code === 4001) {
+            const password = prompt(`${event.reason} Enter the room password:`);
+            if (password) {
+                roomPassword = password;
+                connectWebSocket();
+            } else {
+                document.getElementById('statusText').textContent = event.reason;
+            }
+            return;
+        }
+        // Policy close (e.g. expired guest pass) or maintenance: show the
+        // reason, don't retry
+        if (event.code === 1008 || event.code === 1013) {
+            document.getElementById('statusText').textContent = event.reason || 'Disconnected';
+            return;
+        }
+        document.getElementById('statusText').textContent = 'Reconnecting...';
+
+        // A restarting server (1012) that didn't get to say when to come
+        // back: spread out the reconnects anyway
+        let delay = reconnectDelay || 3000;
+        if (!reconnectDelay && event.code === 1012) delay += Math.random() * 5000;
+        reconnectDelay = 0;
         setTimeout(() => {
             if (currentRoom) {
                 connectWebSocket();
             }
-        }, 3000);
+        }, delay);
     };
 
     ws.onerror = (error) => {
@@ -354,16 +484,108 @@ function connectWebSocket() {
     };
 }
 
+// The protocol version we speak: typed payloads, and userList only in them
+const PROTOCOL_VERSION = 3;
+
+// Offset between the server clock and ours, from timeSync probes (or
+// serverTime beacons until the first probe comes back)
+let serverClockOffset = 0;
+let roomClosed = false; // the host closed the room; don't reconnect
+let reconnectDelay = 0; // ms to wait before reconnecting, from serverShutdown
+let feedbackToken = ''; // from feedbackRequest, for rating the session once the room closes
+let feedbackRating = 0;
+
+function serverNow() {
+    return Date.now() + serverClockOffset;
+}
+
 function handleMessage(msg) {
+    if (msg.type === 'timeSync') {
+        handleClockSample(msg);
+        return;
+    }
+    if (msg.serverTime && !clockSynced) {
+        serverClockOffset = msg.serverTime - Date.now();
+    }
+    if (msg.type === 'serverTime') return;
+
+    if (msg.type === 'hello') {
+        console.log('Protocol version', msg.payload.version);
+        if (msg.userID) {
+            myUserId = msg.userID;
+            console.log('Your ID:', myUserId);
+        }
+        return;
+    }
+
+    // A message of ours the server refused; a bug rather than anything to
+    // tell the viewer about
+    if (msg.type === 'error') {
+        if (msg.payload && msg.payload.code === 'relayUnavailable') {
+            relayRefused(msg.payload.message);
+            return;
+        }
+        console.warn('Server refused a message:', msg.payload);
+        return;
+    }
+
+    if (msg.type === 'adaptHint') {
+        adaptHint = msg.hint;
+        console.log('Connection quality:', msg.content, adaptHint);
+        return;
+    }
+
+    if (msg.type === 'resumeToken') {
+        sessionStorage.setItem('coopcinema_resume', msg.content);
+        return;
+    }
+    if (msg.type === 'resumed') {
+        return;
+    }
+    // Kept for reconnecting as the same guest, and so this guest's history
+    // can be claimed after signing up
+    if (msg.type === 'claimToken') {
+        sessionStorage.setItem('coopcinema_claim', msg.content);
+        localStorage.setItem('coopcinema_claim', msg.content);
+        return;
+    }
+
+    // First visit: keep the token that our preferences will be saved under
+    if (msg.type === 'deviceToken') {
+        localStorage.setItem('coopcinema_device', msg.content);
+        rememberName();
+        return;
+    }
+
+    if (msg.type === 'preferences') {
+        applyPreferences(msg.preferences || {});
+        return;
+    }
+
+    // Waiting in the join queue of a busy room
+    if (msg.type === 'queued') {
+        document.getElementById('statusText').textContent = `In line to join (#${msg.content})`;
+        return;
+    }
+
     if (msg.type === 'userList') {
-        const users = JSON.parse(msg.userName);
+        document.getElementById('statusText').textContent = 'Connected';
+        const users = msg.payload.users;
         roomUsers = users;
+        const host = users.find(u => u.host);
+        if (host) hostUserId = host.id;
         updateUserList(users);
         handleUserListForStateSync(users);
         updateHostUI();
         return;
     }
 
+    // Secondary media slot (picture-in-picture)
+    if (msg.slot || msg.type === 'slotControl') {
+        handleSlotMessage(msg);
+        return;
+    }
+
     // Source loading messages
     if (msg.type === 'youtube') {
         loadYouTube(msg.url, false);
@@ -373,6 +595,26 @@ function handleMessage(msg) {
         loadDirectUrl(msg.url, false);
         return;
     }
+    if (msg.type === 'file') {
+        promptLocalFile(msg.url, null, msg.userID);
+        return;
+    }
+    if (msg.type === 'signal') {
+        handleSignal(msg);
+        return;
+    }
+    if (msg.type.startsWith('voice')) {
+        handleVoiceMessage(msg);
+        return;
+    }
+    if (msg.type.startsWith('relay')) {
+        handleRelayMessage(msg);
+        return;
+    }
+    if (msg.type === 'mediaRejected') {
+        alert(`The room can't play that: ${msg.content}.`);
+        return;
+    }
     if (msg.type === 'vimeo') {
         loadVimeo(msg.url, false);
         return;
@@ -388,7 +630,233 @@ function handleMessage(msg) {
 
     // Chat
     if (msg.type === 'chat') {
-        displayChatMessage(msg.userName, msg.content, false);
+        displayChatMessage(msg.chat.senderName, msg.chat.text, false, msg.chat.at);
+        return;
+    }
+    // What happened before we joined, with the recent chat; like
+    // chatHistory it replaces whatever a reconnect left behind
+    if (msg.type === 'catchUp') {
+        document.getElementById('chatMessages').innerHTML = '';
+        msg.catchUp.forEach(e => {
+            if (e.kind === 'chat') {
+                displayChatMessage(e.userName, e.text, e.userID === myUserId, e.at, true);
+            } else {
+                displayChatMessage(e.userName || 'Room', describeCatchUp(e), false, e.at, true);
+            }
+        });
+        return;
+    }
+    // Recent chat, on joining; it replaces whatever a reconnect left behind
+    if (msg.type === 'chatHistory') {
+        document.getElementById('chatMessages').innerHTML = '';
+        msg.history.forEach(c => displayChatMessage(c.senderName, c.text, c.senderID === myUserId, c.at, true));
+        return;
+    }
+
+    // Pre-roll before the feature
+    if (msg.type === 'preroll') {
+        showPreRoll(JSON.parse(msg.content));
+        return;
+    }
+    if (msg.type === 'prerollEnd') {
+        hidePreRoll();
+        return;
+    }
+
+    // Moved to a breakout room (or back to the main room)
+    if (msg.type === 'roomTransfer') {
+        handleRoomTransfer(msg);
+        return;
+    }
+
+    if (msg.type === 'qualityCap') {
+        qualityCap = parseInt(msg.content, 10) || 0;
+        applyQualityCap();
+        return;
+    }
+    if (msg.type === 'renditions') {
+        showRenditions(JSON.parse(msg.content));
+        return;
+    }
+
+    // Attention summaries: members heartbeat while the host has them on
+    if (msg.type === 'attentionMode') {
+        setAttentionHeartbeat(msg.content === 'on');
+        return;
+    }
+    if (msg.type === 'attention') {
+        const s = JSON.parse(msg.content);
+        let text = `👀 ${s.watching} of ${s.total} watching`;
+        if (s.away && s.away.length) text += ` (away: ${s.away.join(', ')})`;
+        document.getElementById('statusText').textContent = text;
+        return;
+    }
+
+    // Someone is guessing at this room's credentials (sent to the host only)
+    if (msg.type === 'joinAttack') {
+        displayChatMessage('🔒 Security', `${msg.content} failed attempts to join this room. New joins with a pass are paused for ${Math.ceil(msg.cooldown)}s.`, false);
+        return;
+    }
+
+    // DJ mode: only the DJ can load the next track
+    if (msg.type === 'dj') {
+        if (msg.content !== 'on') {
+            displayChatMessage('🎧 DJ', 'DJ mode is off. Anyone can load media.', false);
+        } else if (msg.userID === myUserId) {
+            displayChatMessage('🎧 DJ', "You're the DJ! Load the next track.", false);
+        } else {
+            displayChatMessage('🎧 DJ', `${msg.userName || 'Someone'} picks the next track. Use /voteskip to pass the turn on.`, false);
+        }
+        return;
+    }
+
+    // Transcoding of an upload of ours moved on
+    if (msg.type === 'mediaProgress') {
+        if (pendingStreams.has(msg.url)) {
+            document.getElementById('uploadStatus').textContent = `Preparing ${msg.content} for streaming: ${Math.round(msg.timestamp * 100)}%`;
+        }
+        return;
+    }
+    if (msg.type === 'mediaReady') {
+        for (const [source, stream] of pendingStreams) {
+            if (stream !== msg.url) continue;
+            pendingStreams.delete(source);
+            document.getElementById('uploadStatus').textContent = '';
+            loadDirectUrl(msg.url, true);
+        }
+        return;
+    }
+    if (msg.type === 'mediaFailed') {
+        // The original may still play in some browsers
+        if (pendingStreams.delete(msg.url)) {
+            document.getElementById('uploadStatus').textContent = `Could not convert ${msg.content}; playing the original file.`;
+            loadDirectUrl(msg.url, true);
+        }
+        return;
+    }
+
+    // Someone shared subtitles for what's playing
+    if (msg.type === 'subtitlesAvailable') {
+        loadSubtitles(msg.url, msg.timestamp);
+        displayChatMessage('💬 Subtitles', `Subtitles${msg.content ? ` "${msg.content}"` : ''} are on for everyone.`, false);
+        return;
+    }
+    if (msg.type === 'subtitlesRemoved') {
+        clearSubtitles();
+        return;
+    }
+    if (msg.type === 'subtitleOffset') {
+        setSubtitleOffset(msg.timestamp || 0);
+        return;
+    }
+
+    // The playlist changed, or we just joined a room with one
+    if (msg.type === 'queue') {
+        queueState = msg.queue || { items: [] };
+        renderQueue();
+        return;
+    }
+
+    // The host gave the room a new code; keep our link current
+    if (msg.type === 'codeRotated') {
+        currentRoom = msg.roomCode;
+        document.getElementById('roomCodeDisplay').textContent = currentRoom.toUpperCase();
+        window.history.replaceState({}, '', window.location.origin + msg.url);
+        saveRoomToStorage();
+        displayChatMessage('🔑 Room', `The room has a new code. Share ${window.location.origin + msg.url} from now on; old links no longer work.`, false);
+        return;
+    }
+
+    // The server is dropping our messages of one type for coming too fast
+    if (msg.type === 'rateLimited') {
+        displayChatMessage('⏳ Slow down', `Too many ${msg.content} messages; wait ${Math.ceil(msg.cooldown || 1)}s. Keep it up and you'll be disconnected.`, false);
+        return;
+    }
+
+    // The room's media link died (expired or removed); say what can be done
+    if (msg.type === 'mediaUnavailable') {
+        const hints = {
+            reshare: 'load a fresh link',
+            voteskip: 'vote to pass the DJ turn with /voteskip'
+        };
+        const options = (msg.suggestions || []).map(s => hints[s]).filter(Boolean);
+        let notice = `The video link stopped working (${msg.content}).`;
+        if (options.length) notice += ` You can ${options.join(', or ')}.`;
+        displayChatMessage('📼 Media', notice, false);
+        return;
+    }
+
+    // Some members are in countries where the provider won't play the media
+    if (msg.type === 'regionWarning') {
+        let who = `${msg.viewers} member${msg.viewers === 1 ? '' : 's'}`;
+        if (msg.userName) {
+            try { who = JSON.parse(msg.userName).join(', '); } catch (e) { /* keep the count */ }
+        }
+        displayChatMessage('🌍 Media', `This video isn't available where ${who} ${msg.viewers === 1 ? 'is' : 'are'}. Pick another before starting, or they'll be left out.`, false);
+        return;
+    }
+
+    // The server is restarting; the close frame follows, and we come back
+    // after the delay it suggests
+    if (msg.type === 'serverShutdown') {
+        reconnectDelay = (msg.cooldown || 3) * 1000;
+        displayChatMessage('🔄 Server', `${msg.content} Reconnecting in ${Math.ceil(msg.cooldown || 3)}s...`, false);
+        return;
+    }
+
+    // The server will close the room soon unless someone uses it
+    if (msg.type === 'roomExpiring') {
+        const minutes = Math.max(1, Math.round((msg.cooldown || 0) / 60));
+        const when = `in ${minutes} minute${minutes === 1 ? '' : 's'}`;
+        const notice = msg.content === 'ttl'
+            ? `This room reaches its time limit and closes ${when}.`
+            : `This room has been idle and closes ${when}. Play something or chat to keep it open.`;
+        displayChatMessage('⏰ Room', notice, false);
+        return;
+    }
+
+    // Sent just before roomClosed when the server collects feedback
+    if (msg.type === 'feedbackRequest') {
+        feedbackToken = msg.content;
+        return;
+    }
+
+    // The host or an admin ended the room, maybe pointing to another one
+    if (msg.type === 'roomClosed') {
+        if (feedbackToken) {
+            document.getElementById('feedbackModal').style.display = 'flex';
+        }
+        roomClosed = true;
+        clearRoomStorage();
+        document.getElementById('statusText').textContent = 'Room closed';
+        let notice = msg.content || 'This room has been closed.';
+        if (msg.url) notice += ` Continue in the new room: ${window.location.origin + msg.url}`;
+        displayChatMessage('🚪 Room', notice, false);
+        return;
+    }
+
+    // Slash command replies and polls
+    if (msg.type === 'commandResult') {
+        displayChatMessage('⚙️ /' + msg.command, msg.error || msg.content, false);
+        return;
+    }
+    if (msg.type === 'maintenance') {
+        showMaintenanceBanner(JSON.parse(msg.content));
+        return;
+    }
+    if (msg.type === 'accessibility') {
+        accessibility = JSON.parse(msg.content);
+        applyAccessibility();
+        return;
+    }
+    if (msg.type === 'milestone') {
+        displayChatMessage('🏆 Leaderboard', msg.content, false);
+        return;
+    }
+    if (msg.type === 'poll') {
+        const poll = JSON.parse(msg.content);
+        const lines = poll.options.map((opt, i) => `${i + 1}. ${opt} (${poll.tally[i]})`);
+        displayChatMessage('📊 Poll', `${poll.question}\n${lines.join('\n')}`, false);
         return;
     }
 
@@ -404,12 +872,30 @@ function handleMessage(msg) {
         return;
     }
 
+    // Where the room is, straight from the server on joining. sentAt is on
+    // the server's clock; handleStateSync expects ours.
+    if (msg.type === 'syncState') {
+        handleStateSync(Object.assign({}, msg, { sentAt: msg.sentAt - serverClockOffset }));
+        return;
+    }
+
     // State sync (for new joiners)
     if (msg.type === 'state') {
         handleStateSync(msg);
         return;
     }
 
+    // Wait for everyone: the server pauses and resumes the room
+    if (msg.type === 'waitMode') {
+        setWaitMode(msg.content === 'on');
+        return;
+    }
+    if (msg.type === 'waiting') {
+        showWaiting(JSON.parse(msg.content));
+        return;
+    }
+    if (msg.type === 'play') showWaiting([]);
+
     // Buffering sync
     if (msg.type === 'buffering') {
         peersBuffering.add(msg.userID);
@@ -435,6 +921,12 @@ function handleMessage(msg) {
         updateHostUI();
         return;
     }
+    // Hosting handed off, or the host left
+    if (msg.type === 'promote') {
+        hostUserId = msg.userID;
+        updateHostUI();
+        return;
+    }
 
     // Playback sync (play/pause/seek)
     handlePlaybackSync(msg);
@@ -444,8 +936,8 @@ function handlePlaybackSync(msg) {
     // In host mode, ignore sync from non-host
     if (hostMode && msg.userID !== hostUserId) return;
 
-    const sentAt = msg.sentAt || 0;
-    const latencyOffset = sentAt ? (Date.now() - sentAt) / 2000 : 0; // seconds
+    // Seconds; the viewer's own A/V offset rides along
+    const latencyOffset = sinceSent(msg, true) + (myPrefs.avOffset || 0);
 
     if (currentSource === 'youtube') {
         if (!ytPlayer || !ytReady) return;
@@ -572,8 +1064,7 @@ function sendMessage(type) {
 
     ws.send(JSON.stringify({
         type: type,
-        timestamp: timestamp,
-        sentAt: Date.now()
+        payload: { timestamp: timestamp, sentAt: Date.now() }
     }));
 }
 
@@ -592,6 +1083,13 @@ function updateUserList(users) {
         const badge = document.createElement('div');
         badge.className = 'user-badge' + (user.id === myUserId ? ' me' : '');
         badge.id = 'user-badge-' + user.id;
+        if (user.away) {
+            badge.classList.add('link-lost');
+            badge.title = 'Reconnecting...';
+        } else if (user.link && user.link !== 'healthy') {
+            badge.classList.add('link-' + user.link);
+            badge.title = user.link === 'lost' ? 'Connection lost?' : 'Unstable connection';
+        }
 
         let statusIcon = '';
         const st = userStatuses[user.id];
@@ -601,7 +1099,13 @@ function updateUserList(users) {
 
         const hostCrown = (hostMode && user.id === hostUserId) ? '<span class="host-crown">👑</span>' : '';
 
-        badge.innerHTML = hostCrown + statusIcon + user.name + (user.id === myUserId ? ' (You)' : '');
+        let voiceIcon = '';
+        if (user.voice) {
+            const speaking = user.speaking ? ' speaking' : '';
+            voiceIcon = `<span class="user-voice-icon${speaking}" id="user-voice-${user.id}">${user.muted ? '🔇' : '🎙️'}</span>`;
+        }
+
+        badge.innerHTML = hostCrown + voiceIcon + statusIcon + user.name + (user.id === myUserId ? ' (You)' : '');
 
         // Host transfer: click another user's badge to transfer host
         if (isHost && hostMode && user.id !== myUserId) {
@@ -644,6 +1148,20 @@ function handleUserListForStateSync(users) {
     if (sortedIds[0] !== myUserId) return; // only lowest responds
 
     // Send current state
+    const { timestamp, playing } = currentPlayback();
+
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({
+            type: 'state',
+            sourceType: currentSource,
+            url: currentSourceUrl,
+            payload: { timestamp: timestamp, playing: playing, sentAt: Date.now() }
+        }));
+    }
+}
+
+// currentPlayback reads the playhead from whichever player is active.
+function currentPlayback() {
     let timestamp = 0;
     let playing = false;
 
@@ -666,17 +1184,7 @@ function handleUserListForStateSync(users) {
             playing = !video.paused;
         }
     }
-
-    if (ws && ws.readyState === WebSocket.OPEN) {
-        ws.send(JSON.stringify({
-            type: 'state',
-            sourceType: currentSource,
-            url: currentSourceUrl,
-            timestamp: timestamp,
-            playing: playing,
-            sentAt: Date.now()
-        }));
-    }
+    return { timestamp, playing };
 }
 
 function handleStateSync(msg) {
@@ -695,13 +1203,19 @@ function handleStateSync(msg) {
         loadTwitch(url, false);
     } else if (srcType === 'dailymotion') {
         loadDailymotion(url, false);
-    } else if (srcType === 'file') {
+    } else if (srcType === 'url') {
         loadDirectUrl(url, false);
+    } else if (srcType === 'file') {
+        // Nothing to load until they open their copy
+        promptLocalFile(url, msg, msg.userID);
+        return;
     }
 
     // After load, seek to timestamp and set play state
     setTimeout(() => {
-        const target = msg.timestamp || 0;
+        // Playback moved on while the player was loading
+        const elapsed = msg.playing ? sinceSent(msg, false) : 0;
+        const target = (msg.timestamp || 0) + elapsed;
         if (srcType === 'youtube' && ytPlayer && ytReady) {
             ytPlayer.seekTo(target, true);
             if (msg.playing) ytPlayer.playVideo(); else ytPlayer.pauseVideo();
@@ -773,46 +1287,251 @@ function onLoadUrlClick() {
     }
 }
 
-// URL detection hint as user types
-function updateUrlHint() {
-    const url = document.getElementById('videoUrlInput').value.trim();
-    const hint = document.getElementById('urlDetectHint');
-    if (!url) { hint.textContent = ''; return; }
-    const type = detectSourceType(url);
-    const labels = {
-        youtube: 'YouTube video detected',
-        vimeo: 'Vimeo video detected',
-        twitch: 'Twitch stream/VOD detected',
-        dailymotion: 'Dailymotion video detected',
-        directurl: 'Direct video URL'
-    };
-    hint.textContent = labels[type] || '';
+// The load message a pasted link becomes, or null if it can't be played
+function mediaFromUrl(url) {
+    switch (detectSourceType(url)) {
+    case 'youtube': {
+        const id = extractYouTubeId(url);
+        return id ? { type: 'youtube', url: id } : null;
+    }
+    case 'vimeo': {
+        const id = extractVimeoId(url);
+        return id ? { type: 'vimeo', url: id } : null;
+    }
+    case 'twitch': {
+        const info = extractTwitchChannel(url);
+        return info ? { type: 'twitch', url: JSON.stringify(info) } : null;
+    }
+    case 'dailymotion': {
+        const id = extractDailymotionId(url);
+        return id ? { type: 'dailymotion', url: id } : null;
+    }
+    default:
+        return { type: 'directurl', url: url };
+    }
 }
 
 // ============================================
-// HIDE/SHOW PLAYERS
+// SHARED SUBTITLES
 // ============================================
 
-function hideAllPlayers() {
-    document.getElementById('videoPlayer').style.display = 'none';
-    document.getElementById('youtubePlayerContainer').style.display = 'none';
-    document.getElementById('vimeoPlayerContainer').style.display = 'none';
-    document.getElementById('twitchPlayerContainer').style.display = 'none';
-    document.getElementById('dailymotionPlayerContainer').style.display = 'none';
+let subtitleCues = [];
+let subtitleOffset = 0; // seconds added to every cue's times, shared by the room
+let subtitleTimer = null;
+
+// The server always sends plain WebVTT: a header, then blank-line
+// separated cues of a timing line and text
+function parseVtt(text) {
+    const toSeconds = (t) => {
+        const [h, m, s] = t.trim().split(':');
+        return Number(h) * 3600 + Number(m) * 60 + Number(s);
+    };
+    const cues = [];
+    for (const block of text.replace(/\r/g, '').split(/\n\n+/)) {
+        const lines = block.split('\n');
+        const timing = lines.findIndex(line => line.includes('-->'));
+        if (timing < 0) continue;
+        const [start, end] = lines[timing].split('-->');
+        cues.push({
+            start: toSeconds(start),
+            end: toSeconds(end),
+            text: lines.slice(timing + 1).join('\n').replace(/<[^>]*>/g, '')
+        });
+    }
+    return cues;
 }
 
-function activatePlayerView() {
-    document.getElementById('dropZone').style.display = 'none';
-    document.querySelector('.yt-divider').style.display = 'none';
-    document.getElementById('urlInputGroup').style.display = 'none';
-    document.querySelector('.video-container').classList.add('active');
-    document.getElementById('reactionBar').style.display = 'flex';
-    document.getElementById('customControlsBar').style.display = 'flex';
+async function loadSubtitles(url, offset) {
+    try {
+        const response = await fetch(url);
+        if (!response.ok) return;
+        subtitleCues = parseVtt(await response.text());
+    } catch (e) {
+        console.error('Subtitles failed to load:', e);
+        return;
+    }
+    setSubtitleOffset(offset || 0);
+    document.getElementById('subtitleOffsetControls').style.display = 'inline';
+    if (!subtitleTimer) subtitleTimer = setInterval(renderSubtitle, 200);
 }
 
-// ============================================
-// YOUTUBE PLAYER
-// ============================================
+function clearSubtitles() {
+    subtitleCues = [];
+    subtitleOffset = 0;
+    if (subtitleTimer) {
+        clearInterval(subtitleTimer);
+        subtitleTimer = null;
+    }
+    document.getElementById('subtitleOverlay').innerHTML = '';
+    document.getElementById('subtitleOffsetControls').style.display = 'none';
+}
+
+function renderSubtitle() {
+    const at = currentPlayback().timestamp;
+    const active = subtitleCues.filter(c => c.start + subtitleOffset <= at && at < c.end + subtitleOffset);
+    const overlay = document.getElementById('subtitleOverlay');
+    const text = active.map(c => c.text).join('\n');
+    if (overlay.dataset.text === text) return;
+    overlay.dataset.text = text;
+    overlay.innerHTML = '';
+    if (text) {
+        const span = document.createElement('span');
+        span.textContent = text;
+        overlay.appendChild(span);
+    }
+}
+
+function setSubtitleOffset(offset) {
+    subtitleOffset = offset;
+    document.getElementById('subtitleOffsetDisplay').textContent = `${offset > 0 ? '+' : ''}${offset.toFixed(1)}s`;
+}
+
+// Shift everyone's subtitles; in host mode only the host's change sticks
+function nudgeSubtitles(delta) {
+    setSubtitleOffset(Math.round((subtitleOffset + delta) * 10) / 10);
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'subtitleOffset', timestamp: subtitleOffset }));
+    }
+}
+
+async function uploadSubtitles(file) {
+    const form = new FormData();
+    form.append('file', file);
+    const headers = { 'X-Device-Token': localStorage.getItem('coopcinema_device') || '' };
+    if (roomPassword) headers['X-Room-Password'] = roomPassword;
+    const response = await fetch(`/api/v1/rooms/${encodeURIComponent(currentRoom)}/subtitles`, {
+        method: 'POST',
+        headers: headers,
+        body: form
+    });
+    if (!response.ok) {
+        alert(`Could not share subtitles: ${(await response.text()).trim()}`);
+    }
+}
+
+// ============================================
+// PLAYLIST
+// ============================================
+
+let queueState = { items: [] };
+
+function onQueueAddClick() {
+    const input = document.getElementById('queueUrlInput');
+    const link = input.value.trim();
+    if (!link) return;
+    const media = mediaFromUrl(link);
+    if (!media) {
+        alert('Could not recognize that video link');
+        return;
+    }
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify({ type: 'queueAdd', sourceType: media.type, url: media.url, content: link }));
+    input.value = '';
+}
+
+function sendQueue(type, content) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: type, content: content }));
+    }
+}
+
+function moveQueueItem(index) {
+    const ids = queueState.items.map(item => item.id);
+    [ids[index - 1], ids[index]] = [ids[index], ids[index - 1]];
+    sendQueue('queueReorder', JSON.stringify(ids));
+}
+
+function renderQueue() {
+    const now = document.getElementById('queueNow');
+    now.textContent = queueState.current ? `▶ Now playing: ${queueState.current.title || queueState.current.url}` : '';
+
+    const list = document.getElementById('queueList');
+    list.innerHTML = '';
+    queueState.items.forEach((item, i) => {
+        const li = document.createElement('li');
+        const title = document.createElement('span');
+        title.className = 'queue-title';
+        title.textContent = item.title || item.url;
+        title.title = item.title || item.url;
+        li.appendChild(title);
+        if (item.addedBy) {
+            const by = document.createElement('span');
+            by.className = 'queue-by';
+            by.textContent = item.addedBy;
+            li.appendChild(by);
+        }
+        if (i > 0) {
+            const up = document.createElement('button');
+            up.className = 'btn-icon';
+            up.title = 'Move up';
+            up.textContent = '⬆';
+            up.onclick = () => moveQueueItem(i);
+            li.appendChild(up);
+        }
+        const remove = document.createElement('button');
+        remove.className = 'btn-icon';
+        remove.title = 'Remove';
+        remove.textContent = '✕';
+        remove.onclick = () => sendQueue('queueRemove', item.id);
+        li.appendChild(remove);
+        list.appendChild(li);
+    });
+    document.getElementById('queueSkipBtn').style.display = queueState.items.length ? 'inline-block' : 'none';
+}
+
+// Tell the server what we were playing ran out, so the queue moves on
+function sendEnded() {
+    if (ws && ws.readyState === WebSocket.OPEN && currentSourceUrl) {
+        ws.send(JSON.stringify({ type: 'ended', url: currentSourceUrl }));
+    }
+}
+
+// URL detection hint as user types
+function updateUrlHint() {
+    const url = document.getElementById('videoUrlInput').value.trim();
+    const hint = document.getElementById('urlDetectHint');
+    if (!url) { hint.textContent = ''; return; }
+    const type = detectSourceType(url);
+    const labels = {
+        youtube: 'YouTube video detected',
+        vimeo: 'Vimeo video detected',
+        twitch: 'Twitch stream/VOD detected',
+        dailymotion: 'Dailymotion video detected',
+        directurl: 'Direct video URL'
+    };
+    hint.textContent = labels[type] || '';
+}
+
+// ============================================
+// HIDE/SHOW PLAYERS
+// ============================================
+
+function hideAllPlayers() {
+    // Subtitles belong to the media they were shared for
+    clearSubtitles();
+    document.getElementById('videoPlayer').style.display = 'none';
+    document.getElementById('youtubePlayerContainer').style.display = 'none';
+    document.getElementById('vimeoPlayerContainer').style.display = 'none';
+    document.getElementById('twitchPlayerContainer').style.display = 'none';
+    document.getElementById('dailymotionPlayerContainer').style.display = 'none';
+    if (hlsPlayer) {
+        hlsPlayer.destroy();
+        hlsPlayer = null;
+    }
+}
+
+function activatePlayerView() {
+    document.getElementById('dropZone').style.display = 'none';
+    document.querySelector('.yt-divider').style.display = 'none';
+    document.getElementById('urlInputGroup').style.display = 'none';
+    document.querySelector('.video-container').classList.add('active');
+    document.getElementById('reactionBar').style.display = 'flex';
+    document.getElementById('customControlsBar').style.display = 'flex';
+}
+
+// ============================================
+// YOUTUBE PLAYER
+// ============================================
 
 function onYouTubeIframeAPIReady() {
     console.log('YouTube IFrame API ready');
@@ -827,16 +1546,17 @@ function loadYouTube(videoId, broadcast) {
 
     if (ytPlayer && ytReady) {
         ytPlayer.loadVideoById(videoId);
+        applyAccessibility();
     } else {
         ytPlayer = new YT.Player('youtubePlayerContainer', {
             videoId: videoId,
-            playerVars: { autoplay: 0, controls: 1, rel: 0, modestbranding: 1 },
-            events: { onReady: onYTPlayerReady, onStateChange: onYTStateChange }
+            playerVars: { autoplay: 0, controls: 1, rel: 0, modestbranding: 1, cc_load_policy: accessibility.forceCaptions ? 1 : 0 },
+            events: { onReady: onYTPlayerReady, onStateChange: onYTStateChange, onPlaybackQualityChange: onYTQualityChange }
         });
     }
 
     if (broadcast && ws && ws.readyState === WebSocket.OPEN) {
-        ws.send(JSON.stringify({ type: 'youtube', url: videoId }));
+        ws.send(JSON.stringify({ type: 'setMedia', sourceType: 'youtube', url: videoId }));
     }
 }
 
@@ -844,6 +1564,8 @@ function onYTPlayerReady() {
     ytReady = true;
     ytLastKnownTime = 0;
     showYTControls();
+    applyAccessibility();
+    applyQualityCap();
 }
 
 function onYTStateChange(event) {
@@ -860,6 +1582,8 @@ function onYTStateChange(event) {
         sendMessage('pause');
     } else if (event.data === YT.PlayerState.BUFFERING) {
         sendBuffering(true);
+    } else if (event.data === YT.PlayerState.ENDED) {
+        sendEnded();
     }
 
     if (event.data === YT.PlayerState.PLAYING || event.data === YT.PlayerState.PAUSED) {
@@ -908,6 +1632,7 @@ function loadVimeo(videoId, broadcast) {
     vimeoPlayer.on('timeupdate', (data) => {
         vimeoLastTime = data.seconds;
     });
+    vimeoPlayer.on('ended', sendEnded);
     vimeoPlayer.on('bufferstart', () => sendBuffering(true));
     vimeoPlayer.on('bufferend', () => sendBuffering(false));
 
@@ -1035,6 +1760,8 @@ function loadDailymotion(videoId, broadcast) {
 // DIRECT URL PLAYER
 // ============================================
 
+let hlsPlayer = null; // hls.js, for HLS streams where the browser can't play them itself
+
 function loadDirectUrl(url, broadcast) {
     currentSource = 'file';
     currentSourceUrl = url;
@@ -1043,10 +1770,17 @@ function loadDirectUrl(url, broadcast) {
 
     const video = document.getElementById('videoPlayer');
     video.style.display = 'block';
-    video.src = url;
+    const isHls = new URL(url, location.href).pathname.endsWith('.m3u8');
+    if (isHls && !video.canPlayType('application/vnd.apple.mpegurl') && window.Hls && Hls.isSupported()) {
+        hlsPlayer = new Hls();
+        hlsPlayer.loadSource(url);
+        hlsPlayer.attachMedia(video);
+    } else {
+        video.src = url;
+    }
 
     if (broadcast && ws && ws.readyState === WebSocket.OPEN) {
-        ws.send(JSON.stringify({ type: 'directurl', url: url }));
+        ws.send(JSON.stringify({ type: 'setMedia', sourceType: 'url', url: url }));
     }
 }
 
@@ -1098,6 +1832,201 @@ video.addEventListener('playing', () => {
     if (currentSource === 'file') sendBuffering(false);
 });
 
+video.addEventListener('ended', () => {
+    if (currentSource === 'file') sendEnded();
+});
+
+video.addEventListener('loadedmetadata', applyAccessibility);
+video.addEventListener('resize', () => reportRendition(video.videoHeight));
+
+// ============================================
+// PICTURE-IN-PICTURE (secondary media slot)
+// ============================================
+
+const pip = document.getElementById('pipPlayer');
+let pipController = ''; // user ID the host handed the slot to, '' for anyone
+let pipRemoteAction = false;
+
+function mayControlPip() {
+    return !pipController || pipController === myUserId || hostUserId === myUserId;
+}
+
+function sendSlot(type, extra) {
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify(Object.assign({ type: type, slot: 'secondary' }, extra)));
+}
+
+function openPip(url) {
+    pip.src = url;
+    pip.classList.add('active');
+}
+
+function closePip() {
+    pip.pause();
+    pip.removeAttribute('src');
+    pip.load();
+    pip.classList.remove('active');
+}
+
+function handleSlotMessage(msg) {
+    if (msg.type === 'slotControl') {
+        pipController = msg.userID || '';
+        return;
+    }
+    if (msg.slot !== 'secondary') return;
+
+    switch (msg.type) {
+    case 'directurl':
+        openPip(msg.url);
+        return;
+    case 'slotClear':
+        closePip();
+        return;
+    case 'play':
+    case 'pause':
+    case 'seek':
+    case 'state': {
+        if (!pip.classList.contains('active')) return;
+        const latencyOffset = sinceSent(msg, true);
+        const target = msg.timestamp + (msg.type === 'pause' ? 0 : latencyOffset);
+        const playing = msg.type === 'play' || (msg.type === 'state' && msg.playing);
+        const stopped = msg.type === 'pause' || (msg.type === 'state' && !msg.playing);
+        pipRemoteAction = true;
+        if (Math.abs(pip.currentTime - target) > 0.5) pip.currentTime = target;
+        if (playing && pip.paused) pip.play().catch(() => {});
+        if (stopped && !pip.paused) pip.pause();
+        setTimeout(() => { pipRemoteAction = false; }, 300);
+        return;
+    }
+    default:
+        // Only files can be shown picture-in-picture for now
+        console.log('Unsupported secondary media:', msg.type);
+    }
+}
+
+// "/pip <url>" opens the secondary slot for everyone, "/pip off" closes it
+function handlePipCommand(text) {
+    const arg = text.slice('/pip'.length).trim();
+    if (!mayControlPip()) {
+        displayChatMessage('⚙️ /pip', 'The host gave the picture-in-picture slot to someone else', false);
+        return;
+    }
+    if (arg === 'off') {
+        closePip();
+        sendSlot('slotClear');
+    } else if (arg) {
+        openPip(arg);
+        sendSlot('directurl', { url: arg });
+    }
+}
+
+['play', 'pause', 'seeked'].forEach(event => {
+    pip.addEventListener(event, () => {
+        if (pipRemoteAction || !mayControlPip()) return;
+        sendSlot(event === 'seeked' ? 'seek' : event, { timestamp: pip.currentTime, sentAt: Date.now() });
+    });
+});
+
+// ============================================
+// ACCESSIBILITY
+// ============================================
+
+function matchesLanguage(track, lang) {
+    return !lang || (track.language || '').toLowerCase().startsWith(lang.toLowerCase());
+}
+
+function applyAccessibility() {
+    if (currentSource === 'youtube' && ytPlayer && ytReady) {
+        if (accessibility.forceCaptions) {
+            ytPlayer.loadModule('captions');
+            ytPlayer.setOption('captions', 'track', { languageCode: accessibility.captionLanguage || myPrefs.subtitleLanguage || 'en' });
+        } else {
+            ytPlayer.unloadModule('captions');
+        }
+    }
+
+    if (currentSource === 'file') {
+        let shown = false;
+        for (const track of video.textTracks) {
+            const pick = accessibility.forceCaptions && !shown &&
+                (track.kind === 'captions' || track.kind === 'subtitles') &&
+                matchesLanguage(track, accessibility.captionLanguage || myPrefs.subtitleLanguage);
+            if (pick) {
+                track.mode = 'showing';
+                shown = true;
+            } else if (accessibility.forceCaptions) {
+                track.mode = 'disabled';
+            }
+        }
+
+        // audioTracks is only exposed by some browsers
+        if (accessibility.audioDescription && video.audioTracks) {
+            const tracks = Array.from(video.audioTracks);
+            const described = tracks.find(t => t.kind === 'description' && matchesLanguage(t, accessibility.audioDescription)) ||
+                tracks.find(t => matchesLanguage(t, accessibility.audioDescription));
+            if (described) tracks.forEach(t => { t.enabled = t === described; });
+        }
+    }
+}
+
+// Attention heartbeats: tab visibility and playhead, sent only while the
+// host has attention summaries on.
+let attentionTimer = null;
+
+function sendHeartbeat() {
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify({
+        type: 'heartbeat',
+        content: document.hidden ? 'hidden' : 'visible',
+        timestamp: currentPlayback().timestamp
+    }));
+}
+
+function setAttentionHeartbeat(on) {
+    clearInterval(attentionTimer);
+    attentionTimer = null;
+    document.removeEventListener('visibilitychange', sendHeartbeat);
+    if (!on) {
+        displayChatMessage('👀 Attention', 'The host turned attention summaries off.', false);
+        return;
+    }
+    displayChatMessage('👀 Attention', 'The host sees how many people are watching (tab visible and video moving).', false);
+    document.addEventListener('visibilitychange', sendHeartbeat);
+    attentionTimer = setInterval(sendHeartbeat, 15000);
+    sendHeartbeat();
+}
+
+// Quality: tell the room what we're playing and respect the host's cap.
+// YouTube names its renditions; everything else reports a height.
+const ytQualityHeights = { tiny: 144, small: 240, medium: 360, large: 480, hd720: 720, hd1080: 1080, hd1440: 1440, hd2160: 2160, highres: 4320 };
+let qualityCap = 0;
+let reportedRendition = -1;
+
+function reportRendition(height) {
+    if (!height || height === reportedRendition) return;
+    reportedRendition = height;
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'rendition', content: String(height) }));
+    }
+}
+
+function onYTQualityChange(event) {
+    reportRendition(ytQualityHeights[event.data]);
+}
+
+function applyQualityCap() {
+    if (currentSource !== 'youtube' || !ytPlayer || !ytReady || !qualityCap) return;
+    const allowed = Object.keys(ytQualityHeights).filter(q => ytQualityHeights[q] <= qualityCap);
+    if (allowed.length) ytPlayer.setPlaybackQuality(allowed[allowed.length - 1]);
+}
+
+function showRenditions(list) {
+    list.forEach(r => {
+        const badge = document.getElementById('user-badge-' + r.userID);
+        if (badge) badge.title = `Playing ${r.height}p`;
+    });
+}
+
 // ============================================
 // FILE HANDLING
 // ============================================
@@ -1128,19 +2057,615 @@ fileInput.addEventListener('change', (e) => {
     handleFile(e.target.files[0]);
 });
 
+// Upload a video to the room so everyone streams the same file, then load
+// it for the room like any direct URL. Videos the server transcodes are
+// loaded once mediaReady says their HLS stream is done.
+const pendingStreams = new Map(); // uploaded file URL -> HLS playlist URL
+const uploadInput = document.getElementById('uploadInput');
+
+document.getElementById('uploadShareBtn').addEventListener('click', (e) => {
+    e.stopPropagation();
+    uploadInput.click();
+});
+
+uploadInput.addEventListener('click', (e) => e.stopPropagation());
+
+uploadInput.addEventListener('change', (e) => {
+    if (e.target.files.length) uploadVideo(e.target.files[0]);
+    e.target.value = '';
+});
+
+function uploadVideo(file) {
+    const button = document.getElementById('uploadShareBtn');
+    const status = document.getElementById('uploadStatus');
+    const form = new FormData();
+    form.append('file', file);
+
+    // XMLHttpRequest, unlike fetch, reports upload progress
+    const xhr = new XMLHttpRequest();
+    xhr.open('POST', `/api/v1/rooms/${encodeURIComponent(currentRoom)}/media`);
+    xhr.setRequestHeader('X-Device-Token', localStorage.getItem('coopcinema_device') || '');
+    if (roomPassword) xhr.setRequestHeader('X-Room-Password', roomPassword);
+    xhr.upload.onprogress = (e) => {
+        if (e.lengthComputable) status.textContent = `Uploading ${file.name}: ${Math.floor(e.loaded / e.total * 100)}%`;
+    };
+    xhr.onload = () => {
+        button.disabled = false;
+        if (xhr.status !== 201) {
+            status.textContent = `Upload failed: ${xhr.responseText.trim()}`;
+            return;
+        }
+        const upload = JSON.parse(xhr.responseText);
+        if (upload.stream) {
+            pendingStreams.set(upload.url, upload.stream);
+            status.textContent = `Preparing ${file.name} for streaming…`;
+            return;
+        }
+        status.textContent = '';
+        loadDirectUrl(upload.url, true);
+    };
+    xhr.onerror = () => {
+        button.disabled = false;
+        status.textContent = 'Upload failed: connection lost';
+    };
+    button.disabled = true;
+    status.textContent = `Uploading ${file.name}…`;
+    xhr.send(form);
+}
+
+// The local file the room is playing, and where it was when we joined,
+// until we open our copy
+let pendingLocalFile = null;
+
 function handleFile(file) {
     if (file && file.type.startsWith('video/')) {
         currentSource = 'file';
+        currentSourceUrl = file.name;
+        localShareFile = file;
+        document.querySelector('#dropZone .drop-text').textContent = 'Drop your video file here';
+        document.getElementById('p2pFetchBtn').style.display = 'none';
         const url = URL.createObjectURL(file);
-        video.src = url;
         hideAllPlayers();
+        video.src = url;
         video.style.display = 'block';
         activatePlayerView();
+
+        const pending = pendingLocalFile;
+        pendingLocalFile = null;
+        if (pending && pending.name === file.name) {
+            // Catch up with the room instead of restarting it for everyone
+            if (pending.state) {
+                const elapsed = pending.state.playing ? sinceSent(pending.state, false) : 0;
+                video.currentTime = (pending.state.timestamp || 0) + elapsed;
+                if (pending.state.playing) video.play().catch(() => {});
+            }
+            return;
+        }
+        if (ws && ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify({ type: 'setMedia', sourceType: 'file', url: file.name }));
+        }
     } else {
         alert('Please select a valid video file');
     }
 }
 
+// Someone is playing a local file: everyone opens their own copy of it, or
+// copies it from the sharer's browser. state is the syncState we joined
+// with, if that's how we heard.
+function promptLocalFile(name, state, sharerID) {
+    if (currentSource === 'file' && currentSourceUrl === name) return;
+    pendingLocalFile = { name, state, sharerID };
+    document.getElementById('p2pFetchBtn').style.display = sharerID && sharerID !== myUserId && window.RTCPeerConnection ? '' : 'none';
+    displayChatMessage('🎞️ Local file', `The room is playing "${name}". Open your copy of it to watch along.`, false);
+
+    hideAllPlayers();
+    video.pause();
+    currentSource = 'none';
+    document.getElementById('dropZone').style.display = 'block';
+    document.querySelector('.video-container').classList.remove('active');
+    document.querySelector('#dropZone .drop-text').textContent = `Open your copy of "${name}"`;
+}
+
+// ============================================
+// PEER-TO-PEER FILE TRANSFER
+// ============================================
+
+// A member without the room's local file can copy it from the member who
+// shared it over a WebRTC data channel. The server only relays the
+// offer, answer and ICE candidates as signal messages; the file goes
+// straight between the two browsers, unless they can't reach each other,
+// when it falls back to a relay through the server (see RELAY FALLBACK).
+
+const P2P_CHUNK = 16 * 1024;
+const P2P_ICE = [{ urls: 'stun:stun.l.google.com:19302' }];
+let localShareFile = null; // the local file we're playing, offered to peers who ask
+const peerLinks = new Map(); // user ID -> RTCPeerConnection
+
+function sendSignal(to, signal) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'signal', to: to, signal: signal }));
+    }
+}
+
+// onFailed, if given, is called when the connection can't be made
+function newPeerLink(peerID, onFailed) {
+    closePeerLink(peerID);
+    const pc = new RTCPeerConnection({ iceServers: P2P_ICE });
+    pc.onicecandidate = (e) => {
+        if (e.candidate) sendSignal(peerID, { kind: 'candidate', candidate: e.candidate });
+    };
+    pc.onconnectionstatechange = () => {
+        if (pc.connectionState === 'failed' && onFailed) onFailed();
+        if (pc.connectionState === 'failed' || pc.connectionState === 'closed') closePeerLink(peerID, pc);
+    };
+    peerLinks.set(peerID, pc);
+    return pc;
+}
+
+function closePeerLink(peerID, only) {
+    const pc = peerLinks.get(peerID);
+    if (!pc || (only && pc !== only)) return;
+    peerLinks.delete(peerID);
+    pc.close();
+}
+
+// Ask the sharer for the pending file and open it once it has all arrived
+async function fetchFromPeer() {
+    const pending = pendingLocalFile;
+    if (!pending || !pending.sharerID) return;
+    const status = document.getElementById('uploadStatus');
+    const button = document.getElementById('p2pFetchBtn');
+    button.disabled = true;
+
+    const receive = fileReceiver(pending.name, () => {
+        closePeerLink(pending.sharerID, pc);
+        if (relayFile && relayFile.receive === receive) {
+            closeRelay(pending.sharerID, 'file');
+            relayFile = null;
+        }
+    });
+    const pc = newPeerLink(pending.sharerID, () => {
+        if (receive.started()) return;
+        status.textContent = `Can't reach them directly; asking the server to pass ${pending.name} on…`;
+        relayFile = { peerID: pending.sharerID, receive };
+        openRelay(pending.sharerID, 'file');
+    });
+    const channel = pc.createDataChannel('file');
+    channel.binaryType = 'arraybuffer';
+    channel.onmessage = (e) => receive(typeof e.data === 'string' ? JSON.parse(e.data) : e.data);
+    channel.onclose = () => receive.cutOff();
+
+    const offer = await pc.createOffer();
+    await pc.setLocalDescription(offer);
+    sendSignal(pending.sharerID, { kind: 'offer', sdp: pc.localDescription, name: pending.name });
+    status.textContent = `Asking for ${pending.name}…`;
+}
+
+async function handleSignal(msg) {
+    const signal = msg.signal || {};
+    if (signal.kind === 'offer') {
+        // Someone wants our file
+        const pc = newPeerLink(msg.userID);
+        pc.ondatachannel = (e) => sendFileTo(e.channel, signal.name, msg.userID, pc);
+        await pc.setRemoteDescription(signal.sdp);
+        const answer = await pc.createAnswer();
+        await pc.setLocalDescription(answer);
+        sendSignal(msg.userID, { kind: 'answer', sdp: pc.localDescription });
+        return;
+    }
+    const pc = peerLinks.get(msg.userID);
+    if (!pc) return;
+    if (signal.kind === 'answer') {
+        await pc.setRemoteDescription(signal.sdp);
+    } else if (signal.kind === 'candidate') {
+        await pc.addIceCandidate(signal.candidate).catch(() => {});
+    }
+}
+
+// fileReceiver takes a transfer's header object, then its bytes as
+// ArrayBuffers, and opens the file once it has all arrived, calling done
+// when the transfer is over either way
+function fileReceiver(name, done) {
+    const status = document.getElementById('uploadStatus');
+    const button = document.getElementById('p2pFetchBtn');
+    let header = null;
+    let received = 0;
+    const chunks = [];
+    const receive = (data) => {
+        if (!header) {
+            header = data;
+            if (header.error) {
+                status.textContent = `Could not get ${name}: ${header.error}`;
+                button.disabled = false;
+                done();
+            }
+            return;
+        }
+        chunks.push(data);
+        received += data.byteLength;
+        status.textContent = `Receiving ${header.name}: ${Math.floor(received / header.size * 100)}%`;
+        if (received >= header.size) {
+            status.textContent = '';
+            button.disabled = false;
+            done();
+            handleFile(new File(chunks, header.name, { type: header.type }));
+        }
+    };
+    receive.started = () => header !== null;
+    receive.cutOff = () => {
+        if (header && received < header.size) {
+            status.textContent = `The transfer of ${header.name} was cut off.`;
+            button.disabled = false;
+        }
+    };
+    return receive;
+}
+
+// Send our local file down a data channel: a JSON header, then the bytes,
+// pausing whenever the channel's buffer fills
+function sendFileTo(channel, name, peerID, pc) {
+    channel.binaryType = 'arraybuffer';
+    channel.onopen = async () => {
+        const file = localShareFile;
+        if (!file || file.name !== name) {
+            channel.send(JSON.stringify({ error: 'they are not playing that file any more' }));
+            return;
+        }
+        displayChatMessage('📤 Sharing', `Sending "${file.name}" to a member, peer to peer.`, false);
+        channel.send(JSON.stringify({ name: file.name, size: file.size, type: file.type }));
+        channel.bufferedAmountLowThreshold = P2P_CHUNK * 16;
+        for (let offset = 0; offset < file.size; offset += P2P_CHUNK) {
+            if (channel.readyState !== 'open') return;
+            if (channel.bufferedAmount > P2P_CHUNK * 64) {
+                await new Promise(resolve => { channel.onbufferedamountlow = resolve; });
+            }
+            channel.send(await file.slice(offset, offset + P2P_CHUNK).arrayBuffer());
+        }
+    };
+    channel.onclose = () => closePeerLink(peerID, pc);
+}
+
+document.getElementById('p2pFetchBtn').addEventListener('click', (e) => {
+    e.stopPropagation();
+    fetchFromPeer();
+});
+
+// ============================================
+// VOICE CHAT
+// ============================================
+
+// Members in voice chat each hold an audio connection to every other
+// member in it. Whoever is already in voice offers the connection to a
+// newcomer; the server relays the signaling as voiceSignal.
+
+let voiceStream = null; // our microphone, while in voice chat
+let voiceMuted = true;
+let voiceSpeaking = false;
+let voiceMeter = null; // interval watching our microphone level
+const voicePeers = new Map(); // user ID -> { pc, audio }
+
+function voiceSupported() {
+    return !!(window.RTCPeerConnection && navigator.mediaDevices && navigator.mediaDevices.getUserMedia);
+}
+
+async function toggleVoice() {
+    if (voiceStream) {
+        leaveVoice();
+        return;
+    }
+    try {
+        voiceStream = await navigator.mediaDevices.getUserMedia({ audio: { echoCancellation: true, noiseSuppression: true } });
+    } catch (e) {
+        alert('Could not use your microphone: ' + e.message);
+        return;
+    }
+    // Everyone joins muted
+    voiceMuted = true;
+    voiceStream.getAudioTracks().forEach(t => { t.enabled = false; });
+    watchSpeaking();
+    ws.send(JSON.stringify({ type: 'voiceJoin' }));
+    updateVoiceButtons();
+}
+
+function leaveVoice() {
+    if (!voiceStream) return;
+    if (ws && ws.readyState === WebSocket.OPEN) ws.send(JSON.stringify({ type: 'voiceLeave' }));
+    voiceStream.getTracks().forEach(t => t.stop());
+    voiceStream = null;
+    clearInterval(voiceMeter);
+    voiceMeter = null;
+    voiceSpeaking = false;
+    for (const id of [...voicePeers.keys()]) closeVoicePeer(id);
+    updateVoiceButtons();
+}
+
+// After a reconnect the server has forgotten we were in voice: join again
+// and let the others call us afresh
+function rejoinVoice() {
+    if (!voiceStream) return;
+    for (const id of [...voicePeers.keys()]) closeVoicePeer(id);
+    ws.send(JSON.stringify({ type: 'voiceJoin' }));
+    if (!voiceMuted) ws.send(JSON.stringify({ type: 'voiceState', content: 'unmuted' }));
+}
+
+function toggleMute() {
+    if (!voiceStream) return;
+    voiceMuted = !voiceMuted;
+    voiceStream.getAudioTracks().forEach(t => { t.enabled = !voiceMuted; });
+    if (voiceMuted) voiceSpeaking = false;
+    ws.send(JSON.stringify({ type: 'voiceState', content: voiceMuted ? 'muted' : 'unmuted' }));
+    updateVoiceButtons();
+}
+
+function updateVoiceButtons() {
+    document.getElementById('voiceControls').style.display = voiceSupported() ? 'flex' : 'none';
+    document.getElementById('voiceJoinBtn').textContent = voiceStream ? '📴 Leave voice' : '🎙️ Join voice';
+    const mute = document.getElementById('voiceMuteBtn');
+    mute.style.display = voiceStream ? '' : 'none';
+    mute.textContent = voiceMuted ? 'Unmute' : 'Mute';
+}
+
+// Tell the room when we start and stop talking, with some hold time so a
+// pause for breath doesn't flicker
+function watchSpeaking() {
+    const ctx = new (window.AudioContext || window.webkitAudioContext)();
+    const analyser = ctx.createAnalyser();
+    analyser.fftSize = 512;
+    ctx.createMediaStreamSource(voiceStream).connect(analyser);
+    const samples = new Uint8Array(analyser.fftSize);
+    let lastLoud = 0;
+    voiceMeter = setInterval(() => {
+        if (!voiceStream) {
+            ctx.close();
+            return;
+        }
+        analyser.getByteTimeDomainData(samples);
+        let peak = 0;
+        for (const s of samples) peak = Math.max(peak, Math.abs(s - 128));
+        const now = Date.now();
+        if (peak > 12) lastLoud = now;
+        const speaking = !voiceMuted && now - lastLoud < 400;
+        if (speaking !== voiceSpeaking) {
+            voiceSpeaking = speaking;
+            ws.send(JSON.stringify({ type: 'voiceState', content: speaking ? 'speaking' : 'quiet' }));
+            setSpeaking(myUserId, speaking);
+        }
+    }, 100);
+}
+
+function setSpeaking(userId, speaking) {
+    const icon = document.getElementById('user-voice-' + userId);
+    if (icon) icon.classList.toggle('speaking', speaking);
+}
+
+function newVoicePeer(peerID) {
+    closeVoicePeer(peerID);
+    const pc = new RTCPeerConnection({ iceServers: P2P_ICE });
+    voiceStream.getTracks().forEach(t => pc.addTrack(t, voiceStream));
+    const audio = new Audio();
+    audio.autoplay = true;
+    pc.ontrack = (e) => { audio.srcObject = e.streams[0]; };
+    pc.onicecandidate = (e) => {
+        if (e.candidate) sendVoiceSignal(peerID, { kind: 'candidate', candidate: e.candidate });
+    };
+    pc.onconnectionstatechange = () => {
+        if (pc.connectionState === 'failed' && voicePeers.get(peerID)?.pc === pc) openRelay(peerID, 'voice');
+    };
+    voicePeers.set(peerID, { pc, audio });
+    return pc;
+}
+
+function closeVoicePeer(peerID) {
+    const peer = voicePeers.get(peerID);
+    if (!peer) return;
+    voicePeers.delete(peerID);
+    peer.audio.srcObject = null;
+    peer.pc.close();
+    closeVoiceRelay(peerID, true);
+}
+
+function sendVoiceSignal(to, signal) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'voiceSignal', to: to, signal: signal }));
+    }
+}
+
+async function handleVoiceMessage(msg) {
+    switch (msg.type) {
+    case 'voiceJoin':
+        // We're already in voice: call the newcomer
+        if (voiceStream && msg.userID !== myUserId) {
+            const pc = newVoicePeer(msg.userID);
+            const offer = await pc.createOffer();
+            await pc.setLocalDescription(offer);
+            sendVoiceSignal(msg.userID, { kind: 'offer', sdp: pc.localDescription });
+        }
+        return;
+    case 'voiceLeave':
+        closeVoicePeer(msg.userID);
+        return;
+    case 'voiceState':
+        if (msg.content === 'speaking' || msg.content === 'quiet') setSpeaking(msg.userID, msg.content === 'speaking');
+        return;
+    case 'voiceSignal': {
+        if (!voiceStream) return;
+        const signal = msg.signal || {};
+        if (signal.kind === 'offer') {
+            const pc = newVoicePeer(msg.userID);
+            await pc.setRemoteDescription(signal.sdp);
+            const answer = await pc.createAnswer();
+            await pc.setLocalDescription(answer);
+            sendVoiceSignal(msg.userID, { kind: 'answer', sdp: pc.localDescription });
+            return;
+        }
+        const peer = voicePeers.get(msg.userID);
+        if (!peer) return;
+        if (signal.kind === 'answer') {
+            await peer.pc.setRemoteDescription(signal.sdp);
+        } else if (signal.kind === 'candidate') {
+            await peer.pc.addIceCandidate(signal.candidate).catch(() => {});
+        }
+        return;
+    }
+    }
+}
+
+updateVoiceButtons();
+
+// ============================================
+// RELAY FALLBACK
+// ============================================
+
+// When a peer connection fails (both members behind strict NATs, say),
+// the file or the voice goes through the server instead: relayOpen asks
+// for a relay to the other member and relayData then carries what the
+// connection would have, base64 in signal. The server caps how fast each
+// member may send, so we pace ourselves on the socket's buffer.
+
+const RELAY_BUFFER = 256 * 1024; // bytes queued on the socket before we wait
+const RELAY_VOICE_SLICE = 250; // ms of audio per relayData
+let relayFile = null; // { peerID, receive }: the file we're getting through a relay
+const voiceRelays = new Map(); // user ID -> { recorder, audio, source, buffer, queue }
+
+function openRelay(peerID, kind) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'relayOpen', to: peerID, content: kind }));
+    }
+}
+
+function sendRelay(peerID, kind, signal) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'relayData', to: peerID, content: kind, signal: signal }));
+    }
+}
+
+function closeRelay(peerID, kind) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'relayClose', to: peerID, content: kind }));
+    }
+}
+
+function toBase64(buffer) {
+    const bytes = new Uint8Array(buffer);
+    let binary = '';
+    for (let i = 0; i < bytes.length; i += 0x8000) {
+        binary += String.fromCharCode.apply(null, bytes.subarray(i, i + 0x8000));
+    }
+    return btoa(binary);
+}
+
+function fromBase64(text) {
+    const binary = atob(text);
+    const bytes = new Uint8Array(binary.length);
+    for (let i = 0; i < binary.length; i++) bytes[i] = binary.charCodeAt(i);
+    return bytes.buffer;
+}
+
+// The server refused a relay: it's off or full
+function relayRefused(reason) {
+    if (relayFile) {
+        relayFile.receive({ error: `you can't reach them directly and the server won't pass it on (${reason})` });
+        relayFile = null;
+    }
+    if (voiceStream) displayChatMessage('🎙️ Voice', `Some members can't be reached for voice: ${reason}.`, false);
+}
+
+function handleRelayMessage(msg) {
+    switch (msg.type) {
+    case 'relayOpen':
+        if (msg.content === 'file' && relayFile && relayFile.peerID === msg.userID) {
+            sendRelay(msg.userID, 'file', { want: pendingLocalFile ? pendingLocalFile.name : '' });
+        } else if (msg.content === 'voice') {
+            startVoiceRelay(msg.userID);
+        }
+        return;
+    case 'relayData': {
+        const signal = msg.signal || {};
+        if (msg.content === 'file') {
+            if (signal.want !== undefined) {
+                relayFileTo(msg.userID, signal.want);
+            } else if (relayFile && relayFile.peerID === msg.userID) {
+                relayFile.receive(signal.header || fromBase64(signal.data || ''));
+            }
+        } else if (msg.content === 'voice' && signal.data) {
+            playVoiceRelay(msg.userID, fromBase64(signal.data));
+        }
+        return;
+    }
+    case 'relayClose':
+        if (msg.content === 'file' && relayFile && relayFile.peerID === msg.userID) {
+            relayFile.receive.cutOff();
+            relayFile = null;
+        } else if (msg.content === 'voice') {
+            closeVoiceRelay(msg.userID, false);
+        }
+        return;
+    }
+}
+
+// Send our local file through a relay: the header, then the bytes in
+// P2P_CHUNK pieces
+async function relayFileTo(peerID, name) {
+    const file = localShareFile;
+    if (!file || file.name !== name) {
+        sendRelay(peerID, 'file', { header: { error: 'they are not playing that file any more' } });
+        closeRelay(peerID, 'file');
+        return;
+    }
+    displayChatMessage('📤 Sharing', `Sending "${file.name}" to a member through the server.`, false);
+    sendRelay(peerID, 'file', { header: { name: file.name, size: file.size, type: file.type } });
+    for (let offset = 0; offset < file.size; offset += P2P_CHUNK) {
+        if (!ws || ws.readyState !== WebSocket.OPEN) return;
+        while (ws.bufferedAmount > RELAY_BUFFER) await new Promise(resolve => setTimeout(resolve, 50));
+        sendRelay(peerID, 'file', { data: toBase64(await file.slice(offset, offset + P2P_CHUNK).arrayBuffer()) });
+    }
+}
+
+// Once a relay to a voice peer is open, record our microphone in short
+// Opus slices for them and play theirs back through a MediaSource
+function startVoiceRelay(peerID) {
+    const mime = 'audio/webm;codecs=opus';
+    if (!voiceStream || voiceRelays.has(peerID) || !window.MediaRecorder || !window.MediaSource ||
+        !MediaRecorder.isTypeSupported(mime) || !MediaSource.isTypeSupported(mime)) return;
+
+    const relay = { recorder: new MediaRecorder(voiceStream, { mimeType: mime }), audio: new Audio(), source: new MediaSource(), buffer: null, queue: [] };
+    relay.recorder.ondataavailable = async (e) => {
+        if (e.data.size > 0) sendRelay(peerID, 'voice', { data: toBase64(await e.data.arrayBuffer()) });
+    };
+    relay.recorder.start(RELAY_VOICE_SLICE);
+    relay.audio.autoplay = true;
+    relay.audio.src = URL.createObjectURL(relay.source);
+    relay.source.addEventListener('sourceopen', () => {
+        relay.buffer = relay.source.addSourceBuffer(mime);
+        relay.buffer.addEventListener('updateend', () => feedVoiceRelay(relay));
+        feedVoiceRelay(relay);
+    });
+    voiceRelays.set(peerID, relay);
+}
+
+function playVoiceRelay(peerID, data) {
+    const relay = voiceRelays.get(peerID);
+    if (!relay) return;
+    relay.queue.push(data);
+    feedVoiceRelay(relay);
+}
+
+function feedVoiceRelay(relay) {
+    if (!relay.buffer || relay.buffer.updating || relay.queue.length === 0) return;
+    relay.buffer.appendBuffer(relay.queue.shift());
+}
+
+// tell says whether the other end still needs to hear it's over
+function closeVoiceRelay(peerID, tell) {
+    const relay = voiceRelays.get(peerID);
+    if (!relay) return;
+    voiceRelays.delete(peerID);
+    if (relay.recorder.state !== 'inactive') relay.recorder.stop();
+    relay.audio.pause();
+    URL.revokeObjectURL(relay.audio.src);
+    if (tell) closeRelay(peerID, 'voice');
+}
+
 // ============================================
 // CHAT
 // ============================================
@@ -1182,20 +2707,148 @@ function sendChat() {
     const text = input.value.trim();
     if (!text || !ws || ws.readyState !== WebSocket.OPEN) return;
 
+    if (text === '/pip' || text.startsWith('/pip ')) {
+        handlePipCommand(text);
+        input.value = '';
+        return;
+    }
+
     ws.send(JSON.stringify({
         type: 'chat',
-        content: text,
-        userName: myUserName
+        userName: myUserName,
+        payload: { text: text }
     }));
 
     displayChatMessage(myUserName, text, true);
     input.value = '';
 }
 
-function displayChatMessage(userName, content, isMe) {
+// ============================================
+// MAINTENANCE BANNER
+// ============================================
+
+function showMaintenanceBanner(m) {
+    let banner = document.getElementById('maintenanceBanner');
+    if (!m.active && !m.at) {
+        if (banner) banner.remove();
+        return;
+    }
+    if (!banner) {
+        banner = document.createElement('div');
+        banner.id = 'maintenanceBanner';
+        banner.className = 'maintenance-banner';
+        document.body.prepend(banner);
+    }
+    banner.textContent = m.active
+        ? '🚧 ' + m.message
+        : `🚧 Maintenance starts at ${new Date(m.at).toLocaleTimeString()}: ${m.message}`;
+}
+
+// ============================================
+// PRE-ROLL
+// ============================================
+
+let preRollTimer = null;
+
+function showPreRoll(preRoll) {
+    hidePreRoll();
+    const overlay = document.createElement('div');
+    overlay.className = 'preroll-overlay';
+    overlay.id = 'preRollOverlay';
+
+    const elapsed = Math.max(0, (serverNow() - preRoll.startAt) / 1000);
+
+    if (preRoll.kind === 'clip') {
+        const clip = document.createElement('video');
+        clip.src = preRoll.url;
+        clip.autoplay = true;
+        clip.playsInline = true;
+        clip.addEventListener('loadedmetadata', () => { clip.currentTime = elapsed; });
+        overlay.appendChild(clip);
+    } else {
+        const card = document.createElement('div');
+        card.className = 'preroll-card';
+        const title = document.createElement('div');
+        title.className = 'preroll-title';
+        title.textContent = preRoll.text || 'Feature starts in';
+        const count = document.createElement('div');
+        count.className = 'preroll-count';
+        card.appendChild(title);
+        card.appendChild(count);
+        overlay.appendChild(card);
+
+        const tick = () => {
+            const left = Math.ceil(preRoll.seconds - (serverNow() - preRoll.startAt) / 1000);
+            count.textContent = Math.max(0, left);
+        };
+        tick();
+        preRollTimer = setInterval(tick, 250);
+    }
+
+    document.querySelector('.video-container').appendChild(overlay);
+}
+
+function hidePreRoll() {
+    if (preRollTimer) {
+        clearInterval(preRollTimer);
+        preRollTimer = null;
+    }
+    const overlay = document.getElementById('preRollOverlay');
+    if (overlay) overlay.remove();
+}
+
+function handleRoomTransfer(msg) {
+    currentRoom = msg.roomCode;
+    document.getElementById('roomCodeDisplay').textContent = currentRoom.toUpperCase();
+    window.history.replaceState({}, '', `${window.location.origin}/?room=${currentRoom}`);
+    saveRoomToStorage();
+
+    if (!msg.content) {
+        displayChatMessage('🔀 Breakout', 'You are back in the main room.', false);
+        return;
+    }
+
+    displayChatMessage('🔀 Breakout', `You were moved to breakout room ${currentRoom.toUpperCase()}.`, false);
+    const btn = document.createElement('button');
+    btn.className = 'btn btn-secondary breakout-return';
+    btn.textContent = '↩ Return to main room';
+    btn.onclick = () => {
+        if (ws && ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify({ type: 'returnToMain' }));
+        }
+        btn.remove();
+    };
+    document.getElementById('chatMessages').appendChild(btn);
+}
+
+// describeCatchUp words a media or playback event from a catchUp as a chat
+// line
+function describeCatchUp(e) {
+    if (e.kind === 'media') {
+        const what = {
+            youtube: 'a YouTube video',
+            vimeo: 'a Vimeo video',
+            dailymotion: 'a Dailymotion video',
+            twitch: 'a Twitch stream',
+            directurl: 'a video from a link'
+        }[e.sourceType];
+        return 'loaded ' + (what || 'the file ' + e.url);
+    }
+    const verb = { play: 'played from', pause: 'paused at', seek: 'jumped to' }[e.kind];
+    return verb + ' ' + formatPosition(e.timestamp || 0);
+}
+
+function formatPosition(seconds) {
+    const s = Math.floor(seconds);
+    const mm = String(Math.floor(s / 60) % 60).padStart(2, '0');
+    const ss = String(s % 60).padStart(2, '0');
+    return s >= 3600 ? Math.floor(s / 3600) + ':' + mm + ':' + ss : Math.floor(s / 60) + ':' + ss;
+}
+
+function displayChatMessage(userName, content, isMe, at, fromHistory) {
     const container = document.getElementById('chatMessages');
     const msg = document.createElement('div');
-    msg.className = 'chat-msg' + (isMe ? ' me' : '') + (!isMe ? ' new-msg' : '');
+    msg.className = 'chat-msg' + (isMe ? ' me' : '') + (!isMe && !fromHistory ? ' new-msg' : '');
 
     const nameEl = document.createElement('div');
     nameEl.className = 'chat-msg-name';
@@ -1207,7 +2860,7 @@ function displayChatMessage(userName, content, isMe) {
 
     const timeEl = document.createElement('div');
     timeEl.className = 'chat-msg-time';
-    timeEl.textContent = new Date().toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+    timeEl.textContent = new Date(at || Date.now()).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
 
     msg.appendChild(nameEl);
     msg.appendChild(textEl);
@@ -1216,10 +2869,11 @@ function displayChatMessage(userName, content, isMe) {
     container.scrollTop = container.scrollHeight;
 
     // Notification for incoming messages
-    if (!isMe) {
-        playChatNotifSound();
+    if (!isMe && !fromHistory) {
+        const notify = myPrefs.notifications || {};
+        if (notify.chatSound !== false) playChatNotifSound();
         // Show toast popup only when chat is closed
-        if (!chatOpen) {
+        if (!chatOpen && notify.chatToast !== false) {
             showChatToast(userName, content);
         }
     }
@@ -1273,9 +2927,16 @@ function clearAllToasts() {
 // REACTIONS
 // ============================================
 
+// Server-provided adaptation policy, updated by adaptHint messages
+let adaptHint = { driftReports: true, maxReactionsPerSec: 5, bufferTarget: 2 };
+let lastReactionSent = 0;
+
 function sendReaction(emoji) {
     if (!ws || ws.readyState !== WebSocket.OPEN) return;
-    ws.send(JSON.stringify({ type: 'reaction', content: emoji, userName: myUserName }));
+    const now = Date.now();
+    if (now - lastReactionSent < 1000 / adaptHint.maxReactionsPerSec) return;
+    lastReactionSent = now;
+    ws.send(JSON.stringify({ type: 'reaction', content: emoji, userName: myUserName, timestamp: currentPlayback().timestamp }));
     showReactionAnimation(emoji, myUserName);
 }
 
@@ -1311,6 +2972,7 @@ function startStatusUpdates() {
 
 function sendPlaybackStatus() {
     if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    if (!adaptHint.driftReports) return;
 
     let status = 'paused';
     if (currentSource === 'youtube' && ytPlayer && ytReady) {
@@ -1346,8 +3008,9 @@ function sendPlaybackStatus() {
 
 function sendBuffering(isBuffering) {
     if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    bufferingReported = isBuffering;
     ws.send(JSON.stringify({
-        type: isBuffering ? 'buffering' : 'bufferend',
+        type: isBuffering ? 'buffering' : 'ready',
         userID: myUserId
     }));
 }
@@ -1389,6 +3052,115 @@ function resumeAfterBuffering() {
     }
 }
 
+// ============================================
+// CLOCK SYNC
+// ============================================
+
+// timeSync probes measure our offset from the server clock and the round
+// trip. The sample with the shortest trip is the most accurate, so we keep
+// the last few and trust the best. Playback messages carry serverAt, when
+// their position held on the server clock, so with the offset we know how
+// far the sender's player has moved on since.
+const CLOCK_SAMPLES = 8;
+const CLOCK_BURST = 5;
+const CLOCK_EVERY = 60000;
+let clockSamples = [];
+let clockSynced = false;
+let clockTimer = null;
+
+function startClockSync() {
+    clockSamples = [];
+    for (let i = 0; i < CLOCK_BURST; i++) setTimeout(sendClockProbe, i * 250);
+    if (!clockTimer) clockTimer = setInterval(sendClockProbe, CLOCK_EVERY);
+}
+
+function sendClockProbe() {
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify({ type: 'timeSync', sentAt: Date.now() }));
+}
+
+function handleClockSample(msg) {
+    const now = Date.now();
+    if (!msg.sentAt || !msg.serverTime || msg.sentAt > now) return;
+    const rtt = now - msg.sentAt;
+    clockSamples.push({ rtt, offset: msg.serverTime - (msg.sentAt + now) / 2 });
+    if (clockSamples.length > CLOCK_SAMPLES) clockSamples.shift();
+    const best = clockSamples.reduce((a, b) => (b.rtt < a.rtt ? b : a));
+    serverClockOffset = best.offset;
+    clockSynced = true;
+}
+
+// sinceServerAt is how many seconds ago the position in msg held, or null
+// if we can't tell from the server clock. A paused player doesn't move on.
+function sinceServerAt(msg) {
+    if (!msg.serverAt || !clockSynced) return null;
+    if (msg.type === 'pause') return 0;
+    return Math.max(0, (serverNow() - msg.serverAt) / 1000);
+}
+
+// sinceSent is sinceServerAt, falling back to sentAt when there is no
+// clock sync: the whole gap, or half of it (one way) when sentAt is on the
+// sender's clock rather than ours.
+function sinceSent(msg, oneWay) {
+    const since = sinceServerAt(msg);
+    if (since !== null) return since;
+    if (!msg.sentAt) return 0;
+    return (Date.now() - msg.sentAt) / (oneWay ? 2000 : 1000);
+}
+
+// ============================================
+// WAIT FOR EVERYONE
+// ============================================
+
+// In wait mode the server pauses the room while anyone buffers and plays it
+// once all report ready, so we only report. A player paused by the server
+// doesn't say when it has caught up, so we check while we're waited for.
+let bufferingReported = false;
+let readyWatch = null;
+let waitingText = '';
+
+function setWaitMode(on) {
+    peersBuffering.clear();
+    displayChatMessage('⏳ Sync', on
+        ? 'Wait for everyone is on: the room pauses while anyone buffers.'
+        : 'Wait for everyone is off.', false);
+    if (!on) showWaiting([]);
+}
+
+function showWaiting(names) {
+    const status = document.getElementById('statusText');
+    if (names.length) {
+        waitingText = `⏳ Waiting for ${names.join(', ')}`;
+        status.textContent = waitingText;
+    } else if (waitingText && status.textContent === waitingText) {
+        waitingText = '';
+        status.textContent = 'Connected';
+    }
+    if (names.length && bufferingReported) watchUntilReady();
+}
+
+// caughtUp reports whether the active player has enough buffered to play on.
+function caughtUp() {
+    if (currentSource === 'youtube' && ytPlayer && ytReady) {
+        const fraction = ytPlayer.getVideoLoadedFraction();
+        return fraction >= 1 || fraction * ytPlayer.getDuration() - ytPlayer.getCurrentTime() >= 5;
+    }
+    if (currentSource === 'file') {
+        return document.getElementById('videoPlayer').readyState >= 3;
+    }
+    return true;
+}
+
+function watchUntilReady() {
+    if (readyWatch) return;
+    readyWatch = setInterval(() => {
+        if (bufferingReported && !caughtUp()) return;
+        clearInterval(readyWatch);
+        readyWatch = null;
+        if (bufferingReported) sendBuffering(false);
+    }, 500);
+}
+
 // ============================================
 // HOST/VIEWER ROLES
 // ============================================
@@ -1444,10 +3216,9 @@ function transferHost(newHostId) {
     if (!isHost) return;
     hostUserId = newHostId;
     isHost = false;
-    hostMode = true;
 
     if (ws && ws.readyState === WebSocket.OPEN) {
-        ws.send(JSON.stringify({ type: 'hostchange', userID: newHostId }));
+        ws.send(JSON.stringify({ type: 'transferHost', content: newHostId }));
     }
 
     updateHostUI();
@@ -1536,12 +3307,95 @@ function onFullscreenChange() {
     }
 }
 
+// ============================================
+// PREFERENCES
+// ============================================
+
+function preferencesHeaders() {
+    return {
+        'Content-Type': 'application/json',
+        'X-Device-Token': localStorage.getItem('coopcinema_device') || ''
+    };
+}
+
+function applyPreferences(prefs) {
+    myPrefs = prefs;
+    document.documentElement.dataset.theme = prefs.theme || '';
+    if (prefs.name && !currentRoom) {
+        document.getElementById('userName').value = prefs.name;
+    }
+    if (currentSource !== 'none') applyAccessibility();
+}
+
+async function loadPreferences() {
+    if (!localStorage.getItem('coopcinema_device') && !signedIn) return;
+    try {
+        const response = await fetch('/api/me/preferences', { headers: preferencesHeaders() });
+        if (response.ok) applyPreferences(await response.json());
+    } catch (error) {
+        console.error('Error loading preferences:', error);
+    }
+}
+
+// The name picked for a room becomes the default for the next one
+async function rememberName() {
+    if (!myUserName || myUserName === myPrefs.name || (!localStorage.getItem('coopcinema_device') && !signedIn)) return;
+    try {
+        // Merge into what is saved, which may not have reached us yet
+        const saved = await fetch('/api/me/preferences', { headers: preferencesHeaders() });
+        if (!saved.ok) return;
+        const response = await fetch('/api/me/preferences', {
+            method: 'PUT',
+            headers: preferencesHeaders(),
+            body: JSON.stringify({ ...(await saved.json()), name: myUserName })
+        });
+        if (response.ok) myPrefs = await response.json();
+    } catch (error) {
+        console.error('Error saving preferences:', error);
+    }
+}
+
+// Shows who we're signed in as, or the providers we can sign in with
+async function initAuth() {
+    const bar = document.getElementById('authBar');
+    try {
+        const me = await fetch('/auth/me');
+        if (me.ok) {
+            const identity = await me.json();
+            signedIn = true;
+            myUserId = identity.id; // the server knows us by our account now
+            if (identity.name) document.getElementById('userName').value = identity.name;
+            bar.textContent = `Signed in as ${identity.name || identity.id}`;
+            const signOut = document.createElement('button');
+            signOut.textContent = 'Sign out';
+            signOut.onclick = async () => {
+                await fetch('/auth/logout', { method: 'POST' });
+                window.location.reload();
+            };
+            bar.appendChild(signOut);
+            return;
+        }
+        const providers = await (await fetch('/auth/providers')).json();
+        const returnTo = encodeURIComponent(window.location.pathname + window.location.search);
+        for (const p of providers) {
+            const link = document.createElement('a');
+            link.href = `/auth/login?provider=${encodeURIComponent(p.name)}&return=${returnTo}`;
+            link.textContent = `Sign in with ${p.label}`;
+            bar.appendChild(link);
+        }
+    } catch (error) {
+        console.error('Error checking sign-in:', error);
+    }
+}
+
 // ============================================
 // INITIALIZATION
 // ============================================
 
-// Set random theater name on load
+// Set random theater name on load, unless the account or a saved one
+// replaces it
 document.getElementById('userName').value = generateName();
+initAuth().then(loadPreferences);
 
 // URL hint listener
 document.getElementById('videoUrlInput').addEventListener('input', updateUrlHint);
@@ -1598,5 +3452,15 @@ document.getElementById('videoUrlInput').addEventListener('keypress', (e) => {
     }
 });
 
+document.getElementById('subtitleFileInput').addEventListener('change', (e) => {
+    if (e.target.files.length) uploadSubtitles(e.target.files[0]);
+    e.target.value = '';
+});
+
+document.getElementById('queueUrlInput').addEventListener('keypress', (e) => {
+    if (e.key === 'Enter') {
+        onQueueAddClick();
+    }
+});
+
 console.log('Co-op Cinema initialized');
-console.log('Your ID:', myUserId);
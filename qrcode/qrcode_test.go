@@ -0,0 +1,170 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	zxqr "github.com/makiuchi-d/gozxing/qrcode"
+)
+
+var levelNames = [4]string{Low: "L", Medium: "M", Quartile: "Q", High: "H"}
+
+// decode reads c back with ZXing's decoder, from the PNG a browser would be
+// shown, and checks the level it was made at.
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+	data, err := c.PNG(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := zxqr.NewQRCodeReader().Decode(bmp, map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_PURE_BARCODE:  true,
+		gozxing.DecodeHintType_CHARACTER_SET: "UTF-8",
+	})
+	if err != nil {
+		t.Fatalf("version %d level %s doesn't decode: %v", c.version, levelNames[c.level], err)
+	}
+	if got := result.GetResultMetadata()[gozxing.ResultMetadataType_ERROR_CORRECTION_LEVEL]; got != levelNames[c.level] {
+		t.Errorf("version %d decoded at level %v, want %s", c.version, got, levelNames[c.level])
+	}
+	return result.GetText()
+}
+
+// fill is text of n bytes that varies, so no two codewords look alike.
+func fill(n int) string {
+	const alphabet = "https://cinema.example/?room=abcdef0123456789-_.~"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[(i*7+i/len(alphabet))%len(alphabet)]
+	}
+	return string(b)
+}
+
+// capacity is the most bytes of text that fit version at level.
+func capacity(version int, level Level) int {
+	return (8*dataCodewords(version, level) - 4 - countBits(version)) / 8
+}
+
+func TestDecodes(t *testing.T) {
+	for _, text := range []string{"", "a", "https://cinema.example/?room=abc123", "héllo ✓ 🎬"} {
+		c, err := Encode(text, Medium)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decode(t, c); got != text {
+			t.Errorf("%q decoded as %q", text, got)
+		}
+	}
+}
+
+// TestEveryVersion fills each version to capacity at each level, which
+// covers every block layout, alignment pattern and version information
+// block, and the jump in count width at versions 10 and 27.
+func TestEveryVersion(t *testing.T) {
+	versions := []int{1, 2, 5, 6, 7, 9, 10, 14, 21, 26, 27, 32, 40}
+	if testing.Short() {
+		versions = []int{1, 7, 10, 27}
+	}
+	for level := Low; level <= High; level++ {
+		for _, v := range versions {
+			t.Run(fmt.Sprintf("%s%d", levelNames[level], v), func(t *testing.T) {
+				text := fill(capacity(v, level))
+				c, err := Encode(text, level)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.version != v || c.Size != 4*v+17 {
+					t.Fatalf("%d bytes took version %d, %d modules; want version %d", len(text), c.version, c.Size, v)
+				}
+				if got := decode(t, c); got != text {
+					t.Fatalf("decoded %d bytes, differing from what was encoded", len(got))
+				}
+
+				// One byte more needs the next version
+				if v < 40 {
+					if c, err := Encode(text+"x", level); err != nil || c.version != v+1 {
+						t.Fatalf("one byte over: version %d, %v", c.version, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestTooLong(t *testing.T) {
+	for level := Low; level <= High; level++ {
+		if _, err := Encode(fill(capacity(40, level)+1), level); !errors.Is(err, ErrTooLong) {
+			t.Errorf("level %s: %v, want ErrTooLong", levelNames[level], err)
+		}
+	}
+}
+
+// TestDamaged covers a code's middle with a smudge it should read through
+// at level High, which the reader can only do if the error correction
+// codewords are right.
+func TestDamaged(t *testing.T) {
+	text := "https://cinema.example/?room=abc123"
+	c, err := Encode(text, High)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid, damaged := c.Size/2, 0
+	for y := mid - 2; y <= mid+2; y++ {
+		for x := mid - 2; x <= mid+2; x++ {
+			if !c.function[y*c.Size+x] {
+				c.modules[y*c.Size+x] = !c.modules[y*c.Size+x]
+				damaged++
+			}
+		}
+	}
+	if damaged == 0 {
+		t.Fatal("nothing to damage")
+	}
+	if got := decode(t, c); got != text {
+		t.Fatalf("damaged code decoded as %q", got)
+	}
+}
+
+// TestSVG checks the SVG draws the same modules as the PNG.
+func TestSVG(t *testing.T) {
+	c, err := Encode("https://cinema.example/?room=abc123", Quartile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(c.SVG())
+	side := c.Size + 2*quietZone
+	if !strings.Contains(svg, fmt.Sprintf(`viewBox="0 0 %d %d"`, side, side)) {
+		t.Fatalf("viewBox isn't %d square: %.120s", side, svg)
+	}
+	drawn := make(map[[2]int]bool)
+	for _, m := range regexp.MustCompile(`M(\d+),(\d+)h1v1h-1z`).FindAllStringSubmatch(svg, -1) {
+		x, _ := strconv.Atoi(m[1])
+		y, _ := strconv.Atoi(m[2])
+		drawn[[2]int{x - quietZone, y - quietZone}] = true
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if drawn[[2]int{x, y}] != c.Dark(x, y) {
+				t.Fatalf("module %d,%d: drawn %v, dark %v", x, y, drawn[[2]int{x, y}], c.Dark(x, y))
+			}
+		}
+	}
+	if len(drawn) == 0 {
+		t.Fatal("no modules drawn")
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// forgetAfter is how long a key's failures are remembered without a new one.
+const forgetAfter = 24 * time.Hour
+
+type strikes struct {
+	failures int
+	until    time.Time
+	last     time.Time
+}
+
+// Backoff locks a key out after repeated failures. The first Free failures
+// cost nothing; each one after that locks the key out for twice as long as
+// the last, starting at Base and capped at Max.
+type Backoff struct {
+	Free int
+	Base time.Duration
+	Max  time.Duration
+
+	mu    sync.Mutex
+	keys  map[string]*strikes
+	swept time.Time
+}
+
+func NewBackoff(free int, base, max time.Duration) *Backoff {
+	return &Backoff{Free: free, Base: base, Max: max, keys: make(map[string]*strikes)}
+}
+
+// Locked returns how much longer key is locked out, or 0.
+func (b *Backoff) Locked(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.keys[key]
+	if !ok {
+		return 0
+	}
+	return max(0, time.Until(s.until))
+}
+
+// Fail records a failure for key and returns the failure count and the
+// lockout it started, if any.
+func (b *Backoff) Fail(key string) (failures int, lockout time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.sweep(now)
+
+	s, ok := b.keys[key]
+	if !ok {
+		s = &strikes{}
+		b.keys[key] = s
+	}
+	s.failures++
+	s.last = now
+	if over := s.failures - b.Free; over > 0 {
+		lockout = b.Max
+		if over < 32 {
+			lockout = min(b.Max, b.Base<<(over-1))
+		}
+		s.until = now.Add(lockout)
+	}
+	return s.failures, lockout
+}
+
+// Reset forgets key's failures.
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.keys, key)
+}
+
+// sweep drops keys with no recent failures, at most once a minute.
+func (b *Backoff) sweep(now time.Time) {
+	if now.Sub(b.swept) < time.Minute {
+		return
+	}
+	b.swept = now
+	for key, s := range b.keys {
+		if now.Sub(s.last) > forgetAfter && now.After(s.until) {
+			delete(b.keys, key)
+		}
+	}
+}
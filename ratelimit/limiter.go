@@ -0,0 +1,105 @@
+// Package ratelimit provides a keyed token-bucket limiter.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter allows Burst events at once per key, refilled at Rate per second.
+type Limiter struct {
+	Rate  float64
+	Burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func New(rate, burst float64) *Limiter {
+	return &Limiter{Rate: rate, Burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// SetRate changes the limits, keeping every key's bucket; a bucket over
+// the new burst is trimmed the next time it is used.
+func (l *Limiter) SetRate(rate, burst float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Rate, l.Burst = rate, burst
+}
+
+// Allow takes a token for key and reports whether one was available.
+func (l *Limiter) Allow(key string) bool {
+	ok, _ := l.Reserve(key)
+	return ok
+}
+
+// Reserve is like Allow but also returns how long until a token is free
+// when none is.
+func (l *Limiter) Reserve(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.Burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.Burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Take takes n tokens for key, going into debt if there aren't enough, and
+// returns how long until the debt is paid off. A caller that waits that
+// long before going on keeps key to the rate however much it asks for.
+func (l *Limiter) Take(key string, n float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.Burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.Burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.Rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		// A bucket Take left in debt takes longer than Burst/Rate to fill
+		full := time.Duration((l.Burst - b.tokens) / l.Rate * float64(time.Second))
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
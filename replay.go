@@ -0,0 +1,25 @@
+package main
+
+import (
+	"coopcinema/wiretap"
+	"fmt"
+	"os"
+)
+
+// runReplay plays a client's recorded frames back against a server and
+// prints what the stand-in client sends and receives.
+func runReplay(path, server string, speed float64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	frames, err := wiretap.Read(f)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Replaying %d frames from %s against %s\n\n", len(frames), path, server)
+	return wiretap.Replay(server, frames, speed, os.Stdout)
+}
@@ -0,0 +1,151 @@
+// Package retention prunes stored data by class on a schedule, with
+// per-tenant overrides of how long each class is kept.
+package retention
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Class is a kind of stored data with its own retention period.
+type Class string
+
+const (
+	Chat      Class = "chat"
+	Events    Class = "events"
+	Telemetry Class = "telemetry"
+)
+
+// Defaults are used for classes the configuration does not mention.
+var Defaults = map[Class]time.Duration{
+	Chat:      24 * time.Hour,
+	Events:    7 * 24 * time.Hour,
+	Telemetry: 30 * 24 * time.Hour,
+}
+
+// Policy maps classes to retention periods, with optional per-tenant
+// overrides keyed by tenant ID.
+type Policy struct {
+	Default map[Class]time.Duration
+	Tenants map[string]map[Class]time.Duration
+}
+
+// ParseRules reads "chat=24h,events=168h" into a class map.
+func ParseRules(s string) (map[Class]time.Duration, error) {
+	rules := make(map[Class]time.Duration)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		class, dur, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("retention: malformed rule %q", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(dur))
+		if err != nil {
+			return nil, fmt.Errorf("retention: %s: %v", class, err)
+		}
+		rules[Class(strings.TrimSpace(class))] = d
+	}
+	return rules, nil
+}
+
+// TTL returns how long data of a class is kept for a tenant ("" for the
+// default instance).
+func (p Policy) TTL(tenantID string, c Class) time.Duration {
+	if t, ok := p.Tenants[tenantID]; ok {
+		if d, ok := t[c]; ok {
+			return d
+		}
+	}
+	if d, ok := p.Default[c]; ok {
+		return d
+	}
+	return Defaults[c]
+}
+
+// Cutoff returns a function giving, per tenant, the time before which data
+// of class c is expired.
+func (p Policy) Cutoff(c Class, now time.Time) func(tenantID string) time.Time {
+	return func(tenantID string) time.Time {
+		return now.Add(-p.TTL(tenantID, c))
+	}
+}
+
+// Pending describes data that is due for pruning.
+type Pending struct {
+	Class   Class     `json:"class"`
+	Source  string    `json:"source"`
+	TTL     string    `json:"ttl"`
+	DueNow  int       `json:"dueNow"`
+	NextDue time.Time `json:"nextDue,omitempty"` // when the oldest kept item expires
+}
+
+// Pruner removes expired items of one class from one source.
+type Pruner interface {
+	Name() string
+	Class() Class
+	// Prune deletes items older than cutoff(tenantID) and returns how many.
+	Prune(cutoff func(tenantID string) time.Time) int
+	// Scan counts items already expired and returns the oldest remaining
+	// item's expiry.
+	Scan(cutoff func(tenantID string) time.Time, ttl func(tenantID string) time.Duration) (due int, next time.Time)
+}
+
+// Job runs pruners against a policy.
+type Job struct {
+	Policy Policy
+
+	mu      sync.Mutex
+	pruners []Pruner
+}
+
+func (j *Job) Add(p Pruner) {
+	j.mu.Lock()
+	j.pruners = append(j.pruners, p)
+	j.mu.Unlock()
+}
+
+// Run prunes every interval until the process exits.
+func (j *Job) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		j.mu.Lock()
+		for _, p := range j.pruners {
+			if n := p.Prune(j.Policy.Cutoff(p.Class(), now)); n > 0 {
+				log.Printf("🧹 Pruned %d %s items from %s", n, p.Class(), p.Name())
+			}
+		}
+		j.mu.Unlock()
+	}
+}
+
+// Report lists what each pruner would delete now and when its next item
+// expires.
+func (j *Job) Report(now time.Time) []Pending {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var out []Pending
+	for _, p := range j.pruners {
+		class := p.Class()
+		ttl := func(tenantID string) time.Duration { return j.Policy.TTL(tenantID, class) }
+		due, next := p.Scan(j.Policy.Cutoff(class, now), ttl)
+		out = append(out, Pending{
+			Class:   class,
+			Source:  p.Name(),
+			TTL:     j.Policy.TTL("", class).String(),
+			DueNow:  due,
+			NextDue: next,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out
+}
@@ -0,0 +1,114 @@
+package roomstore
+
+import (
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStore keeps rooms as a JSON array in one file, and tenants in
+// another beside it: rooms.json's are in rooms.tenants.json.
+type FileStore struct {
+	path string
+	mu   sync.Mutex // held while the tenants file is read and rewritten
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Save replaces the file whole, so a crash mid-write leaves the previous
+// snapshot.
+func (s *FileStore) Save(rooms []models.RoomSnapshot) error {
+	return writeJSON(s.path, rooms)
+}
+
+// writeJSON replaces the file at path with v through a temporary file.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FileStore) Load() ([]models.RoomSnapshot, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rooms []models.RoomSnapshot
+	err = json.Unmarshal(data, &rooms)
+	return rooms, err
+}
+
+func (s *FileStore) tenantsPath() string {
+	return strings.TrimSuffix(s.path, filepath.Ext(s.path)) + ".tenants.json"
+}
+
+func (s *FileStore) LoadTenants() ([]tenant.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readTenants()
+}
+
+// readTenants reads the tenants file. Callers hold s.mu.
+func (s *FileStore) readTenants() ([]tenant.Tenant, error) {
+	data, err := os.ReadFile(s.tenantsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tenants []tenant.Tenant
+	err = json.Unmarshal(data, &tenants)
+	return tenants, err
+}
+
+func (s *FileStore) SaveTenant(t tenant.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tenants, err := s.readTenants()
+	if err != nil {
+		return err
+	}
+	return writeJSON(s.tenantsPath(), withTenant(tenants, t.ID, &t))
+}
+
+func (s *FileStore) DeleteTenant(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tenants, err := s.readTenants()
+	if err != nil {
+		return err
+	}
+	return writeJSON(s.tenantsPath(), withTenant(tenants, id, nil))
+}
+
+// withTenant returns tenants with the one with ID id replaced by t, or
+// dropped when t is nil.
+func withTenant(tenants []tenant.Tenant, id string, t *tenant.Tenant) []tenant.Tenant {
+	out := make([]tenant.Tenant, 0, len(tenants)+1)
+	for _, o := range tenants {
+		if o.ID != id {
+			out = append(out, o)
+		}
+	}
+	if t != nil {
+		out = append(out, *t)
+	}
+	return out
+}
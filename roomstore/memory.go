@@ -0,0 +1,56 @@
+package roomstore
+
+import (
+	"coopcinema/memstore"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"sync"
+)
+
+// MemoryStore keeps rooms in the "rooms" section of a memstore, which
+// writes them out on its own schedule rather than on every Save, and
+// tenants in the "tenants" section.
+type MemoryStore struct {
+	store *memstore.Store
+	mu    sync.Mutex // held while the tenants section is read and replaced
+}
+
+func NewMemoryStore(store *memstore.Store) *MemoryStore {
+	return &MemoryStore{store: store}
+}
+
+func (s *MemoryStore) Save(rooms []models.RoomSnapshot) error {
+	return s.store.Put("rooms", rooms)
+}
+
+func (s *MemoryStore) Load() ([]models.RoomSnapshot, error) {
+	var rooms []models.RoomSnapshot
+	_, err := s.store.Get("rooms", &rooms)
+	return rooms, err
+}
+
+func (s *MemoryStore) LoadTenants() ([]tenant.Tenant, error) {
+	var tenants []tenant.Tenant
+	_, err := s.store.Get("tenants", &tenants)
+	return tenants, err
+}
+
+func (s *MemoryStore) SaveTenant(t tenant.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tenants, err := s.LoadTenants()
+	if err != nil {
+		return err
+	}
+	return s.store.Put("tenants", withTenant(tenants, t.ID, &t))
+}
+
+func (s *MemoryStore) DeleteTenant(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tenants, err := s.LoadTenants()
+	if err != nil {
+		return err
+	}
+	return s.store.Put("tenants", withTenant(tenants, id, nil))
+}
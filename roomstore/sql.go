@@ -0,0 +1,119 @@
+package roomstore
+
+import (
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"database/sql"
+	"encoding/json"
+)
+
+// SQLStore keeps one row per room, holding the room as JSON, so the same
+// table works in SQLite and Postgres. Tenants get a table of their own.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore connects through the named database/sql driver and creates
+// the rooms and tenants tables if they aren't there.
+func NewSQLStore(driver, dsn string) (*SQLStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has one writer at a time; writes on other connections would
+	// fail with SQLITE_BUSY rather than wait
+	if driver == "sqlite" || driver == "sqlite3" {
+		db.SetMaxOpenConns(1)
+	}
+	for _, table := range []string{
+		`CREATE TABLE IF NOT EXISTS rooms (code TEXT PRIMARY KEY, data TEXT NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS tenants (id TEXT PRIMARY KEY, data TEXT NOT NULL)`,
+	} {
+		if _, err := db.Exec(table); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Save(rooms []models.RoomSnapshot) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM rooms`); err != nil {
+		return err
+	}
+	for _, room := range rooms {
+		data, err := json.Marshal(room)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO rooms (code, data) VALUES ($1, $2)`, room.Code, string(data)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Load() ([]models.RoomSnapshot, error) {
+	rows, err := s.db.Query(`SELECT data FROM rooms`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []models.RoomSnapshot
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var room models.RoomSnapshot
+		if err := json.Unmarshal([]byte(data), &room); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+func (s *SQLStore) LoadTenants() ([]tenant.Tenant, error) {
+	rows, err := s.db.Query(`SELECT data FROM tenants`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []tenant.Tenant
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var t tenant.Tenant
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// SaveTenant writes one tenant's row, leaving the others as they are.
+func (s *SQLStore) SaveTenant(t tenant.Tenant) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO tenants (id, data) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET data = excluded.data`, t.ID, string(data))
+	return err
+}
+
+func (s *SQLStore) DeleteTenant(id string) error {
+	_, err := s.db.Exec(`DELETE FROM tenants WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,6 @@
+package roomstore
+
+// SQLite is the default room store, so its driver is built in: a pure Go
+// one, which needs no cgo. It registers as "sqlite"; a Postgres driver
+// still has to be blank-imported in main.go.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,69 @@
+// Package roomstore keeps rooms across restarts. The hub's rooms are
+// snapshotted every so often and read back at startup.
+package roomstore
+
+import (
+	"bytes"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Store saves and loads the set of live rooms. Save replaces whatever was
+// saved before. Tenants are kept beside the rooms, each saved on its own.
+type Store interface {
+	Save(rooms []models.RoomSnapshot) error
+	Load() ([]models.RoomSnapshot, error)
+	tenant.Saver
+}
+
+// Open returns the store for kind: "file" keeps a JSON file at dsn;
+// "sqlite" and "postgres" keep a table in the database dsn names, through
+// whichever database/sql driver for it is linked into the binary. SQLite's
+// always is (see sqlite.go).
+func Open(kind, dsn string) (Store, error) {
+	switch kind {
+	case "file":
+		return NewFileStore(dsn), nil
+	case "sqlite":
+		return openSQL(dsn, "sqlite", "sqlite3")
+	case "postgres":
+		return openSQL(dsn, "pgx", "postgres")
+	}
+	return nil, fmt.Errorf("unknown room store %q", kind)
+}
+
+func openSQL(dsn string, drivers ...string) (Store, error) {
+	for _, name := range drivers {
+		if slices.Contains(sql.Drivers(), name) {
+			return NewSQLStore(name, dsn)
+		}
+	}
+	return nil, fmt.Errorf("no %s driver in this build; blank-import one in main.go", drivers[0])
+}
+
+// Run saves snapshot() every interval, forever, skipping saves when nothing
+// changed since the last one.
+func Run(store Store, snapshot func() []models.RoomSnapshot, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	var last []byte
+	for range ticker.C {
+		rooms := snapshot()
+		data, _ := json.Marshal(rooms)
+		if bytes.Equal(data, last) {
+			continue
+		}
+		if err := store.Save(rooms); err != nil {
+			log.Printf("roomstore: save: %v", err)
+			continue
+		}
+		last = data
+	}
+}
@@ -0,0 +1,159 @@
+package roomstore
+
+import (
+	"coopcinema/memstore"
+	"coopcinema/models"
+	"coopcinema/tenant"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// stores opens one of each kind of store in a fresh directory.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	sqlite, err := Open("sqlite", filepath.Join(dir, "rooms.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.(*SQLStore).db.Close() })
+	mem, err := memstore.Open(filepath.Join(dir, "memory.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{
+		"sqlite": sqlite,
+		"file":   NewFileStore(filepath.Join(dir, "rooms.json")),
+		"memory": NewMemoryStore(mem),
+	}
+}
+
+func byCode(rooms []models.RoomSnapshot) []models.RoomSnapshot {
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Code < rooms[j].Code })
+	return rooms
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	rooms := []models.RoomSnapshot{
+		{
+			Code:         "abc123",
+			HostID:       "host",
+			HostMode:     true,
+			RosterMode:   "open",
+			PasswordHash: []byte("hash"),
+			Media:        &models.Message{Type: "youtube", URL: "dQw4w9WgXcQ"},
+			Position:     42.5,
+			ChatHistory:  []models.ChatEntry{{SenderID: "host", SenderName: "Host", Text: "hi"}},
+		},
+		{Code: "def456", Position: 0},
+	}
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			got, err := store.Load()
+			if err != nil || len(got) != 0 {
+				t.Fatalf("empty store loaded %v, %v", got, err)
+			}
+			if err := store.Save(rooms); err != nil {
+				t.Fatal(err)
+			}
+			if got, err = store.Load(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(byCode(got), rooms) {
+				t.Fatalf("loaded %+v, want %+v", got, rooms)
+			}
+
+			// A save replaces what was there, rooms that closed included
+			if err := store.Save(rooms[1:]); err != nil {
+				t.Fatal(err)
+			}
+			if got, err = store.Load(); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].Code != "def456" {
+				t.Fatalf("after saving one room, loaded %+v", got)
+			}
+		})
+	}
+}
+
+// TestSQLiteReopen checks rooms outlive the connection, as across a
+// restart.
+func TestSQLiteReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.db")
+	store, err := Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save([]models.RoomSnapshot{{Code: "abc123", Position: 7}}); err != nil {
+		t.Fatal(err)
+	}
+	store.(*SQLStore).db.Close()
+
+	if store, err = Open("sqlite", path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.(*SQLStore).db.Close()
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Code != "abc123" || got[0].Position != 7 {
+		t.Fatalf("reopened store loaded %+v", got)
+	}
+}
+
+// TestTenants checks tenants saved at the same time all stay, and that
+// saving or deleting one leaves the rest alone.
+func TestTenants(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			errs := make(chan error, 20)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					id := fmt.Sprintf("club%02d", i)
+					errs <- store.SaveTenant(tenant.Tenant{ID: id, Hostnames: []string{id + ".example"}})
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			renamed := tenant.Tenant{ID: "club03", Name: "Film Club", Hostnames: []string{"watch.filmclub.org"}}
+			if err := store.SaveTenant(renamed); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.DeleteTenant("club07"); err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.LoadTenants()
+			if err != nil {
+				t.Fatal(err)
+			}
+			byID := make(map[string]tenant.Tenant)
+			for _, t := range got {
+				byID[t.ID] = t
+			}
+			if len(byID) != 19 || len(got) != 19 {
+				t.Fatalf("loaded %d tenants, want 19: %+v", len(got), got)
+			}
+			if _, ok := byID["club07"]; ok {
+				t.Error("deleted tenant still there")
+			}
+			if !reflect.DeepEqual(byID["club03"], renamed) {
+				t.Errorf("saved over %+v, loaded %+v", renamed, byID["club03"])
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package schedule
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is the subset of RFC 5545 RRULE supported for recurring rooms:
+// FREQ=DAILY|WEEKLY with optional INTERVAL, BYDAY, COUNT, UNTIL and WKST.
+// Occurrences keep the wall-clock time of the start in its location, so a
+// start in an IANA zone stays put across daylight saving changes.
+type Rule struct {
+	Freq      string
+	Interval  int
+	ByDay     []time.Weekday
+	Count     int
+	Until     time.Time
+	WeekStart time.Weekday // WKST: the day weeks are counted from for INTERVAL
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// maxOccurrences bounds iteration so a malformed rule cannot spin forever.
+const maxOccurrences = 5000
+
+// Parse reads an RRULE value such as "FREQ=WEEKLY;BYDAY=FR;INTERVAL=1".
+// An optional "RRULE:" prefix is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+
+	for _, part := range strings.Split(s, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, errors.New("rrule: malformed part " + strconv.Quote(part))
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(val)
+			if r.Freq != "DAILY" && r.Freq != "WEEKLY" {
+				return nil, errors.New("rrule: unsupported FREQ " + val)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, errors.New("rrule: invalid INTERVAL")
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, errors.New("rrule: invalid COUNT")
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := time.Parse("20060102T150405Z", val)
+			if err != nil {
+				return nil, errors.New("rrule: invalid UNTIL")
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				wd, ok := weekdays[strings.ToUpper(d)]
+				if !ok {
+					return nil, errors.New("rrule: invalid BYDAY " + d)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "WKST":
+			wd, ok := weekdays[strings.ToUpper(val)]
+			if !ok {
+				return nil, errors.New("rrule: invalid WKST " + val)
+			}
+			r.WeekStart = wd
+		default:
+			return nil, errors.New("rrule: unsupported part " + key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("rrule: FREQ is required")
+	}
+	return r, nil
+}
+
+// Next returns the first occurrence strictly after the given time for a
+// series starting at start, or the zero time if the series has ended.
+func (r *Rule) Next(start, after time.Time) time.Time {
+	n := 0
+	for _, t := range r.occurrences(start) {
+		n++
+		if r.Count > 0 && n > r.Count {
+			break
+		}
+		if !r.Until.IsZero() && t.After(r.Until) {
+			break
+		}
+		if t.After(after) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (r *Rule) occurrences(start time.Time) []time.Time {
+	var out []time.Time
+
+	if r.Freq == "DAILY" {
+		for i := 0; i < maxOccurrences; i++ {
+			out = append(out, start.AddDate(0, 0, i*r.Interval))
+		}
+		return out
+	}
+
+	days := r.ByDay
+	if len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+	// AddDate keeps the wall-clock time in start's location
+	weekStart := start.AddDate(0, 0, -(int(start.Weekday()-r.WeekStart)+7)%7)
+	for week := 0; len(out) < maxOccurrences; week += r.Interval {
+		base := weekStart.AddDate(0, 0, week*7)
+		for i := 0; i < 7; i++ {
+			if !containsDay(days, (r.WeekStart+time.Weekday(i))%7) {
+				continue
+			}
+			t := base.AddDate(0, 0, i)
+			if !t.Before(start) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+func containsDay(days []time.Weekday, d time.Weekday) bool {
+	for _, x := range days {
+		if x == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// occurrencesOf lists a rule's occurrences from start, up to n of them.
+func occurrencesOf(t *testing.T, rrule string, start time.Time, n int) []time.Time {
+	t.Helper()
+	r, err := Parse(rrule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []time.Time
+	for after := start.Add(-time.Second); len(out) < n; {
+		next := r.Next(start, after)
+		if next.IsZero() {
+			break
+		}
+		out = append(out, next)
+		after = next
+	}
+	return out
+}
+
+// TestWeekStart runs RFC 5545's own WKST example, where the day weeks
+// start on changes which dates every other week covers.
+func TestWeekStart(t *testing.T) {
+	start := time.Date(1997, 8, 5, 9, 0, 0, 0, time.UTC) // a Tuesday
+	for rule, want := range map[string][]int{
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO": {5, 10, 19, 24},
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU":         {5, 10, 19, 24}, // Monday by default
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU": {5, 17, 19, 31},
+	} {
+		got := occurrencesOf(t, rule, start, 10)
+		if len(got) != len(want) {
+			t.Fatalf("%s: %v", rule, got)
+		}
+		for i, day := range want {
+			if got[i].Month() != time.August || got[i].Day() != day {
+				t.Errorf("%s: occurrence %d on %s, want August %d", rule, i, got[i].Format(time.DateOnly), day)
+			}
+		}
+	}
+}
+
+// TestDaylightSaving checks a weekly start keeps its local time across the
+// change to and from summer time.
+func TestDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	start := time.Date(2025, 3, 21, 20, 0, 0, 0, berlin)
+	for _, at := range occurrencesOf(t, "FREQ=WEEKLY;BYDAY=FR", start, 40) {
+		if at.Hour() != 20 || at.Minute() != 0 || at.Weekday() != time.Friday {
+			t.Fatalf("occurrence at %s, want Fridays at 20:00", at)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, rule := range []string{"", "FREQ=MONTHLY", "FREQ=WEEKLY;WKST=XX", "FREQ=DAILY;INTERVAL=0", "FREQ=WEEKLY;BYDAY=FX"} {
+		if _, err := Parse(rule); err == nil {
+			t.Errorf("%q parsed", rule)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Package scripting runs operator-provided Lua room automations.
+//
+// Every *.lua file in the scripts directory gets its own sandboxed
+// interpreter with only the base, string, table and math libraries (no file,
+// OS or module loading, and no string.rep). Each callback runs under a CPU
+// time limit and a memory limit; a script that goes over the memory limit is
+// unloaded.
+//
+// Scripts register callbacks and act on rooms with:
+//
+//	on("join", function(room, name) end)
+//	on("leave", function(room, name) end)
+//	on("chat", function(room, name, text) end)   -- return true to swallow the message
+//	on("tick", function(room, position, playing) end) -- once per second
+//	say(room, text)
+//	pause(room)
+//	play(room)
+//	seek(room, seconds)
+package scripting
+
+import (
+	"context"
+	"coopcinema/hub"
+	"coopcinema/models"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/metrics"
+	"sort"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// BotName is shown as the author of script chat messages.
+const BotName = "🤖 Room Bot"
+
+// memoryCheckEvery is how often the heap is looked at while a script runs.
+const memoryCheckEvery = 5 * time.Millisecond
+
+var errOutOfMemory = errors.New("script went over its memory limit")
+
+// wideFormat matches a string.format width or precision of more than three
+// digits, which would have fmt allocate that much.
+var wideFormat = regexp.MustCompile(`%[-+ #0]*(\d{4,}|\d*\.\d{4,})`)
+
+type script struct {
+	name      string
+	mu        sync.Mutex
+	L         *lua.LState // nil once unloaded
+	callbacks map[string]*lua.LFunction
+}
+
+// Engine owns the loaded scripts.
+type Engine struct {
+	hub     *hub.Hub
+	scripts []*script
+	limit   time.Duration
+	memory  uint64 // bytes the heap may grow by during one callback
+}
+
+// Load compiles every script in dir. A script that fails to load is logged
+// and skipped. Each callback may run for limit and grow the heap by memory
+// bytes.
+func Load(h *hub.Hub, dir string, limit time.Duration, memory int64) (*Engine, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	e := &Engine{hub: h, limit: limit, memory: uint64(memory)}
+	for _, path := range paths {
+		s, err := e.load(path)
+		if err != nil {
+			log.Printf("script %s: %v", filepath.Base(path), err)
+			continue
+		}
+		e.scripts = append(e.scripts, s)
+		log.Printf("📜 Script %s loaded", s.name)
+	}
+	return e, nil
+}
+
+func (e *Engine) load(path string) (*script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	L := lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: 64, RegistrySize: 4096})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	// string.rep makes a huge string in one step, too fast for the memory
+	// check to catch, as do wide string.format fields
+	strlib := L.GetGlobal("string").(*lua.LTable)
+	strlib.RawSetString("rep", lua.LNil)
+	format := strlib.RawGetString("format").(*lua.LFunction)
+	strlib.RawSetString("format", L.NewFunction(func(L *lua.LState) int {
+		if wideFormat.MatchString(L.CheckString(1)) {
+			L.RaiseError("format width or precision is too large")
+		}
+		L.Insert(format, 1)
+		L.Call(L.GetTop()-1, 1)
+		return 1
+	}))
+
+	s := &script{name: filepath.Base(path), L: L, callbacks: make(map[string]*lua.LFunction)}
+	L.SetGlobal("on", L.NewFunction(func(L *lua.LState) int {
+		s.callbacks[L.CheckString(1)] = L.CheckFunction(2)
+		return 0
+	}))
+	L.SetGlobal("say", L.NewFunction(func(L *lua.LState) int {
+		e.hub.Announce(L.CheckString(1), BotName, L.CheckString(2))
+		return 0
+	}))
+	L.SetGlobal("pause", L.NewFunction(func(L *lua.LState) int {
+		e.control(L.CheckString(1), "pause", -1)
+		return 0
+	}))
+	L.SetGlobal("play", L.NewFunction(func(L *lua.LState) int {
+		e.control(L.CheckString(1), "play", -1)
+		return 0
+	}))
+	L.SetGlobal("seek", L.NewFunction(func(L *lua.LState) int {
+		e.control(L.CheckString(1), "seek", float64(L.CheckNumber(2)))
+		return 0
+	}))
+
+	ctx, cancel := e.limits()
+	defer cancel(nil)
+	L.SetContext(ctx)
+	if err := L.DoString(string(src)); err != nil {
+		L.Close()
+		if context.Cause(ctx) == errOutOfMemory {
+			return nil, errOutOfMemory
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// limits returns the context a callback runs under. It ends once the
+// callback has run for the time limit, or with errOutOfMemory once the heap
+// has grown by more than the memory limit since it started. The heap is
+// shared with the rest of the server, so this is only an estimate of what
+// the script allocated, but it stops a runaway one long before it matters.
+func (e *Engine) limits() (context.Context, context.CancelCauseFunc) {
+	timed, stop := context.WithTimeout(context.Background(), e.limit)
+	ctx, cancel := context.WithCancelCause(timed)
+	start := heapBytes()
+	go func() {
+		defer stop()
+		tick := time.NewTicker(memoryCheckEvery)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				if heapBytes() > start+e.memory {
+					cancel(errOutOfMemory)
+					return
+				}
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// heapBytes is the memory in heap objects, live or not yet collected.
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// control sends the room a playback command at the given position, or at
+// the room's current position when at is negative.
+func (e *Engine) control(roomCode, msgType string, at float64) {
+	pos, _, ok := e.hub.Playback(roomCode)
+	if !ok {
+		return
+	}
+	if at >= 0 {
+		pos = at
+	}
+	e.hub.ControlPlayback(roomCode, models.Message{
+		Type:      msgType,
+		Timestamp: pos,
+		SentAt:    float64(time.Now().UnixMilli()),
+	})
+}
+
+// call runs an event callback in every script that registered one and
+// reports whether any of them returned true.
+func (e *Engine) call(event string, args ...lua.LValue) bool {
+	handled := false
+	for _, s := range e.scripts {
+		s.mu.Lock()
+		fn, ok := s.callbacks[event]
+		if ok && s.L != nil {
+			ctx, cancel := e.limits()
+			s.L.SetContext(ctx)
+			err := s.L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...)
+			cancel(nil)
+			if context.Cause(ctx) == errOutOfMemory {
+				// Whatever it holds on to goes with it
+				log.Printf("script %s: %s: %v; unloading it", s.name, event, errOutOfMemory)
+				s.L.Close()
+				s.L = nil
+			} else if err != nil {
+				log.Printf("script %s: %s: %v", s.name, event, err)
+			} else {
+				handled = handled || lua.LVAsBool(s.L.Get(-1))
+				s.L.Pop(1)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return handled
+}
+
+// Install hooks the scripts into the hub and starts the tick loop.
+func (e *Engine) Install() {
+	if len(e.scripts) == 0 {
+		return
+	}
+
+	e.hub.AddHooks(hub.Hooks{
+		ClientJoined: func(room *models.Room, client *models.Client) {
+			go e.call("join", lua.LString(room.Code), lua.LString(client.Name))
+		},
+		ClientLeft: func(room *models.Room, client *models.Client) {
+			go e.call("leave", lua.LString(room.Code), lua.LString(client.Name))
+		},
+	})
+
+	e.hub.Use(hub.StageFilter, func(next hub.Handler) hub.Handler {
+		return func(msg models.Message, sender *models.Client) {
+			if msg.Type == "chat" && e.call("chat", lua.LString(sender.RoomCode), lua.LString(sender.Name), lua.LString(msg.Content)) {
+				return
+			}
+			next(msg, sender)
+		}
+	})
+
+	go func() {
+		for range time.Tick(time.Second) {
+			for _, code := range e.hub.RoomCodes() {
+				pos, playing, ok := e.hub.Playback(code)
+				if ok {
+					e.call("tick", lua.LString(code), lua.LNumber(pos), lua.LBool(playing))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package scripting
+
+import (
+	"coopcinema/hub"
+	"coopcinema/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// await returns the next message of type typ sent to c.
+func await(t *testing.T, c *models.Client, typ string) models.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-c.Send:
+			if msg.Type == typ {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("%s: no %q message", c.ID, typ)
+		}
+	}
+}
+
+// TestSeekSyncsJoiners checks someone joining after a script seeks starts
+// where the script moved the room to.
+func TestSeekSyncsJoiners(t *testing.T) {
+	dir := t.TempDir()
+	src := `on("chat", function(room, name, text) if text == "!skip" then seek(room, 95) end end)`
+	if err := os.WriteFile(filepath.Join(dir, "skip.lua"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := hub.NewHub()
+	e, err := Load(h, dir, time.Second, 64<<20)
+	if err != nil || len(e.scripts) != 1 {
+		t.Fatalf("loaded %d scripts, %v", len(e.scripts), err)
+	}
+
+	member := func(id string) *models.Client {
+		c := &models.Client{ID: id, Name: id, RoomCode: "room", Send: make(chan models.Message, 256), Protocol: 3}
+		h.Join(c)
+		t.Cleanup(func() { h.Leave(c) })
+		return c
+	}
+	host, ann := member("host"), member("ann")
+	await(t, ann, "syncState")
+	h.Broadcast(models.Message{Type: "youtube", URL: "dQw4w9WgXcQ"}, host)
+	await(t, ann, "youtube")
+
+	e.call("chat", lua.LString("room"), lua.LString("ann"), lua.LString("!skip"))
+	if msg := await(t, ann, "seek"); msg.Timestamp != 95 {
+		t.Fatalf("script seeked to %v", msg.Timestamp)
+	}
+	if msg := await(t, member("bob"), "syncState"); msg.URL != "dQw4w9WgXcQ" || msg.Timestamp != 95 {
+		t.Fatalf("joiner synced to %q at %v, want 95s in", msg.URL, msg.Timestamp)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"coopcinema/eventlog"
+	"coopcinema/simulate"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runSimulation replays an event log under a grid of sync parameters and
+// prints the predicted drift distribution for each combination.
+func runSimulation(path, thresholds, intervals string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	events, err := eventlog.Read(f)
+	if err != nil {
+		return err
+	}
+
+	var ts []float64
+	for _, s := range strings.Split(thresholds, ",") {
+		t, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("invalid threshold %q", s)
+		}
+		ts = append(ts, t)
+	}
+	var ivs []time.Duration
+	for _, s := range strings.Split(intervals, ",") {
+		iv, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("invalid interval %q", s)
+		}
+		ivs = append(ivs, iv)
+	}
+
+	fmt.Printf("Simulating %d events from %s\n\n", len(events), path)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "THRESHOLD\tINTERVAL\tSAMPLES\tCORRECTIONS\tP50\tP90\tP99\tMAX")
+	for _, r := range simulate.Grid(events, ts, ivs) {
+		fmt.Fprintf(tw, "%.2fs\t%s\t%d\t%d\t%.3f\t%.3f\t%.3f\t%.3f\n",
+			r.Params.Threshold, r.Params.Interval, r.Samples, r.Corrections, r.P50, r.P90, r.P99, r.Max)
+	}
+	return tw.Flush()
+}
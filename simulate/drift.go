@@ -0,0 +1,127 @@
+package simulate
+
+import (
+	"coopcinema/eventlog"
+	"math"
+	"sort"
+	"time"
+)
+
+// Params are the sync knobs under evaluation.
+type Params struct {
+	Threshold float64       `json:"threshold"` // seconds of drift before a client seeks
+	Interval  time.Duration `json:"interval"`  // minimum time between corrections per client
+}
+
+// Report summarises the simulated drift for one parameter set.
+type Report struct {
+	Params      Params  `json:"params"`
+	Samples     int     `json:"samples"`
+	Corrections int     `json:"corrections"`
+	P50         float64 `json:"p50"`
+	P90         float64 `json:"p90"`
+	P99         float64 `json:"p99"`
+	Max         float64 `json:"max"`
+}
+
+type reference struct {
+	userID  string
+	pos     float64
+	at      time.Time
+	playing bool
+}
+
+type follower struct {
+	offset        float64
+	lastCorrected time.Time
+}
+
+// Run replays recorded events under the given parameters.
+//
+// The last play/pause/seek in a room is the reference timeline. Every
+// position report from another client yields its raw drift against that
+// reference. Each simulated client carries a correction offset: when the
+// drift since its last correction exceeds Threshold and Interval has passed,
+// it seeks (drift drops to zero); otherwise the residual drift is recorded.
+func Run(events []eventlog.Event, p Params) Report {
+	sorted := append([]eventlog.Event(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].At.Before(sorted[j].At) })
+
+	refs := make(map[string]*reference)
+	followers := make(map[string]*follower)
+	report := Report{Params: p}
+	var drifts []float64
+
+	for _, e := range sorted {
+		switch e.Type {
+		case "play", "pause", "seek":
+			refs[e.RoomCode] = &reference{
+				userID:  e.UserID,
+				pos:     e.Timestamp,
+				at:      e.At,
+				playing: e.Type == "play" || (e.Type == "seek" && refPlaying(refs[e.RoomCode])),
+			}
+
+		case "state":
+			ref := refs[e.RoomCode]
+			if ref == nil || ref.userID == e.UserID {
+				continue
+			}
+
+			expected := ref.pos
+			if ref.playing {
+				expected += e.At.Sub(ref.at).Seconds()
+			}
+			raw := e.Timestamp - expected
+
+			key := e.RoomCode + "/" + e.UserID
+			f := followers[key]
+			if f == nil {
+				f = &follower{}
+				followers[key] = f
+			}
+
+			d := raw - f.offset
+			if math.Abs(d) > p.Threshold && e.At.Sub(f.lastCorrected) >= p.Interval {
+				f.offset = raw
+				f.lastCorrected = e.At
+				report.Corrections++
+				d = 0
+			}
+			drifts = append(drifts, math.Abs(d))
+		}
+	}
+
+	report.Samples = len(drifts)
+	if len(drifts) > 0 {
+		sort.Float64s(drifts)
+		report.P50 = percentile(drifts, 0.50)
+		report.P90 = percentile(drifts, 0.90)
+		report.P99 = percentile(drifts, 0.99)
+		report.Max = drifts[len(drifts)-1]
+	}
+	return report
+}
+
+// Grid runs every combination of thresholds and intervals.
+func Grid(events []eventlog.Event, thresholds []float64, intervals []time.Duration) []Report {
+	var reports []Report
+	for _, t := range thresholds {
+		for _, iv := range intervals {
+			reports = append(reports, Run(events, Params{Threshold: t, Interval: iv}))
+		}
+	}
+	return reports
+}
+
+func refPlaying(r *reference) bool {
+	return r != nil && r.playing
+}
+
+func percentile(sorted []float64, q float64) float64 {
+	idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
@@ -0,0 +1,119 @@
+// Package subtitles reads SRT and WebVTT files and writes them back out as
+// plain WebVTT, so every player gets the same simple format.
+package subtitles
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrNoCues = errors.New("subtitles: no timed cues found")
+
+// timestamp matches SRT's 00:01:02,500 and WebVTT's 01:02.500 or
+// 00:01:02.500.
+var timestamp = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{1,2})[,.](\d{1,3})$`)
+
+// Cue is one subtitle, shown from Start to End seconds into the media.
+type Cue struct {
+	Start float64
+	End   float64
+	Text  string
+}
+
+// Parse reads an SRT or WebVTT file and returns its cues sorted by start
+// time. Cue numbers, cue settings and WebVTT NOTE, STYLE and REGION blocks
+// are dropped.
+func Parse(r io.Reader) ([]Cue, error) {
+	var cues []Cue
+	var block []string
+	flush := func() {
+		if cue, ok := parseBlock(block); ok {
+			cues = append(cues, cue)
+		}
+		block = block[:0]
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(cues) == 0 && len(block) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	if len(cues) == 0 {
+		return nil, ErrNoCues
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Start < cues[j].Start })
+	return cues, nil
+}
+
+// parseBlock reads one blank-line separated block. Only blocks with a
+// timing line are cues; the text is what follows it.
+func parseBlock(block []string) (Cue, bool) {
+	for i, line := range block {
+		from, rest, ok := strings.Cut(line, "-->")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return Cue{}, false
+		}
+		start, ok1 := seconds(strings.TrimSpace(from))
+		end, ok2 := seconds(fields[0])
+		if !ok1 || !ok2 || end < start {
+			return Cue{}, false
+		}
+		text := strings.TrimSpace(strings.Join(block[i+1:], "\n"))
+		if text == "" {
+			return Cue{}, false
+		}
+		return Cue{Start: start, End: end, Text: text}, true
+	}
+	return Cue{}, false
+}
+
+func seconds(s string) (float64, bool) {
+	m := timestamp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.Atoi(m[3])
+	ms, _ := strconv.Atoi((m[4] + "00")[:3])
+	return float64(h*3600+min*60+sec) + float64(ms)/1000, true
+}
+
+// WriteVTT writes cues as a WebVTT file.
+func WriteVTT(w io.Writer, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n")
+	for _, c := range cues {
+		// A blank line would end the cue early
+		text := strings.ReplaceAll(c.Text, "\n\n", "\n")
+		fmt.Fprintf(bw, "\n%s --> %s\n%s\n", vttTime(c.Start), vttTime(c.End), text)
+	}
+	return bw.Flush()
+}
+
+func vttTime(s float64) string {
+	ms := int(s*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,236 @@
+// Package tenant maps custom hostnames to communities sharing one instance.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Tenant is a community with its own hostnames and room namespace.
+type Tenant struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Hostnames []string          `json:"hostnames"`
+	Retention map[string]string `json:"retention,omitempty"` // data class -> duration
+	Feeds     []Feed            `json:"feeds,omitempty"`
+}
+
+// Feed posts new RSS, Atom or ICS entries into one of a tenant's rooms.
+type Feed struct {
+	URL   string `json:"url"`
+	Room  string `json:"room"`
+	Every string `json:"every,omitempty"` // poll interval, a Go duration
+}
+
+// Saver keeps tenants across restarts. It saves them one at a time, so
+// admins changing different tenants at once don't undo each other.
+type Saver interface {
+	LoadTenants() ([]Tenant, error)
+	SaveTenant(t Tenant) error
+	DeleteTenant(id string) error
+}
+
+var (
+	ErrInvalid   = errors.New("a tenant needs an ID of letters, digits, - and _ and at least one hostname")
+	ErrHostTaken = errors.New("hostname belongs to another tenant")
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Store holds the tenants, indexed by hostname, in front of the Saver that
+// keeps them.
+type Store struct {
+	mu     sync.RWMutex
+	saver  Saver // nil keeps tenants in memory only
+	byID   map[string]*Tenant
+	byHost map[string]*Tenant
+}
+
+// Open loads the tenants saver keeps. Without a saver the store starts
+// empty and forgets its tenants at restart.
+func Open(saver Saver) (*Store, error) {
+	s := &Store{saver: saver, byID: make(map[string]*Tenant), byHost: make(map[string]*Tenant)}
+	if saver == nil {
+		return s, nil
+	}
+	tenants, err := saver.LoadTenants()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tenants {
+		s.add(&tenants[i])
+	}
+	return s, nil
+}
+
+// Import puts every tenant in a JSON file into the store, replacing those
+// with the same ID, and returns how many there were. A missing file imports
+// nothing.
+func (s *Store) Import(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return 0, err
+	}
+	for _, t := range tenants {
+		if err := s.Put(t); err != nil {
+			return 0, fmt.Errorf("tenant %s: %w", t.ID, err)
+		}
+	}
+	return len(tenants), nil
+}
+
+// Put adds a tenant or replaces the one with its ID.
+func (s *Store) Put(t Tenant) error {
+	if !validID.MatchString(t.ID) || len(t.Hostnames) == 0 {
+		return ErrInvalid
+	}
+	t.Hostnames = append([]string(nil), t.Hostnames...)
+	for i, host := range t.Hostnames {
+		if host == "" {
+			return ErrInvalid
+		}
+		t.Hostnames[i] = strings.ToLower(host)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, host := range t.Hostnames {
+		if other, ok := s.byHost[host]; ok && other.ID != t.ID {
+			return ErrHostTaken
+		}
+	}
+	if s.saver != nil {
+		if err := s.saver.SaveTenant(t); err != nil {
+			return err
+		}
+	}
+	s.remove(t.ID)
+	s.add(&t)
+	return nil
+}
+
+// Delete removes a tenant and reports whether there was one.
+func (s *Store) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[id]; !ok {
+		return false, nil
+	}
+	if s.saver != nil {
+		if err := s.saver.DeleteTenant(id); err != nil {
+			return false, err
+		}
+	}
+	s.remove(id)
+	return true, nil
+}
+
+// add indexes t. Callers hold s.mu, or own s.
+func (s *Store) add(t *Tenant) {
+	s.byID[t.ID] = t
+	for _, host := range t.Hostnames {
+		s.byHost[strings.ToLower(host)] = t
+	}
+}
+
+// remove drops a tenant from the indexes. Callers hold s.mu.
+func (s *Store) remove(id string) {
+	t, ok := s.byID[id]
+	if !ok {
+		return
+	}
+	delete(s.byID, id)
+	for _, host := range t.Hostnames {
+		delete(s.byHost, strings.ToLower(host))
+	}
+}
+
+// All returns every tenant, sorted by ID.
+func (s *Store) All() []Tenant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Tenant, 0, len(s.byID))
+	for _, t := range s.byID {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// ForHost returns the tenant serving a Host header value.
+func (s *Store) ForHost(host string) (*Tenant, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.byHost[strings.ToLower(host)]
+	return t, ok
+}
+
+// HostPolicy allows certificate issuance only for registered hostnames. It
+// matches the signature of autocert.HostPolicy.
+func (s *Store) HostPolicy(_ context.Context, host string) error {
+	if _, ok := s.ForHost(host); !ok {
+		return errors.New("tenant: unknown host " + host)
+	}
+	return nil
+}
+
+type ctxKey struct{}
+
+// Middleware resolves the request's tenant from its Host header. Requests
+// for hosts without a tenant are served as the default instance.
+func Middleware(s *Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := s.ForHost(r.Host); ok {
+			r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, t))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// FromContext returns the tenant resolved by Middleware, if any.
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(ctxKey{}).(*Tenant)
+	return t, ok
+}
+
+// Scope namespaces a room code by the request's tenant so communities
+// cannot collide with or join each other's rooms.
+func Scope(r *http.Request, roomCode string) string {
+	if t, ok := FromContext(r.Context()); ok && roomCode != "" {
+		return Code(t.ID, roomCode)
+	}
+	return roomCode
+}
+
+// Code namespaces a room code by tenant ID.
+func Code(tenantID, roomCode string) string {
+	return tenantID + ":" + roomCode
+}
+
+// Split separates a scoped room code into its tenant ID ("" for the
+// default instance) and the code users see.
+func Split(scoped string) (tenantID, roomCode string) {
+	if id, code, ok := strings.Cut(scoped, ":"); ok {
+		return id, code
+	}
+	return "", scoped
+}
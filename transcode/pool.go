@@ -0,0 +1,293 @@
+// Package transcode turns uploaded videos into HLS by running ffmpeg, a
+// fixed number at a time, so a burst of uploads queues up instead of
+// taking every CPU the server has.
+package transcode
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxWaiting is how many jobs may queue for a worker before Submit refuses
+// more.
+const maxWaiting = 32
+
+// jobRetention is how long a finished job can still be looked up.
+const jobRetention = 10 * time.Minute
+
+var ErrBusy = errors.New("transcode: too many videos waiting")
+
+const (
+	Queued  = "queued"
+	Running = "running"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// Job is one video being turned into HLS.
+type Job struct {
+	ID       string  `json:"id"`
+	Room     string  `json:"-"`
+	Name     string  `json:"name,omitempty"`
+	Source   string  `json:"source"`   // URL of the uploaded file
+	Playlist string  `json:"playlist"` // URL of the HLS playlist once done
+	Status   string  `json:"status"`
+	Progress float64 `json:"progress"` // 0 to 1
+	Error    string  `json:"error,omitempty"`
+
+	input  string
+	outDir string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Pool runs ffmpeg jobs on a fixed number of workers. OnProgress and OnDone
+// get a copy of the job as it advances and once it has finished or failed.
+type Pool struct {
+	ffmpeg     string
+	queue      chan *Job
+	ctx        context.Context
+	stop       context.CancelFunc
+	workers    sync.WaitGroup
+	onProgress func(Job)
+	onDone     func(Job)
+
+	mu   sync.Mutex
+	jobs map[string]*Job // by room + "/" + ID
+}
+
+func NewPool(ffmpeg string, workers int, onProgress, onDone func(Job)) *Pool {
+	ctx, stop := context.WithCancel(context.Background())
+	p := &Pool{
+		ffmpeg:     ffmpeg,
+		queue:      make(chan *Job, maxWaiting),
+		ctx:        ctx,
+		stop:       stop,
+		onProgress: onProgress,
+		onDone:     onDone,
+		jobs:       make(map[string]*Job),
+	}
+	for range max(workers, 1) {
+		p.workers.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues input to be written as HLS to outDir/index.m3u8. job
+// describes it; its status fields are filled in here.
+func (p *Pool) Submit(job Job, input, outDir string) error {
+	ctx, cancel := context.WithCancel(p.ctx)
+	j := &job
+	j.Status, j.Progress, j.Error = Queued, 0, ""
+	j.input, j.outDir, j.ctx, j.cancel = input, outDir, ctx, cancel
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case p.queue <- j:
+	default:
+		cancel()
+		return ErrBusy
+	}
+	p.jobs[j.Room+"/"+j.ID] = j
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		delete(p.jobs, j.Room+"/"+j.ID)
+		p.mu.Unlock()
+	}()
+	return nil
+}
+
+// Job reports on a queued or running job, or one that finished within the
+// last jobRetention.
+func (p *Pool) Job(room, id string) (Job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	j, ok := p.jobs[room+"/"+id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// CancelRoom stops a room's jobs, killing ffmpeg if it is running.
+func (p *Pool) CancelRoom(room string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, j := range p.jobs {
+		if j.Room == room {
+			j.cancel()
+		}
+	}
+}
+
+// Stop cancels every job and waits for the workers to exit.
+func (p *Pool) Stop() {
+	p.stop()
+	p.workers.Wait()
+}
+
+func (p *Pool) work() {
+	defer p.workers.Done()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case j := <-p.queue:
+			p.run(j)
+		}
+	}
+}
+
+func (p *Pool) run(j *Job) {
+	p.update(j, func() { j.Status = Running })
+	err := p.transcode(j)
+
+	p.update(j, func() {
+		if err != nil {
+			j.Status, j.Error = Failed, err.Error()
+			return
+		}
+		j.Status, j.Progress = Done, 1
+	})
+	p.mu.Lock()
+	done := *j
+	p.mu.Unlock()
+	if err != nil {
+		os.RemoveAll(j.outDir)
+	}
+	if p.onDone != nil {
+		p.onDone(done)
+	}
+	time.AfterFunc(jobRetention, j.cancel)
+}
+
+// update changes j under the pool's lock.
+func (p *Pool) update(j *Job, change func()) {
+	p.mu.Lock()
+	change()
+	p.mu.Unlock()
+}
+
+// durationLine is how ffmpeg reports the input's length on stderr.
+var durationLine = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+
+func (p *Pool) transcode(j *Job) error {
+	ctx := j.ctx
+	if ctx.Err() != nil {
+		return errors.New("canceled")
+	}
+	if err := os.MkdirAll(j.outDir, 0o755); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, p.ffmpeg,
+		"-hide_banner", "-nostdin", "-nostats", "-progress", "pipe:1",
+		"-i", j.input,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		"-c:a", "aac", "-b:a", "160k",
+		"-f", "hls", "-hls_time", "6", "-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(j.outDir, "seg%05d.ts"),
+		filepath.Join(j.outDir, "index.m3u8"),
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// stderr gives the input's length, and its last line says why ffmpeg
+	// failed if it does
+	var duration float64
+	var lastErr string
+	durationKnown := make(chan struct{})
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		known := false
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if m := durationLine.FindStringSubmatch(line); m != nil && !known {
+				h, _ := strconv.Atoi(m[1])
+				min, _ := strconv.Atoi(m[2])
+				sec, _ := strconv.ParseFloat(m[3], 64)
+				duration = float64(h*3600+min*60) + sec
+				known = true
+				close(durationKnown)
+			}
+			if line != "" {
+				lastErr = line
+			}
+		}
+		if !known {
+			close(durationKnown)
+		}
+	}()
+	p.readProgress(j, stdout, durationKnown, &duration)
+	<-stderrDone
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return errors.New("canceled")
+		}
+		if lastErr != "" {
+			return fmt.Errorf("ffmpeg: %s", lastErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// readProgress follows ffmpeg's -progress output, reporting each whole 5%
+// of the input written.
+func (p *Pool) readProgress(j *Job, r io.Reader, durationKnown <-chan struct{}, duration *float64) {
+	reported := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		// Despite the name, out_time_ms is in microseconds
+		if key != "out_time_ms" {
+			continue
+		}
+		us, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		<-durationKnown
+		if *duration <= 0 {
+			continue
+		}
+		progress := min(us/1e6 / *duration, 0.99)
+		if step := int(progress * 20); step > reported {
+			reported = step
+			p.update(j, func() { j.Progress = float64(step) / 20 })
+			if p.onProgress != nil {
+				p.mu.Lock()
+				update := *j
+				p.mu.Unlock()
+				p.onProgress(update)
+			}
+		}
+	}
+}
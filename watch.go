@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"coopcinema/client"
+	"coopcinema/mpv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A state report only moves mpv when it is this far from the room.
+const watchDrift = time.Second
+
+// pauseObserver is the id mpv's pause property is observed under.
+const pauseObserver = 1
+
+// watcher keeps a local mpv in step with a room: what the room plays,
+// pauses, seeks and loads is applied to mpv, and what is done in mpv is sent
+// to the room. Changes it makes itself are told apart from the user's so
+// they aren't echoed back.
+type watcher struct {
+	c      *client.Client
+	player *mpv.Player
+	base   *url.URL // the server's HTTP base, for media it serves itself
+
+	mu       sync.Mutex
+	media    string    // what mpv was told to load
+	loaded   bool      // whether that has finished loading
+	position float64   // the room's position at when
+	when     time.Time // when position was right
+	playing  bool      // whether the room is playing
+	paused   bool      // the pause state last given to mpv
+	ownSeeks int       // seeks issued that mpv hasn't reported yet
+	seeking  bool      // the user seeked and mpv hasn't restarted playback
+}
+
+// runWatch joins room on server as name and drives mpv, launching mpvPath
+// or, given socket, attaching to an mpv already listening there. It runs
+// until mpv is quit, the room closes or the process is interrupted.
+func runWatch(server, room, name, mpvPath, socket string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	base, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+	base.Scheme = strings.Replace(base.Scheme, "ws", "http", 1)
+	base.Path, base.RawQuery = "", ""
+
+	var player *mpv.Player
+	if socket != "" {
+		player, err = mpv.Dial(socket)
+	} else {
+		socket = filepath.Join(os.TempDir(), fmt.Sprintf("coopcinema-mpv-%d.sock", os.Getpid()))
+		player, err = mpv.Start(ctx, mpvPath, socket)
+		defer os.Remove(socket)
+	}
+	if err != nil {
+		return fmt.Errorf("mpv: %w", err)
+	}
+	defer player.Close()
+	if err := player.Observe(pauseObserver, "pause"); err != nil {
+		return err
+	}
+
+	w := &watcher{
+		c:      client.New(client.Options{URL: server, Room: room, Name: name}),
+		player: player,
+		base:   base,
+		paused: true,
+	}
+	w.c.OnConnect(func() { log.Printf("watch: joined %s", w.c.Room()) })
+	w.c.OnDisconnect(func(err error) { log.Printf("watch: disconnected: %v", err) })
+	w.c.OnMedia(w.load)
+	w.c.OnPlayback(w.follow)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case ev := <-player.Events():
+				w.event(ev)
+			case <-player.Done():
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err = w.c.Run(ctx)
+	select {
+	case <-player.Done():
+		return nil
+	default:
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// load opens what the room loaded, unless mpv already has it.
+func (w *watcher) load(m client.Media) {
+	if m.Slot != "" {
+		return
+	}
+	path := w.mediaPath(m)
+	w.mu.Lock()
+	if path == "" || path == w.media {
+		w.mu.Unlock()
+		return
+	}
+	w.media, w.loaded = path, false
+	w.mu.Unlock()
+
+	log.Printf("watch: loading %s", path)
+	if err := w.player.Load(path); err != nil {
+		log.Printf("watch: %v", err)
+	}
+}
+
+// mediaPath is what mpv should open for m, "" if it can't play it.
+func (w *watcher) mediaPath(m client.Media) string {
+	switch m.Type {
+	case "youtube":
+		return "https://www.youtube.com/watch?v=" + url.QueryEscape(m.URL)
+	case "vimeo":
+		return "https://vimeo.com/" + url.PathEscape(m.URL)
+	case "dailymotion":
+		return "https://www.dailymotion.com/video/" + url.PathEscape(m.URL)
+	case "twitch":
+		var info struct{ Type, ID string }
+		if json.Unmarshal([]byte(m.URL), &info) != nil || info.ID == "" {
+			return ""
+		}
+		if info.Type == "video" {
+			return "https://www.twitch.tv/videos/" + url.PathEscape(info.ID)
+		}
+		return "https://www.twitch.tv/" + url.PathEscape(info.ID)
+	case "directurl", "url":
+		ref, err := url.Parse(m.URL)
+		if err != nil {
+			return ""
+		}
+		return w.base.ResolveReference(ref).String()
+	case "file":
+		// Every member opens their own copy, looked for in the working
+		// directory
+		return m.URL
+	}
+	return ""
+}
+
+// follow records where the room is and moves mpv there.
+func (w *watcher) follow(p client.Playback) {
+	if p.Slot != "" {
+		return
+	}
+	w.mu.Lock()
+	w.position, w.when, w.playing = p.Position, time.Now(), p.Playing
+	// A relayed position was right when the server relayed it; catch up by
+	// the time since, if the clocks look close enough to tell
+	if since := time.Since(p.ServerAt); p.Playing && !p.ServerAt.IsZero() && since > 0 && since < 5*time.Second {
+		w.when = p.ServerAt
+	}
+	loaded := w.loaded
+	w.mu.Unlock()
+
+	if loaded {
+		w.apply(p.Type != "seek")
+	}
+}
+
+// apply moves mpv to the room's position and pause state. With lenient
+// set, mpv is only seeked when it is watchDrift or more away.
+func (w *watcher) apply(lenient bool) {
+	w.mu.Lock()
+	target := w.position
+	if w.playing {
+		target += time.Since(w.when).Seconds()
+	}
+	paused := !w.playing
+	w.mu.Unlock()
+
+	seek := true
+	if lenient {
+		if pos, err := w.player.Position(); err == nil && math.Abs(pos-target) < watchDrift.Seconds() {
+			seek = false
+		}
+	}
+	if seek {
+		w.mu.Lock()
+		w.ownSeeks++
+		w.mu.Unlock()
+		if err := w.player.Seek(target); err != nil {
+			w.mu.Lock()
+			w.ownSeeks--
+			w.mu.Unlock()
+		}
+	}
+
+	w.mu.Lock()
+	changed := w.paused != paused
+	w.paused = paused
+	w.mu.Unlock()
+	if changed {
+		w.player.SetPaused(paused)
+	}
+}
+
+// event handles what mpv reports: the user pausing, resuming or seeking
+// goes to the room, and a newly loaded file is brought to the room's
+// position.
+func (w *watcher) event(ev mpv.Event) {
+	switch ev.Name {
+	case "file-loaded":
+		w.mu.Lock()
+		w.loaded = true
+		w.mu.Unlock()
+		w.apply(false)
+
+	case "property-change":
+		if ev.ID != pauseObserver {
+			return
+		}
+		var paused bool
+		if json.Unmarshal(ev.Data, &paused) != nil {
+			return
+		}
+		w.mu.Lock()
+		own := paused == w.paused || !w.loaded
+		w.paused = paused
+		w.mu.Unlock()
+		if own {
+			return
+		}
+		pos, err := w.player.Position()
+		if err != nil {
+			return
+		}
+		w.record(pos, !paused)
+		if paused {
+			w.c.Pause(pos)
+		} else {
+			w.c.Play(pos)
+		}
+
+	case "seek":
+		w.mu.Lock()
+		if w.ownSeeks > 0 {
+			w.ownSeeks--
+		} else if w.loaded {
+			w.seeking = true
+		}
+		w.mu.Unlock()
+
+	case "playback-restart":
+		w.mu.Lock()
+		seeking := w.seeking
+		w.seeking = false
+		w.mu.Unlock()
+		if !seeking {
+			return
+		}
+		if pos, err := w.player.Position(); err == nil {
+			w.record(pos, !w.isPaused())
+			w.c.Seek(pos)
+		}
+	}
+}
+
+// record notes a change the user made in mpv as where the room now is.
+func (w *watcher) record(position float64, playing bool) {
+	w.mu.Lock()
+	w.position, w.when, w.playing = position, time.Now(), playing
+	w.mu.Unlock()
+}
+
+func (w *watcher) isPaused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paused
+}
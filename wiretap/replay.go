@@ -0,0 +1,126 @@
+package wiretap
+
+import (
+	"coopcinema/hub"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// relayed are the message types a replay's stand-in for the other members
+// sends: what moves the recorded client's player.
+var relayed = map[string]bool{
+	"play": true, "pause": true, "seek": true, "state": true,
+	"youtube": true, "vimeo": true, "twitch": true, "dailymotion": true, "directurl": true,
+}
+
+// envelope is the part of a recorded message a replay looks at.
+type envelope struct {
+	Type   string `json:"type"`
+	UserID string `json:"userID"`
+}
+
+// Replay plays a recording back against the server at wsURL, e.g.
+// ws://127.0.0.1:8080/ws, in a fresh hidden room. One connection stands in
+// for the recorded client and sends what it sent; a second sends the
+// playback and media messages the other members sent it. Both keep the
+// recorded pace, divided by speed. Every frame sent, and every frame the
+// stand-in receives, is written to out with its offset.
+func Replay(wsURL string, frames []Frame, speed float64, out io.Writer) error {
+	if len(frames) == 0 || frames[0].Dir != Open {
+		return errors.New("not a wiretap recording")
+	}
+	var session Session
+	if err := json.Unmarshal(frames[0].Data, &session); err != nil {
+		return fmt.Errorf("recording header: %w", err)
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+
+	room := hub.HiddenRoomPrefix + "replay-" + randomID()
+	subject, err := dial(wsURL, room, "replay-"+session.UserID)
+	if err != nil {
+		return err
+	}
+	defer subject.Close()
+	peer, err := dial(wsURL, room, "replay-peer")
+	if err != nil {
+		return err
+	}
+	defer peer.Close()
+
+	start := time.Now()
+	var mu sync.Mutex
+	logf := func(who string, data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(out, "%9.3fs %-4s %s\n", time.Since(start).Seconds(), who, data)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, data, err := subject.ReadMessage()
+			if err != nil {
+				return
+			}
+			logf("got", data)
+		}
+	}()
+
+	began := frames[0].At
+	for _, f := range frames[1:] {
+		conn, who := subject, "sent"
+		if f.Dir == Out {
+			var env envelope
+			if json.Unmarshal(f.Data, &env) != nil || !relayed[env.Type] || env.UserID == session.UserID {
+				continue
+			}
+			conn, who = peer, "peer"
+		} else if f.Dir != In {
+			continue
+		}
+
+		time.Sleep(time.Until(start.Add(time.Duration(float64(f.At.Sub(began)) / speed))))
+		if err := conn.WriteMessage(websocket.TextMessage, f.Data); err != nil {
+			return err
+		}
+		logf(who, f.Data)
+	}
+
+	// Let the last relayed messages arrive
+	time.Sleep(2 * time.Second)
+	subject.Close()
+	<-done
+	return nil
+}
+
+func dial(wsURL, room, name string) (*websocket.Conn, error) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("room", room)
+	q.Set("name", name)
+	u.RawQuery = q.Encode()
+
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	return conn, err
+}
+
+func randomID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
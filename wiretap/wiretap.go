@@ -0,0 +1,155 @@
+// Package wiretap records one client's WebSocket frames in both directions
+// so reports like "my player jumps around" can be replayed offline against a
+// local server. Recording needs the client's consent or an admin arming it.
+package wiretap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frame directions. The first frame of a recording is an Open frame naming
+// the room and client.
+const (
+	Open = "open"
+	In   = "in"  // client to server
+	Out  = "out" // server to client
+)
+
+// A recording stops growing past this size.
+const maxBytes = 16 << 20
+
+// Frame is one recorded WebSocket message.
+type Frame struct {
+	At   time.Time       `json:"at"`
+	Dir  string          `json:"dir"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Session names the connection a recording is of.
+type Session struct {
+	RoomCode string `json:"room"`
+	UserID   string `json:"userID"`
+}
+
+// Recorder appends one connection's frames to a JSON Lines file. A nil
+// Recorder records nothing, so connections that aren't tapped can use it
+// unconditionally.
+type Recorder struct {
+	path    string
+	mu      sync.Mutex
+	f       *os.File
+	enc     *json.Encoder
+	written int64
+}
+
+// Start opens a new recording in dir for a client's connection.
+func Start(dir, roomCode, userID string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%s-%d.jsonl", safe(roomCode), safe(userID), time.Now().Unix())
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{path: path, f: f, enc: json.NewEncoder(f)}
+	session, _ := json.Marshal(Session{RoomCode: roomCode, UserID: userID})
+	r.Frame(Open, session)
+	return r, nil
+}
+
+// Path is the recording's file.
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Frame records data sent in direction dir.
+func (r *Recorder) Frame(dir string, data []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.written > maxBytes {
+		return
+	}
+	// Malformed frames are kept, as a JSON string
+	raw := json.RawMessage(data)
+	if !json.Valid(data) {
+		raw, _ = json.Marshal(string(data))
+	}
+	r.written += int64(len(raw))
+	r.enc.Encode(Frame{At: time.Now(), Dir: dir, Data: raw})
+}
+
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// Read decodes a recording, skipping bad lines.
+func Read(rd io.Reader) ([]Frame, error) {
+	var frames []Frame
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var f Frame
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			continue
+		}
+		frames = append(frames, f)
+	}
+	return frames, scanner.Err()
+}
+
+// safe keeps a room code or user ID usable as part of a file name.
+func safe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// Arms holds user IDs an admin asked to record. Each arming covers the
+// user's next connection within the window.
+type Arms struct {
+	mu  sync.Mutex
+	ids map[string]time.Time // user ID -> arming expiry
+}
+
+func NewArms() *Arms {
+	return &Arms{ids: make(map[string]time.Time)}
+}
+
+// Arm records userID's next connection if it comes within ttl.
+func (a *Arms) Arm(userID string, ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ids[userID] = time.Now().Add(ttl)
+}
+
+// Take reports whether userID is armed, disarming it.
+func (a *Arms) Take(userID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	until, ok := a.ids[userID]
+	delete(a.ids, userID)
+	return ok && time.Now().Before(until)
+}